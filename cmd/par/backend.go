@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/par1"
+	"github.com/akalin/gopar/par2"
+	"github.com/akalin/gopar/par3"
+)
+
+// backend is how commands access files: either the OS file system,
+// or, in tests, an fsio.RenameFS.
+type backend interface {
+	par1Create(parPath string, filePaths []string, options par1.CreateOptions) error
+	par1Verify(parPath string, options par1.VerifyOptions) (par1.VerifyResult, error)
+	par1Repair(parPath string, options par1.RepairOptions) (par1.RepairResult, error)
+	par2Create(parPath string, filePaths []string, options par2.CreateOptions) error
+	par2CreateFromTar(parPath string, r io.Reader, options par2.CreateOptions) error
+	par2Verify(parPath string, options par2.VerifyOptions) (par2.VerifyResult, error)
+	par2VerifyFromTar(parPath string, r io.Reader, options par2.VerifyOptions) (par2.VerifyResult, error)
+	par2Repair(parPath string, options par2.RepairOptions) (par2.RepairResult, error)
+	par2Add(parPath string, filePaths []string, options par2.AddOptions) (par2.AddResult, error)
+	par3Create(parPath string, filePaths []string, options par3.CreateOptions) error
+	par3Verify(parPath string, options par3.VerifyOptions) (par3.VerifyResult, error)
+	par3Repair(parPath string, options par3.RepairOptions) (par3.RepairResult, error)
+	stat(path string) (fs.FileInfo, error)
+	readDir(path string) ([]fs.DirEntry, error)
+}
+
+type osBackend struct{}
+
+func (osBackend) par1Create(parPath string, filePaths []string, options par1.CreateOptions) error {
+	return par1.Create(parPath, filePaths, options)
+}
+
+func (osBackend) par1Verify(parPath string, options par1.VerifyOptions) (par1.VerifyResult, error) {
+	return par1.Verify(parPath, options)
+}
+
+func (osBackend) par1Repair(parPath string, options par1.RepairOptions) (par1.RepairResult, error) {
+	return par1.Repair(parPath, options)
+}
+
+func (osBackend) par2Create(parPath string, filePaths []string, options par2.CreateOptions) error {
+	return par2.Create(parPath, filePaths, options)
+}
+
+func (osBackend) par2CreateFromTar(parPath string, r io.Reader, options par2.CreateOptions) error {
+	return par2.CreateFromTar(parPath, r, options)
+}
+
+func (osBackend) par2Verify(parPath string, options par2.VerifyOptions) (par2.VerifyResult, error) {
+	return par2.Verify(parPath, options)
+}
+
+func (osBackend) par2VerifyFromTar(parPath string, r io.Reader, options par2.VerifyOptions) (par2.VerifyResult, error) {
+	return par2.VerifyFromTar(parPath, r, options)
+}
+
+func (osBackend) par2Repair(parPath string, options par2.RepairOptions) (par2.RepairResult, error) {
+	return par2.Repair(parPath, options)
+}
+
+func (osBackend) par2Add(parPath string, filePaths []string, options par2.AddOptions) (par2.AddResult, error) {
+	return par2.Add(parPath, filePaths, options)
+}
+
+func (osBackend) par3Create(parPath string, filePaths []string, options par3.CreateOptions) error {
+	return par3.Create(parPath, filePaths, options)
+}
+
+func (osBackend) par3Verify(parPath string, options par3.VerifyOptions) (par3.VerifyResult, error) {
+	return par3.Verify(parPath, options)
+}
+
+func (osBackend) par3Repair(parPath string, options par3.RepairOptions) (par3.RepairResult, error) {
+	return par3.Repair(parPath, options)
+}
+
+func (osBackend) stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osBackend) readDir(path string) ([]fs.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+// fsBackend treats paths as relative to the root of fsys, so they
+// can't be absolute. It doesn't support tar streams or adding files.
+type fsBackend struct {
+	fsys fsio.RenameFS
+}
+
+var errUnsupportedByFSBackend = errors.New("not supported for fsio.RenameFS")
+
+func toName(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+func toNames(paths []string) []string {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = toName(p)
+	}
+	return names
+}
+
+func (b fsBackend) par1Create(parPath string, filePaths []string, options par1.CreateOptions) error {
+	return par1.CreateFS(b.fsys, toName(parPath), toNames(filePaths), options)
+}
+
+func (b fsBackend) par1Verify(parPath string, options par1.VerifyOptions) (par1.VerifyResult, error) {
+	return par1.VerifyFS(b.fsys, toName(parPath), options)
+}
+
+func (b fsBackend) par1Repair(parPath string, options par1.RepairOptions) (par1.RepairResult, error) {
+	return par1.RepairFS(b.fsys, toName(parPath), options)
+}
+
+func (b fsBackend) par2Create(parPath string, filePaths []string, options par2.CreateOptions) error {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par2.CreateFS(b.fsys, toName(parPath), toNames(filePaths), options)
+}
+
+func (fsBackend) par2CreateFromTar(parPath string, r io.Reader, options par2.CreateOptions) error {
+	return errUnsupportedByFSBackend
+}
+
+func (b fsBackend) par2Verify(parPath string, options par2.VerifyOptions) (par2.VerifyResult, error) {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par2.VerifyFS(b.fsys, toName(parPath), options)
+}
+
+func (fsBackend) par2VerifyFromTar(parPath string, r io.Reader, options par2.VerifyOptions) (par2.VerifyResult, error) {
+	return par2.VerifyResult{}, errUnsupportedByFSBackend
+}
+
+func (b fsBackend) par2Repair(parPath string, options par2.RepairOptions) (par2.RepairResult, error) {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par2.RepairFS(b.fsys, toName(parPath), options)
+}
+
+func (fsBackend) par2Add(parPath string, filePaths []string, options par2.AddOptions) (par2.AddResult, error) {
+	return par2.AddResult{}, errUnsupportedByFSBackend
+}
+
+func (b fsBackend) par3Create(parPath string, filePaths []string, options par3.CreateOptions) error {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par3.CreateFS(b.fsys, toName(parPath), toNames(filePaths), options)
+}
+
+func (b fsBackend) par3Verify(parPath string, options par3.VerifyOptions) (par3.VerifyResult, error) {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par3.VerifyFS(b.fsys, toName(parPath), options)
+}
+
+func (b fsBackend) par3Repair(parPath string, options par3.RepairOptions) (par3.RepairResult, error) {
+	if options.BasePath != "" {
+		options.BasePath = toName(options.BasePath)
+	}
+	return par3.RepairFS(b.fsys, toName(parPath), options)
+}
+
+func (b fsBackend) stat(path string) (fs.FileInfo, error) {
+	return fs.Stat(b.fsys, toName(path))
+}
+
+func (b fsBackend) readDir(path string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(b.fsys, toName(path))
+}
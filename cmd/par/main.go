@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/signal"
@@ -15,6 +16,7 @@ import (
 	"github.com/akalin/gopar/par1"
 	"github.com/akalin/gopar/par2"
 	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/par3"
 	"github.com/akalin/gopar/rsec16"
 )
 
@@ -98,10 +100,16 @@ type par1LogRepairDelegate struct {
 type par2LogCreateDelegate struct{}
 
 func (par2LogCreateDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {
+	progress := fmt.Sprintf("%d/%d", i, n)
+	if n == 0 {
+		// The file count isn't known in advance when reading
+		// from a tar stream.
+		progress = fmt.Sprintf("%d", i)
+	}
 	if err != nil {
-		fmt.Printf("[%d/%d] Loading data file %q failed: %+v\n", i, n, path, err)
+		fmt.Printf("[%s] Loading data file %q failed: %+v\n", progress, path, err)
 	} else {
-		fmt.Printf("[%d/%d] Loaded data file %q (%d bytes)\n", i, n, path, byteCount)
+		fmt.Printf("[%s] Loaded data file %q (%d bytes)\n", progress, path, byteCount)
 	}
 }
 
@@ -121,6 +129,44 @@ func (par2LogCreateDelegate) OnRecoveryFileWrite(start, count, total int, path s
 	}
 }
 
+type par2LogUpdateDelegate struct{}
+
+func (par2LogUpdateDelegate) OnParityFileLoad(i int, path string, err error) {
+	if err != nil {
+		fmt.Printf("[%d] Loading volume file %q failed: %+v\n", i, path, err)
+	} else {
+		fmt.Printf("[%d] Loaded volume file %q\n", i, path)
+	}
+}
+
+func (par2LogUpdateDelegate) OnParityFileWrite(i int, path string, byteCount int, err error) {
+	if err != nil {
+		fmt.Printf("[%d] Writing volume file %q failed: %+v\n", i, path, err)
+	} else {
+		fmt.Printf("[%d] Wrote volume file %q (%d bytes)\n", i, path, byteCount)
+	}
+}
+
+type par2LogAddDelegate struct {
+	par2LogUpdateDelegate
+}
+
+func (par2LogAddDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {
+	if err != nil {
+		fmt.Printf("[%d/%d] Loading data file %q failed: %+v\n", i, n, path, err)
+	} else {
+		fmt.Printf("[%d/%d] Loaded data file %q (%d bytes)\n", i, n, path, byteCount)
+	}
+}
+
+func (par2LogAddDelegate) OnShiftedDataFileLoad(path string, byteCount int, err error) {
+	if err != nil {
+		fmt.Printf("Re-reading existing data file %q failed: %+v\n", path, err)
+	} else {
+		fmt.Printf("Re-read existing data file %q (%d bytes), since the added files sort before it in the recovery set, which changes its slices' parity coefficients\n", path, byteCount)
+	}
+}
+
 type par2LogDecoderDelegate struct{}
 
 func (par2LogDecoderDelegate) OnCreatorPacketLoad(clientID string) {
@@ -179,6 +225,10 @@ func (par2LogDecoderDelegate) OnDetectDataFileWrongByteCount(fileID [16]byte, pa
 	fmt.Printf("Wrong byte count for %q (ID %x)\n", path, fileID)
 }
 
+func (par2LogDecoderDelegate) OnDetectCorruptParityShard(exponent uint16, path string) {
+	fmt.Printf("Corrupt parity shard: exponent %d in %q\n", exponent, path)
+}
+
 func (par2LogDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount int, err error) {
 	if err != nil {
 		fmt.Printf("[%d/%d] Writing data file %q failed: %+v\n", i, n, path, err)
@@ -195,6 +245,68 @@ type par2LogRepairDelegate struct {
 	par2LogDecoderDelegate
 }
 
+type par3LogDecoderDelegate struct{}
+
+func (par3LogDecoderDelegate) OnCreatorPacketLoad(clientID string) {
+	fmt.Printf("Loaded creator packet with client ID %q\n", clientID)
+}
+
+func (par3LogDecoderDelegate) OnStartPacketLoad(blockByteCount int) {
+	fmt.Printf("Loaded start packet: block byte count=%d\n", blockByteCount)
+}
+
+func (par3LogDecoderDelegate) OnRecoveryPacketLoad(blockIndex, byteCount int) {
+	fmt.Printf("Loaded recovery packet: block index=%d, byte count=%d\n", blockIndex, byteCount)
+}
+
+func (par3LogDecoderDelegate) OnUnknownPacketLoad(packetType [8]byte, byteCount int) {
+	fmt.Printf("Loaded unknown packet of type %q and byte count %d\n", packetType, byteCount)
+}
+
+func (par3LogDecoderDelegate) OnOtherPacketSkip(setID [8]byte, packetType [8]byte, byteCount int) {
+	fmt.Printf("Skipped packet with input set ID %x of type %q and byte count %d\n", setID, packetType, byteCount)
+}
+
+func (par3LogDecoderDelegate) OnCorruptPacketSkip(offset int, packetType [8]byte, err error) {
+	fmt.Printf("Skipped corrupt packet of type %q at offset %d: %+v\n", packetType, offset, err)
+}
+
+func (par3LogDecoderDelegate) OnDataFileLoad(i, n int, path string, byteCount, hits, misses int, err error) {
+	if err != nil {
+		fmt.Printf("[%d/%d] Loading data file %q failed: %+v\n", i, n, path, err)
+	} else {
+		fmt.Printf("[%d/%d] Loaded data file %q (%d bytes, %d hits, %d misses)\n", i, n, path, byteCount, hits, misses)
+	}
+}
+
+func (par3LogDecoderDelegate) OnParityFileLoad(i int, path string, err error) {
+	if err != nil {
+		fmt.Printf("[%d] Loading volume file %q failed: %+v\n", i, path, err)
+	} else {
+		fmt.Printf("[%d] Loaded volume file %q\n", i, path)
+	}
+}
+
+func (par3LogDecoderDelegate) OnDetectCorruptDataChunk(path string, startByteOffset, endByteOffset int) {
+	fmt.Printf("Corrupt data chunk: %q, bytes %d to %d\n", path, startByteOffset, endByteOffset-1)
+}
+
+func (par3LogDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount int, err error) {
+	if err != nil {
+		fmt.Printf("[%d/%d] Writing data file %q failed: %+v\n", i, n, path, err)
+	} else {
+		fmt.Printf("[%d/%d] Wrote data file %q (%d bytes)\n", i, n, path, byteCount)
+	}
+}
+
+type par3LogVerifyDelegate struct {
+	par3LogDecoderDelegate
+}
+
+type par3LogRepairDelegate struct {
+	par3LogDecoderDelegate
+}
+
 func newFlagSet(name string) *flag.FlagSet {
 	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
 	flagSet.SetOutput(ioutil.Discard)
@@ -205,6 +317,9 @@ type globalFlags struct {
 	usage         bool
 	cpuProfile    string
 	numGoroutines int
+	memoryLimitMB int
+	useMmap       bool
+	par2CmdLine   bool
 }
 
 func getGlobalFlags(name string) (*flag.FlagSet, *globalFlags) {
@@ -214,7 +329,10 @@ func getGlobalFlags(name string) (*flag.FlagSet, *globalFlags) {
 	flagSet.BoolVar(&flags.usage, "h", false, "print usage info")
 	flagSet.StringVar(&flags.cpuProfile, "cpuprofile", "", "if non-empty, where to write the CPU profile")
 	// TODO: Detect hyperthreading and use only number of physical cores.
-	flagSet.IntVar(&flags.numGoroutines, "g", rsec16.DefaultNumGoroutines(), "number of goroutines to use for encoding/decoding PAR2")
+	flagSet.IntVar(&flags.numGoroutines, "g", rsec16.DefaultNumGoroutines(), "number of goroutines to use for encoding/decoding")
+	flagSet.IntVar(&flags.memoryLimitMB, "m", 0, "roughly how much memory in MB to use for parity data, or 0 for no limit (PAR2 only)")
+	flagSet.BoolVar(&flags.useMmap, "mmap", false, "memory-map files instead of reading them into memory, if possible (PAR2 only)")
+	flagSet.BoolVar(&flags.par2CmdLine, "par2cmdline", false, "parse the rest of the command line like par2cmdline does, which is also done if the program is named par2, par2create, par2verify, or par2repair")
 
 	return flagSet, &flags
 }
@@ -222,34 +340,43 @@ func getGlobalFlags(name string) (*flag.FlagSet, *globalFlags) {
 type createFlags struct {
 	sliceByteCount  int
 	numParityShards int
+	tar             bool
+	recordFileInfo  bool
 }
 
 func getCreateFlags(name string) (*flag.FlagSet, *createFlags) {
 	flagSet := newFlagSet(name + " create")
 
 	var flags createFlags
-	flagSet.IntVar(&flags.sliceByteCount, "s", par2.SliceByteCountDefault, "block size in bytes (must be a multiple of 4) (PAR2 only)")
+	flagSet.IntVar(&flags.sliceByteCount, "s", par2.SliceByteCountDefault, "block size in bytes (must be a multiple of 4) (PAR2 and PAR3 only)")
 	// par1.NumParityFilesDefault == par2.NumParityShardsDefault
 	flagSet.IntVar(&flags.numParityShards, "c", par2.NumParityShardsDefault, "number of recovery blocks to create (or files, for PAR1)")
+	flagSet.BoolVar(&flags.tar, "tar", false, "read the data files from a tar stream on stdin instead (PAR2 only)")
+	flagSet.BoolVar(&flags.recordFileInfo, "i", false, "whether or not to record the permissions and modification time of the data files, so that repair can restore them for missing files (PAR2 only)")
 
 	return flagSet, &flags
 }
 
 type verifyFlags struct {
 	verifyAllData bool
+	tar           bool
+	purge         bool
 }
 
 func getVerifyFlags(name string) (*flag.FlagSet, *verifyFlags) {
 	flagSet := newFlagSet(name + " verify")
 
 	var flags verifyFlags
-	// TODO: Implement this for PAR2 too.
-	flagSet.BoolVar(&flags.verifyAllData, "a", false, "whether or not to do extra checking even if no missing or corrupt files are detected (PAR1 only)")
+	flagSet.BoolVar(&flags.verifyAllData, "a", false, "whether or not to do extra checking even if no missing or corrupt files are detected")
+	flagSet.BoolVar(&flags.tar, "tar", false, "read the data files from a tar stream on stdin instead (PAR2 only)")
+	flagSet.BoolVar(&flags.purge, "p", false, "whether or not to remove the PAR files if no repair is needed")
 	return flagSet, &flags
 }
 
 type repairFlags struct {
 	doubleCheck bool
+	keepBackups bool
+	purge       bool
 }
 
 func getRepairFlags(name string) (*flag.FlagSet, *repairFlags) {
@@ -257,6 +384,8 @@ func getRepairFlags(name string) (*flag.FlagSet, *repairFlags) {
 
 	var flags repairFlags
 	flagSet.BoolVar(&flags.doubleCheck, "doublecheck", false, "whether or not to do extra checking after any repairs")
+	flagSet.BoolVar(&flags.keepBackups, "k", false, "whether or not to keep damaged files as <file>.1 (or .2, etc.) instead of overwriting them")
+	flagSet.BoolVar(&flags.purge, "p", false, "whether or not to remove the PAR files, and any backups made, after a successful repair or if no repair is needed")
 
 	return flagSet, &flags
 }
@@ -267,10 +396,11 @@ const (
 	createCommand commandMask = 1 << iota
 	verifyCommand
 	repairCommand
-	allCommands = createCommand | verifyCommand | repairCommand
+	addCommand
+	allCommands = createCommand | verifyCommand | repairCommand | addCommand
 )
 
-func printUsageAndExit(name string, mask commandMask, err error) {
+func printUsage(name string, mask commandMask, err error) int {
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 	}
@@ -279,16 +409,26 @@ func printUsageAndExit(name string, mask commandMask, err error) {
 
 	if mask&createCommand != 0 {
 		fmt.Printf("  %s [global options] c(reate) [create options] <PAR file> <data files...>\n", name)
+		fmt.Printf("  %s [global options] c(reate) [create options] -tar <PAR2 file> < <tar stream>\n", name)
 	}
 
 	if mask&verifyCommand != 0 {
 		fmt.Printf("  %s [global options] v(erify) [verify options] <PAR file>\n", name)
+		fmt.Printf("  %s [global options] v(erify) [verify options] -tar <PAR2 file> < <tar stream>\n", name)
 	}
 
 	if mask&repairCommand != 0 {
 		fmt.Printf("  %s [global options] f(epair) [repair options] <PAR file>\n", name)
 	}
 
+	if mask&addCommand != 0 {
+		fmt.Printf("  %s [global options] a(dd) <PAR2 file> <data files...>\n", name)
+	}
+
+	if mask == allCommands {
+		fmt.Printf("  %s [global options] -par2cmdline <par2cmdline arguments...>\n", name)
+	}
+
 	fmt.Printf("\nGlobal options\n")
 	globalFlagSet, _ := getGlobalFlags(name)
 	globalFlagSet.SetOutput(os.Stdout)
@@ -317,24 +457,35 @@ func printUsageAndExit(name string, mask commandMask, err error) {
 
 	fmt.Printf("\n")
 	if err != nil {
-		os.Exit(par2cmdline.ExitInvalidCommandLineArguments)
+		return par2cmdline.ExitInvalidCommandLineArguments
 	}
-	os.Exit(par2cmdline.ExitSuccess)
+	return par2cmdline.ExitSuccess
 }
 
-func printCreateErrorAndExit(err error, exitCode int) {
+// warnPar3Unverified prints a warning that PAR3 support hasn't been
+// checked against other PAR3 clients.
+func warnPar3Unverified() {
+	fmt.Fprintf(os.Stderr, "Warning: PAR3 support is experimental and hasn't been verified against other PAR3 clients, so the files may not be compatible with them.\n")
+}
+
+func printCreateError(err error, exitCode int) int {
 	fmt.Printf("Create error: %s\n", err)
-	os.Exit(exitCode)
+	return exitCode
 }
 
-func printVerifyErrorAndExit(err error, exitCode int) {
+func printVerifyError(err error, exitCode int) int {
 	fmt.Printf("Verify error: %s\n", err)
-	os.Exit(exitCode)
+	return exitCode
 }
 
-func printRepairErrorAndExit(err error, exitCode int) {
+func printRepairError(err error, exitCode int) int {
 	fmt.Printf("Repair error: %s\n", err)
-	os.Exit(exitCode)
+	return exitCode
+}
+
+func printAddError(err error, exitCode int) int {
+	fmt.Printf("Add error: %s\n", err)
+	return exitCode
 }
 
 type repairChecker interface {
@@ -342,44 +493,98 @@ type repairChecker interface {
 	RepairPossible() bool
 }
 
-func processRepairChecker(repairChecker repairChecker) int {
+func processRepairChecker(w io.Writer, repairChecker repairChecker) int {
 	if repairChecker.RepairNeeded() {
 		if repairChecker.RepairPossible() {
-			fmt.Printf("Repair necessary and possible.\n")
+			fmt.Fprintf(w, "Repair necessary and possible.\n")
 			return par2cmdline.ExitRepairPossible
 		}
-		fmt.Printf("Repair necessary but not possible.\n")
+		fmt.Fprintf(w, "Repair necessary but not possible.\n")
 		return par2cmdline.ExitRepairNotPossible
 	}
 	return par2cmdline.ExitSuccess
 }
 
-func processRepairResultAndExit(
-	repairedPaths []string,
-	repairErrorMeansRepairNecessaryButNotPossible func(error) bool,
-	err error) {
-	fmt.Printf("Repaired files: %v\n", repairedPaths)
+// processVerifyAllDataResult is like processRepairChecker, except
+// that if allDataChecked is true and allDataOk is false, i.e. no data
+// is missing or corrupt but some parity data doesn't match it, it
+// returns ExitRepairPossible instead of success, so that scripts
+// notice the corrupt parity data.
+func processVerifyAllDataResult(w io.Writer, repairChecker repairChecker, allDataChecked, allDataOk bool) int {
+	exitCode := processRepairChecker(w, repairChecker)
+	if exitCode == par2cmdline.ExitSuccess && allDataChecked && !allDataOk {
+		fmt.Fprintf(w, "Parity data doesn't match the data files.\n")
+		return par2cmdline.ExitRepairPossible
+	}
+	return exitCode
+}
+
+// processPar2VerifyResult is like processVerifyAllDataResult, except
+// that it also returns ExitRepairPossible if no data is missing or
+// corrupt but some data file still doesn't match its recorded hash,
+// e.g. a missing file whose slices are all found in other files.
+func processPar2VerifyResult(w io.Writer, result par2.VerifyResult, verifyAllData bool) int {
+	allDataChecked := verifyAllData && result.ShardCounts.UsableParityShardCount > 0
+	exitCode := processVerifyAllDataResult(w, result.ShardCounts, allDataChecked, result.AllDataOk)
+	if exitCode == par2cmdline.ExitSuccess && !result.DataFilesOk {
+		fmt.Fprintf(w, "Repair necessary and possible.\n")
+		return par2cmdline.ExitRepairPossible
+	}
+	return exitCode
+}
+
+func printPurgedPaths(w io.Writer, purgedPaths []string) {
+	if len(purgedPaths) > 0 {
+		fmt.Fprintf(w, "Purged files: %v\n", purgedPaths)
+	}
+}
+
+func processRepairResult(
+	w io.Writer,
+	repairedPaths, backupPaths, purgedPaths []string,
+	exitCodeForRepairError func(error) int,
+	err error) int {
+	fmt.Fprintf(w, "Repaired files: %v\n", repairedPaths)
+	if len(backupPaths) > 0 {
+		fmt.Fprintf(w, "Backed up damaged files to: %v\n", backupPaths)
+	}
+	printPurgedPaths(w, purgedPaths)
 	// Match exit codes to par2cmdline.
-	if repairErrorMeansRepairNecessaryButNotPossible(err) {
-		fmt.Printf("Repair necessary but not possible.\n")
-		os.Exit(par2cmdline.ExitRepairNotPossible)
+	exitCode := exitCodeForRepairError(err)
+	if exitCode == par2cmdline.ExitRepairNotPossible {
+		fmt.Fprintf(w, "Repair necessary but not possible.\n")
+		return exitCode
 	}
 	if err != nil {
-		printRepairErrorAndExit(err, par2cmdline.ExitLogicError)
+		fmt.Fprintf(w, "Repair error: %s\n", err)
+		return exitCode
 	}
-	os.Exit(par2cmdline.ExitSuccess)
+	return par2cmdline.ExitSuccess
 }
 
 func main() {
-	name := filepath.Base(os.Args[0])
+	os.Exit(run(filepath.Base(os.Args[0]), os.Args[1:], osBackend{}))
+}
+
+// run runs the command line with the given program name and
+// arguments, and returns the exit code.
+func run(name string, args []string, b backend) int {
+	if operation, ok := par2CmdLineOperationForName(name); ok {
+		_, globalFlags := getGlobalFlags(name)
+		return runPar2CmdLine(b, *globalFlags, append(operation, args...))
+	}
 
 	globalFlagSet, globalFlags := getGlobalFlags(name)
-	err := globalFlagSet.Parse(os.Args[1:])
+	err := globalFlagSet.Parse(args)
 	if err == nil && globalFlagSet.NArg() == 0 {
 		err = errors.New("no command specified")
 	}
 	if err != nil || globalFlags.usage {
-		printUsageAndExit(name, allCommands, err)
+		return printUsage(name, allCommands, err)
+	}
+
+	if globalFlags.par2CmdLine {
+		return runPar2CmdLine(b, *globalFlags, globalFlagSet.Args())
 	}
 
 	if globalFlags.cpuProfile != "" {
@@ -411,7 +616,7 @@ func main() {
 	}
 
 	cmd := globalFlagSet.Arg(0)
-	args := globalFlagSet.Args()[1:]
+	args = globalFlagSet.Args()[1:]
 
 	switch strings.ToLower(cmd) {
 	case "c":
@@ -422,43 +627,80 @@ func main() {
 		if err == nil {
 			if createFlagSet.NArg() == 0 {
 				err = errors.New("no PAR file specified")
-			} else if createFlagSet.NArg() == 1 {
+			} else if createFlags.tar && createFlagSet.NArg() > 1 {
+				err = errors.New("data files can't be specified with -tar")
+			} else if !createFlags.tar && createFlagSet.NArg() == 1 {
 				err = errors.New("no data files specified")
 			}
 		}
 		if err != nil {
-			printUsageAndExit(name, createCommand, err)
+			return printUsage(name, createCommand, err)
 		}
 
 		allFiles := createFlagSet.Args()
 		parFile, filePaths := allFiles[0], allFiles[1:]
 
+		if createFlags.tar {
+			if ext := path.Ext(parFile); ext != ".par2" {
+				return printCreateError(fmt.Errorf("unsupported extension %s for -tar", ext), par2cmdline.ExitLogicError)
+			}
+			err := b.par2CreateFromTar(parFile, os.Stdin, par2.CreateOptions{
+				SliceByteCount:  createFlags.sliceByteCount,
+				NumParityShards: createFlags.numParityShards,
+				NumGoroutines:   globalFlags.numGoroutines,
+				MemoryLimit:     globalFlags.memoryLimitMB << 20,
+				CreateDelegate:  par2LogCreateDelegate{},
+				RecordFileInfo:  createFlags.recordFileInfo,
+			})
+			if err != nil {
+				return printCreateError(err, par2.ExitCodeForCreateErrorPar2CmdLine(err))
+			}
+			return par2cmdline.ExitSuccess
+		}
+
 		switch ext := path.Ext(parFile); ext {
 		case ".par":
-			err := par1.Create(parFile, filePaths, par1.CreateOptions{
-
+			err := b.par1Create(parFile, filePaths, par1.CreateOptions{
 				NumParityFiles: createFlags.numParityShards,
+				NumGoroutines:  globalFlags.numGoroutines,
 				CreateDelegate: par1LogCreateDelegate{},
 			})
 			if err != nil {
-				printCreateErrorAndExit(err, par2cmdline.ExitLogicError)
+				return printCreateError(err, par1.ExitCodeForCreateErrorPar2CmdLine(err))
 			}
-			os.Exit(par2cmdline.ExitSuccess)
+			return par2cmdline.ExitSuccess
 
 		case ".par2":
-			err := par2.Create(parFile, filePaths, par2.CreateOptions{
+			err := b.par2Create(parFile, filePaths, par2.CreateOptions{
 				SliceByteCount:  createFlags.sliceByteCount,
 				NumParityShards: createFlags.numParityShards,
 				NumGoroutines:   globalFlags.numGoroutines,
+				MemoryLimit:     globalFlags.memoryLimitMB << 20,
+				CreateDelegate:  par2LogCreateDelegate{},
+				UseMmap:         globalFlags.useMmap,
+				RecordFileInfo:  createFlags.recordFileInfo,
+			})
+			if err != nil {
+				return printCreateError(err, par2.ExitCodeForCreateErrorPar2CmdLine(err))
+			}
+			return par2cmdline.ExitSuccess
+
+		case ".par3":
+			warnPar3Unverified()
+			// The PAR2 create delegate logs the same events.
+			err := b.par3Create(parFile, filePaths, par3.CreateOptions{
+				BlockByteCount:  createFlags.sliceByteCount,
+				NumParityShards: createFlags.numParityShards,
+				NumGoroutines:   globalFlags.numGoroutines,
 				CreateDelegate:  par2LogCreateDelegate{},
 			})
 			if err != nil {
-				printCreateErrorAndExit(err, par2.ExitCodeForCreateErrorPar2CmdLine(err))
+				return printCreateError(err, par3.ExitCodeForCreateErrorPar2CmdLine(err))
 			}
-			os.Exit(par2cmdline.ExitSuccess)
+			return par2cmdline.ExitSuccess
 
 		default:
-			printCreateErrorAndExit(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
+			return printCreateError(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
 		}
 
 	case "v":
@@ -470,36 +712,74 @@ func main() {
 			err = errors.New("no PAR file specified")
 		}
 		if err != nil {
-			printUsageAndExit(name, verifyCommand, err)
+			return printUsage(name, verifyCommand, err)
 		}
 
 		parFile := verifyFlagSet.Arg(0)
 
+		if verifyFlags.tar {
+			if ext := path.Ext(parFile); ext != ".par2" {
+				return printVerifyError(fmt.Errorf("unsupported extension %s for -tar", ext), par2cmdline.ExitLogicError)
+			}
+			result, err := b.par2VerifyFromTar(parFile, os.Stdin, par2.VerifyOptions{
+				NumGoroutines:  globalFlags.numGoroutines,
+				MemoryLimit:    globalFlags.memoryLimitMB << 20,
+				VerifyAllData:  verifyFlags.verifyAllData,
+				VerifyDelegate: par2LogVerifyDelegate{},
+				Purge:          verifyFlags.purge,
+			})
+			if err != nil {
+				return printVerifyError(err, par2.ExitCodeForVerifyErrorPar2CmdLine(err))
+			}
+			printPurgedPaths(os.Stdout, result.PurgedPaths)
+			return processPar2VerifyResult(os.Stdout, result, verifyFlags.verifyAllData)
+		}
+
 		switch ext := path.Ext(parFile); ext {
 		case ".par":
-			result, err := par1.Verify(parFile, par1.VerifyOptions{
+			result, err := b.par1Verify(parFile, par1.VerifyOptions{
+				NumGoroutines:  globalFlags.numGoroutines,
 				VerifyAllData:  verifyFlags.verifyAllData,
 				VerifyDelegate: par1LogVerifyDelegate{},
+				Purge:          verifyFlags.purge,
 			})
 			if err != nil {
-				printVerifyErrorAndExit(err, par2cmdline.ExitLogicError)
+				return printVerifyError(err, par1.ExitCodeForVerifyErrorPar2CmdLine(err))
 			}
-			exitCode := processRepairChecker(result.FileCounts)
-			os.Exit(exitCode)
+			printPurgedPaths(os.Stdout, result.PurgedPaths)
+			allDataChecked := verifyFlags.verifyAllData && result.FileCounts.AllFilesUsable()
+			return processVerifyAllDataResult(os.Stdout, result.FileCounts, allDataChecked, result.AllDataOk)
 
 		case ".par2":
-			result, err := par2.Verify(parFile, par2.VerifyOptions{
+			result, err := b.par2Verify(parFile, par2.VerifyOptions{
 				NumGoroutines:  globalFlags.numGoroutines,
+				MemoryLimit:    globalFlags.memoryLimitMB << 20,
+				VerifyAllData:  verifyFlags.verifyAllData,
 				VerifyDelegate: par2LogVerifyDelegate{},
+				UseMmap:        globalFlags.useMmap,
+				Purge:          verifyFlags.purge,
+			})
+			if err != nil {
+				return printVerifyError(err, par2.ExitCodeForVerifyErrorPar2CmdLine(err))
+			}
+			printPurgedPaths(os.Stdout, result.PurgedPaths)
+			return processPar2VerifyResult(os.Stdout, result, verifyFlags.verifyAllData)
+
+		case ".par3":
+			warnPar3Unverified()
+			result, err := b.par3Verify(parFile, par3.VerifyOptions{
+				NumGoroutines:  globalFlags.numGoroutines,
+				VerifyDelegate: par3LogVerifyDelegate{},
+				Purge:          verifyFlags.purge,
 			})
 			if err != nil {
-				printVerifyErrorAndExit(err, par2cmdline.ExitLogicError)
+				return printVerifyError(err, par3.ExitCodeForVerifyErrorPar2CmdLine(err))
 			}
-			exitCode := processRepairChecker(result.ShardCounts)
-			os.Exit(exitCode)
+			printPurgedPaths(os.Stdout, result.PurgedPaths)
+			return processRepairChecker(os.Stdout, result.ShardCounts)
 
 		default:
-			printVerifyErrorAndExit(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
+			return printVerifyError(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
 		}
 
 	case "r":
@@ -511,36 +791,86 @@ func main() {
 			err = errors.New("no PAR file specified")
 		}
 		if err != nil {
-			printUsageAndExit(name, repairCommand, err)
+			return printUsage(name, repairCommand, err)
 		}
 
 		parFile := repairFlagSet.Arg(0)
 
 		switch ext := path.Ext(parFile); ext {
 		case ".par":
-			result, err := par1.Repair(parFile, par1.RepairOptions{
+			result, err := b.par1Repair(parFile, par1.RepairOptions{
 				DoubleCheck:    repairFlags.doubleCheck,
+				NumGoroutines:  globalFlags.numGoroutines,
 				RepairDelegate: par1LogRepairDelegate{},
+				KeepBackups:    repairFlags.keepBackups,
+				Purge:          repairFlags.purge,
 			})
-			if err != nil {
-				printRepairErrorAndExit(err, par2cmdline.ExitLogicError)
-			}
-			processRepairResultAndExit(result.RepairedPaths, par1.RepairErrorMeansRepairNecessaryButNotPossible, err)
+			return processRepairResult(os.Stdout, result.RepairedPaths, result.BackupPaths, result.PurgedPaths, par1.ExitCodeForRepairErrorPar2CmdLine, err)
 
 		case ".par2":
-			result, err := par2.Repair(parFile, par2.RepairOptions{
+			result, err := b.par2Repair(parFile, par2.RepairOptions{
 				DoubleCheck:    repairFlags.doubleCheck,
 				NumGoroutines:  globalFlags.numGoroutines,
+				MemoryLimit:    globalFlags.memoryLimitMB << 20,
 				RepairDelegate: par2LogRepairDelegate{},
+				UseMmap:        globalFlags.useMmap,
+				KeepBackups:    repairFlags.keepBackups,
+				Purge:          repairFlags.purge,
 			})
-			processRepairResultAndExit(result.RepairedPaths, par2.RepairErrorMeansRepairNecessaryButNotPossible, err)
+			return processRepairResult(os.Stdout, result.RepairedPaths, result.BackupPaths, result.PurgedPaths, par2.ExitCodeForRepairErrorPar2CmdLine, err)
+
+		case ".par3":
+			warnPar3Unverified()
+			result, err := b.par3Repair(parFile, par3.RepairOptions{
+				NumGoroutines:  globalFlags.numGoroutines,
+				RepairDelegate: par3LogRepairDelegate{},
+				KeepBackups:    repairFlags.keepBackups,
+				Purge:          repairFlags.purge,
+			})
+			return processRepairResult(os.Stdout, result.RepairedPaths, result.BackupPaths, result.PurgedPaths, par3.ExitCodeForRepairErrorPar2CmdLine, err)
 
 		default:
-			printRepairErrorAndExit(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
+			return printRepairError(fmt.Errorf("unknown extension %s", ext), par2cmdline.ExitLogicError)
 		}
 
-	default:
-		err := fmt.Errorf("unknown command '%s'", cmd)
-		printUsageAndExit(name, allCommands, err)
+	case "a":
+		fallthrough
+	case "add":
+		addFlagSet := newFlagSet(name + " add")
+		err := addFlagSet.Parse(args)
+		if err == nil {
+			if addFlagSet.NArg() == 0 {
+				err = errors.New("no PAR file specified")
+			} else if addFlagSet.NArg() == 1 {
+				err = errors.New("no data files specified")
+			}
+		}
+		if err != nil {
+			return printUsage(name, addCommand, err)
+		}
+
+		allFiles := addFlagSet.Args()
+		parFile, filePaths := allFiles[0], allFiles[1:]
+
+		switch ext := path.Ext(parFile); ext {
+		case ".par2":
+			result, err := b.par2Add(parFile, filePaths, par2.AddOptions{
+				NumGoroutines: globalFlags.numGoroutines,
+				AddDelegate:   par2LogAddDelegate{},
+			})
+			if err != nil {
+				return printAddError(err, par2.ExitCodeForCreateErrorPar2CmdLine(err))
+			}
+			if len(result.ShiftedPaths) > 0 {
+				fmt.Printf("Re-read %d existing data files; all others were left untouched.\n", len(result.ShiftedPaths))
+			}
+			return par2cmdline.ExitSuccess
+
+		default:
+			return printAddError(fmt.Errorf("unsupported extension %s", ext), par2cmdline.ExitLogicError)
+		}
 	}
+
+	err = fmt.Errorf("unknown command '%s'", cmd)
+	return printUsage(name, allCommands, err)
 }
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestMemFS() memfs.MemFS {
+	data := func(n int, seed byte) []byte {
+		bs := make([]byte, n)
+		for i := range bs {
+			bs[i] = byte(i) ^ seed
+		}
+		return bs
+	}
+	return memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"a.bin":                              data(1000, 0x1),
+		filepath.Join("dir", "b.bin"):        data(500, 0x2),
+		filepath.Join("dir", "sub", "c.bin"): data(30, 0x3),
+	})
+}
+
+func memFSContents(t *testing.T, fs memfs.MemFS) map[string][]byte {
+	contents := make(map[string][]byte)
+	for _, path := range fs.Paths() {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		relPath, err := filepath.Rel(memfs.RootDir(), path)
+		require.NoError(t, err)
+		contents[filepath.ToSlash(relPath)] = data
+	}
+	return contents
+}
+
+func memFSNames(t *testing.T, fs memfs.MemFS) []string {
+	var names []string
+	for name := range memFSContents(t, fs) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runForTest(t *testing.T, fs memfs.MemFS, name, args string) int {
+	t.Helper()
+	t.Logf("%s %s", name, args)
+	return run(name, strings.Fields(args), fsBackend{fs})
+}
+
+func TestPar2CmdLineCompatibility(t *testing.T) {
+	dataNames := []string{"a.bin", "dir/b.bin", "dir/sub/c.bin"}
+	createAndCorrupt := func(t *testing.T, fs memfs.MemFS) {
+		require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "c -s 100 -c 5 file.par2 a.bin dir/b.bin"))
+		data, err := fs.ReadFile("a.bin")
+		require.NoError(t, err)
+		data[0]++
+	}
+
+	for _, test := range []struct {
+		name  string
+		setup func(*testing.T, memfs.MemFS)
+		// If native is empty, the results of the par2cmdline
+		// command line are checked against expectedNames
+		// instead.
+		native, par2CmdLine string
+		expectedExitCode    int
+		expectedNames       []string
+	}{
+		{
+			name:             "create",
+			native:           "c -s 100 -c 5 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "c -s100 -c5 file.par2 a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "create with separate values",
+			native:           "c -s 100 -c 5 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "create -s 100 -c 5 file a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			// 10 + 5 blocks, and 20% of 15 is 3.
+			name:             "create with redundancy",
+			native:           "c -s 100 -c 3 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "c -s100 -r20 file.par2 a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			// 250 + 125 blocks of 4 bytes is within the
+			// default of 2000 blocks, and 5% of 375 rounds
+			// to 19.
+			name:             "create with defaults",
+			native:           "c -s 4 -c 19 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "c file.par2 a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "create with block count",
+			native:           "c -s 200 -c 3 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "c -b8 -c3 file.par2 a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "create with archive name and --",
+			native:           "c -s 100 -c 3 file.par2 a.bin dir/b.bin",
+			par2CmdLine:      "c -q -afile -s100 -c3 -t2 -m16 -- a.bin dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "create recursively",
+			native:           "c -s 100 -c 3 file.par2 a.bin dir/b.bin dir/sub/c.bin",
+			par2CmdLine:      "c -s100 -c3 -R file.par2 a.bin dir",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "create index only",
+			par2CmdLine:      "c -s100 -r0 file.par2 a.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    append([]string{"file.par2"}, dataNames...),
+		},
+		{
+			name:             "create with directory but no -R",
+			par2CmdLine:      "c -s100 -c3 file.par2 a.bin dir",
+			expectedExitCode: par2cmdline.ExitFileIOError,
+			expectedNames:    dataNames,
+		},
+		{
+			name:             "create uniform",
+			par2CmdLine:      "c -s100 -c5 -n2 -u file.par2 a.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    append([]string{"file.par2", "file.vol00+03.par2", "file.vol03+02.par2"}, dataNames...),
+		},
+		{
+			// dir/b.bin has 5 blocks.
+			name:             "create limited",
+			par2CmdLine:      "c -s100 -c12 -l file.par2 dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    append([]string{"file.par2", "file.vol00+01.par2", "file.vol01+02.par2", "file.vol03+04.par2", "file.vol07+05.par2"}, dataNames...),
+		},
+		{
+			name:             "create with base path",
+			par2CmdLine:      "c -s100 -c1 -B dir dir/sub/file.par2 dir/b.bin",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    []string{"a.bin", "dir/b.bin", "dir/sub/c.bin", "dir/sub/file.par2", "dir/sub/file.vol00+01.par2"},
+		},
+		{
+			name:             "create with invalid block size",
+			native:           "c -s 6 file.par2 a.bin",
+			par2CmdLine:      "c -s6 file.par2 a.bin",
+			expectedExitCode: par2cmdline.ExitInvalidCommandLineArguments,
+		},
+		{
+			name:             "create with too many recovery files",
+			par2CmdLine:      "c -s100 -c2 -n3 file.par2 a.bin",
+			expectedExitCode: par2cmdline.ExitInvalidCommandLineArguments,
+			expectedNames:    dataNames,
+		},
+		{
+			name:             "verify",
+			setup:            createAndCorrupt,
+			native:           "v file.par2",
+			par2CmdLine:      "v -N -S100 file.par2 a.bin",
+			expectedExitCode: par2cmdline.ExitRepairPossible,
+		},
+		{
+			name:             "silent verify",
+			setup:            createAndCorrupt,
+			native:           "v file.par2",
+			par2CmdLine:      "v -qq file.par2",
+			expectedExitCode: par2cmdline.ExitRepairPossible,
+		},
+		{
+			name:             "repair",
+			setup:            createAndCorrupt,
+			native:           "r -k file.par2",
+			par2CmdLine:      "r file.par2",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "repair and purge",
+			setup:            createAndCorrupt,
+			native:           "r -k -p file.par2",
+			par2CmdLine:      "r -p file.par2",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name:             "repair and purge files",
+			setup:            createAndCorrupt,
+			par2CmdLine:      "r -p file.par2",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    dataNames,
+		},
+		{
+			name:             "verify and purge",
+			setup:            createAndCorrupt,
+			native:           "v -p file.par2",
+			par2CmdLine:      "v -p file.par2",
+			expectedExitCode: par2cmdline.ExitRepairPossible,
+		},
+		{
+			name: "repair PAR1 with backup",
+			setup: func(t *testing.T, fs memfs.MemFS) {
+				require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "c -c 2 file.par a.bin"))
+				_, err := fs.RemoveFile("file.p01")
+				require.NoError(t, err)
+				data, err := fs.ReadFile("a.bin")
+				require.NoError(t, err)
+				data[0]++
+			},
+			native:           "r -k file.par",
+			par2CmdLine:      "r file.par",
+			expectedExitCode: par2cmdline.ExitSuccess,
+		},
+		{
+			name: "verify PAR1 and purge",
+			setup: func(t *testing.T, fs memfs.MemFS) {
+				require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "c -c 2 file.par a.bin"))
+			},
+			par2CmdLine:      "v -p file.par",
+			expectedExitCode: par2cmdline.ExitSuccess,
+			expectedNames:    dataNames,
+		},
+		{
+			name:             "verify missing file",
+			native:           "v file.par2",
+			par2CmdLine:      "v file.par2",
+			expectedExitCode: par2cmdline.ExitFileIOError,
+		},
+		{
+			name:             "verify with create option",
+			par2CmdLine:      "v -r10 file.par2",
+			expectedExitCode: par2cmdline.ExitInvalidCommandLineArguments,
+			expectedNames:    dataNames,
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			par2CmdLineFS := makeTestMemFS()
+			if test.setup != nil {
+				test.setup(t, par2CmdLineFS)
+			}
+			exitCode := runForTest(t, par2CmdLineFS, "par2", test.par2CmdLine)
+			require.Equal(t, test.expectedExitCode, exitCode)
+
+			if test.native == "" {
+				expectedNames := append([]string(nil), test.expectedNames...)
+				sort.Strings(expectedNames)
+				require.Equal(t, expectedNames, memFSNames(t, par2CmdLineFS))
+				return
+			}
+
+			nativeFS := makeTestMemFS()
+			if test.setup != nil {
+				test.setup(t, nativeFS)
+			}
+			exitCode = runForTest(t, nativeFS, "par", test.native)
+			require.Equal(t, test.expectedExitCode, exitCode)
+			require.Equal(t, memFSContents(t, nativeFS), memFSContents(t, par2CmdLineFS))
+		})
+	}
+}
+
+func TestPar2CmdLineProgramNames(t *testing.T) {
+	for _, name := range []string{"par2create", "PAR2CREATE.EXE"} {
+		fs := makeTestMemFS()
+		require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, name, "-s100 -c1 file.par2 a.bin"))
+		require.Equal(t, []string{"a.bin", "dir/b.bin", "dir/sub/c.bin", "file.par2", "file.vol00+01.par2"}, memFSNames(t, fs))
+		require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par2verify", "file.par2"))
+		require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "-par2cmdline r file.par2"))
+	}
+}
+
+// corruptPAR2RecoveryData changes a byte of the recovery data of the
+// first recovery slice packet in the PAR2 file at path, and fixes up
+// the packet's hash, so that the packet still looks valid.
+func corruptPAR2RecoveryData(t *testing.T, fs memfs.MemFS, path string) {
+	data, err := fs.ReadFile(path)
+	require.NoError(t, err)
+	// A packet header is the magic string, the packet length,
+	// the hash of the rest of the packet, the recovery set ID,
+	// and the packet type, followed by the body, which for a
+	// recovery slice packet starts with a 4-byte exponent.
+	i := bytes.Index(data, []byte("PAR 2.0\x00RecvSlic"))
+	require.True(t, i >= 48, "no recovery slice packet found")
+	start := i - 48
+	length := int(binary.LittleEndian.Uint64(data[start+8:]))
+	data[start+64+4]++
+	hash := md5.Sum(data[start+32 : start+length])
+	copy(data[start+16:], hash[:])
+}
+
+func TestVerifyAllDataCorruptParity(t *testing.T) {
+	fs := makeTestMemFS()
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "c -s 100 -c 3 file.par2 a.bin dir/b.bin"))
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "v -a file.par2"))
+
+	corruptPAR2RecoveryData(t, fs, "file.vol01+02.par2")
+	// Without -a, the corruption isn't noticed.
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "v file.par2"))
+	require.Equal(t, par2cmdline.ExitRepairPossible, runForTest(t, fs, "par", "v -a file.par2"))
+}
+
+func TestPAR3(t *testing.T) {
+	fs := makeTestMemFS()
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "c -s 100 -c 3 file.par3 a.bin dir/b.bin dir/sub/c.bin"))
+	require.Equal(t, []string{"a.bin", "dir/b.bin", "dir/sub/c.bin", "file.par3", "file.vol00+01.par3", "file.vol01+02.par3"}, memFSNames(t, fs))
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "v file.par3"))
+
+	data, err := fs.ReadFile("a.bin")
+	require.NoError(t, err)
+	data[0]++
+	require.Equal(t, par2cmdline.ExitRepairPossible, runForTest(t, fs, "par", "v file.par3"))
+	require.Equal(t, par2cmdline.ExitSuccess, runForTest(t, fs, "par", "r -p file.par3"))
+	require.Equal(t, []string{"a.bin", "dir/b.bin", "dir/sub/c.bin"}, memFSNames(t, fs))
+	require.Equal(t, memFSContents(t, makeTestMemFS()), memFSContents(t, fs))
+}
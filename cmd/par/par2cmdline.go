@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/akalin/gopar/par1"
+	"github.com/akalin/gopar/par2"
+	"github.com/akalin/gopar/par2cmdline"
+)
+
+// par2CmdLineOperationForName returns the arguments to prepend to the
+// command line if name is one of par2cmdline's program names, which
+// means that the command line should be parsed like par2cmdline does.
+func par2CmdLineOperationForName(name string) ([]string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+	switch name {
+	case "par2":
+		return nil, true
+	case "par2create":
+		return []string{"c"}, true
+	case "par2verify":
+		return []string{"v"}, true
+	case "par2repair":
+		return []string{"r"}, true
+	}
+	return nil, false
+}
+
+func printPar2CmdLineUsage(err error) int {
+	fmt.Printf("Error: %s\n", err)
+	fmt.Printf(`
+Usage (par2cmdline compatibility mode):
+  par2 c(reate) [options] <PAR2 file> [files...]
+  par2 c(reate) [options] -a <PAR2 file> [files...]
+  par2 v(erify) [options] <PAR2 or PAR file> [extra files...]
+  par2 r(epair) [options] <PAR2 or PAR file> [extra files...]
+
+Options:
+  -a<file> : Name of the PAR2 file to create
+  -b<n>    : Set the block count to use (don't use both -b and -s)
+  -s<n>    : Set the block size to use (don't use both -b and -s)
+  -r<n>    : Level of redundancy (%%) (don't use both -r and -c)
+  -c<n>    : Recovery block count (don't use both -r and -c)
+  -n<n>    : Number of recovery files (don't use both -n and -l)
+  -u       : Uniform recovery file sizes
+  -l       : Limit size of recovery files (don't use both -u and -l)
+  -R       : Recurse into subdirectories
+  -p       : Purge backup and PAR files on successful verify or repair
+  -N       : Data skipping (accepted, but every byte offset is scanned)
+  -S<n>    : Skip leeway (accepted, but every byte offset is scanned)
+  -m<n>    : Memory (in MB) to use for parity data (PAR2 only)
+  -t<n>    : Number of threads to use
+  -v [-v]  : Be more verbose (accepted, but the output doesn't change)
+  -q [-q]  : Be more quiet (-q -q gives silence)
+  -B<path> : Set the base path to use as reference for the data files
+  --       : Treat all following arguments as files
+`)
+	return par2cmdline.ExitInvalidCommandLineArguments
+}
+
+// runPar2CmdLine runs the par2cmdline command line in args, which
+// starts with the operation. The global flags supply defaults for
+// options that par2cmdline doesn't have.
+func runPar2CmdLine(b backend, globalFlags globalFlags, args []string) int {
+	c, err := par2cmdline.ParseCommandLine(args)
+	if err != nil {
+		return printPar2CmdLineUsage(err)
+	}
+
+	numGoroutines := globalFlags.numGoroutines
+	if c.NumThreads > 0 {
+		numGoroutines = c.NumThreads
+	}
+
+	memoryLimit := globalFlags.memoryLimitMB << 20
+	if c.MemoryMB > 0 {
+		memoryLimit = c.MemoryMB << 20
+	}
+
+	// -N and -S make par2cmdline scan faster at the cost of
+	// missing displaced blocks, but gopar always scans every
+	// byte offset, so they're just ignored.
+	//
+	// Similarly, the delegates always log everything that
+	// par2cmdline logs by default, and they have nothing more
+	// detailed to log, so -v is also ignored; only -q has an
+	// effect.
+
+	var w io.Writer = os.Stdout
+	if c.Verbosity <= -2 {
+		w = ioutil.Discard
+	}
+	quiet := c.Verbosity < 0
+
+	if c.Operation == par2cmdline.Create {
+		return runPar2CmdLineCreate(b, c, w, quiet, numGoroutines, memoryLimit, globalFlags.useMmap)
+	}
+
+	if len(c.Files) > 0 && !quiet {
+		fmt.Fprintf(w, "Ignoring extra files %v, since data files are only looked up by name\n", c.Files)
+	}
+
+	isPar1 := false
+	switch ext := strings.ToLower(path.Ext(c.ParFile)); ext {
+	case ".par2":
+	case ".par":
+		isPar1 = true
+		if c.BasePath != "" {
+			return printPar2CmdLineUsage(fmt.Errorf("-B isn't supported for PAR files"))
+		}
+	default:
+		return printPar2CmdLineUsage(fmt.Errorf("unknown extension %s", ext))
+	}
+
+	switch {
+	case c.Operation == par2cmdline.Verify && isPar1:
+		var delegate par1.VerifyDelegate = par1LogVerifyDelegate{}
+		if quiet {
+			delegate = par1.DoNothingVerifyDelegate{}
+		}
+		result, err := b.par1Verify(c.ParFile, par1.VerifyOptions{
+			NumGoroutines:  numGoroutines,
+			VerifyDelegate: delegate,
+			Purge:          c.Purge,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "Verify error: %s\n", err)
+			return par1.ExitCodeForVerifyErrorPar2CmdLine(err)
+		}
+		printPurgedPaths(w, result.PurgedPaths)
+		return processRepairChecker(w, result.FileCounts)
+
+	case c.Operation == par2cmdline.Verify:
+		var delegate par2.VerifyDelegate = par2LogVerifyDelegate{}
+		if quiet {
+			delegate = par2.DoNothingVerifyDelegate{}
+		}
+		result, err := b.par2Verify(c.ParFile, par2.VerifyOptions{
+			NumGoroutines:  numGoroutines,
+			MemoryLimit:    memoryLimit,
+			VerifyDelegate: delegate,
+			UseMmap:        globalFlags.useMmap,
+			BasePath:       c.BasePath,
+			Purge:          c.Purge,
+		})
+		if err != nil {
+			fmt.Fprintf(w, "Verify error: %s\n", err)
+			return par2.ExitCodeForVerifyErrorPar2CmdLine(err)
+		}
+		printPurgedPaths(w, result.PurgedPaths)
+		return processRepairChecker(w, result.ShardCounts)
+
+	// Like par2cmdline, always keep backups of damaged files
+	// when repairing, which -p then purges.
+	case isPar1:
+		var delegate par1.RepairDelegate = par1LogRepairDelegate{}
+		if quiet {
+			delegate = par1.DoNothingRepairDelegate{}
+		}
+		result, err := b.par1Repair(c.ParFile, par1.RepairOptions{
+			NumGoroutines:  numGoroutines,
+			RepairDelegate: delegate,
+			KeepBackups:    true,
+			Purge:          c.Purge,
+		})
+		return processRepairResult(w, result.RepairedPaths, result.BackupPaths, result.PurgedPaths, par1.ExitCodeForRepairErrorPar2CmdLine, err)
+
+	default:
+		var delegate par2.RepairDelegate = par2LogRepairDelegate{}
+		if quiet {
+			delegate = par2.DoNothingRepairDelegate{}
+		}
+		result, err := b.par2Repair(c.ParFile, par2.RepairOptions{
+			NumGoroutines:  numGoroutines,
+			MemoryLimit:    memoryLimit,
+			RepairDelegate: delegate,
+			UseMmap:        globalFlags.useMmap,
+			BasePath:       c.BasePath,
+			KeepBackups:    true,
+			Purge:          c.Purge,
+		})
+		return processRepairResult(w, result.RepairedPaths, result.BackupPaths, result.PurgedPaths, par2.ExitCodeForRepairErrorPar2CmdLine, err)
+	}
+}
+
+func runPar2CmdLineCreate(b backend, c par2cmdline.CommandLine, w io.Writer, quiet bool, numGoroutines, memoryLimit int, useMmap bool) int {
+	var filePaths []string
+	var fileByteCounts []int64
+	for _, filePath := range c.Files {
+		err := collectFiles(b, filePath, c.Recurse, func(filePath string, byteCount int64) {
+			filePaths = append(filePaths, filePath)
+			fileByteCounts = append(fileByteCounts, byteCount)
+		})
+		if err != nil {
+			fmt.Fprintf(w, "Create error: %s\n", err)
+			return par2cmdline.ExitFileIOError
+		}
+	}
+
+	scheme := par2.RecoveryFileSchemeVariable
+	if c.Uniform {
+		scheme = par2.RecoveryFileSchemeUniform
+	} else if c.LimitSize {
+		scheme = par2.RecoveryFileSchemeLimited
+	}
+
+	var delegate par2.CreateDelegate = par2LogCreateDelegate{}
+	if quiet {
+		delegate = par2.DoNothingCreateDelegate{}
+	}
+
+	sliceByteCount := c.SliceByteCount(fileByteCounts)
+	err := b.par2Create(c.ParFile, filePaths, par2.CreateOptions{
+		SliceByteCount:     sliceByteCount,
+		NumParityShards:    c.NumParityShards(fileByteCounts, sliceByteCount),
+		IndexOnly:          c.IndexOnly,
+		NumGoroutines:      numGoroutines,
+		MemoryLimit:        memoryLimit,
+		CreateDelegate:     delegate,
+		UseMmap:            useMmap,
+		RecoveryFileScheme: scheme,
+		NumRecoveryFiles:   c.RecoveryFileCount,
+		BasePath:           c.BasePath,
+	})
+	if err != nil {
+		fmt.Fprintf(w, "Create error: %s\n", err)
+		return par2.ExitCodeForCreateErrorPar2CmdLine(err)
+	}
+	return par2cmdline.ExitSuccess
+}
+
+// collectFiles calls fn for filePath if it's a file, or, if recurse
+// is true, for every file under it if it's a directory.
+func collectFiles(b backend, filePath string, recurse bool, fn func(filePath string, byteCount int64)) error {
+	info, err := b.stat(filePath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		fn(filePath, info.Size())
+		return nil
+	}
+	if !recurse {
+		return fmt.Errorf("%s is a directory; use -R to recurse into it", filePath)
+	}
+
+	entries, err := b.readDir(filePath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := collectFiles(b, filepath.Join(filePath, entry.Name()), recurse, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// +build linux
+
+package fsio
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func ownerAndAccessTime(info fs.FileInfo) (uid, gid int, atime time.Time, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, time.Time{}, false
+	}
+	return int(stat.Uid), int(stat.Gid), time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)), true
+}
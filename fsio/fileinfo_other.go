@@ -0,0 +1,12 @@
+// +build !linux
+
+package fsio
+
+import (
+	"io/fs"
+	"time"
+)
+
+func ownerAndAccessTime(info fs.FileInfo) (uid, gid int, atime time.Time, ok bool) {
+	return 0, 0, time.Time{}, false
+}
@@ -0,0 +1,557 @@
+// Package fsio contains the file system abstraction used by the par1
+// and par2 packages, which lets them work on files that aren't on
+// disk, e.g. inside zip files or tarballs.
+package fsio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteFS is a file system that also supports writing files. A
+// read-only fs.FS is enough for verifying, but creating and repairing
+// need a WriteFS.
+type WriteFS interface {
+	fs.FS
+	// WriteFile writes data to the file with the given name,
+	// creating it if necessary, and replacing its contents
+	// otherwise.
+	WriteFile(name string, data []byte) error
+}
+
+// RemoveFS is a WriteFS that also supports removing files.
+type RemoveFS interface {
+	WriteFS
+	// Remove removes the file with the given name.
+	Remove(name string) error
+}
+
+// RenameFS is a RemoveFS that also supports renaming files.
+type RenameFS interface {
+	RemoveFS
+	// Rename renames the file with the name oldname to newname,
+	// replacing the file with the name newname if it exists.
+	Rename(oldname, newname string) error
+}
+
+// PendingFileFS is a WriteFS that can also write files piecewise,
+// without holding them in memory.
+type PendingFileFS interface {
+	WriteFS
+	// CreatePendingFile returns a PendingFile that replaces the
+	// file with the given name once it's committed.
+	CreatePendingFile(name string) (PendingFile, error)
+}
+
+// FileInfoFS is a file system that also supports changing the
+// metadata of files.
+type FileInfoFS interface {
+	fs.FS
+	// SetFileInfo sets the permissions and modification time
+	// of the file with the given name to those in info, along
+	// with any other metadata the file system supports, like
+	// the SetFileInfo function does.
+	SetFileInfo(name string, info fs.FileInfo) error
+}
+
+// ErrReadOnly is returned when trying to write a file to a file
+// system that isn't a WriteFS.
+var ErrReadOnly = errors.New("file system is read-only")
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// DirFS returns a RenameFS for the tree of files rooted at the
+// directory dir. Like os.DirFS, it doesn't prevent symlinks in dir
+// from pointing outside of it.
+func DirFS(dir string) RenameFS {
+	return dirFS{os.DirFS(dir), dir}
+}
+
+func (fsys dirFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return WriteFileAtomic(filepath.Join(fsys.dir, filepath.FromSlash(name)), data, 0600)
+}
+
+func (fsys dirFS) CreatePendingFile(name string) (PendingFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return CreatePendingFile(filepath.Join(fsys.dir, filepath.FromSlash(name)), 0600)
+}
+
+func (fsys dirFS) Remove(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Remove(filepath.Join(fsys.dir, filepath.FromSlash(name)))
+}
+
+func (fsys dirFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+	if !fs.ValidPath(newname) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrInvalid}
+	}
+	return os.Rename(filepath.Join(fsys.dir, filepath.FromSlash(oldname)), filepath.Join(fsys.dir, filepath.FromSlash(newname)))
+}
+
+func (fsys dirFS) SetFileInfo(name string, info fs.FileInfo) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	return SetFileInfo(filepath.Join(fsys.dir, filepath.FromSlash(name)), info)
+}
+
+// A PendingFile is a file that's written at arbitrary offsets, and
+// that only replaces the file at its path once it's committed, so
+// that large files can be written piecewise without ever leaving a
+// partially written file behind.
+type PendingFile interface {
+	io.WriterAt
+	// Commit makes the written data the contents of the file at
+	// the pending file's path. The PendingFile can't be used
+	// afterwards, even if Commit fails.
+	Commit() error
+	// Discard throws away the written data. It does nothing if
+	// Commit or Discard was already called, so it can be
+	// deferred.
+	Discard() error
+}
+
+type tempPendingFile struct {
+	f    *os.File
+	path string
+	perm fs.FileMode
+	done bool
+}
+
+// CreatePendingFile returns a PendingFile for the file at the given
+// path, which is written to a temporary file in the same directory,
+// and which is synced and then renamed over path when committed, so
+// that a crash never leaves path with partial contents. If path
+// already exists, its permissions are kept; otherwise, the file is
+// created with permissions perm.
+func CreatePendingFile(path string, perm fs.FileMode) (PendingFile, error) {
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir, file := filepath.Split(path)
+	if dir == "" {
+		// Otherwise, ioutil.TempFile uses os.TempDir().
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+file+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &tempPendingFile{f, path, perm, false}, nil
+}
+
+func (p *tempPendingFile) WriteAt(b []byte, off int64) (int, error) {
+	return p.f.WriteAt(b, off)
+}
+
+func (p *tempPendingFile) Commit() error {
+	if p.done {
+		return errors.New("pending file already committed or discarded")
+	}
+	p.done = true
+
+	tempPath := p.f.Name()
+	err := p.f.Sync()
+	closeErr := p.f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, p.perm)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, p.path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+	}
+	return err
+}
+
+func (p *tempPendingFile) Discard() error {
+	if p.done {
+		return nil
+	}
+	p.done = true
+	_ = p.f.Close()
+	return os.Remove(p.f.Name())
+}
+
+type bufferedPendingFile struct {
+	data      []byte
+	writeFile func(data []byte) error
+	done      bool
+}
+
+// NewBufferedPendingFile returns a PendingFile that holds the written
+// data in memory, and passes it to writeFile when committed. It's for
+// file systems that can only write whole files.
+func NewBufferedPendingFile(writeFile func(data []byte) error) PendingFile {
+	return &bufferedPendingFile{writeFile: writeFile}
+}
+
+func (p *bufferedPendingFile) WriteAt(b []byte, off int64) (int, error) {
+	if p.done {
+		return 0, errors.New("pending file already committed or discarded")
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if end := int(off) + len(b); end > len(p.data) {
+		p.data = append(p.data, make([]byte, end-len(p.data))...)
+	}
+	return copy(p.data[off:], b), nil
+}
+
+func (p *bufferedPendingFile) Commit() error {
+	if p.done {
+		return errors.New("pending file already committed or discarded")
+	}
+	p.done = true
+	data := p.data
+	p.data = nil
+	return p.writeFile(data)
+}
+
+func (p *bufferedPendingFile) Discard() error {
+	p.done = true
+	p.data = nil
+	return nil
+}
+
+// WriteFileAtomic writes data to the file at the given path using a
+// PendingFile from CreatePendingFile, so that a crash never leaves
+// path with partial contents. If path already exists, its
+// permissions are kept; otherwise, the file is created with
+// permissions perm.
+func WriteFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	p, err := CreatePendingFile(path, perm)
+	if err != nil {
+		return err
+	}
+	_, err = p.WriteAt(data, 0)
+	if err != nil {
+		_ = p.Discard()
+		return err
+	}
+	return p.Commit()
+}
+
+// RestoredFilePerm is the permissions that a missing file restored
+// by a repair gets when its original permissions aren't known.
+const RestoredFilePerm fs.FileMode = 0644
+
+// SetFileInfo sets the permissions and modification time of the file
+// at the given path to those in info. If info came from a stat on a
+// platform that exposes them (currently only Linux), the owner and
+// access time are also restored, except that failing to change the
+// owner for lack of privileges isn't an error; otherwise, the access
+// time is set to the current time.
+func SetFileInfo(path string, info fs.FileInfo) error {
+	atime := time.Now()
+	if uid, gid, infoAtime, ok := ownerAndAccessTime(info); ok {
+		atime = infoAtime
+		err := os.Chown(path, uid, gid)
+		if err != nil && !errors.Is(err, fs.ErrPermission) {
+			return err
+		}
+	}
+
+	// Chown may clear the setuid and setgid bits, so chmod
+	// afterwards.
+	err := os.Chmod(path, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(path, atime, info.ModTime())
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// NewFileInfo returns an fs.FileInfo for a regular file with the
+// given name, size, permissions and modification time, e.g. to pass
+// to SetFileInfo for a file that has no existing metadata to keep.
+func NewFileInfo(name string, size int64, perm fs.FileMode, modTime time.Time) fs.FileInfo {
+	return fileInfo{name, size, perm.Perm(), modTime}
+}
+
+// Root returns the absolute path that the root of a file system
+// wrapped in a PathFS corresponds to. On Unix-like systems this is
+// just /, but on Windows it may be C:\ or some other drive letter.
+func Root() string {
+	// See the comments in memfs.RootDir.
+	wd, err := os.Getwd()
+	if err != nil {
+		return string(filepath.Separator)
+	}
+	volName := filepath.VolumeName(filepath.Clean(wd))
+	return volName + string(filepath.Separator)
+}
+
+// PathFS wraps an fs.FS so that it can be accessed with absolute,
+// OS-specific paths under Root() instead of slash-separated names,
+// which is what the par1 and par2 packages use internally.
+type PathFS struct {
+	FS fs.FS
+}
+
+// Path returns the path under Root() for the given name in p.FS.
+func (p PathFS) Path(name string) string {
+	return filepath.Join(Root(), filepath.FromSlash(name))
+}
+
+// Name returns the name in p.FS for the given path, which must be
+// absolute and lie under Root().
+func (p PathFS) Name(path string) (string, error) {
+	relPath, err := filepath.Rel(Root(), path)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.ToSlash(relPath)
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "open", Path: path, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+// Paths returns the paths under Root() for the given names in p.FS.
+func (p PathFS) Paths(names []string) []string {
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = p.Path(name)
+	}
+	return paths
+}
+
+// ReadFile returns the data of the file at the given path.
+func (p PathFS) ReadFile(path string) ([]byte, error) {
+	name, err := p.Name(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(p.FS, name)
+}
+
+// FindWithPrefixAndSuffix returns the paths of all files in the
+// directory of prefix whose path matches the given prefix and suffix,
+// like filepath.Glob(prefix + "*" + suffix) would.
+func (p PathFS) FindWithPrefixAndSuffix(prefix, suffix string) ([]string, error) {
+	dir, basePrefix := filepath.Split(prefix)
+	dirName, err := p.Name(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(p.FS, dirName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if len(name) >= len(basePrefix)+len(suffix) && strings.HasPrefix(name, basePrefix) && strings.HasSuffix(name, suffix) {
+			matches = append(matches, filepath.Join(dir, name))
+		}
+	}
+	return matches, nil
+}
+
+// WriteFile writes data to the file at the given path, or returns
+// ErrReadOnly if p.FS isn't a WriteFS.
+func (p PathFS) WriteFile(path string, data []byte) error {
+	writeFS, ok := p.FS.(WriteFS)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: path, Err: ErrReadOnly}
+	}
+	name, err := p.Name(path)
+	if err != nil {
+		return err
+	}
+	return writeFS.WriteFile(name, data)
+}
+
+// CreatePendingFile returns a PendingFile for the file at the given
+// path. If p.FS isn't a PendingFileFS, the written data is held in
+// memory and passed to WriteFile when committed, and if it isn't a
+// WriteFS either, ErrReadOnly is returned.
+func (p PathFS) CreatePendingFile(path string) (PendingFile, error) {
+	writeFS, ok := p.FS.(WriteFS)
+	if !ok {
+		return nil, &fs.PathError{Op: "write", Path: path, Err: ErrReadOnly}
+	}
+	name, err := p.Name(path)
+	if err != nil {
+		return nil, err
+	}
+	if pendingFileFS, ok := writeFS.(PendingFileFS); ok {
+		return pendingFileFS.CreatePendingFile(name)
+	}
+	return NewBufferedPendingFile(func(data []byte) error {
+		return writeFS.WriteFile(name, data)
+	}), nil
+}
+
+// MoveFile moves the file at oldPath to newPath, replacing any file
+// at newPath. If p.FS isn't a RenameFS, the file is copied and then
+// removed instead, which requires p.FS to be a RemoveFS; otherwise,
+// ErrReadOnly is returned.
+func (p PathFS) MoveFile(oldPath, newPath string) error {
+	oldName, err := p.Name(oldPath)
+	if err != nil {
+		return err
+	}
+	newName, err := p.Name(newPath)
+	if err != nil {
+		return err
+	}
+	if renameFS, ok := p.FS.(RenameFS); ok {
+		return renameFS.Rename(oldName, newName)
+	}
+	removeFS, ok := p.FS.(RemoveFS)
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: ErrReadOnly}
+	}
+	data, err := fs.ReadFile(removeFS, oldName)
+	if err != nil {
+		return err
+	}
+	err = removeFS.WriteFile(newName, data)
+	if err != nil {
+		return err
+	}
+	return removeFS.Remove(oldName)
+}
+
+// DeleteFile removes the file at the given path, or returns
+// ErrReadOnly if p.FS isn't a RemoveFS.
+func (p PathFS) DeleteFile(path string) error {
+	removeFS, ok := p.FS.(RemoveFS)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: path, Err: ErrReadOnly}
+	}
+	name, err := p.Name(path)
+	if err != nil {
+		return err
+	}
+	return removeFS.Remove(name)
+}
+
+// StatFile returns a FileInfo describing the file at the given path.
+func (p PathFS) StatFile(path string) (fs.FileInfo, error) {
+	name, err := p.Name(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(p.FS, name)
+}
+
+// SetFileInfo sets the permissions and modification time of the file
+// at the given path to those in info if p.FS is a FileInfoFS, and
+// otherwise does nothing, since file metadata is only preserved on a
+// best-effort basis.
+func (p PathFS) SetFileInfo(path string, info fs.FileInfo) error {
+	fileInfoFS, ok := p.FS.(FileInfoFS)
+	if !ok {
+		return nil
+	}
+	name, err := p.Name(path)
+	if err != nil {
+		return err
+	}
+	return fileInfoFS.SetFileInfo(name, info)
+}
+
+// A FileMover finds, moves and removes files by path. PathFS is a
+// FileMover, as are the file I/O types that the par packages use
+// for the OS file system.
+type FileMover interface {
+	// FindWithPrefixAndSuffix returns the paths of all files
+	// whose path matches the given prefix and suffix.
+	FindWithPrefixAndSuffix(prefix, suffix string) ([]string, error)
+	// MoveFile moves the file at oldPath to newPath, replacing
+	// any file at newPath.
+	MoveFile(oldPath, newPath string) error
+	// DeleteFile removes the file at the given path.
+	DeleteFile(path string) error
+}
+
+// BackUpFile moves the file at path to the first of path.1, path.2,
+// etc. that doesn't exist, and returns its new path, or the empty
+// string if there's no file at path.
+func BackUpFile(m FileMover, path string) (string, error) {
+	matches, err := m.FindWithPrefixAndSuffix(path+".", "")
+	if err != nil {
+		return "", err
+	}
+	// The matches may not be in the same form as path,
+	// e.g. absolute instead of relative, so compare only the
+	// filenames.
+	existing := make(map[string]bool)
+	for _, match := range matches {
+		existing[filepath.Base(match)] = true
+	}
+
+	for i := 1; ; i++ {
+		backupPath := fmt.Sprintf("%s.%d", path, i)
+		if existing[filepath.Base(backupPath)] {
+			continue
+		}
+		err := m.MoveFile(path, backupPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		return backupPath, nil
+	}
+}
+
+// DeleteFiles removes the files at the given paths in order,
+// stopping at the first error, and returns the paths of the removed
+// files, which is present even if an error is returned.
+func DeleteFiles(m FileMover, paths []string) ([]string, error) {
+	var deletedPaths []string
+	for _, path := range paths {
+		err := m.DeleteFile(path)
+		if err != nil {
+			return deletedPaths, err
+		}
+		deletedPaths = append(deletedPaths, path)
+	}
+	return deletedPaths, nil
+}
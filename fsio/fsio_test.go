@@ -0,0 +1,302 @@
+package fsio
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFSRead(t *testing.T) {
+	p := PathFS{fstest.MapFS{
+		"file.par2":              {Data: []byte{0x1}},
+		"file.vol00+01.par2":     {Data: []byte{0x2}},
+		"file.vol01+02.par2":     {Data: []byte{0x3}},
+		"dir/file.vol02+01.par2": {Data: []byte{0x4}},
+	}}
+
+	path := p.Path("file.vol00+01.par2")
+	require.Equal(t, filepath.Join(Root(), "file.vol00+01.par2"), path)
+	name, err := p.Name(path)
+	require.NoError(t, err)
+	require.Equal(t, "file.vol00+01.par2", name)
+
+	data, err := p.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x2}, data)
+
+	_, err = p.ReadFile(p.Path("file.vol03+01.par2"))
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	matches, err := p.FindWithPrefixAndSuffix(p.Path("file."), ".par2")
+	require.NoError(t, err)
+	sort.Strings(matches)
+	require.Equal(t, []string{
+		p.Path("file.vol00+01.par2"),
+		p.Path("file.vol01+02.par2"),
+	}, matches)
+
+	matches, err = p.FindWithPrefixAndSuffix(p.Path("nodir/file."), ".par2")
+	require.NoError(t, err)
+	require.Equal(t, 0, len(matches))
+
+	err = p.WriteFile(p.Path("file.par2"), []byte{0x5})
+	require.True(t, errors.Is(err, ErrReadOnly))
+}
+
+func TestPathFSWrite(t *testing.T) {
+	fs := memfs.MakeMemFS(memfs.RootDir(), nil)
+	p := PathFS{fs}
+
+	require.NoError(t, p.WriteFile(p.Path("dir/file.par2"), []byte{0x1}))
+	data, err := fs.ReadFile(filepath.Join("dir", "file.par2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1}, data)
+
+	matches, err := p.FindWithPrefixAndSuffix(p.Path("dir/file"), ".par2")
+	require.NoError(t, err)
+	require.Equal(t, []string{p.Path("dir/file.par2")}, matches)
+
+	require.NoError(t, p.MoveFile(p.Path("dir/file.par2"), p.Path("file.par2.1")))
+	data, err = fs.ReadFile("file.par2.1")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1}, data)
+
+	require.NoError(t, p.DeleteFile(p.Path("file.par2.1")))
+	require.Equal(t, 0, fs.FileCount())
+
+	err = PathFS{fstest.MapFS{}}.DeleteFile(p.Path("file.par2"))
+	require.True(t, errors.Is(err, ErrReadOnly))
+	err = PathFS{fstest.MapFS{}}.MoveFile(p.Path("file.par2"), p.Path("file.par2.1"))
+	require.True(t, errors.Is(err, ErrReadOnly))
+}
+
+func TestPathFSMoveFileWithoutRename(t *testing.T) {
+	fs := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"file.par2": {0x1},
+	})
+	// Hide MemFS.Rename.
+	p := PathFS{struct{ RemoveFS }{fs}}
+
+	require.NoError(t, p.MoveFile(p.Path("file.par2"), p.Path("dir/file.par2")))
+	require.Equal(t, []string{filepath.Join(memfs.RootDir(), "dir", "file.par2")}, fs.Paths())
+}
+
+func TestPathFSPaths(t *testing.T) {
+	p := PathFS{fstest.MapFS{}}
+	require.Equal(t, []string{p.Path("file.rar"), p.Path("dir/file.r01")}, p.Paths([]string{"file.rar", "dir/file.r01"}))
+}
+
+func TestBackUpFile(t *testing.T) {
+	memFS := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"file.rar":   {0x1},
+		"file.rar.1": {0x2},
+		"file.rar.3": {0x3},
+	})
+	p := PathFS{memFS}
+
+	backupPath, err := BackUpFile(p, p.Path("file.rar"))
+	require.NoError(t, err)
+	require.Equal(t, p.Path("file.rar.2"), backupPath)
+	data, err := memFS.ReadFile("file.rar.2")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1}, data)
+
+	// There's nothing to back up anymore.
+	backupPath, err = BackUpFile(p, p.Path("file.rar"))
+	require.NoError(t, err)
+	require.Equal(t, "", backupPath)
+	require.Equal(t, 3, memFS.FileCount())
+}
+
+func TestDeleteFiles(t *testing.T) {
+	memFS := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"file.par2":          {0x1},
+		"file.vol00+01.par2": {0x2},
+	})
+	p := PathFS{memFS}
+
+	deletedPaths, err := DeleteFiles(p, p.Paths([]string{"file.par2", "file.vol01+01.par2", "file.vol00+01.par2"}))
+	require.True(t, errors.Is(err, fs.ErrNotExist), "%v", err)
+	require.Equal(t, []string{p.Path("file.par2")}, deletedPaths)
+	require.Equal(t, 1, memFS.FileCount())
+}
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	fsys := DirFS(dir)
+
+	require.NoError(t, fsys.WriteFile("file.par2", []byte{0x1, 0x2}))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "file.par2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x2}, data)
+
+	data, err = fs.ReadFile(fsys, "file.par2")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x2}, data)
+
+	err = fsys.WriteFile("../file.par2", []byte{0x1})
+	require.True(t, errors.Is(err, fs.ErrInvalid))
+
+	require.NoError(t, fsys.Remove("file.par2"))
+	_, err = fs.Stat(fsys, "file.par2")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	err = fsys.Remove("file.par2")
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+	err = fsys.Remove("../file.par2")
+	require.True(t, errors.Is(err, fs.ErrInvalid))
+
+	require.NoError(t, fsys.WriteFile("file.par2", []byte{0x3}))
+	require.NoError(t, fsys.Rename("file.par2", "file.par2.1"))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "file.par2.1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x3}, data)
+	err = fsys.Rename("file.par2.1", "../file.par2")
+	require.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.rar")
+
+	require.NoError(t, WriteFileAtomic(path, []byte{0x1, 0x2}, 0600))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x2}, data)
+
+	// Windows only supports a read-only bit.
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(path, 0640))
+		require.NoError(t, WriteFileAtomic(path, []byte{0x3}, 0600))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, fs.FileMode(0640), info.Mode().Perm())
+	}
+
+	// No temporary files should be left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "file.rar", entries[0].Name())
+
+	err = WriteFileAtomic(filepath.Join(dir, "nodir", "file.rar"), []byte{0x1}, 0600)
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestCreatePendingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.par2")
+	require.NoError(t, ioutil.WriteFile(path, []byte{0x1}, 0600))
+
+	p, err := CreatePendingFile(path, 0600)
+	require.NoError(t, err)
+	_, err = p.WriteAt([]byte{0x4, 0x5}, 2)
+	require.NoError(t, err)
+	_, err = p.WriteAt([]byte{0x2, 0x3}, 0)
+	require.NoError(t, err)
+
+	// The file isn't replaced until the pending file is
+	// committed.
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1}, data)
+
+	require.NoError(t, p.Commit())
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x2, 0x3, 0x4, 0x5}, data)
+	require.NoError(t, p.Discard())
+	require.Error(t, p.Commit())
+
+	p, err = CreatePendingFile(path, 0600)
+	require.NoError(t, err)
+	_, err = p.WriteAt([]byte{0x6}, 0)
+	require.NoError(t, err)
+	require.NoError(t, p.Discard())
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x2, 0x3, 0x4, 0x5}, data)
+
+	// No temporary files should be left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries))
+	require.Equal(t, "file.par2", entries[0].Name())
+}
+
+func TestPathFSCreatePendingFile(t *testing.T) {
+	// MemFS can only write whole files, so the data is buffered.
+	memFS := memfs.MakeMemFS(memfs.RootDir(), nil)
+	p := PathFS{memFS}
+	pendingFile, err := p.CreatePendingFile(p.Path("dir/file.par2"))
+	require.NoError(t, err)
+	_, err = pendingFile.WriteAt([]byte{0x3}, 2)
+	require.NoError(t, err)
+	_, err = pendingFile.WriteAt([]byte{0x1}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, memFS.FileCount())
+	require.NoError(t, pendingFile.Commit())
+	data, err := memFS.ReadFile(filepath.Join("dir", "file.par2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x0, 0x3}, data)
+
+	dir := t.TempDir()
+	p = PathFS{DirFS(dir)}
+	pendingFile, err = p.CreatePendingFile(p.Path("file.par2"))
+	require.NoError(t, err)
+	_, err = pendingFile.WriteAt([]byte{0x1, 0x2}, 0)
+	require.NoError(t, err)
+	require.NoError(t, pendingFile.Commit())
+	data, err = ioutil.ReadFile(filepath.Join(dir, "file.par2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x2}, data)
+
+	_, err = PathFS{fstest.MapFS{}}.CreatePendingFile(p.Path("file.par2"))
+	require.True(t, errors.Is(err, ErrReadOnly))
+}
+
+func TestSetFileInfo(t *testing.T) {
+	dir := t.TempDir()
+	fsys := DirFS(dir)
+	require.NoError(t, fsys.WriteFile("file.rar", []byte{0x1}))
+	require.NoError(t, fsys.WriteFile("file.r01", []byte{0x2}))
+
+	atime := time.Date(2021, time.February, 3, 4, 5, 6, 0, time.UTC)
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "file.rar"), atime, modTime))
+	info, err := fs.Stat(fsys, "file.rar")
+	require.NoError(t, err)
+
+	p := PathFS{fsys}
+	require.NoError(t, p.SetFileInfo(p.Path("file.r01"), info))
+	newInfo, err := p.StatFile(p.Path("file.r01"))
+	require.NoError(t, err)
+	require.True(t, modTime.Equal(newInfo.ModTime()))
+	require.Equal(t, info.Mode(), newInfo.Mode())
+	if _, _, newAtime, ok := ownerAndAccessTime(newInfo); ok {
+		require.True(t, atime.Equal(newAtime))
+	}
+
+	// Files without existing metadata can be given some.
+	require.NoError(t, p.SetFileInfo(p.Path("file.r01"), NewFileInfo("file.r01", 1, RestoredFilePerm, modTime.Add(time.Hour))))
+	newInfo, err = p.StatFile(p.Path("file.r01"))
+	require.NoError(t, err)
+	require.True(t, modTime.Add(time.Hour).Equal(newInfo.ModTime()))
+	if runtime.GOOS != "windows" {
+		require.Equal(t, RestoredFilePerm, newInfo.Mode().Perm())
+	}
+
+	// SetFileInfo does nothing for file systems that don't
+	// support it.
+	require.NoError(t, PathFS{fstest.MapFS{}}.SetFileInfo(p.Path("file.r01"), info))
+}
@@ -0,0 +1,15 @@
+package gf2
+
+// clmulGeneric returns the full 128-bit carry-less product of p and
+// q, split into its high and low 64 bits.
+func clmulGeneric(p, q uint64) (hi, lo uint64) {
+	for i := uint(0); i < 64 && q>>i != 0; i++ {
+		if q&(1<<i) != 0 {
+			lo ^= p << i
+			if i > 0 {
+				hi ^= p >> (64 - i)
+			}
+		}
+	}
+	return hi, lo
+}
@@ -0,0 +1,19 @@
+package gf2
+
+import "github.com/klauspost/cpuid/v2"
+
+var hasCLMUL bool
+
+func init() {
+	hasCLMUL = cpuid.CPU.Supports(cpuid.CLMUL)
+}
+
+//go:noescape
+func clmulPCLMULQDQ(p, q uint64) (hi, lo uint64)
+
+func clmul(p, q uint64, useCLMUL bool) (hi, lo uint64) {
+	if useCLMUL {
+		return clmulPCLMULQDQ(p, q)
+	}
+	return clmulGeneric(p, q)
+}
@@ -0,0 +1,14 @@
+#include "textflag.h"
+
+// func clmulPCLMULQDQ(p, q uint64) (hi, lo uint64)
+TEXT ·clmulPCLMULQDQ(SB), NOSPLIT, $0
+	MOVQ p+0(FP), X0
+	MOVQ q+8(FP), X1
+
+	// X0 = p * q, as a 128-bit carry-less product.
+	PCLMULQDQ $0x00, X1, X0
+
+	MOVQ   X0, lo+24(FP)
+	PSRLDQ $8, X0
+	MOVQ   X0, hi+16(FP)
+	RET
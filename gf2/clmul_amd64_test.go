@@ -0,0 +1,42 @@
+package gf2
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLMULPCLMULQDQ(t *testing.T) {
+	if !hasCLMUL {
+		t.Skip("PCLMULQDQ not supported; skipping")
+	}
+
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		p := rand.Uint64()
+		q := rand.Uint64()
+		expectedHi, expectedLo := clmulGeneric(p, q)
+		hi, lo := clmulPCLMULQDQ(p, q)
+		require.Equal(t, expectedHi, hi, "p=%x, q=%x", p, q)
+		require.Equal(t, expectedLo, lo, "p=%x, q=%x", p, q)
+	}
+}
+
+func BenchmarkCLMUL(b *testing.B) {
+	for _, useCLMUL := range []bool{false, true} {
+		if useCLMUL && !hasCLMUL {
+			continue
+		}
+		name := "Generic"
+		if useCLMUL {
+			name = "PCLMULQDQ"
+		}
+		b.Run(name, func(b *testing.B) {
+			p := uint64(0x123456789abcdef0)
+			for i := 0; i < b.N; i++ {
+				_, p = clmul(p, 0xfedcba9876543210, useCLMUL)
+			}
+		})
+	}
+}
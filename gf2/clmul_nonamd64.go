@@ -0,0 +1,10 @@
+//go:build !amd64
+// +build !amd64
+
+package gf2
+
+const hasCLMUL = false
+
+func clmul(p, q uint64, useCLMUL bool) (hi, lo uint64) {
+	return clmulGeneric(p, q)
+}
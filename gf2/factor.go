@@ -0,0 +1,131 @@
+package gf2
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// This file has just enough integer factoring to find the prime
+// factors of 2^n - 1 for n < 64, which Primitive and GeneratesMod
+// need.
+
+func mulMod64(a, b, n uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return bits.Rem64(hi, lo, n)
+}
+
+func powMod64(a, e, n uint64) uint64 {
+	r := uint64(1) % n
+	a %= n
+	for ; e != 0; e >>= 1 {
+		if e&1 != 0 {
+			r = mulMod64(r, a, n)
+		}
+		a = mulMod64(a, a, n)
+	}
+	return r
+}
+
+func gcd64(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// isPrime64 returns whether n is prime, using the Miller-Rabin test
+// with a set of bases that is known to be deterministic for all
+// 64-bit integers.
+func isPrime64(n uint64) bool {
+	bases := []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+	if n < 2 {
+		return false
+	}
+	for _, b := range bases {
+		if n%b == 0 {
+			return n == b
+		}
+	}
+
+	d := n - 1
+	s := 0
+	for d%2 == 0 {
+		d /= 2
+		s++
+	}
+
+nextBase:
+	for _, b := range bases {
+		x := powMod64(b, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		for i := 1; i < s; i++ {
+			x = mulMod64(x, x, n)
+			if x == n-1 {
+				continue nextBase
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// findFactor64 returns a non-trivial factor of n, which must be odd
+// and composite, using Pollard's rho algorithm.
+func findFactor64(n uint64) uint64 {
+	for c := uint64(1); ; c++ {
+		f := func(x uint64) uint64 {
+			return (mulMod64(x, x, n) + c) % n
+		}
+		x, y, d := uint64(2), uint64(2), uint64(1)
+		for d == 1 {
+			x = f(x)
+			y = f(f(y))
+			if x > y {
+				d = gcd64(x-y, n)
+			} else {
+				d = gcd64(y-x, n)
+			}
+		}
+		if d != n {
+			return d
+		}
+	}
+}
+
+func addPrimeFactors64(n uint64, factors map[uint64]bool) {
+	if n == 1 {
+		return
+	}
+	if isPrime64(n) {
+		factors[n] = true
+		return
+	}
+	d := findFactor64(n)
+	addPrimeFactors64(d, factors)
+	addPrimeFactors64(n/d, factors)
+}
+
+// primeFactors64 returns the distinct prime factors of n, which must
+// be non-zero, in increasing order.
+func primeFactors64(n uint64) []uint64 {
+	if n == 0 {
+		panic("zero has no prime factorization")
+	}
+	factors := make(map[uint64]bool)
+	for n%2 == 0 {
+		factors[2] = true
+		n /= 2
+	}
+	addPrimeFactors64(n, factors)
+
+	var result []uint64
+	for p := range factors {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
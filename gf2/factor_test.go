@@ -0,0 +1,53 @@
+package gf2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func isPrimeSlow(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for d := uint64(2); d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIsPrime64(t *testing.T) {
+	for n := uint64(0); n < 10000; n++ {
+		require.Equal(t, isPrimeSlow(n), isPrime64(n), "n=%d", n)
+	}
+	// 2^61 - 1 is a Mersenne prime, and 2^64 - 59 is the largest
+	// 64-bit prime.
+	require.True(t, isPrime64(1<<61-1))
+	require.True(t, isPrime64(1<<64-59))
+	require.False(t, isPrime64((1<<31-1)*(1<<31-1)))
+}
+
+func TestPrimeFactors64(t *testing.T) {
+	require.Equal(t, []uint64(nil), primeFactors64(1))
+	require.Equal(t, []uint64{2, 3, 5}, primeFactors64(2*2*3*5*5*5))
+
+	for n := uint(1); n < 64; n++ {
+		m := uint64(1)<<n - 1
+		factors := primeFactors64(m)
+		// Divide out all the factors, which must be
+		// increasing primes.
+		for i, p := range factors {
+			require.True(t, isPrime64(p), "n=%d, p=%d", n, p)
+			if i > 0 {
+				require.True(t, factors[i-1] < p)
+			}
+			require.Equal(t, uint64(0), m%p, "n=%d, p=%d", n, p)
+			for m%p == 0 {
+				m /= p
+			}
+		}
+		require.Equal(t, uint64(1), m, "n=%d", n)
+	}
+}
@@ -1,5 +1,7 @@
 package gf2
 
+import "math/bits"
+
 // A Poly64 is a polynomial over GF(2) mod x^64.
 type Poly64 uint64
 
@@ -18,15 +20,23 @@ func (p Poly64) Minus(q Poly64) Poly64 {
 // Times returns the product of p and q as polynomials over GF(2), mod
 // x^64.
 func (p Poly64) Times(q Poly64) Poly64 {
-	var prod Poly64
-	for p != 0 && q != 0 {
-		if q&1 != 0 {
-			prod ^= p
-		}
-		q >>= 1
-		p <<= 1
-	}
-	return prod
+	_, lo := clmul(uint64(p), uint64(q), hasCLMUL)
+	return Poly64(lo)
+}
+
+// TimesFull returns the full product of p and q as polynomials over
+// GF(2), which has degree at most 126, split into hi, the quotient of
+// the product by x^64, and lo, the product mod x^64. Like Times, it
+// uses the PCLMULQDQ instruction if it's available.
+func (p Poly64) TimesFull(q Poly64) (hi, lo Poly64) {
+	h, l := clmul(uint64(p), uint64(q), hasCLMUL)
+	return Poly64(h), Poly64(l)
+}
+
+// Degree returns the degree of p, i.e. floor(log2(p)), or -1 if
+// p == 0.
+func (p Poly64) Degree() int {
+	return bits.Len64(uint64(p)) - 1
 }
 
 // ilog2(n) returns floor(log2(n)), assuming n > 0.
@@ -66,3 +76,140 @@ func (p Poly64) Div(p2 Poly64) (q, r Poly64) {
 
 	return q, r
 }
+
+// reduce returns hi * x^64 + lo mod m. It panics if m == 0.
+func reduce(hi, lo, m Poly64) Poly64 {
+	if m == 0 {
+		panic("division by zero")
+	}
+
+	d := m.Degree()
+	for hi != 0 {
+		// Cancel the leading term of hi * x^64 + lo, which is
+		// x^(64 + k), by adding m * x^shift.
+		k := hi.Degree()
+		shift := uint(64 + k - d)
+		if shift >= 64 {
+			hi ^= m << (shift - 64)
+		} else {
+			hi ^= m >> (64 - shift)
+			lo ^= m << shift
+		}
+	}
+	_, r := lo.Div(m)
+	return r
+}
+
+// TimesMod returns the product of p and q as polynomials over GF(2),
+// mod m. Unlike Times, the product isn't truncated to 64 bits before
+// being reduced. It panics if m == 0.
+func (p Poly64) TimesMod(q, m Poly64) Poly64 {
+	hi, lo := p.TimesFull(q)
+	return reduce(hi, lo, m)
+}
+
+// PowMod returns p^e mod m, where p^0 is 1. It panics if m == 0.
+func (p Poly64) PowMod(e uint64, m Poly64) Poly64 {
+	_, r := Poly64(1).Div(m)
+	_, p = p.Div(m)
+	for ; e != 0; e >>= 1 {
+		if e&1 != 0 {
+			r = r.TimesMod(p, m)
+		}
+		p = p.TimesMod(p, m)
+	}
+	return r
+}
+
+// GCD returns the greatest common divisor of p and q, which is 0 if
+// both are 0.
+func (p Poly64) GCD(q Poly64) Poly64 {
+	for q != 0 {
+		_, r := p.Div(q)
+		p, q = q, r
+	}
+	return p
+}
+
+// ExtendedGCD returns the greatest common divisor g of p and q, along
+// with s and t such that s * p + t * q = g, where the products aren't
+// truncated mod x^64. s and t are small enough that
+// s.Times(p).Plus(t.Times(q)) == g also holds if
+// deg(p) + deg(q) < 64.
+func (p Poly64) ExtendedGCD(q Poly64) (g, s, t Poly64) {
+	oldR, r := p, q
+	oldS, s := Poly64(1), Poly64(0)
+	oldT, t := Poly64(0), Poly64(1)
+	for r != 0 {
+		quo, rem := oldR.Div(r)
+		oldR, r = r, rem
+		oldS, s = s, oldS.Minus(quo.Times(s))
+		oldT, t = t, oldT.Minus(quo.Times(t))
+	}
+	return oldR, oldS, oldT
+}
+
+// Irreducible returns whether p is irreducible, i.e. whether it has
+// degree at least 1 and can't be written as the product of two
+// polynomials of lower degree.
+func (p Poly64) Irreducible() bool {
+	n := p.Degree()
+	if n < 1 {
+		return false
+	}
+
+	// Use Rabin's test: p is irreducible exactly when p divides
+	// x^(2^n) - x, and x^(2^(n/r)) - x is coprime to p for each
+	// prime factor r of n.
+	//
+	// xPows[k] = x^(2^k) mod p.
+	xPows := make([]Poly64, n+1)
+	_, xPows[0] = Poly64(2).Div(p)
+	for k := 1; k <= n; k++ {
+		xPows[k] = xPows[k-1].TimesMod(xPows[k-1], p)
+	}
+	if xPows[n] != xPows[0] {
+		return false
+	}
+	for _, r := range primeFactors64(uint64(n)) {
+		if xPows[n/int(r)].Minus(xPows[0]).GCD(p) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// GeneratesMod returns whether p generates the multiplicative group
+// of the field GF(2)[x]/m, i.e. whether every non-zero element of the
+// field is some power of p mod m. It panics if m isn't irreducible.
+func (p Poly64) GeneratesMod(m Poly64) bool {
+	if !m.Irreducible() {
+		panic("modulus is not irreducible")
+	}
+
+	_, p = p.Div(m)
+	if p == 0 {
+		return false
+	}
+
+	// p is a generator exactly when its order is 2^n - 1, which
+	// is true exactly when p^((2^n - 1) / r) != 1 for each prime
+	// factor r of 2^n - 1.
+	order := uint64(1)<<uint(m.Degree()) - 1
+	if order == 1 {
+		return true
+	}
+	for _, r := range primeFactors64(order) {
+		if p.PowMod(order/r, m) == 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Primitive returns whether p is a primitive polynomial, i.e. whether
+// it is irreducible and x generates the multiplicative group of the
+// field GF(2)[x]/p.
+func (p Poly64) Primitive() bool {
+	return p.Irreducible() && Poly64(2).GeneratesMod(p)
+}
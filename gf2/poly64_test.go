@@ -1,6 +1,7 @@
 package gf2
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -85,3 +86,177 @@ func TestMod11(t *testing.T) {
 		assert.True(t, foundInvMod11, "i=%d", i)
 	}
 }
+
+func randPoly64(rand *rand.Rand, degree int) Poly64 {
+	return Poly64(rand.Uint64()>>uint(63-degree)) | 1<<uint(degree)
+}
+
+func TestCLMULGeneric(t *testing.T) {
+	// (x^63 + 1)(x^63 + x) = x^126 + x^64 + x^63 + x.
+	hi, lo := clmulGeneric(1<<63|1, 1<<63|2)
+	require.Equal(t, uint64(1<<62|1), hi)
+	require.Equal(t, uint64(1<<63|2), lo)
+
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		p := rand.Uint64()
+		q := rand.Uint64()
+		hi, lo := clmulGeneric(p, q)
+		hi2, lo2 := clmulGeneric(q, p)
+		require.Equal(t, hi, hi2)
+		require.Equal(t, lo, lo2)
+
+		// Compute the product using the distributive law
+		// with the low and high halves of q.
+		qLo, qHi := q&(1<<32-1), q>>32
+		hiLo, loLo := clmulGeneric(p, qLo)
+		hiHi, loHi := clmulGeneric(p, qHi)
+		require.Equal(t, hiLo^hiHi<<32^loHi>>32, hi)
+		require.Equal(t, loLo^loHi<<32, lo)
+	}
+}
+
+func TestPoly64TimesFull(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		p := Poly64(rand.Uint64())
+		q := Poly64(rand.Uint64())
+		hi, lo := p.TimesFull(q)
+		require.Equal(t, p.Times(q), lo)
+
+		expectedHi, expectedLo := clmulGeneric(uint64(p), uint64(q))
+		require.Equal(t, Poly64(expectedHi), hi)
+		require.Equal(t, Poly64(expectedLo), lo)
+	}
+}
+
+func TestPoly64Degree(t *testing.T) {
+	require.Equal(t, -1, Poly64(0).Degree())
+	require.Equal(t, 0, Poly64(1).Degree())
+	require.Equal(t, 1, Poly64(3).Degree())
+	require.Equal(t, 16, Poly64(0x1100b).Degree())
+	require.Equal(t, 63, Poly64(1<<63|1).Degree())
+}
+
+// timesModSlow computes p * q mod m one bit of q at a time.
+func timesModSlow(p, q, m Poly64) Poly64 {
+	var r Poly64
+	_, a := p.Div(m)
+	for ; q != 0; q >>= 1 {
+		if q&1 != 0 {
+			r ^= a
+		}
+		_, a = (a << 1).Div(m)
+	}
+	return r
+}
+
+func TestPoly64TimesMod(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		p := Poly64(rand.Uint64())
+		q := Poly64(rand.Uint64())
+		m := randPoly64(rand, rand.Intn(64))
+		require.Equal(t, timesModSlow(p, q, m), p.TimesMod(q, m), "p=%x, q=%x, m=%x", p, q, m)
+	}
+}
+
+func TestPoly64PowMod(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		p := Poly64(rand.Uint64())
+		m := randPoly64(rand, 1+rand.Intn(63))
+		_, expected := Poly64(1).Div(m)
+		for e := uint64(0); e < 100; e++ {
+			require.Equal(t, expected, p.PowMod(e, m), "p=%x, e=%d, m=%x", p, e, m)
+			expected = expected.TimesMod(p, m)
+		}
+	}
+
+	require.Equal(t, Poly64(0), Poly64(5).PowMod(0, 1))
+}
+
+func TestPoly64GCD(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		c := randPoly64(rand, rand.Intn(20))
+		p := randPoly64(rand, rand.Intn(20)).Times(c)
+		q := randPoly64(rand, rand.Intn(20)).Times(c)
+
+		g := p.GCD(q)
+		require.Equal(t, g, q.GCD(p))
+		for _, n := range []Poly64{p, q} {
+			_, r := n.Div(g)
+			require.Equal(t, Poly64(0), r, "p=%x, q=%x, g=%x", p, q, g)
+		}
+		_, r := g.Div(c)
+		require.Equal(t, Poly64(0), r, "p=%x, q=%x, g=%x, c=%x", p, q, g, c)
+
+		g2, s, t2 := p.ExtendedGCD(q)
+		require.Equal(t, g, g2)
+		require.Equal(t, g, s.Times(p).Plus(t2.Times(q)), "p=%x, q=%x, s=%x, t=%x", p, q, s, t2)
+	}
+
+	require.Equal(t, Poly64(0), Poly64(0).GCD(0))
+	require.Equal(t, Poly64(7), Poly64(0).GCD(7))
+}
+
+func TestPoly64ExtendedGCDInverse(t *testing.T) {
+	// Since 0x1100b is irreducible, ExtendedGCD can be used to
+	// compute inverses mod it.
+	const m Poly64 = 0x1100b
+	for p := Poly64(1); p < 1<<16; p += 97 {
+		g, s, _ := p.ExtendedGCD(m)
+		require.Equal(t, Poly64(1), g)
+		require.Equal(t, Poly64(1), p.TimesMod(s, m), "p=%x", p)
+	}
+}
+
+func TestPoly64Irreducible(t *testing.T) {
+	for p := Poly64(0); p < 1<<10; p++ {
+		require.Equal(t, p >= 2 && irreducible(p), p.Irreducible(), "p=%x", p)
+	}
+
+	// x^31 + x^3 + 1 and x^32 + x^22 + x^2 + x + 1 are
+	// irreducible, but their product isn't.
+	p := Poly64(1<<31 | 1<<3 | 1)
+	q := Poly64(1<<32 | 1<<22 | 1<<2 | 1<<1 | 1)
+	require.True(t, p.Irreducible())
+	require.True(t, q.Irreducible())
+	require.False(t, p.Times(q).Irreducible())
+
+	// x^63 + x + 1 is irreducible, but x^63 + 1 isn't.
+	require.True(t, Poly64(1<<63|1<<1|1).Irreducible())
+	require.False(t, Poly64(1<<63|1).Irreducible())
+}
+
+// orderMod returns the multiplicative order of p mod m, which must be
+// non-zero mod m, by brute force.
+func orderMod(p, m Poly64) int {
+	_, p = p.Div(m)
+	x := p
+	order := 1
+	for x != 1 {
+		x = x.TimesMod(p, m)
+		order++
+	}
+	return order
+}
+
+func TestPoly64GeneratesMod(t *testing.T) {
+	for m := Poly64(2); m < 1<<9; m++ {
+		if !m.Irreducible() {
+			require.Panics(t, func() { Poly64(2).GeneratesMod(m) }, "m=%x", m)
+			continue
+		}
+		fieldOrder := 1<<uint(m.Degree()) - 1
+		for p := Poly64(0); p < 1<<uint(m.Degree()); p++ {
+			expected := p != 0 && orderMod(p, m) == fieldOrder
+			require.Equal(t, expected, p.GeneratesMod(m), "p=%x, m=%x", p, m)
+		}
+		require.Equal(t, m != 2 && orderMod(2, m) == fieldOrder, m.Primitive(), "m=%x", m)
+	}
+
+	// x^63 + x + 1 is primitive.
+	require.True(t, Poly64(1<<63|1<<1|1).Primitive())
+}
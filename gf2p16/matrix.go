@@ -1,10 +1,15 @@
 package gf2p16
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
 
 // Matrix is an immutable rectangular array of elements of
-// GF(2^16). It has just enough methods to support Reed-Solomon
-// erasure codes.
+// GF(2^16). Methods that return a modified matrix, like Set, return a
+// new one, so a Matrix can be shared freely.
 type Matrix struct {
 	rows, columns int
 	// Elements are stored in row-major order.
@@ -51,7 +56,7 @@ func NewMatrixFromFunction(rows, columns int, fn func(int, int) T) Matrix {
 			elements[i*columns+j] = fn(i, j)
 		}
 	}
-	return NewMatrixFromSlice(rows, columns, elements)
+	return Matrix{rows, columns, elements}
 }
 
 // NewIdentityMatrix returns an n x n identity matrix.
@@ -76,6 +81,16 @@ func (m Matrix) checkColumnIndex(i int) {
 	}
 }
 
+// Rows returns the number of rows of m.
+func (m Matrix) Rows() int {
+	return m.rows
+}
+
+// Columns returns the number of columns of m.
+func (m Matrix) Columns() int {
+	return m.columns
+}
+
 // At returns the element at row index i and column index j.
 func (m Matrix) At(i, j int) T {
 	m.checkRowIndex(i)
@@ -83,6 +98,105 @@ func (m Matrix) At(i, j int) T {
 	return m.elements[i*m.columns+j]
 }
 
+// Set returns a copy of m with the element at row index i and column
+// index j replaced with t.
+func (m Matrix) Set(i, j int, t T) Matrix {
+	m.checkRowIndex(i)
+	m.checkColumnIndex(j)
+	n := m.clone()
+	n.elements[i*n.columns+j] = t
+	return n
+}
+
+// Equal returns whether m and n have the same dimensions and
+// elements.
+func (m Matrix) Equal(n Matrix) bool {
+	if m.rows != n.rows || m.columns != n.columns {
+		return false
+	}
+	for i, t := range m.elements {
+		if n.elements[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a representation of m with one row per line, and
+// with each element in hex.
+func (m Matrix) String() string {
+	var b strings.Builder
+	for i := 0; i < m.rows; i++ {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteByte('[')
+		for j, t := range m.row(i) {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(&b, "%04x", uint16(t))
+		}
+		b.WriteByte(']')
+	}
+	return b.String()
+}
+
+// Transpose returns the transpose of m.
+func (m Matrix) Transpose() Matrix {
+	return NewMatrixFromFunction(m.columns, m.rows, func(i, j int) T {
+		return m.At(j, i)
+	})
+}
+
+// SubMatrix returns the matrix made up of the elements of m in the
+// given rows and columns, in the given order. Indices may be
+// repeated.
+func (m Matrix) SubMatrix(rows, columns []int) Matrix {
+	for _, i := range rows {
+		m.checkRowIndex(i)
+	}
+	for _, j := range columns {
+		m.checkColumnIndex(j)
+	}
+	return NewMatrixFromFunction(len(rows), len(columns), func(i, j int) T {
+		return m.At(rows[i], columns[j])
+	})
+}
+
+// MulVec treats in as a column vector with m.Columns() entries and
+// out as one with m.Rows() entries, where each entry is an array of
+// Ts stored in little-endian format, as with MulByteSliceLE, and
+// sets out to the product of m with in. All entries must have the
+// same even length, and out must not share memory with in.
+func (m Matrix) MulVec(in, out [][]byte) {
+	if len(in) != m.columns {
+		panic("in must have m.Columns() entries")
+	}
+	if len(out) != m.rows {
+		panic("out must have m.Rows() entries")
+	}
+	byteCount := len(in[0])
+	if byteCount%2 != 0 {
+		panic("odd byte count")
+	}
+	for _, entries := range [][][]byte{in, out} {
+		for _, entry := range entries {
+			if len(entry) != byteCount {
+				panic("mismatched byte counts")
+			}
+		}
+	}
+
+	for i, outEntry := range out {
+		row := m.row(i)
+		MulByteSliceLE(row[0], in[0], outEntry)
+		for j := 1; j < len(in); j++ {
+			MulAndAddByteSliceLE(row[j], in[j], outEntry)
+		}
+	}
+}
+
 // Times returns the matrix product of m with n, which must have
 // compatible dimensions.
 func (m Matrix) Times(n Matrix) Matrix {
@@ -90,15 +204,18 @@ func (m Matrix) Times(n Matrix) Matrix {
 		panic("mismatched dimensions")
 	}
 
-	return NewMatrixFromFunction(m.rows, n.columns, func(i, j int) T {
-		var t T
-		for k := 0; k < m.columns; k++ {
-			mIK := m.At(i, k)
-			nKJ := n.At(k, j)
-			t ^= mIK.Times(nKJ)
+	// Compute each row of the product as a linear combination of
+	// the rows of n, which uses the vectorized slice functions.
+	p := NewZeroMatrix(m.rows, n.columns)
+	for i := 0; i < m.rows; i++ {
+		rowP := p.row(i)
+		for k, c := range m.row(i) {
+			if c != 0 {
+				mulAndAddSlice(c, n.row(k), rowP)
+			}
 		}
-		return t
-	})
+	}
+	return p
 }
 
 // row returns a slice into m.elements, so caller must not mutate
@@ -141,49 +258,119 @@ func (m Matrix) addScaledRow(dest, src int, c T) {
 	mulAndAddSlice(c, rowSrc, rowDest)
 }
 
-func (m Matrix) rowReduceForInverse(n Matrix) error {
-	// Convert to row echelon form.
-	for i := 0; i < m.rows; i++ {
-		// Swap the ith row with the first row with a non-zero
-		// ith column.
-		var pivot T
-		for j := i; j < m.rows; j++ {
-			if m.At(j, i) != 0 {
-				m.swapRows(i, j)
-				n.swapRows(i, j)
-				pivot = m.At(i, i)
-				break
-			}
+// rowReduceBlockSize is the number of pivots that rowReduceForInverse
+// finds before updating the rest of the rows.
+const rowReduceBlockSize = 32
+
+// runParallel calls fn on consecutive subranges [start, end) of [0,
+// count), with up to numGoroutines goroutines.
+func runParallel(count, numGoroutines int, fn func(start, end int)) {
+	if numGoroutines < 1 {
+		panic("invalid numGoroutines value")
+	}
+	if numGoroutines > count {
+		numGoroutines = count
+	}
+	if numGoroutines <= 1 {
+		fn(0, count)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			fn(i*count/numGoroutines, (i+1)*count/numGoroutines)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// reduceRow zeroes out the columns [start, end) of the ith row of m
+// by subtracting multiples of the rows [start, end) of m, which must
+// be zero in the columns [0, start), and must be the identity in the
+// columns [start, end). The same row operations are applied to n.
+func reduceRow(m, n Matrix, i, start, end int) {
+	rowM := m.row(i)
+	rowN := n.row(i)
+	for k := start; k < end; k++ {
+		// Since the kth row is zero in the other columns in
+		// [start, end), subtracting multiples of it doesn't
+		// change the elements of the ith row that are yet to be
+		// zeroed out.
+		c := rowM[k]
+		if c != 0 {
+			mulAndAddSlice(c, m.row(k)[start:], rowM[start:])
+			mulAndAddSlice(c, n.row(k), rowN)
 		}
-		if pivot == 0 {
-			return errors.New("singular matrix")
+	}
+}
+
+func (m Matrix) rowReduceForInverse(n Matrix, numGoroutines int) error {
+	// This is Gauss-Jordan elimination, except that pivots are
+	// found a block at a time, and the other rows are only reduced
+	// by the pivot rows of a block once the block is done, which
+	// can be done in parallel.
+	for start := 0; start < m.rows; start += rowReduceBlockSize {
+		end := start + rowReduceBlockSize
+		if end > m.rows {
+			end = m.rows
 		}
 
-		// Scale the ith row to have 1 as the pivot.
-		pivotInv := pivot.Inverse()
-		m.scaleRow(i, pivotInv)
-		n.scaleRow(i, pivotInv)
+		// Make the rows [start, end) pivot rows, i.e. the
+		// identity in the columns [start, end).
+		for i := start; i < end; i++ {
+			// Swap the ith row with the first row with a
+			// non-zero ith column once reduced by the
+			// pivot rows found so far.
+			found := false
+			for j := i; j < m.rows; j++ {
+				t := m.At(j, i)
+				for k := start; k < i; k++ {
+					t ^= m.At(j, k).Times(m.At(k, i))
+				}
+				if t != 0 {
+					m.swapRows(i, j)
+					n.swapRows(i, j)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.New("singular matrix")
+			}
 
-		// Zero out all elements below m_ii.
-		for j := i + 1; j < m.rows; j++ {
-			t := m.At(j, i)
-			if t != 0 {
-				m.addScaledRow(j, i, t)
-				n.addScaledRow(j, i, t)
+			reduceRow(m, n, i, start, i)
+
+			// Scale the ith row to have 1 as the pivot.
+			pivotInv := m.At(i, i).Inverse()
+			mulSlice(pivotInv, m.row(i)[start:], m.row(i)[start:])
+			n.scaleRow(i, pivotInv)
+
+			// Zero out the ith column of the previous pivot
+			// rows.
+			for j := start; j < i; j++ {
+				t := m.At(j, i)
+				if t != 0 {
+					mulAndAddSlice(t, m.row(i)[start:], m.row(j)[start:])
+					n.addScaledRow(j, i, t)
+				}
 			}
 		}
-	}
 
-	// Then convert to reduced row echelon form.
-	for i := 0; i < m.rows; i++ {
-		// Zero out all elements above m_ii.
-		for j := 0; j < i; j++ {
-			t := m.At(j, i)
-			if t != 0 {
-				m.addScaledRow(j, i, t)
-				n.addScaledRow(j, i, t)
+		// Zero out the columns [start, end) of all the other
+		// rows.
+		otherRowCount := m.rows - (end - start)
+		runParallel(otherRowCount, numGoroutines, func(otherStart, otherEnd int) {
+			for j := otherStart; j < otherEnd; j++ {
+				i := j
+				if i >= start {
+					i += end - start
+				}
+				reduceRow(m, n, i, start, end)
 			}
-		}
+		})
 	}
 
 	return nil
@@ -196,7 +383,7 @@ func (m Matrix) Inverse() (Matrix, error) {
 		panic("cannot invert non-square matrix")
 	}
 	mInv := NewIdentityMatrix(m.columns)
-	err := m.clone().rowReduceForInverse(mInv)
+	err := m.clone().rowReduceForInverse(mInv, 1)
 	if err != nil {
 		return Matrix{}, err
 	}
@@ -204,6 +391,68 @@ func (m Matrix) Inverse() (Matrix, error) {
 	return mInv, nil
 }
 
+// reduceToRowEchelonForm row-reduces m, which must be a local
+// temporary matrix, in place to row echelon form with each pivot
+// scaled to 1. It returns the rank of m, and the product of the
+// pivots before they were scaled, which is the determinant of m if m
+// is square and non-singular.
+func (m Matrix) reduceToRowEchelonForm() (rank int, pivotProduct T) {
+	pivotProduct = 1
+	for j := 0; j < m.columns && rank < m.rows; j++ {
+		pivotRow := -1
+		for i := rank; i < m.rows; i++ {
+			if m.At(i, j) != 0 {
+				pivotRow = i
+				break
+			}
+		}
+		if pivotRow < 0 {
+			continue
+		}
+
+		// Since -1 = 1 in GF(2^16), swapping rows doesn't
+		// change the determinant.
+		m.swapRows(rank, pivotRow)
+		pivot := m.At(rank, j)
+		pivotProduct = pivotProduct.Times(pivot)
+		m.scaleRow(rank, pivot.Inverse())
+		for i := rank + 1; i < m.rows; i++ {
+			t := m.At(i, j)
+			if t != 0 {
+				m.addScaledRow(i, rank, t)
+			}
+		}
+		rank++
+	}
+	return rank, pivotProduct
+}
+
+// Rank returns the rank of m, i.e. the maximum number of linearly
+// independent rows of m.
+func (m Matrix) Rank() int {
+	rank, _ := m.clone().reduceToRowEchelonForm()
+	return rank
+}
+
+// Determinant returns the determinant of m, which must be square.
+func (m Matrix) Determinant() T {
+	if m.rows != m.columns {
+		panic("cannot take determinant of non-square matrix")
+	}
+	rank, pivotProduct := m.clone().reduceToRowEchelonForm()
+	if rank < m.rows {
+		return 0
+	}
+	return pivotProduct
+}
+
+// Solve returns the matrix x such that m.Times(x) equals b, where m
+// must be square and b must have the same number of rows as m. If m
+// is singular, an empty matrix and an error is returned.
+func (m Matrix) Solve(b Matrix) (Matrix, error) {
+	return m.RowReduceForInverse(b)
+}
+
 // RowReduceForInverse runs row reduction on copies of m, which must
 // be square, and n, which must have the same number of rows as m. The
 // row-reduced copy of n is returned if m is non-singular; otherwise,
@@ -217,14 +466,23 @@ func (m Matrix) Inverse() (Matrix, error) {
 // ( I / n' ) is the inverse of ( I / n_L | 0 / m ), where / denotes
 // vertical augmentation.
 func (m Matrix) RowReduceForInverse(n Matrix) (Matrix, error) {
+	return m.RowReduceForInverseParallel(n, 1)
+}
+
+// RowReduceForInverseParallel is like RowReduceForInverse, except
+// that it uses up to numGoroutines goroutines.
+func (m Matrix) RowReduceForInverseParallel(n Matrix, numGoroutines int) (Matrix, error) {
 	if m.rows != m.columns {
 		panic("cannot row-reduce non-square matrix")
 	}
 	if n.rows != m.rows {
 		panic("n must have the same number of rows as m")
 	}
+	if numGoroutines <= 0 {
+		panic("invalid goroutine count")
+	}
 	nReduced := n.clone()
-	err := m.clone().rowReduceForInverse(nReduced)
+	err := m.clone().rowReduceForInverse(nReduced, numGoroutines)
 	if err != nil {
 		return Matrix{}, err
 	}
@@ -2,6 +2,9 @@ package gf2p16
 
 import (
 	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -140,6 +143,45 @@ func TestMatrixInverseSingular(t *testing.T) {
 	require.Equal(t, errors.New("singular matrix"), err)
 }
 
+func TestMatrixRowReduceForInverseParallel(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	// Use sizes around multiples of the block size.
+	for _, count := range []int{1, 2, 31, 32, 33, 100} {
+		m := NewMatrixFromFunction(count, count, func(i, j int) T {
+			return T(rand.Intn(1 << 16))
+		})
+		I := NewIdentityMatrix(count)
+		expectedMInv, err := m.Inverse()
+		require.NoError(t, err)
+		require.Equal(t, I, m.Times(expectedMInv))
+
+		for _, numGoroutines := range []int{1, 2, 3} {
+			mInv, err := m.RowReduceForInverseParallel(I, numGoroutines)
+			require.NoError(t, err)
+			require.Equal(t, expectedMInv, mInv, "count=%d, numGoroutines=%d", count, numGoroutines)
+		}
+	}
+}
+
+func TestMatrixRowReduceForInverseParallelSingular(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	// Make the 70th row the sum of the 10th and 40th rows, which
+	// are in different blocks.
+	count := 100
+	elements := make([]T, count*count)
+	for i := range elements {
+		elements[i] = T(rand.Intn(1 << 16))
+	}
+	for j := 0; j < count; j++ {
+		elements[70*count+j] = elements[10*count+j] ^ elements[40*count+j]
+	}
+	m := NewMatrixFromSlice(count, count, elements)
+	for _, numGoroutines := range []int{1, 3} {
+		_, err := m.RowReduceForInverseParallel(NewIdentityMatrix(count), numGoroutines)
+		require.Equal(t, errors.New("singular matrix"), err)
+	}
+}
+
 func benchmarkMatrixInverse(b *testing.B, count int) {
 	m := NewMatrixFromFunction(count, count, func(i, j int) T {
 		return (T(count+i) ^ T(j)).Inverse()
@@ -161,6 +203,35 @@ func BenchmarkMatrixInverse(b *testing.B) {
 	})
 }
 
+func benchmarkMatrixInverseParallel(b *testing.B, count, numGoroutines int) {
+	m := NewMatrixFromFunction(count, count, func(i, j int) T {
+		return (T(count+i) ^ T(j)).Inverse()
+	})
+	I := NewIdentityMatrix(count)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := m.RowReduceForInverseParallel(I, numGoroutines)
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkMatrixInverseParallel(b *testing.B) {
+	numGoroutines := runtime.GOMAXPROCS(0)
+	for _, count := range []int{1000, 5000, 20000} {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			// Inverting a 20000 x 20000 matrix takes a long
+			// time, even in parallel; rsec16 uses a
+			// closed-form inverse for Cauchy matrices that
+			// large instead.
+			if count > 5000 && testing.Short() {
+				b.Skip("skipping in short mode")
+			}
+			benchmarkMatrixInverseParallel(b, count, numGoroutines)
+		})
+	}
+}
+
 func TestMatrixRowReduceForInverse(t *testing.T) {
 	m := NewMatrixFromSlice(3, 3, []T{
 		1, 2, 3,
@@ -182,3 +253,229 @@ func TestMatrixRowReduceForInverse(t *testing.T) {
 
 	require.Equal(t, expectedN, n)
 }
+
+func randomMatrix(rand *rand.Rand, rows, columns int) Matrix {
+	return NewMatrixFromFunction(rows, columns, func(i, j int) T {
+		return T(rand.Intn(1 << 16))
+	})
+}
+
+// randomMatrixWithRank returns a random rows x columns matrix with
+// rank at most rank.
+func randomMatrixWithRank(rand *rand.Rand, rows, columns, rank int) Matrix {
+	if rank == 0 {
+		return NewZeroMatrix(rows, columns)
+	}
+	return randomMatrix(rand, rows, rank).Times(randomMatrix(rand, rank, columns))
+}
+
+func indices(n int) []int {
+	is := make([]int, n)
+	for i := range is {
+		is[i] = i
+	}
+	return is
+}
+
+// laplaceDeterminant computes the determinant of m by cofactor
+// expansion along the first row.
+func laplaceDeterminant(m Matrix) T {
+	n := m.Rows()
+	if n == 1 {
+		return m.At(0, 0)
+	}
+	var det T
+	for j := 0; j < n; j++ {
+		var otherColumns []int
+		for k := 0; k < n; k++ {
+			if k != j {
+				otherColumns = append(otherColumns, k)
+			}
+		}
+		// Since -1 = 1, the cofactor signs don't matter.
+		minor := m.SubMatrix(indices(n)[1:], otherColumns)
+		det ^= m.At(0, j).Times(laplaceDeterminant(minor))
+	}
+	return det
+}
+
+// subsets returns all the subsets of [0, n) with k elements.
+func subsets(n, k int) [][]int {
+	if k == 0 {
+		return [][]int{nil}
+	}
+	if k > n {
+		return nil
+	}
+	var result [][]int
+	for _, s := range subsets(n-1, k-1) {
+		result = append(result, append(s, n-1))
+	}
+	return append(result, subsets(n-1, k)...)
+}
+
+// bruteForceRank computes the rank of m as the size of its largest
+// square submatrix with a non-zero determinant.
+func bruteForceRank(m Matrix) int {
+	for k := m.Rows(); k > 0; k-- {
+		for _, rows := range subsets(m.Rows(), k) {
+			for _, columns := range subsets(m.Columns(), k) {
+				if laplaceDeterminant(m.SubMatrix(rows, columns)) != 0 {
+					return k
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestMatrixRowsColumns(t *testing.T) {
+	m := NewZeroMatrix(2, 3)
+	require.Equal(t, 2, m.Rows())
+	require.Equal(t, 3, m.Columns())
+}
+
+func TestMatrixSet(t *testing.T) {
+	m := NewMatrixFromSlice(2, 2, []T{1, 2, 3, 4})
+	n := m.Set(1, 0, 5)
+	require.Equal(t, NewMatrixFromSlice(2, 2, []T{1, 2, 5, 4}), n)
+	// m must be unchanged.
+	require.Equal(t, NewMatrixFromSlice(2, 2, []T{1, 2, 3, 4}), m)
+}
+
+func TestMatrixEqual(t *testing.T) {
+	m := NewMatrixFromSlice(2, 2, []T{1, 2, 3, 4})
+	require.True(t, m.Equal(NewMatrixFromSlice(2, 2, []T{1, 2, 3, 4})))
+	require.False(t, m.Equal(m.Set(0, 1, 0)))
+	require.False(t, m.Equal(NewMatrixFromSlice(1, 4, []T{1, 2, 3, 4})))
+}
+
+func TestMatrixString(t *testing.T) {
+	m := NewMatrixFromSlice(2, 3, []T{1, 0x20, 0x300, 0x4000, 0xffff, 0})
+	require.Equal(t, "[0001 0020 0300]\n[4000 ffff 0000]", m.String())
+}
+
+func TestMatrixTranspose(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	m := randomMatrix(rand, 3, 5)
+	mT := m.Transpose()
+	require.Equal(t, 5, mT.Rows())
+	require.Equal(t, 3, mT.Columns())
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 5; j++ {
+			require.Equal(t, m.At(i, j), mT.At(j, i))
+		}
+	}
+	require.Equal(t, m, mT.Transpose())
+}
+
+func TestMatrixSubMatrix(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	m := randomMatrix(rand, 4, 5)
+	rows := []int{3, 0, 3}
+	columns := []int{4, 1}
+	n := m.SubMatrix(rows, columns)
+	require.Equal(t, 3, n.Rows())
+	require.Equal(t, 2, n.Columns())
+	for i, r := range rows {
+		for j, c := range columns {
+			require.Equal(t, m.At(r, c), n.At(i, j))
+		}
+	}
+}
+
+func TestMatrixDeterminant(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for n := 1; n <= 6; n++ {
+		for rank := 0; rank <= n; rank++ {
+			m := randomMatrixWithRank(rand, n, n, rank)
+			expectedDet := laplaceDeterminant(m)
+			require.Equal(t, expectedDet, m.Determinant(), "n=%d, rank=%d", n, rank)
+			if rank < n {
+				require.Equal(t, T(0), expectedDet)
+			}
+		}
+	}
+}
+
+func TestMatrixDeterminantTimes(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	m := randomMatrix(rand, 10, 10)
+	n := randomMatrix(rand, 10, 10)
+	require.Equal(t, m.Determinant().Times(n.Determinant()), m.Times(n).Determinant())
+}
+
+func TestMatrixRank(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for rows := 1; rows <= 4; rows++ {
+		for columns := 1; columns <= 4; columns++ {
+			for rank := 0; rank <= rows && rank <= columns; rank++ {
+				m := randomMatrixWithRank(rand, rows, columns, rank)
+				require.Equal(t, bruteForceRank(m), m.Rank(), "rows=%d, columns=%d, rank=%d", rows, columns, rank)
+				require.Equal(t, m.Rank(), m.Transpose().Rank())
+			}
+		}
+	}
+}
+
+func TestMatrixSolve(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for n := 1; n <= 5; n++ {
+		m := randomMatrix(rand, n, n)
+		b := randomMatrix(rand, n, 2)
+		x, err := m.Solve(b)
+		require.NoError(t, err)
+		require.Equal(t, b, m.Times(x))
+
+		// Check against Cramer's rule, i.e. x[i, k] is the
+		// determinant of m with its ith column replaced by
+		// the kth column of b, divided by that of m.
+		det := laplaceDeterminant(m)
+		for i := 0; i < n; i++ {
+			for k := 0; k < 2; k++ {
+				mi := NewMatrixFromFunction(n, n, func(r, c int) T {
+					if c == i {
+						return b.At(r, k)
+					}
+					return m.At(r, c)
+				})
+				require.Equal(t, laplaceDeterminant(mi).Div(det), x.At(i, k), "n=%d, i=%d, k=%d", n, i, k)
+			}
+		}
+	}
+}
+
+func TestMatrixSolveSingular(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	m := randomMatrixWithRank(rand, 4, 4, 3)
+	_, err := m.Solve(randomMatrix(rand, 4, 1))
+	require.Equal(t, errors.New("singular matrix"), err)
+}
+
+func TestMatrixMulVec(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	m := randomMatrix(rand, 3, 4)
+	in := make([][]byte, 4)
+	for j := range in {
+		in[j] = makeBytes(t, rand, 10)
+	}
+	out := make([][]byte, 3)
+	for i := range out {
+		// MulVec must overwrite out.
+		out[i] = makeBytes(t, rand, 10)
+	}
+
+	m.MulVec(in, out)
+
+	for i := range out {
+		for k := 0; k < 5; k++ {
+			var expected T
+			for j := range in {
+				x := T(in[j][2*k]) | T(in[j][2*k+1])<<8
+				expected ^= m.At(i, j).Times(x)
+			}
+			actual := T(out[i][2*k]) | T(out[i][2*k+1])<<8
+			require.Equal(t, expected, actual, "i=%d, k=%d", i, k)
+		}
+	}
+}
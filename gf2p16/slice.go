@@ -1,7 +1,7 @@
 package gf2p16
 
 func mulByteSliceLEGeneric(c T, in, out []byte) {
-	cEntry := &mulTable[c]
+	cEntry := getMulTableEntry(c)
 	for i := 0; i < len(in); i += 2 {
 		cx := cEntry.s0[in[i]] ^ cEntry.s8[in[i+1]]
 		out[i] = byte(cx)
@@ -10,7 +10,7 @@ func mulByteSliceLEGeneric(c T, in, out []byte) {
 }
 
 func mulAndAddByteSliceLEGeneric(c T, in, out []byte) {
-	cEntry := &mulTable[c]
+	cEntry := getMulTableEntry(c)
 	for i := 0; i < len(in); i += 2 {
 		cx := cEntry.s0[in[i]] ^ cEntry.s8[in[i+1]]
 		out[i] ^= byte(cx)
@@ -20,7 +20,7 @@ func mulAndAddByteSliceLEGeneric(c T, in, out []byte) {
 
 // mulSliceGeneric sets each out[i] to c.Times(in[i]).
 func mulSliceGeneric(c T, in, out []T) {
-	cEntry := &mulTable[c]
+	cEntry := getMulTableEntry(c)
 	for i := 0; i < len(in); i++ {
 		out[i] = cEntry.s0[in[i]&0xff] ^ cEntry.s8[in[i]>>8]
 	}
@@ -28,7 +28,7 @@ func mulSliceGeneric(c T, in, out []T) {
 
 // mulAndAddSliceGeneric adds c.Times(in[i]) to out[i], for each i.
 func mulAndAddSliceGeneric(c T, in, out []T) {
-	cEntry := &mulTable[c]
+	cEntry := getMulTableEntry(c)
 	for i := 0; i < len(in); i++ {
 		out[i] ^= cEntry.s0[in[i]&0xff] ^ cEntry.s8[in[i]>>8]
 	}
@@ -28,13 +28,13 @@ func mulByteSliceLE(c T, in, out []byte, useSSSE3 bool) {
 	}
 	start := 0
 	if useSSSE3 && len(in) >= 32 {
-		mulSliceSSSE3Unsafe(&mulTable64[c], in, out)
+		mulSliceSSSE3Unsafe(getMulTable64Entry(c), in, out)
 		start = len(in) - (len(in) % 32)
 		if start == len(in) {
 			return
 		}
 	}
-	mulByteSliceLEUnsafe(&mulTable[c], in[start:], out[start:])
+	mulByteSliceLEUnsafe(getMulTableEntry(c), in[start:], out[start:])
 }
 
 // MulAndAddByteSliceLE treats in and out as arrays of Ts stored in
@@ -53,13 +53,13 @@ func mulAndAddByteSliceLE(c T, in, out []byte, useSSSE3 bool) {
 	}
 	start := 0
 	if useSSSE3 && len(in) >= 32 {
-		mulAndAddSliceSSSE3Unsafe(&mulTable64[c], in, out)
+		mulAndAddSliceSSSE3Unsafe(getMulTable64Entry(c), in, out)
 		start = len(in) - (len(in) % 32)
 		if start == len(in) {
 			return
 		}
 	}
-	mulAndAddByteSliceLEUnsafe(&mulTable[c], in[start:], out[start:])
+	mulAndAddByteSliceLEUnsafe(getMulTableEntry(c), in[start:], out[start:])
 }
 
 func castTToByteSlice(ts []T) []byte {
@@ -138,7 +138,7 @@ func altToStandardMapSliceSSSE3Unsafe(in, out []byte)
 //
 //   (outHigh[i] << 8) | outLow[i] == c.Times((inHigh[i] << 8) | inLow[i]),
 //
-// where cEntry is &mulTable64[c].
+// where cEntry is getMulTable64Entry(c).
 //
 //go:noescape
 func mulAltMapSSSE3Unsafe(cEntry *mulTable64Entry, inLow, inHigh, outLow, outHigh *[16]byte)
@@ -162,7 +162,7 @@ func mulSliceAltMapSSSE3Unsafe(cEntry *mulTable64Entry, in, out []byte)
 //   out0[2*i] | (out0[2*i+1] << 8) == c.Times(in0[2*i] | in0[2*i+1] << 8)
 //   out1[2*i] | (out1[2*i+1] << 8) == c.Times(in1[2*i] | in1[2*i+1] << 8),
 //
-// where cEntry is &mulTable64[c].
+// where cEntry is getMulTable64Entry(c).
 //
 //go:noescape
 func mulSSSE3Unsafe(cEntry *mulTable64Entry, in0, in1, out0, out1 *[16]byte)
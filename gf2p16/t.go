@@ -1,6 +1,10 @@
 package gf2p16
 
-import "github.com/akalin/gopar/gf2"
+import (
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
 
 // T is an element of GF(2^16).
 type T uint16
@@ -17,54 +21,69 @@ func (t T) Minus(u T) T {
 	return t ^ u
 }
 
+//go:generate go run gen_tables.go
+
 const order = 1 << 16
 
-var logTable [order - 1]uint16
-var expTable [order - 1]T
+// The log and exp tables are in the generated file tables.go.
 
+// A mulTableEntry holds the products of some c with all the Ts with
+// only their low byte or only their high byte set, so that c times x
+// is s0[x&0xff] ^ s8[x>>8].
 type mulTableEntry struct {
 	s0, s8 [1 << 8]T
 }
 
-var mulTable [1 << 16]mulTableEntry
-
-func init() {
-	// TODO: Generate tables at compile time.
-
-	// m is the irreducible polynomial of degree 16 used to model
-	// GF(2^16). m was chosen to match the PAR2 spec.
-	const m gf2.Poly64 = 0x1100b
-
-	// g is a generator of GF(2^16).
-	const g T = 3
-
-	x := T(1)
-	for p := 0; p < order-1; p++ {
-		if x == 1 && p != 0 {
-			panic("repeated power (1)")
-		} else if x != 1 && logTable[x-1] != 0 {
-			panic("repeated power")
-		}
-		if expTable[p] != 0 {
-			panic("repeated exponent")
-		}
+// mulTable[c] points to the mulTableEntry for c, or is nil if it
+// hasn't been needed yet. Since the full table would take 64 MiB,
+// entries are only built for coefficients that are actually used;
+// use getMulTableEntry to access it.
+var mulTable [1 << 16]unsafe.Pointer
+
+func newMulTableEntry(c T) *mulTableEntry {
+	// Since multiplication by c is linear, fill in each table
+	// from the products of c with powers of 2.
+	var powerProducts [16]T
+	for k := range powerProducts {
+		powerProducts[k] = c.Times(T(1 << k))
+	}
+	var e mulTableEntry
+	for j := 1; j < len(e.s0); j++ {
+		k := bits.TrailingZeros(uint(j))
+		e.s0[j] = e.s0[j&(j-1)] ^ powerProducts[k]
+		e.s8[j] = e.s8[j&(j-1)] ^ powerProducts[8+k]
+	}
+	return &e
+}
 
-		logTable[x-1] = uint16(p)
-		expTable[p] = x
-		_, r := gf2.Poly64(x).Times(gf2.Poly64(g)).Div(m)
-		x = T(r)
+// getMulTableEntry returns the mulTableEntry for c, building it if
+// necessary.
+func getMulTableEntry(c T) *mulTableEntry {
+	if p := atomic.LoadPointer(&mulTable[c]); p != nil {
+		return (*mulTableEntry)(p)
 	}
+	// If multiple goroutines build the entry at the same time,
+	// they all build the same thing, so it doesn't matter which
+	// one wins.
+	e := newMulTableEntry(c)
+	atomic.StorePointer(&mulTable[c], unsafe.Pointer(e))
+	return e
+}
 
-	// Since we've filled in logTable and expTable, we can use
-	// T.Times below.
-	for i := 0; i < len(mulTable); i++ {
-		for j := 0; j < len(mulTable[i].s0); j++ {
-			mulTable[i].s0[j] = T(i).Times(T(j))
-			mulTable[i].s8[j] = T(i).Times(T(j << 8))
-		}
+// Log returns the discrete log of t with respect to 3, which
+// generates the multiplicative group of GF(2^16). It panics if
+// t == 0.
+func (t T) Log() uint16 {
+	if t == 0 {
+		panic("zero has no log")
 	}
+	return logTable[t-1]
+}
 
-	platformInit()
+// Exp returns 3^p as an element of GF(2^16). Since 3 has order
+// 65535, p is taken mod 65535.
+func Exp(p uint32) T {
+	return expTable[p%(order-1)]
 }
 
 // Times returns the product of t and u as elements of GF(2^16).
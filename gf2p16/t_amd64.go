@@ -1,30 +1,52 @@
 package gf2p16
 
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A mulTable64Entry holds the products of some c with all the Ts with
+// only a single nibble set, split into low and high bytes, for use
+// with PSHUFB.
 type mulTable64Entry struct {
 	s0Low, s4Low, s8Low, s12Low     [1 << 4]byte
 	s0High, s4High, s8High, s12High [1 << 4]byte
 }
 
-var mulTable64 [1 << 16]mulTable64Entry
+// mulTable64[c] points to the mulTable64Entry for c, or is nil if it
+// hasn't been needed yet; use getMulTable64Entry to access it.
+var mulTable64 [1 << 16]unsafe.Pointer
+
+func newMulTable64Entry(c T) *mulTable64Entry {
+	cEntry := getMulTableEntry(c)
+	var e mulTable64Entry
+	for j := 0; j < len(e.s0Low); j++ {
+		t0 := cEntry.s0[j]
+		e.s0Low[j] = byte(t0)
+		e.s0High[j] = byte(t0 >> 8)
 
-func platformInit() {
-	for i := 0; i < len(mulTable64); i++ {
-		for j := 0; j < len(mulTable64[i].s0Low); j++ {
-			t0 := T(i).Times(T(j))
-			mulTable64[i].s0Low[j] = byte(t0)
-			mulTable64[i].s0High[j] = byte(t0 >> 8)
+		t1 := cEntry.s0[j<<4]
+		e.s4Low[j] = byte(t1)
+		e.s4High[j] = byte(t1 >> 8)
 
-			t1 := T(i).Times(T(j << 4))
-			mulTable64[i].s4Low[j] = byte(t1)
-			mulTable64[i].s4High[j] = byte(t1 >> 8)
+		t2 := cEntry.s8[j]
+		e.s8Low[j] = byte(t2)
+		e.s8High[j] = byte(t2 >> 8)
 
-			t2 := T(i).Times(T(j << 8))
-			mulTable64[i].s8Low[j] = byte(t2)
-			mulTable64[i].s8High[j] = byte(t2 >> 8)
+		t3 := cEntry.s8[j<<4]
+		e.s12Low[j] = byte(t3)
+		e.s12High[j] = byte(t3 >> 8)
+	}
+	return &e
+}
 
-			t3 := T(i).Times(T(j << 12))
-			mulTable64[i].s12Low[j] = byte(t3)
-			mulTable64[i].s12High[j] = byte(t3 >> 8)
-		}
+// getMulTable64Entry returns the mulTable64Entry for c, building it
+// if necessary.
+func getMulTable64Entry(c T) *mulTable64Entry {
+	if p := atomic.LoadPointer(&mulTable64[c]); p != nil {
+		return (*mulTable64Entry)(p)
 	}
+	e := newMulTable64Entry(c)
+	atomic.StorePointer(&mulTable64[c], unsafe.Pointer(e))
+	return e
 }
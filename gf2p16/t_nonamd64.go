@@ -1,5 +0,0 @@
-// +build !amd64
-
-package gf2p16
-
-func platformInit() {}
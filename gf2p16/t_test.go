@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/akalin/gopar/gf2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -87,6 +88,40 @@ func TestPowLarge(t *testing.T) {
 	}
 }
 
+func TestTables(t *testing.T) {
+	// Recompute the generated tables, to make sure that tables.go
+	// is up to date.
+	const m gf2.Poly64 = 0x1100b
+	require.True(t, m.Irreducible())
+	require.True(t, gf2.Poly64(3).GeneratesMod(m))
+	x := gf2.Poly64(1)
+	for p := 0; p < order-1; p++ {
+		require.Equal(t, T(x), expTable[p])
+		require.Equal(t, uint16(p), logTable[x-1])
+		_, x = x.Times(3).Div(m)
+	}
+}
+
+func TestLogExp(t *testing.T) {
+	for i := 1; i < (1 << 16); i++ {
+		x := T(i)
+		require.Equal(t, x, Exp(uint32(x.Log())), "x=%d", x)
+		require.Equal(t, x, Exp(uint32(x.Log())+order-1), "x=%d", x)
+	}
+	require.Equal(t, T(3).Pow(1000), Exp(1000))
+	require.Panics(t, func() { T(0).Log() })
+}
+
+func TestNewMulTableEntry(t *testing.T) {
+	for _, c := range []T{0, 1, 2, 0x1234, 0xffff} {
+		cEntry := newMulTableEntry(c)
+		for j := 0; j < 1<<8; j++ {
+			require.Equal(t, c.Times(T(j)), cEntry.s0[j])
+			require.Equal(t, c.Times(T(j<<8)), cEntry.s8[j])
+		}
+	}
+}
+
 func TestMulTable(t *testing.T) {
 	rand := rand.New(rand.NewSource(1))
 
@@ -94,7 +129,7 @@ func TestMulTable(t *testing.T) {
 	c := T(rand.Int())
 	expectedCX := c.Times(x)
 
-	cEntry := &mulTable[c]
+	cEntry := getMulTableEntry(c)
 	cx := cEntry.s0[x&0xff] ^ cEntry.s8[(x>>8)&0xff]
 
 	require.Equal(t, expectedCX, cx)
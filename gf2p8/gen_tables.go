@@ -0,0 +1,79 @@
+//go:build ignore
+// +build ignore
+
+// This program generates tables.go, which holds the log and exp
+// tables for GF(2^8). Run it with go generate.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+
+	"github.com/akalin/gopar/gf2"
+)
+
+const order = 1 << 8
+
+func writeTable(buf *bytes.Buffer, name, elementType, comment string, table []uint8) {
+	fmt.Fprintf(buf, "\n%s\nvar %s = [order - 1]%s{\n", comment, name, elementType)
+	for i := 0; i < len(table); i += 16 {
+		buf.WriteString("\t")
+		for j := i; j < i+16 && j < len(table); j++ {
+			fmt.Fprintf(buf, "0x%02x, ", table[j])
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+}
+
+func main() {
+	// m is the irreducible polynomial of degree 8 used to model
+	// GF(2^8). m was chosen to match the PAR1 spec.
+	const m gf2.Poly64 = 0x11d
+
+	// g is a generator of GF(2^8).
+	const g gf2.Poly64 = 2
+
+	// Check that m and g are what they claim to be, so that the
+	// loop below visits every non-zero element exactly once.
+	if m.Degree() != 8 || !m.Irreducible() {
+		panic("m is not an irreducible polynomial of degree 8")
+	}
+	if !g.GeneratesMod(m) {
+		panic("g is not a generator")
+	}
+
+	var logTable, expTable [order - 1]uint8
+	x := gf2.Poly64(1)
+	for p := 0; p < order-1; p++ {
+		if x == 1 && p != 0 {
+			panic("repeated power (1)")
+		} else if x != 1 && logTable[x-1] != 0 {
+			panic("repeated power")
+		}
+		if expTable[p] != 0 {
+			panic("repeated exponent")
+		}
+
+		logTable[x-1] = uint8(p)
+		expTable[p] = uint8(x)
+		_, x = x.Times(g).Div(m)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen_tables.go; DO NOT EDIT.\n\npackage gf2p8\n")
+	writeTable(&buf, "logTable", "uint8", "// logTable[x-1] is the discrete log of x with respect to 2.", logTable[:])
+	writeTable(&buf, "expTable", "T", "// expTable[p] is 2^p.", expTable[:])
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile("tables.go", src, 0644)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,318 @@
+package gf2p8
+
+import (
+	"errors"
+	"sync"
+)
+
+// Matrix is an immutable rectangular array of elements of
+// GF(2^8). It has just enough methods to support Reed-Solomon
+// erasure codes.
+type Matrix struct {
+	rows, columns int
+	// Elements are stored in row-major order.
+	elements []T
+}
+
+func checkRowColumnCount(rows, columns int) {
+	if rows <= 0 {
+		panic("invalid row count")
+	}
+	if columns <= 0 {
+		panic("invalid column count")
+	}
+}
+
+// NewZeroMatrix returns a rows x columns matrix with every element
+// being zero.
+func NewZeroMatrix(rows, columns int) Matrix {
+	checkRowColumnCount(rows, columns)
+	return Matrix{rows, columns, make([]T, rows*columns)}
+}
+
+// NewMatrixFromSlice returns a rows x columns matrix with elements
+// taken from the given array in row-major order.
+func NewMatrixFromSlice(rows, columns int, elements []T) Matrix {
+	checkRowColumnCount(rows, columns)
+	if len(elements) != rows*columns {
+		panic("element count is not rows*columns")
+	}
+	elementsCopy := make([]T, len(elements))
+	copy(elementsCopy, elements)
+	return Matrix{rows, columns, elementsCopy}
+}
+
+// NewMatrixFromFunction returns a rows x columns matrix with elements
+// filled in from the given function, which is passed the row index
+// and the column index, and shouldn't rely on any particular call
+// ordering.
+func NewMatrixFromFunction(rows, columns int, fn func(int, int) T) Matrix {
+	checkRowColumnCount(rows, columns)
+	elements := make([]T, rows*columns)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < columns; j++ {
+			elements[i*columns+j] = fn(i, j)
+		}
+	}
+	return Matrix{rows, columns, elements}
+}
+
+// NewIdentityMatrix returns an n x n identity matrix.
+func NewIdentityMatrix(n int) Matrix {
+	return NewMatrixFromFunction(n, n, func(i, j int) T {
+		if i == j {
+			return 1
+		}
+		return 0
+	})
+}
+
+func (m Matrix) checkRowIndex(i int) {
+	if i < 0 || i >= m.rows {
+		panic("row index out of bounds")
+	}
+}
+
+func (m Matrix) checkColumnIndex(i int) {
+	if i < 0 || i >= m.columns {
+		panic("column index out of bounds")
+	}
+}
+
+// At returns the element at row index i and column index j.
+func (m Matrix) At(i, j int) T {
+	m.checkRowIndex(i)
+	m.checkColumnIndex(j)
+	return m.elements[i*m.columns+j]
+}
+
+// Times returns the matrix product of m with n, which must have
+// compatible dimensions.
+func (m Matrix) Times(n Matrix) Matrix {
+	if m.columns != n.rows {
+		panic("mismatched dimensions")
+	}
+
+	// Compute each row of the product as a linear combination of
+	// the rows of n, which uses the vectorized slice functions.
+	p := NewZeroMatrix(m.rows, n.columns)
+	for i := 0; i < m.rows; i++ {
+		rowP := p.row(i)
+		for k, c := range m.row(i) {
+			if c != 0 {
+				mulAndAddSlice(c, n.row(k), rowP)
+			}
+		}
+	}
+	return p
+}
+
+// row returns a slice into m.elements, so caller must not mutate
+// except for local temporary arrays.
+func (m Matrix) row(i int) []T {
+	m.checkRowIndex(i)
+	return m.elements[i*m.columns : (i+1)*m.columns]
+}
+
+func (m Matrix) clone() Matrix {
+	return NewMatrixFromSlice(m.rows, m.columns, m.elements)
+}
+
+// The mutating functions below must not be called except on local
+// temporary arrays.
+
+func (m Matrix) swapRows(i, j int) {
+	m.checkRowIndex(i)
+	m.checkRowIndex(j)
+
+	if i == j {
+		return
+	}
+
+	rowI := m.row(i)
+	rowJ := m.row(j)
+	for k := 0; k < m.columns; k++ {
+		rowI[k], rowJ[k] = rowJ[k], rowI[k]
+	}
+}
+
+func (m Matrix) scaleRow(i int, c T) {
+	row := m.row(i)
+	mulSlice(c, row, row)
+}
+
+func (m Matrix) addScaledRow(dest, src int, c T) {
+	rowSrc := m.row(src)
+	rowDest := m.row(dest)
+	mulAndAddSlice(c, rowSrc, rowDest)
+}
+
+// rowReduceBlockSize is the number of pivots that rowReduceForInverse
+// finds before updating the rest of the rows.
+const rowReduceBlockSize = 32
+
+// runParallel calls fn on consecutive subranges [start, end) of [0,
+// count), with up to numGoroutines goroutines.
+func runParallel(count, numGoroutines int, fn func(start, end int)) {
+	if numGoroutines < 1 {
+		panic("invalid numGoroutines value")
+	}
+	if numGoroutines > count {
+		numGoroutines = count
+	}
+	if numGoroutines <= 1 {
+		fn(0, count)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			fn(i*count/numGoroutines, (i+1)*count/numGoroutines)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// reduceRow zeroes out the columns [start, end) of the ith row of m
+// by subtracting multiples of the rows [start, end) of m, which must
+// be zero in the columns [0, start), and must be the identity in the
+// columns [start, end). The same row operations are applied to n.
+func reduceRow(m, n Matrix, i, start, end int) {
+	rowM := m.row(i)
+	rowN := n.row(i)
+	for k := start; k < end; k++ {
+		// Since the kth row is zero in the other columns in
+		// [start, end), subtracting multiples of it doesn't
+		// change the elements of the ith row that are yet to be
+		// zeroed out.
+		c := rowM[k]
+		if c != 0 {
+			mulAndAddSlice(c, m.row(k)[start:], rowM[start:])
+			mulAndAddSlice(c, n.row(k), rowN)
+		}
+	}
+}
+
+func (m Matrix) rowReduceForInverse(n Matrix, numGoroutines int) error {
+	// This is Gauss-Jordan elimination, except that pivots are
+	// found a block at a time, and the other rows are only reduced
+	// by the pivot rows of a block once the block is done, which
+	// can be done in parallel.
+	for start := 0; start < m.rows; start += rowReduceBlockSize {
+		end := start + rowReduceBlockSize
+		if end > m.rows {
+			end = m.rows
+		}
+
+		// Make the rows [start, end) pivot rows, i.e. the
+		// identity in the columns [start, end).
+		for i := start; i < end; i++ {
+			// Swap the ith row with the first row with a
+			// non-zero ith column once reduced by the
+			// pivot rows found so far.
+			found := false
+			for j := i; j < m.rows; j++ {
+				t := m.At(j, i)
+				for k := start; k < i; k++ {
+					t ^= m.At(j, k).Times(m.At(k, i))
+				}
+				if t != 0 {
+					m.swapRows(i, j)
+					n.swapRows(i, j)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.New("singular matrix")
+			}
+
+			reduceRow(m, n, i, start, i)
+
+			// Scale the ith row to have 1 as the pivot.
+			pivotInv := m.At(i, i).Inverse()
+			mulSlice(pivotInv, m.row(i)[start:], m.row(i)[start:])
+			n.scaleRow(i, pivotInv)
+
+			// Zero out the ith column of the previous pivot
+			// rows.
+			for j := start; j < i; j++ {
+				t := m.At(j, i)
+				if t != 0 {
+					mulAndAddSlice(t, m.row(i)[start:], m.row(j)[start:])
+					n.addScaledRow(j, i, t)
+				}
+			}
+		}
+
+		// Zero out the columns [start, end) of all the other
+		// rows.
+		otherRowCount := m.rows - (end - start)
+		runParallel(otherRowCount, numGoroutines, func(otherStart, otherEnd int) {
+			for j := otherStart; j < otherEnd; j++ {
+				i := j
+				if i >= start {
+					i += end - start
+				}
+				reduceRow(m, n, i, start, end)
+			}
+		})
+	}
+
+	return nil
+}
+
+// Inverse returns the matrix inverse of m, which must be square, or
+// an error if it is singular.
+func (m Matrix) Inverse() (Matrix, error) {
+	if m.rows != m.columns {
+		panic("cannot invert non-square matrix")
+	}
+	mInv := NewIdentityMatrix(m.columns)
+	err := m.clone().rowReduceForInverse(mInv, 1)
+	if err != nil {
+		return Matrix{}, err
+	}
+
+	return mInv, nil
+}
+
+// RowReduceForInverse runs row reduction on copies of m, which must
+// be square, and n, which must have the same number of rows as m. The
+// row-reduced copy of n is returned if m is non-singular; otherwise,
+// an empty matrix and an error is returned.
+//
+// Note that if n is the identity matrix, then the inverse of m is
+// returned. This is the special case of the following fact: if n is
+// equal to some matrix ( n_L | I ), where I is the
+// appropriately-sized identity matrix and | denotes horizontal
+// augmentation, then if the returned matrix is n', the matrix
+// ( I / n' ) is the inverse of ( I / n_L | 0 / m ), where / denotes
+// vertical augmentation.
+func (m Matrix) RowReduceForInverse(n Matrix) (Matrix, error) {
+	return m.RowReduceForInverseParallel(n, 1)
+}
+
+// RowReduceForInverseParallel is like RowReduceForInverse, except
+// that it uses up to numGoroutines goroutines.
+func (m Matrix) RowReduceForInverseParallel(n Matrix, numGoroutines int) (Matrix, error) {
+	if m.rows != m.columns {
+		panic("cannot row-reduce non-square matrix")
+	}
+	if n.rows != m.rows {
+		panic("n must have the same number of rows as m")
+	}
+	if numGoroutines <= 0 {
+		panic("invalid goroutine count")
+	}
+	nReduced := n.clone()
+	err := m.clone().rowReduceForInverse(nReduced, numGoroutines)
+	if err != nil {
+		return Matrix{}, err
+	}
+
+	return nReduced, nil
+}
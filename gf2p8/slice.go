@@ -0,0 +1,25 @@
+package gf2p8
+
+func mulByteSliceGeneric(c T, in, out []byte) {
+	cEntry := getMulTableEntry(c)
+	for i, x := range in {
+		out[i] = byte(cEntry[x])
+	}
+}
+
+func mulAndAddByteSliceGeneric(c T, in, out []byte) {
+	cEntry := getMulTableEntry(c)
+	for i, x := range in {
+		out[i] ^= byte(cEntry[x])
+	}
+}
+
+// mulSlice sets each out[i] to c.Times(in[i]).
+func mulSlice(c T, in, out []T) {
+	MulByteSlice(c, castTToByteSlice(in), castTToByteSlice(out))
+}
+
+// mulAndAddSlice adds c.Times(in[i]) to out[i], for each i.
+func mulAndAddSlice(c T, in, out []T) {
+	MulAndAddByteSlice(c, castTToByteSlice(in), castTToByteSlice(out))
+}
@@ -0,0 +1,62 @@
+package gf2p8
+
+import (
+	"github.com/klauspost/cpuid/v2"
+)
+
+var hasSSSE3 bool
+
+func init() {
+	hasSSSE3 = cpuid.CPU.Supports(cpuid.SSSE3)
+}
+
+// MulByteSlice treats in and out as arrays of Ts, and sets each
+// out[i] to c.Times(in[i]).
+func MulByteSlice(c T, in, out []byte) {
+	mulByteSlice(c, in, out, hasSSSE3)
+}
+
+func mulByteSlice(c T, in, out []byte, useSSSE3 bool) {
+	if len(out) != len(in) {
+		panic("size mismatch")
+	}
+	start := 0
+	if useSSSE3 && len(in) >= 16 {
+		mulSliceSSSE3Unsafe(getMulTable16Entry(c), in, out)
+		start = len(in) - (len(in) % 16)
+	}
+	mulByteSliceGeneric(c, in[start:], out[start:])
+}
+
+// MulAndAddByteSlice treats in and out as arrays of Ts, and adds
+// c.Times(in[i]) to out[i], for each i.
+func MulAndAddByteSlice(c T, in, out []byte) {
+	mulAndAddByteSlice(c, in, out, hasSSSE3)
+}
+
+func mulAndAddByteSlice(c T, in, out []byte, useSSSE3 bool) {
+	if len(out) != len(in) {
+		panic("size mismatch")
+	}
+	start := 0
+	if useSSSE3 && len(in) >= 16 {
+		mulAndAddSliceSSSE3Unsafe(getMulTable16Entry(c), in, out)
+		start = len(in) - (len(in) % 16)
+	}
+	mulAndAddByteSliceGeneric(c, in[start:], out[start:])
+}
+
+// mulSliceSSSE3Unsafe sets out[i] to c.Times(in[i]) for each i less
+// than len(in) rounded down to a multiple of 16, where cEntry is
+// getMulTable16Entry(c).
+//
+// in and out must have the same length, which must be at least 16.
+//
+//go:noescape
+func mulSliceSSSE3Unsafe(cEntry *mulTable16Entry, in, out []byte)
+
+// mulAndAddSliceSSSE3Unsafe is like mulSliceSSSE3Unsafe, except it
+// adds (i.e., xors) to out instead of setting out.
+//
+//go:noescape
+func mulAndAddSliceSSSE3Unsafe(cEntry *mulTable16Entry, in, out []byte)
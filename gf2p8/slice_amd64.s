@@ -0,0 +1,104 @@
+#include "textflag.h"
+
+// All 128-bit words are written in big-endian form below.
+
+// Sets out = 0f0f0f0f:0f0f0f0f:0f0f0f0f:0f0f0f0f, clobbering tmp and
+// tmpx. out and tmpx should be 128-bit registers, i.e. beginning with X,
+// and tmp should be a general purpose register, e.g. AX, BX.
+#define SET_MUL_MASK_SSSE3(out, tmp, tmpx) \
+	MOVQ   $0xf, tmp  \
+	MOVQ   tmp, out   \
+	PXOR   tmpx, tmpx \
+	PSHUFB tmpx, out
+
+// All arguments should be 128-bit registers, i.e. beginning with X.
+// mulMask should be set to 0f0f0f0f:0f0f0f0f:0f0f0f0f:0f0f0f0f.
+//
+// Letting a[i] mean the ith byte of a, for each i, sets
+//
+//   out[i] = s0[in[i] & 0f] ^ s4[(in[i] >> 4) & 0f],
+//
+// and clobbers in and tmp.
+#define MUL_SSSE3(s0, s4, in, mulMask, out, tmp) \
+	MOVO   in, tmp      \
+	PAND   mulMask, tmp \
+	MOVO   s0, out      \
+	PSHUFB tmp, out     \
+	                    \
+	PSRLW  $4, in       \
+	PAND   mulMask, in  \
+	MOVO   s4, tmp      \
+	PSHUFB in, tmp      \
+	PXOR   tmp, out
+
+// func mulSliceSSSE3Unsafe(cEntry *mulTable16Entry, in, out []byte)
+TEXT ·mulSliceSSSE3Unsafe(SB), NOSPLIT, $0
+	// Set X8, X9 to input tables.
+	MOVQ  cEntry+0(FP), AX
+	MOVOU (AX), X8         // X8 = cEntry.s0
+	MOVOU 16(AX), X9       // X9 = cEntry.s4
+
+	SET_MUL_MASK_SSSE3(X7, AX, X2)
+
+	// AX = len(in)/16
+	MOVQ in_len+16(FP), AX
+	SHRQ $4, AX
+
+	// BX, CX = inChunk, outChunk = in, out
+	MOVQ in+8(FP), BX
+	MOVQ out+32(FP), CX
+
+loop:
+	// X0 = inChunk[0:16]
+	MOVOU (BX), X0
+
+	MUL_SSSE3(X8, X9, X0, X7, X1, X2)
+
+	// outChunk[0:16] = X1
+	MOVOU X1, (CX)
+
+	// inChunk += 16, outChunk += 16
+	ADDQ $16, BX
+	ADDQ $16, CX
+
+	SUBQ $1, AX
+	JNZ  loop
+
+	RET
+
+// func mulAndAddSliceSSSE3Unsafe(cEntry *mulTable16Entry, in, out []byte)
+TEXT ·mulAndAddSliceSSSE3Unsafe(SB), NOSPLIT, $0
+	// Set X8, X9 to input tables.
+	MOVQ  cEntry+0(FP), AX
+	MOVOU (AX), X8         // X8 = cEntry.s0
+	MOVOU 16(AX), X9       // X9 = cEntry.s4
+
+	SET_MUL_MASK_SSSE3(X7, AX, X2)
+
+	// AX = len(in)/16
+	MOVQ in_len+16(FP), AX
+	SHRQ $4, AX
+
+	// BX, CX = inChunk, outChunk = in, out
+	MOVQ in+8(FP), BX
+	MOVQ out+32(FP), CX
+
+loop:
+	// X0 = inChunk[0:16]
+	MOVOU (BX), X0
+
+	MUL_SSSE3(X8, X9, X0, X7, X1, X2)
+
+	// outChunk[0:16] ^= X1
+	MOVOU (CX), X2
+	PXOR  X2, X1
+	MOVOU X1, (CX)
+
+	// inChunk += 16, outChunk += 16
+	ADDQ $16, BX
+	ADDQ $16, CX
+
+	SUBQ $1, AX
+	JNZ  loop
+
+	RET
@@ -0,0 +1,77 @@
+package gf2p8
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func skipNonSSSE3(t *testing.T) {
+	if !hasSSSE3 {
+		t.Skip("SSSE3 not supported; skipping")
+	}
+}
+
+func TestMulByteSliceNoSSSE3(t *testing.T) {
+	skipNonSSSE3(t)
+
+	testMulByteSlice(t, 100, func(c T, in, out []byte) {
+		mulByteSlice(c, in, out, false)
+	})
+}
+
+func TestMulAndAddByteSliceNoSSSE3(t *testing.T) {
+	skipNonSSSE3(t)
+
+	testMulAndAddByteSlice(t, 100, func(c T, in, out []byte) {
+		mulAndAddByteSlice(c, in, out, false)
+	})
+}
+
+func fill(bs []byte, b byte) {
+	for i := range bs {
+		bs[i] = b
+	}
+}
+
+func TestMulSliceSSSE3Unsafe(t *testing.T) {
+	skipNonSSSE3(t)
+
+	rand := rand.New(rand.NewSource(1))
+
+	c := T(rand.Int())
+
+	// Only the first 16*10 bytes should be touched.
+	in := makeBytes(t, rand, 16*10+15)
+	out := make([]byte, len(in))
+	expectedOut := make([]byte, len(in))
+	fill(out, 0xdb)
+	fill(expectedOut, 0xdb)
+
+	mulByteSliceGeneric(c, in[:16*10], expectedOut[:16*10])
+
+	mulSliceSSSE3Unsafe(getMulTable16Entry(c), in, out)
+
+	require.Equal(t, expectedOut, out)
+}
+
+func TestMulAndAddSliceSSSE3Unsafe(t *testing.T) {
+	skipNonSSSE3(t)
+
+	rand := rand.New(rand.NewSource(1))
+
+	c := T(rand.Int())
+
+	// Only the first 16*10 bytes should be touched.
+	in := makeBytes(t, rand, 16*10+15)
+	out := makeBytes(t, rand, len(in))
+	expectedOut := make([]byte, len(out))
+	copy(expectedOut, out)
+
+	mulAndAddByteSliceGeneric(c, in[:16*10], expectedOut[:16*10])
+
+	mulAndAddSliceSSSE3Unsafe(getMulTable16Entry(c), in, out)
+
+	require.Equal(t, expectedOut, out)
+}
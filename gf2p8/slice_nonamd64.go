@@ -0,0 +1,22 @@
+//go:build !amd64
+// +build !amd64
+
+package gf2p8
+
+// MulByteSlice treats in and out as arrays of Ts, and sets each
+// out[i] to c.Times(in[i]).
+func MulByteSlice(c T, in, out []byte) {
+	if len(out) != len(in) {
+		panic("size mismatch")
+	}
+	mulByteSliceGeneric(c, in, out)
+}
+
+// MulAndAddByteSlice treats in and out as arrays of Ts, and adds
+// c.Times(in[i]) to out[i], for each i.
+func MulAndAddByteSlice(c T, in, out []byte) {
+	if len(out) != len(in) {
+		panic("size mismatch")
+	}
+	mulAndAddByteSliceGeneric(c, in, out)
+}
@@ -0,0 +1,116 @@
+package gf2p8
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeBytes(tb testing.TB, rand *rand.Rand, byteCount int) []byte {
+	bs := make([]byte, byteCount)
+	n, err := rand.Read(bs)
+	require.NoError(tb, err)
+	require.Equal(tb, byteCount, n)
+	return bs
+}
+
+func mulAndAddByteSliceReference(c T, in, out []byte) {
+	for i, x := range in {
+		out[i] ^= byte(c.Times(T(x)))
+	}
+}
+
+func testMulByteSlice(t *testing.T, byteCount int, mulFn func(T, []byte, []byte)) {
+	rand := rand.New(rand.NewSource(1))
+
+	in := makeBytes(t, rand, byteCount)
+	out := make([]byte, len(in)+1)
+	out[len(in)] = 0xff
+	c := T(0x3)
+
+	expectedOut := make([]byte, len(in))
+	mulAndAddByteSliceReference(c, in, expectedOut)
+
+	mulFn(c, in, out[:len(in)])
+
+	require.Equal(t, expectedOut, out[:len(in)])
+	require.Equal(t, byte(0xff), out[len(in)])
+}
+
+func TestMulByteSlice(t *testing.T) {
+	for _, byteCount := range []int{0, 10, 16, 100, 1000} {
+		t.Run(fmt.Sprintf("generic-%d", byteCount), func(t *testing.T) {
+			testMulByteSlice(t, byteCount, mulByteSliceGeneric)
+		})
+		t.Run(fmt.Sprintf("exported-%d", byteCount), func(t *testing.T) {
+			testMulByteSlice(t, byteCount, MulByteSlice)
+		})
+	}
+}
+
+func testMulAndAddByteSlice(t *testing.T, byteCount int, mulAndAddFn func(T, []byte, []byte)) {
+	rand := rand.New(rand.NewSource(1))
+
+	in := makeBytes(t, rand, byteCount)
+	out := makeBytes(t, rand, byteCount)
+	c := T(0x3)
+
+	expectedOut := make([]byte, len(out))
+	copy(expectedOut, out)
+	mulAndAddByteSliceReference(c, in, expectedOut)
+
+	mulAndAddFn(c, in, out)
+
+	require.Equal(t, expectedOut, out)
+}
+
+func TestMulAndAddByteSlice(t *testing.T) {
+	for _, byteCount := range []int{0, 10, 16, 100, 1000} {
+		t.Run(fmt.Sprintf("generic-%d", byteCount), func(t *testing.T) {
+			testMulAndAddByteSlice(t, byteCount, mulAndAddByteSliceGeneric)
+		})
+		t.Run(fmt.Sprintf("exported-%d", byteCount), func(t *testing.T) {
+			testMulAndAddByteSlice(t, byteCount, MulAndAddByteSlice)
+		})
+	}
+}
+
+func runMulBenchmark(b *testing.B, fn func(*testing.B, int)) {
+	for _, byteCount := range []int{128, 1024, 128 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("%d", byteCount), func(b *testing.B) {
+			fn(b, byteCount)
+		})
+	}
+}
+
+func BenchmarkMulByteSlice(b *testing.B) {
+	runMulBenchmark(b, func(b *testing.B, byteCount int) {
+		rand := rand.New(rand.NewSource(1))
+		in := makeBytes(b, rand, byteCount)
+		out := make([]byte, byteCount)
+		c := T(rand.Int())
+
+		b.SetBytes(int64(byteCount))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			MulByteSlice(c, in, out)
+		}
+	})
+}
+
+func BenchmarkMulAndAddByteSlice(b *testing.B) {
+	runMulBenchmark(b, func(b *testing.B, byteCount int) {
+		rand := rand.New(rand.NewSource(1))
+		in := makeBytes(b, rand, byteCount)
+		out := make([]byte, byteCount)
+		c := T(rand.Int())
+
+		b.SetBytes(int64(byteCount))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			MulAndAddByteSlice(c, in, out)
+		}
+	})
+}
@@ -0,0 +1,20 @@
+package gf2p8
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// castTToByteSlice returns a byte slice sharing memory with ts, which
+// is safe since T has the same size and alignment as byte.
+func castTToByteSlice(ts []T) []byte {
+	tsHdr := (*reflect.SliceHeader)(unsafe.Pointer(&ts))
+	p := unsafe.Pointer(tsHdr.Data)
+
+	var bs []byte
+	bsHdr := (*reflect.SliceHeader)(unsafe.Pointer(&bs))
+	bsHdr.Data = uintptr(p)
+	bsHdr.Len = tsHdr.Len
+	bsHdr.Cap = tsHdr.Cap
+	return bs
+}
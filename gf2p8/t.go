@@ -0,0 +1,107 @@
+package gf2p8
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// T is an element of GF(2^8).
+type T uint8
+
+// Plus returns the sum of t and u as elements of GF(2^8), which is
+// just the bitwise xor of the two.
+func (t T) Plus(u T) T {
+	return t ^ u
+}
+
+// Minus returns the difference of t and u as elements of GF(2^8),
+// which is just the bitwise xor of the two.
+func (t T) Minus(u T) T {
+	return t ^ u
+}
+
+//go:generate go run gen_tables.go
+
+const order = 1 << 8
+
+// The log and exp tables are in the generated file tables.go.
+
+// A mulTableEntry holds the products of some c with all the Ts, so
+// that c times x is just a lookup.
+type mulTableEntry [order]T
+
+// mulTable[c] points to the mulTableEntry for c, or is nil if it
+// hasn't been needed yet; use getMulTableEntry to access it.
+var mulTable [order]unsafe.Pointer
+
+func newMulTableEntry(c T) *mulTableEntry {
+	var e mulTableEntry
+	for x := range e {
+		e[x] = c.Times(T(x))
+	}
+	return &e
+}
+
+// getMulTableEntry returns the mulTableEntry for c, building it if
+// necessary.
+func getMulTableEntry(c T) *mulTableEntry {
+	if p := atomic.LoadPointer(&mulTable[c]); p != nil {
+		return (*mulTableEntry)(p)
+	}
+	// If multiple goroutines build the entry at the same time,
+	// they all build the same thing, so it doesn't matter which
+	// one wins.
+	e := newMulTableEntry(c)
+	atomic.StorePointer(&mulTable[c], unsafe.Pointer(e))
+	return e
+}
+
+// Times returns the product of t and u as elements of GF(2^8).
+func (t T) Times(u T) T {
+	if t == 0 || u == 0 {
+		return 0
+	}
+
+	logT := int(logTable[t-1])
+	logU := int(logTable[u-1])
+	return expTable[(logT+logU)%(order-1)]
+}
+
+// Inverse returns the multiplicative inverse of t, if t != 0. It
+// panics if t == 0.
+func (t T) Inverse() T {
+	if t == 0 {
+		panic("zero has no inverse")
+	}
+	logT := int(logTable[t-1])
+	return expTable[(-logT+(order-1))%(order-1)]
+}
+
+// Div returns the product of t and u^{-1} as elements of GF(2^8), if
+// u != 0. It panics if u == 0.
+func (t T) Div(u T) T {
+	if u == 0 {
+		panic("division by zero")
+	}
+
+	if t == 0 {
+		return 0
+	}
+
+	logT := int(logTable[t-1])
+	logU := int(logTable[u-1])
+	return expTable[(logT-logU+(order-1))%(order-1)]
+}
+
+// Pow returns the t^p as an element of GF(2^8). T(0).Pow(0) returns 1.
+func (t T) Pow(p uint32) T {
+	if t == 0 {
+		if p == 0 {
+			return 1
+		}
+		return 0
+	}
+
+	logT := uint64(logTable[t-1])
+	return expTable[(logT*uint64(p))%(order-1)]
+}
@@ -0,0 +1,36 @@
+package gf2p8
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A mulTable16Entry holds the products of some c with all the Ts with
+// only a single nibble set, for use with PSHUFB.
+type mulTable16Entry struct {
+	s0, s4 [1 << 4]byte
+}
+
+// mulTable16[c] points to the mulTable16Entry for c, or is nil if it
+// hasn't been needed yet; use getMulTable16Entry to access it.
+var mulTable16 [order]unsafe.Pointer
+
+func newMulTable16Entry(c T) *mulTable16Entry {
+	var e mulTable16Entry
+	for j := 0; j < len(e.s0); j++ {
+		e.s0[j] = byte(c.Times(T(j)))
+		e.s4[j] = byte(c.Times(T(j << 4)))
+	}
+	return &e
+}
+
+// getMulTable16Entry returns the mulTable16Entry for c, building it
+// if necessary.
+func getMulTable16Entry(c T) *mulTable16Entry {
+	if p := atomic.LoadPointer(&mulTable16[c]); p != nil {
+		return (*mulTable16Entry)(p)
+	}
+	e := newMulTable16Entry(c)
+	atomic.StorePointer(&mulTable16[c], unsafe.Pointer(e))
+	return e
+}
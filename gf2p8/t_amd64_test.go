@@ -0,0 +1,17 @@
+package gf2p8
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMulTable16(t *testing.T) {
+	for _, c := range []T{0, 1, 2, 0x1d, 0xff} {
+		cEntry := getMulTable16Entry(c)
+		for x := 0; x < order; x++ {
+			cx := cEntry.s0[x&0x0f] ^ cEntry.s4[x>>4]
+			require.Equal(t, c.Times(T(x)), T(cx))
+		}
+	}
+}
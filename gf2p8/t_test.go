@@ -0,0 +1,79 @@
+package gf2p8
+
+import (
+	"testing"
+
+	"github.com/akalin/gopar/gf2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimes(t *testing.T) {
+	// Compare against polynomial multiplication modulo the
+	// PAR1 polynomial.
+	const m gf2.Poly64 = 0x11d
+	for i := 0; i < order; i++ {
+		for j := 0; j < order; j++ {
+			_, expectedP := gf2.Poly64(i).Times(gf2.Poly64(j)).Div(m)
+			require.Equal(t, T(expectedP), T(i).Times(T(j)), "i=%d, j=%d", i, j)
+		}
+	}
+}
+
+func TestInverse(t *testing.T) {
+	var invTable [order - 1]T
+	for i := 1; i < order; i++ {
+		x := T(i)
+		xInv := x.Inverse()
+		require.NotEqual(t, T(0), xInv, "x=%d", x)
+		require.Equal(t, T(0), invTable[x-1])
+		invTable[x-1] = xInv
+		require.Equal(t, T(1), x.Times(xInv), "x=%d", x)
+	}
+}
+
+func TestTimesDiv(t *testing.T) {
+	for i := 0; i < order; i++ {
+		for j := 1; j < order; j++ {
+			x := T(i)
+			y := T(j)
+			require.Equal(t, x, x.Times(y).Div(y), "x=%d, y=%d", x, y)
+			require.Equal(t, x.Times(y.Inverse()), x.Div(y), "x=%d, y=%d", x, y)
+		}
+	}
+}
+
+func TestPow(t *testing.T) {
+	require.Equal(t, T(1), T(0).Pow(0))
+	require.Equal(t, T(0), T(0).Pow(1))
+	for i := 1; i < order; i++ {
+		x := T(i)
+		expectedY := T(1)
+		for p := uint32(0); p < 2*order; p++ {
+			require.Equal(t, expectedY, x.Pow(p), "x=%d, p=%d", x, p)
+			expectedY = expectedY.Times(x)
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	// Recompute the generated tables, to make sure that tables.go
+	// is up to date.
+	const m gf2.Poly64 = 0x11d
+	require.True(t, m.Irreducible())
+	require.True(t, gf2.Poly64(2).GeneratesMod(m))
+	x := gf2.Poly64(1)
+	for p := 0; p < order-1; p++ {
+		require.Equal(t, T(x), expTable[p])
+		require.Equal(t, uint8(p), logTable[x-1])
+		_, x = x.Times(2).Div(m)
+	}
+}
+
+func TestMulTable(t *testing.T) {
+	for _, c := range []T{0, 1, 2, 0x1d, 0xff} {
+		cEntry := getMulTableEntry(c)
+		for x := 0; x < order; x++ {
+			require.Equal(t, c.Times(T(x)), cEntry[x])
+		}
+	}
+}
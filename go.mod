@@ -1,9 +1,8 @@
 module github.com/akalin/gopar
 
-go 1.15
+go 1.16
 
 require (
 	github.com/klauspost/cpuid/v2 v2.0.2
-	github.com/klauspost/reedsolomon v1.9.11
 	github.com/stretchr/testify v1.7.0
 )
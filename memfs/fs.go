@@ -0,0 +1,144 @@
+package memfs
+
+import (
+	"bytes"
+	"io"
+	iofs "io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Open implements the fs.FS interface, treating the working directory
+// as the root. Since WriteFile also treats relative paths as relative
+// to the working directory, MemFS is also a fsio.WriteFS, and with
+// Remove, a fsio.RemoveFS.
+func (fs MemFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+
+	absPath := filepath.Join(fs.workingDir, filepath.FromSlash(name))
+	if data, ok := fs.fileData[absPath]; ok {
+		return &memFile{fileInfo{path.Base(name), int64(len(data)), false}, bytes.NewReader(data)}, nil
+	}
+
+	dirPrefix := absPath
+	if !strings.HasSuffix(dirPrefix, string(filepath.Separator)) {
+		dirPrefix += string(filepath.Separator)
+	}
+	children := make(map[string]fileInfo)
+	for filePath, data := range fs.fileData {
+		if !strings.HasPrefix(filePath, dirPrefix) {
+			continue
+		}
+		rest := filePath[len(dirPrefix):]
+		if i := strings.IndexRune(rest, filepath.Separator); i >= 0 {
+			children[rest[:i]] = fileInfo{rest[:i], 0, true}
+		} else {
+			children[rest] = fileInfo{rest, int64(len(data)), false}
+		}
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+
+	entries := make([]iofs.DirEntry, 0, len(children))
+	for _, info := range children {
+		entries = append(entries, info)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return &memDir{fileInfo{path.Base(name), 0, true}, entries}, nil
+}
+
+// Remove removes the file with the given name, treating the working
+// directory as the root like Open.
+func (fs MemFS) Remove(name string) error {
+	if !iofs.ValidPath(name) {
+		return &iofs.PathError{Op: "remove", Path: name, Err: iofs.ErrInvalid}
+	}
+	_, err := fs.RemoveFile(filepath.FromSlash(name))
+	return err
+}
+
+// Rename renames the file with the name oldname to newname, treating
+// the working directory as the root like Open.
+func (fs MemFS) Rename(oldname, newname string) error {
+	if !iofs.ValidPath(oldname) {
+		return &iofs.PathError{Op: "rename", Path: oldname, Err: iofs.ErrInvalid}
+	}
+	if !iofs.ValidPath(newname) {
+		return &iofs.PathError{Op: "rename", Path: newname, Err: iofs.ErrInvalid}
+	}
+	return fs.MoveFile(filepath.FromSlash(oldname), filepath.FromSlash(newname))
+}
+
+type fileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+func (fi fileInfo) Size() int64 { return fi.size }
+
+func (fi fileInfo) Mode() iofs.FileMode {
+	if fi.isDir {
+		return iofs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+
+func (fi fileInfo) IsDir() bool { return fi.isDir }
+
+func (fi fileInfo) Sys() interface{} { return nil }
+
+func (fi fileInfo) Type() iofs.FileMode { return fi.Mode().Type() }
+
+func (fi fileInfo) Info() (iofs.FileInfo, error) { return fi, nil }
+
+type memFile struct {
+	info fileInfo
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (iofs.FileInfo, error) { return f.info, nil }
+
+func (f *memFile) Close() error { return nil }
+
+type memDir struct {
+	info    fileInfo
+	entries []iofs.DirEntry
+}
+
+func (d *memDir) Stat() (iofs.FileInfo, error) { return d.info, nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.info.name, Err: iofs.ErrInvalid}
+}
+
+func (d *memDir) Close() error { return nil }
+
+func (d *memDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package memfs
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	workingDir := filepath.Join(RootDir(), "dir")
+	memFS := MakeMemFS(workingDir, map[string][]byte{
+		"file.rar":                                {0x1, 0x2, 0x3, 0x4},
+		filepath.Join("dir1", "file.r01"):         {0x5, 0x6, 0x7},
+		filepath.Join("dir1", "dir2", "file.r02"): {0x8},
+		filepath.Join(RootDir(), "outside.r03"):   {0x9},
+	})
+
+	data, err := fs.ReadFile(memFS, "dir1/file.r01")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x5, 0x6, 0x7}, data)
+
+	info, err := fs.Stat(memFS, "dir1/dir2/file.r02")
+	require.NoError(t, err)
+	require.Equal(t, "file.r02", info.Name())
+	require.Equal(t, int64(1), info.Size())
+	require.False(t, info.IsDir())
+
+	entries, err := fs.ReadDir(memFS, ".")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{"dir1", "file.rar"}, names)
+
+	entries, err = fs.ReadDir(memFS, "dir1")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	require.Equal(t, "dir2", entries[0].Name())
+	require.True(t, entries[0].IsDir())
+	require.Equal(t, "file.r01", entries[1].Name())
+	require.False(t, entries[1].IsDir())
+
+	_, err = memFS.Open("../outside.r03")
+	require.ErrorIs(t, err, fs.ErrInvalid)
+	_, err = memFS.Open("outside.r03")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, memFS.Remove("dir1/file.r01"))
+	_, err = fs.Stat(memFS, "dir1/file.r01")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.ErrorIs(t, memFS.Remove("dir1/file.r01"), fs.ErrNotExist)
+	require.ErrorIs(t, memFS.Remove("../outside.r03"), fs.ErrInvalid)
+
+	require.NoError(t, memFS.Rename("dir1/dir2/file.r02", "file.r02.1"))
+	_, err = fs.Stat(memFS, "dir1/dir2/file.r02")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(memFS, "file.r02.1")
+	require.NoError(t, err)
+	require.ErrorIs(t, memFS.Rename("dir1/dir2/file.r02", "file.r02.2"), fs.ErrNotExist)
+	require.ErrorIs(t, memFS.Rename("file.r02.1", "../file.r02"), fs.ErrInvalid)
+}
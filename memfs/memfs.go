@@ -1,6 +1,7 @@
 package memfs
 
 import (
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -114,6 +115,33 @@ func (fs MemFS) RemoveFile(path string) ([]byte, error) {
 	return data, nil
 }
 
+// DeleteFile is like RemoveFile, except that it doesn't return the
+// removed data.
+func (fs MemFS) DeleteFile(path string) error {
+	_, err := fs.RemoveFile(path)
+	return err
+}
+
+// StatFile returns a FileInfo describing the file at the given path,
+// which may be absolute or relative (to the working directory). If
+// the file doesn't exist, os.ErrNotExist is returned.
+func (fs MemFS) StatFile(path string) (iofs.FileInfo, error) {
+	data, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{filepath.Base(path), int64(len(data)), false}, nil
+}
+
+// SetFileInfo would set the metadata of the file at the given path,
+// which may be absolute or relative (to the working directory), but
+// since MemFS doesn't keep track of any, it just checks that the file
+// exists.
+func (fs MemFS) SetFileInfo(path string, info iofs.FileInfo) error {
+	_, err := fs.ReadFile(path)
+	return err
+}
+
 // MoveFile moves the file at oldPath to newPath. oldPath and newPath
 // may be either absolute or relative (to the working directory). If
 // the file doesn't exist at oldPath, os.ErrNotExist is returned.
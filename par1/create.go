@@ -1,15 +1,24 @@
 package par1
 
 import (
-	"errors"
 	"path"
 	"path/filepath"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec8"
 )
 
 // NumParityFilesDefault is the default value used for
 // CreateOptions.NumParityFiles if the latter is <= 0.
 const NumParityFilesDefault = 3
 
+// NumGoroutinesDefault returns the default value used for
+// CreateOptions.NumGoroutines, VerifyOptions.NumGoroutines, and
+// RepairOptions.NumGoroutines if they are <= 0.
+func NumGoroutinesDefault() int {
+	return rsec8.DefaultNumGoroutines()
+}
+
 // CreateDelegate extends EncoderDelegate with another delegate
 // function.
 type CreateDelegate interface {
@@ -36,6 +45,9 @@ type CreateOptions struct {
 	// The number of parity files to create. If <= 0,
 	// NumParityFilesDefault is used.
 	NumParityFiles int
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
 	// The CreateDelegate to use. If nil, DoNothingCreateDelegate
 	// is used.
 	CreateDelegate CreateDelegate
@@ -47,10 +59,18 @@ func Create(parPath string, filePaths []string, options CreateOptions) error {
 	return create(defaultFileIO{}, parPath, filePaths, options)
 }
 
+// CreateFS is like Create, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the elements of
+// filePaths are names in fsys.
+func CreateFS(fsys fsio.WriteFS, parPath string, filePaths []string, options CreateOptions) error {
+	p := fsio.PathFS{FS: fsys}
+	return create(p, p.Path(parPath), p.Paths(filePaths), options)
+}
+
 func checkExtension(parPath string) error {
 	ext := path.Ext(parPath)
 	if ext != ".par" {
-		return errors.New("parPath must have a .par extension")
+		return &InvalidArgumentError{"parPath", "must have a .par extension"}
 	}
 	return nil
 }
@@ -62,7 +82,7 @@ func create(fileIO fileIO, parPath string, filePaths []string, options CreateOpt
 	}
 
 	if len(filePaths) == 0 {
-		return errors.New("filePaths must not be empty")
+		return &InvalidArgumentError{"filePaths", "must not be empty"}
 	}
 
 	numParityFiles := options.NumParityFiles
@@ -70,6 +90,11 @@ func create(fileIO fileIO, parPath string, filePaths []string, options CreateOpt
 		numParityFiles = NumParityFilesDefault
 	}
 
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
 	delegate := options.CreateDelegate
 	if delegate == nil {
 		delegate = DoNothingCreateDelegate{}
@@ -87,7 +112,7 @@ func create(fileIO fileIO, parPath string, filePaths []string, options CreateOpt
 		delegate.OnFilesNotAllInSameDir()
 	}
 
-	encoder, err := newEncoder(fileIO, delegate, filePaths, numParityFiles)
+	encoder, err := newEncoder(fileIO, delegate, filePaths, numParityFiles, numGoroutines)
 	if err != nil {
 		return err
 	}
@@ -3,7 +3,9 @@ package par1
 import (
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
+	"github.com/akalin/gopar/memfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,7 +31,7 @@ func testCreate(t *testing.T, workingDir string, useAbsPath bool, options Create
 		require.NoError(t, fs.MoveFile(path, filepath.Base(path)))
 	}
 
-	decoder, err := newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, parPath)
+	decoder, err := newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, parPath, 1)
 	require.NoError(t, err)
 
 	err = decoder.LoadFileData()
@@ -56,3 +58,30 @@ func TestCreateDefaults(t *testing.T) {
 		testCreate(t, workingDir, useAbsPath, CreateOptions{})
 	})
 }
+
+func TestCreateFS(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir")
+	fs := makeDecoderMemFS(workingDir)
+
+	err := CreateFS(fs, "file.par", []string{
+		"file.rar", "file.r01", "file.r02", "file.r03", "file.r04",
+	}, CreateOptions{
+		CreateDelegate: testCreateDelegate{testEncoderDelegate{t}},
+	})
+	require.NoError(t, err)
+
+	// Verify with a read-only copy of fs.
+	mapFS := make(fstest.MapFS)
+	for _, path := range fs.Paths() {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		mapFS[filepath.Base(path)] = &fstest.MapFile{Data: data}
+	}
+
+	result, err := VerifyFS(mapFS, "file.par", VerifyOptions{
+		VerifyAllData:  true,
+		VerifyDelegate: testVerifyDelegate{testDecoderDelegate{t}},
+	})
+	require.NoError(t, err)
+	require.True(t, result.AllDataOk)
+}
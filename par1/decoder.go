@@ -1,14 +1,17 @@
 package par1
 
 import (
+	"bytes"
 	"crypto/md5"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path"
 	"path/filepath"
+	"time"
 
-	"github.com/klauspost/reedsolomon"
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec8"
 )
 
 // A Decoder keeps track of all information needed to check the
@@ -16,12 +19,19 @@ import (
 // missing/corrupt data files from the parity files (.P00, .P01,
 // etc.).
 type Decoder struct {
-	fileIO   fileIO
-	delegate DecoderDelegate
+	fileIO        fileIO
+	delegate      DecoderDelegate
+	numGoroutines int
 
 	indexFile   string
 	indexVolume volume
 
+	// If true, Repair moves damaged data files out of the way
+	// instead of overwriting them, and records their new paths
+	// in backupPaths.
+	keepBackups bool
+	backupPaths []string
+
 	fileData [][]byte
 
 	shardByteCount int
@@ -63,7 +73,11 @@ func (DoNothingDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount
 func (DoNothingDecoderDelegate) OnVolumeFileLoad(i uint64, path string, storedSetHash, computedSetHash [16]byte, dataByteCount int, err error) {
 }
 
-func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexFile string) (*Decoder, error) {
+func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
+	if numGoroutines <= 0 {
+		return nil, &InvalidArgumentError{"numGoroutines", "must be positive"}
+	}
+
 	indexVolume, err := func() (volume, error) {
 		bytes, err := fileIO.ReadFile(indexFile)
 		if err != nil {
@@ -72,12 +86,12 @@ func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexFile string) (*Dec
 
 		indexVolume, err := readVolume(bytes)
 		if err != nil {
-			return volume{}, err
+			return volume{}, &VolumeError{indexFile, err}
 		}
 
 		if indexVolume.header.VolumeNumber != 0 {
 			// TODO: Relax this check.
-			return volume{}, errors.New("expected volume number 0 for index volume")
+			return volume{}, &MismatchError{indexFile, "volume number", uint64(0), indexVolume.header.VolumeNumber}
 		}
 		return indexVolume, nil
 	}()
@@ -95,17 +109,56 @@ func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexFile string) (*Dec
 	delegate.OnCommentLoad(indexVolume.data)
 
 	return &Decoder{
-		fileIO, delegate,
+		fileIO, delegate, numGoroutines,
 		indexFile, indexVolume,
+		false, nil,
 		nil,
 		0, nil,
 	}, nil
 }
 
+// DecoderOptions holds the options for NewDecoderWithOptions and
+// NewDecoderFSWithOptions.
+type DecoderOptions struct {
+	// The number of goroutines to use while verifying and
+	// reconstructing data. If <= 0, NumGoroutinesDefault() is
+	// used.
+	NumGoroutines int
+}
+
+func (o DecoderOptions) numGoroutines() int {
+	if o.NumGoroutines <= 0 {
+		return NumGoroutinesDefault()
+	}
+	return o.NumGoroutines
+}
+
 // NewDecoder reads the given index file, which usually has a .PAR
 // extension.
 func NewDecoder(delegate DecoderDelegate, indexFile string) (*Decoder, error) {
-	return newDecoder(defaultFileIO{}, delegate, indexFile)
+	return NewDecoderWithOptions(delegate, indexFile, DecoderOptions{})
+}
+
+// NewDecoderWithOptions is like NewDecoder, except that it takes
+// the given options.
+func NewDecoderWithOptions(delegate DecoderDelegate, indexFile string, options DecoderOptions) (*Decoder, error) {
+	return newDecoder(defaultFileIO{}, delegate, indexFile, options.numGoroutines())
+}
+
+// NewDecoderFS is like NewDecoder, except that it reads files from
+// fsys instead of the OS file system, and indexFile is a name in
+// fsys. The paths passed to the delegate and returned by Repair are
+// under fsio.Root(). Repair returns fsio.ErrReadOnly if fsys isn't a
+// fsio.WriteFS.
+func NewDecoderFS(fsys fs.FS, delegate DecoderDelegate, indexFile string) (*Decoder, error) {
+	return NewDecoderFSWithOptions(fsys, delegate, indexFile, DecoderOptions{})
+}
+
+// NewDecoderFSWithOptions is like NewDecoderFS, except that it takes
+// the given options.
+func NewDecoderFSWithOptions(fsys fs.FS, delegate DecoderDelegate, indexFile string, options DecoderOptions) (*Decoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newDecoder(p, delegate, p.Path(indexFile), options.numGoroutines())
 }
 
 func sixteenKHash(data []byte) [md5.Size]byte {
@@ -118,7 +171,7 @@ func sixteenKHash(data []byte) [md5.Size]byte {
 func (d *Decoder) getFilePath(entry fileEntry) (string, error) {
 	filename := entry.filename
 	if filepath.Base(filename) != filename {
-		return "", errors.New("bad filename")
+		return "", &VolumeError{d.indexFile, fmt.Errorf("invalid filename %q", filename)}
 	}
 
 	basePath := filepath.Dir(d.indexFile)
@@ -141,14 +194,14 @@ func (d *Decoder) LoadFileData() error {
 
 		data, corrupt, err := func() ([]byte, bool, error) {
 			data, err := d.fileIO.ReadFile(path)
-			if os.IsNotExist(err) {
+			if errors.Is(err, fs.ErrNotExist) {
 				return nil, true, err
 			} else if err != nil {
 				return nil, false, err
-			} else if sixteenKHash(data) != entry.header.SixteenKHash {
-				return nil, true, errors.New("hash mismatch (16k)")
-			} else if md5.Sum(data) != entry.header.Hash {
-				return nil, true, errors.New("hash mismatch")
+			} else if hash := sixteenKHash(data); hash != entry.header.SixteenKHash {
+				return nil, true, &MismatchError{path, "16k hash", entry.header.SixteenKHash, hash}
+			} else if hash := md5.Sum(data); hash != entry.header.Hash {
+				return nil, true, &MismatchError{path, "hash", entry.header.Hash, hash}
 			}
 			return data, false, nil
 		}()
@@ -170,7 +223,7 @@ func (d *Decoder) LoadFileData() error {
 	}
 
 	if len(fileData) == 0 {
-		return errors.New("no file data found")
+		return &VolumeError{d.indexFile, errors.New("no files saved in the volume set")}
 	}
 
 	d.fileData = fileData
@@ -209,7 +262,7 @@ func (d *Decoder) LoadParityData() error {
 		volumePath := d.volumePath(volumeNumber)
 		parityVolume, byteCount, err := func() (volume, int, error) {
 			volumeBytes, err := d.fileIO.ReadFile(volumePath)
-			if os.IsNotExist(err) {
+			if errors.Is(err, fs.ErrNotExist) {
 				return volume{}, 0, err
 			} else if err != nil {
 				return volume{}, 0, err
@@ -219,35 +272,35 @@ func (d *Decoder) LoadParityData() error {
 			// TODO: Check set hash.
 			if err != nil {
 				// TODO: Relax this check.
-				return volume{}, 0, err
+				return volume{}, 0, &VolumeError{volumePath, err}
 			}
 
 			byteCount := len(parityVolume.data)
 
 			if parityVolume.header.SetHash != d.indexVolume.header.SetHash {
 				// TODO: Relax this check.
-				return volume{}, byteCount, errors.New("unexpected set hash for parity volume")
+				return volume{}, byteCount, &MismatchError{volumePath, "set hash", d.indexVolume.header.SetHash, parityVolume.header.SetHash}
 			}
 
-			if parityVolume.header.VolumeNumber != uint64(i+1) {
+			if parityVolume.header.VolumeNumber != volumeNumber {
 				// TODO: Relax this check.
-				return volume{}, byteCount, errors.New("unexpected volume number for parity volume")
+				return volume{}, byteCount, &MismatchError{volumePath, "volume number", volumeNumber, parityVolume.header.VolumeNumber}
 			}
 
 			if byteCount == 0 {
 				// TODO: Relax this check.
-				return volume{}, byteCount, errors.New("no parity data in volume")
+				return volume{}, byteCount, &VolumeError{volumePath, errors.New("no parity data in volume")}
 			}
 			if shardByteCount == 0 {
 				shardByteCount = byteCount
 			} else if byteCount != shardByteCount {
 				// TODO: Relax this check.
-				return volume{}, byteCount, errors.New("mismatched parity data byte counts")
+				return volume{}, byteCount, &MismatchError{volumePath, "parity data byte count", shardByteCount, byteCount}
 			}
 			return parityVolume, byteCount, nil
 		}()
 		d.delegate.OnVolumeFileLoad(volumeNumber, volumePath, parityVolume.header.SetHash, parityVolume.setHash, byteCount, err)
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			continue
 		} else if err != nil {
 			return err
@@ -262,28 +315,26 @@ func (d *Decoder) LoadParityData() error {
 	return nil
 }
 
-func (d *Decoder) buildShards() [][]byte {
-	shards := make([][]byte, len(d.fileData)+len(d.parityData))
-	for i, data := range d.fileData {
-		if data == nil {
-			continue
-		}
-		padding := make([]byte, d.shardByteCount-len(data))
-		shards[i] = append(data, padding...)
-	}
-
-	for i, data := range d.parityData {
-		if data == nil {
+// buildShards returns the data shards, which are the file data padded
+// to the parity data byte count, and the parity shards. Missing
+// shards are nil.
+func (d *Decoder) buildShards() (data, parity [][]byte) {
+	data = make([][]byte, len(d.fileData))
+	for i, fileData := range d.fileData {
+		if fileData == nil {
 			continue
 		}
-		shards[len(d.fileData)+i] = data
+		padding := make([]byte, d.shardByteCount-len(fileData))
+		data[i] = append(fileData, padding...)
 	}
 
-	return shards
+	parity = make([][]byte, len(d.parityData))
+	copy(parity, d.parityData)
+	return data, parity
 }
 
-func (d *Decoder) newReedSolomon() (reedsolomon.Encoder, error) {
-	return reedsolomon.New(len(d.fileData), len(d.parityData), reedsolomon.WithPAR1Matrix())
+func (d *Decoder) newCoder() (rsec8.Coder, error) {
+	return rsec8.NewCoderPAR1Vandermonde(len(d.fileData), len(d.parityData), d.numGoroutines)
 }
 
 // FileCounts contains file counts which can be used to deduce whether
@@ -366,14 +417,14 @@ func (d *Decoder) FileCounts() FileCounts {
 // there are no unusable data or parity files, since if there are,
 // then false is guaranteed to be returned for ok.
 func (d *Decoder) VerifyAllData() (ok bool, err error) {
-	rs, err := d.newReedSolomon()
+	coder, err := d.newCoder()
 	if err != nil {
 		return false, err
 	}
 
-	shards := d.buildShards()
+	data, parity := d.buildShards()
 
-	return rs.Verify(shards)
+	return coder.Verify(data, parity)
 }
 
 // Repair tries to repair any missing or corrupt data, using the
@@ -383,26 +434,26 @@ func (d *Decoder) VerifyAllData() (ok bool, err error) {
 // error is returned. If checkParity is true, extra checking is done
 // of the reconstructed parity data.
 func (d *Decoder) Repair(checkParity bool) ([]string, error) {
-	rs, err := d.newReedSolomon()
+	coder, err := d.newCoder()
 	if err != nil {
 		return nil, err
 	}
 
-	shards := d.buildShards()
+	shards, parityShards := d.buildShards()
 
-	err = rs.Reconstruct(shards)
+	err = coder.ReconstructData(shards, parityShards)
 	if err != nil {
 		return nil, err
 	}
 
 	if checkParity {
-		ok, err := rs.Verify(shards)
-		if err != nil {
-			return nil, err
-		}
-
-		if !ok {
-			return nil, errors.New("repair failed")
+		// Only the parity shards that are present can be
+		// checked against the reconstructed data.
+		computedParityShards := coder.GenerateParity(shards)
+		for i, parityShard := range parityShards {
+			if parityShard != nil && !bytes.Equal(parityShard, computedParityShards[i]) {
+				return nil, &RepairFailedError{Problem: "reconstructed parity doesn't match"}
+			}
 		}
 	}
 
@@ -414,19 +465,40 @@ func (d *Decoder) Repair(checkParity bool) ([]string, error) {
 		}
 
 		entry := d.indexVolume.entries[i]
+		path, err := d.getFilePath(entry)
+		if err != nil {
+			return repairedPaths, err
+		}
+
 		data = shards[i][:entry.header.FileBytes]
 		if sixteenKHash(data) != entry.header.SixteenKHash {
-			return repairedPaths, errors.New("hash mismatch (16k) in reconstructed data")
+			return repairedPaths, &RepairFailedError{path, "hash mismatch (16k) in reconstructed data"}
 		} else if md5.Sum(data) != entry.header.Hash {
-			return repairedPaths, errors.New("hash mismatch in reconstructed data")
+			return repairedPaths, &RepairFailedError{path, "hash mismatch in reconstructed data"}
 		}
 
-		path, err := d.getFilePath(entry)
+		// Keep the metadata of a damaged file, if it
+		// exists. Otherwise, fall back to defaults, since
+		// PAR1 has nowhere to record file info.
+		info, err := d.fileIO.StatFile(path)
 		if err != nil {
-			return repairedPaths, err
+			info = fsio.NewFileInfo(filepath.Base(path), int64(len(data)), fsio.RestoredFilePerm, time.Now())
+		}
+
+		if d.keepBackups {
+			backupPath, err := fsio.BackUpFile(d.fileIO, path)
+			if err != nil {
+				return repairedPaths, err
+			}
+			if backupPath != "" {
+				d.backupPaths = append(d.backupPaths, backupPath)
+			}
 		}
 
 		err = d.fileIO.WriteFile(path, data)
+		if err == nil {
+			err = d.fileIO.SetFileInfo(path, info)
+		}
 		d.delegate.OnDataFileWrite(i+1, len(d.fileData), path, len(data), err)
 		if err != nil {
 			return repairedPaths, err
@@ -441,3 +513,20 @@ func (d *Decoder) Repair(checkParity bool) ([]string, error) {
 
 	return repairedPaths, nil
 }
+
+// Purge removes the index file, the parity volumes loaded by
+// LoadParityData, and any backups of damaged data files made by
+// Repair, and returns the paths of the removed files, which is
+// present even if an error is returned. It should be called only
+// once the data files are known to be intact.
+func (d *Decoder) Purge() ([]string, error) {
+	paths := []string{d.indexFile}
+	for i, data := range d.parityData {
+		if data != nil {
+			paths = append(paths, d.volumePath(uint64(i+1)))
+		}
+	}
+	paths = append(paths, d.backupPaths...)
+
+	return fsio.DeleteFiles(d.fileIO, paths)
+}
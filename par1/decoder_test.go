@@ -4,13 +4,15 @@ import (
 	"crypto/md5"
 	"errors"
 	"fmt"
+	iofs "io/fs"
 	"path"
 	"path/filepath"
 	"sort"
 	"testing"
 
 	"github.com/akalin/gopar/memfs"
-	"github.com/klauspost/reedsolomon"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec8"
 	"github.com/stretchr/testify/require"
 )
 
@@ -37,6 +39,51 @@ func (io testFileIO) WriteFile(path string, data []byte) (err error) {
 	return io.fileIO.WriteFile(path, data)
 }
 
+func (io testFileIO) FindWithPrefixAndSuffix(prefix, suffix string) (matches []string, err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("FindWithPrefixAndSuffix(%s, %s) => (%d files, %v)", prefix, suffix, len(matches), err)
+	}()
+	return io.fileIO.FindWithPrefixAndSuffix(prefix, suffix)
+}
+
+func (io testFileIO) MoveFile(oldPath, newPath string) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("MoveFile(%s, %s) => %v", oldPath, newPath, err)
+	}()
+	return io.fileIO.MoveFile(oldPath, newPath)
+}
+
+func (io testFileIO) DeleteFile(path string) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("DeleteFile(%s) => %v", path, err)
+	}()
+	return io.fileIO.DeleteFile(path)
+}
+
+func (io testFileIO) StatFile(path string) (info iofs.FileInfo, err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("StatFile(%s) => %v", path, err)
+	}()
+	return io.fileIO.StatFile(path)
+}
+
+func (io testFileIO) SetFileInfo(path string, info iofs.FileInfo) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("SetFileInfo(%s, %v, %v) => %v", path, info.Mode(), info.ModTime(), err)
+	}()
+	return io.fileIO.SetFileInfo(path, info)
+}
+
 type testDecoderDelegate struct {
 	t *testing.T
 }
@@ -112,7 +159,7 @@ func buildVTemplate(t *testing.T, fs memfs.MemFS, sortedPaths []string) volume {
 
 func buildPARData(t *testing.T, fs memfs.MemFS, parityShardCount int) {
 	dataShardCount := fs.FileCount()
-	rs, err := reedsolomon.New(dataShardCount, parityShardCount, reedsolomon.WithPAR1Matrix())
+	coder, err := rsec8.NewCoderPAR1Vandermonde(dataShardCount, parityShardCount, 1)
 	require.NoError(t, err)
 
 	paths := fs.Paths()
@@ -133,11 +180,7 @@ func buildPARData(t *testing.T, fs memfs.MemFS, parityShardCount int) {
 		require.NoError(t, err)
 		shards = append(shards, append(data, make([]byte, shardByteCount-len(data))...))
 	}
-	for i := 0; i < parityShardCount; i++ {
-		shards = append(shards, make([]byte, shardByteCount))
-	}
-	err = rs.Encode(shards)
-	require.NoError(t, err)
+	parityShards := coder.GenerateParity(shards)
 
 	vTemplate := buildVTemplate(t, fs, sortedPaths)
 
@@ -153,7 +196,7 @@ func buildPARData(t *testing.T, fs memfs.MemFS, parityShardCount int) {
 
 	require.NoError(t, fs.WriteFile(base+".par", indexVolumeBytes))
 
-	for i, parityShard := range shards[dataShardCount:] {
+	for i, parityShard := range parityShards {
 		vol := vTemplate
 		vol.header.VolumeNumber = uint64(i + 1)
 		vol.data = parityShard
@@ -174,7 +217,7 @@ func makeDecoderMemFS(workingDir string) memfs.MemFS {
 }
 
 func newDecoderForTest(t *testing.T, fs memfs.MemFS, indexFile string) (*Decoder, error) {
-	return newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, indexFile)
+	return newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, indexFile, 1)
 }
 
 func perturbFile(t *testing.T, fs memfs.MemFS, path string) {
@@ -296,7 +339,7 @@ func testVerifyAllData(t *testing.T, workingDir string, useAbsPath bool) {
 	err = decoder.LoadFileData()
 	require.NoError(t, err)
 	_, err = decoder.VerifyAllData()
-	expectedErr := errors.New("shard sizes do not match")
+	expectedErr := errors.New("missing shard")
 	require.Equal(t, expectedErr, err)
 
 	unperturbFile(t, fs, "file.r04")
@@ -320,7 +363,7 @@ func testVerifyAllData(t *testing.T, workingDir string, useAbsPath bool) {
 	err = decoder.LoadParityData()
 	require.NoError(t, err)
 	_, err = decoder.VerifyAllData()
-	expectedErr = errors.New("shard sizes do not match")
+	expectedErr = errors.New("missing shard")
 	require.Equal(t, expectedErr, err)
 }
 
@@ -346,7 +389,8 @@ func TestBadFilename(t *testing.T) {
 	decoder, err := newDecoderForTest(t, fs, "file.par")
 	require.NoError(t, err)
 	err = decoder.LoadFileData()
-	require.Equal(t, errors.New("bad filename"), err)
+	require.Equal(t, &VolumeError{"file.par", fmt.Errorf("invalid filename %q", filepath.Join("dir", "file.rar"))}, err)
+	require.Equal(t, par2cmdline.ExitInsufficientCriticalData, ExitCodeForVerifyErrorPar2CmdLine(err))
 }
 
 func TestSetHashMismatch(t *testing.T) {
@@ -368,7 +412,10 @@ func TestSetHashMismatch(t *testing.T) {
 	err = decoder.LoadFileData()
 	require.NoError(t, err)
 	err = decoder.LoadParityData()
-	require.Equal(t, errors.New("unexpected set hash for parity volume"), err)
+	var mismatchErr *MismatchError
+	require.True(t, errors.As(err, &mismatchErr))
+	require.Equal(t, "set hash", mismatchErr.What)
+	require.Equal(t, "file.p02", filepath.Base(mismatchErr.Path))
 }
 
 func testDecoderRepair(t *testing.T, workingDir string, useAbsPath bool) {
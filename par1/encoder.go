@@ -2,12 +2,12 @@ package par1
 
 import (
 	"crypto/md5"
-	"errors"
 	"fmt"
 	"path"
 	"path/filepath"
 
-	"github.com/klauspost/reedsolomon"
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec8"
 )
 
 // An Encoder keeps track of all information needed to create parity
@@ -17,8 +17,9 @@ type Encoder struct {
 	fileIO   fileIO
 	delegate EncoderDelegate
 
-	filePaths   []string
-	volumeCount int
+	filePaths     []string
+	volumeCount   int
+	numGoroutines int
 
 	shardByteCount int
 	fileData       [][]byte
@@ -32,23 +33,68 @@ type EncoderDelegate interface {
 	OnVolumeFileWrite(i, n int, path string, dataByteCount, byteCount int, err error)
 }
 
-func newEncoder(fileIO fileIO, delegate EncoderDelegate, filePaths []string, volumeCount int) (*Encoder, error) {
+func newEncoder(fileIO fileIO, delegate EncoderDelegate, filePaths []string, volumeCount, numGoroutines int) (*Encoder, error) {
+	if len(filePaths) == 0 {
+		return nil, &InvalidArgumentError{"filePaths", "must not be empty"}
+	}
+	if volumeCount <= 0 {
+		return nil, &InvalidArgumentError{"volumeCount", "must be positive"}
+	}
+	if numGoroutines <= 0 {
+		return nil, &InvalidArgumentError{"numGoroutines", "must be positive"}
+	}
 	filenames := make(map[string]bool)
 	for _, p := range filePaths {
 		filename := filepath.Base(p)
 		if filenames[filename] {
-			return nil, errors.New("filename collision")
+			return nil, &InvalidArgumentError{"filePaths", fmt.Sprintf("must have distinct filenames, but %s appears more than once", filename)}
 		}
 		filenames[filename] = true
 	}
-	// TODO: Check len(filePaths) and volumeCount.
-	return &Encoder{fileIO, delegate, filePaths, volumeCount, 0, nil, nil}, nil
+	return &Encoder{fileIO, delegate, filePaths, volumeCount, numGoroutines, 0, nil, nil}, nil
+}
+
+// EncoderOptions holds the options for NewEncoderWithOptions and
+// NewEncoderFSWithOptions.
+type EncoderOptions struct {
+	// The number of goroutines to use while computing the
+	// parity volumes. If <= 0, NumGoroutinesDefault() is used.
+	NumGoroutines int
+}
+
+func (o EncoderOptions) numGoroutines() int {
+	if o.NumGoroutines <= 0 {
+		return NumGoroutinesDefault()
+	}
+	return o.NumGoroutines
 }
 
 // NewEncoder creates an encoder with the given list of file paths,
 // and with the given number of intended parity volumes.
 func NewEncoder(delegate EncoderDelegate, filePaths []string, volumeCount int) (*Encoder, error) {
-	return newEncoder(defaultFileIO{}, delegate, filePaths, volumeCount)
+	return NewEncoderWithOptions(delegate, filePaths, volumeCount, EncoderOptions{})
+}
+
+// NewEncoderWithOptions is like NewEncoder, except that it takes the
+// given options.
+func NewEncoderWithOptions(delegate EncoderDelegate, filePaths []string, volumeCount int, options EncoderOptions) (*Encoder, error) {
+	return newEncoder(defaultFileIO{}, delegate, filePaths, volumeCount, options.numGoroutines())
+}
+
+// NewEncoderFS is like NewEncoder, except that it reads and writes
+// files in fsys instead of the OS file system, and the elements of
+// filePaths are names in fsys. The paths passed to the delegate are
+// under fsio.Root(), and so must be the path passed to Write,
+// e.g. as returned by fsio.PathFS.Path.
+func NewEncoderFS(fsys fsio.WriteFS, delegate EncoderDelegate, filePaths []string, volumeCount int) (*Encoder, error) {
+	return NewEncoderFSWithOptions(fsys, delegate, filePaths, volumeCount, EncoderOptions{})
+}
+
+// NewEncoderFSWithOptions is like NewEncoderFS, except that it takes
+// the given options.
+func NewEncoderFSWithOptions(fsys fsio.WriteFS, delegate EncoderDelegate, filePaths []string, volumeCount int, options EncoderOptions) (*Encoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newEncoder(p, delegate, p.Paths(filePaths), volumeCount, options.numGoroutines())
 }
 
 // LoadFileData loads the file data into memory.
@@ -74,38 +120,33 @@ func (e *Encoder) LoadFileData() error {
 }
 
 func (e *Encoder) buildShards() [][]byte {
-	shards := make([][]byte, len(e.fileData)+e.volumeCount)
+	shards := make([][]byte, len(e.fileData))
 	for i, data := range e.fileData {
 		padding := make([]byte, e.shardByteCount-len(data))
 		shards[i] = append(data, padding...)
 	}
-
-	for i := 0; i < e.volumeCount; i++ {
-		shards[len(e.fileData)+i] = make([]byte, e.shardByteCount)
-	}
-
 	return shards
 }
 
 // ComputeParityData computes the parity data for the files.
 func (e *Encoder) ComputeParityData() error {
-	shards := e.buildShards()
-
-	rs, err := reedsolomon.New(len(e.fileData), e.volumeCount, reedsolomon.WithPAR1Matrix())
-	if err != nil {
-		return err
+	if e.shardByteCount == 0 {
+		return &InvalidArgumentError{"filePaths", "must contain at least one non-empty file"}
 	}
 
-	err = rs.Encode(shards)
+	coder, err := rsec8.NewCoderPAR1Vandermonde(len(e.fileData), e.volumeCount, e.numGoroutines)
 	if err != nil {
 		return err
 	}
 
-	e.parityData = shards[len(e.fileData):]
+	e.parityData = coder.GenerateParity(e.buildShards())
 	return nil
 }
 
-func (e *Encoder) Write(indexPath string) error {
+// Write writes the index volume and the parity volumes next to
+// indexPath. If writing any of them fails, the ones already written
+// are removed.
+func (e *Encoder) Write(indexPath string) (err error) {
 	var entries []fileEntry
 	var setHashInput []byte
 	for i, k := range e.filePaths {
@@ -146,12 +187,24 @@ func (e *Encoder) Write(indexPath string) error {
 	ext := path.Ext(indexPath)
 	base := indexPath[:len(indexPath)-len(ext)]
 
+	// Don't leave a partial set of files behind if writing one
+	// of them fails.
+	var writtenPaths []string
+	defer func() {
+		if err != nil {
+			for _, path := range writtenPaths {
+				_ = e.fileIO.DeleteFile(path)
+			}
+		}
+	}()
+
 	realIndexPath := base + ".par"
 	err = e.fileIO.WriteFile(realIndexPath, indexVolumeBytes)
 	e.delegate.OnVolumeFileWrite(0, len(e.parityData), realIndexPath, len(indexVolume.data), len(indexVolumeBytes), err)
 	if err != nil {
 		return err
 	}
+	writtenPaths = append(writtenPaths, realIndexPath)
 
 	for i, parityShard := range e.parityData {
 		vol := vTemplate
@@ -169,6 +222,7 @@ func (e *Encoder) Write(indexPath string) error {
 		if err != nil {
 			return err
 		}
+		writtenPaths = append(writtenPaths, volumePath)
 	}
 
 	return nil
@@ -2,11 +2,13 @@ package par1
 
 import (
 	"errors"
+	"fmt"
 	"path/filepath"
 	"testing"
 
 	"github.com/akalin/gopar/memfs"
-	"github.com/klauspost/reedsolomon"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec8"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,7 +37,7 @@ func makeEncoderMemFS(workingDir string) memfs.MemFS {
 }
 
 func newEncoderForTest(t *testing.T, fs memfs.MemFS, filePaths []string, volumeCount int) (*Encoder, error) {
-	return newEncoder(testFileIO{t, fs}, testEncoderDelegate{t}, filePaths, volumeCount)
+	return newEncoder(testFileIO{t, fs}, testEncoderDelegate{t}, filePaths, volumeCount, 1)
 }
 
 func TestEncodeParity(t *testing.T) {
@@ -52,7 +54,7 @@ func TestEncodeParity(t *testing.T) {
 	err = encoder.ComputeParityData()
 	require.NoError(t, err)
 
-	rs, err := reedsolomon.New(len(encoder.fileData), encoder.volumeCount, reedsolomon.WithPAR1Matrix())
+	coder, err := rsec8.NewCoderPAR1Vandermonde(len(encoder.fileData), encoder.volumeCount, 1)
 	require.NoError(t, err)
 
 	var shards [][]byte
@@ -62,13 +64,46 @@ func TestEncodeParity(t *testing.T) {
 		shards = append(shards, append(data, make([]byte, 4-len(data))...))
 	}
 
-	shards = append(shards, encoder.parityData...)
-
-	ok, err := rs.Verify(shards)
+	ok, err := coder.Verify(shards, encoder.parityData)
 	require.NoError(t, err)
 	require.True(t, ok)
 }
 
+// TestEncodeParityKnownAnswer checks the parity data against values
+// computed by github.com/klauspost/reedsolomon v1.10.0 with
+// WithPAR1Matrix, which is an independent implementation of the
+// PAR1 Vandermonde matrix.
+func TestEncodeParityKnownAnswer(t *testing.T) {
+	fs := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"file.r00": {0x05, 0x24, 0x43, 0x62, 0x81, 0xa0, 0xbf, 0xde},
+		"file.r01": {0x16, 0x35, 0x54, 0x73, 0x92, 0xb1, 0xd0, 0xef},
+		"file.r02": {0x27, 0x46, 0x65, 0x84, 0xa3, 0xc2, 0xe1, 0x00},
+		"file.r03": {0x38, 0x57, 0x76, 0x95, 0xb4, 0xd3, 0xf2, 0x11},
+		"file.r04": {0x49, 0x68, 0x87, 0xa6, 0xc5, 0xe4, 0x03, 0x22},
+	})
+
+	var paths []string
+	for i := 0; i < 5; i++ {
+		paths = append(paths, filepath.Join(memfs.RootDir(), fmt.Sprintf("file.r%02d", i)))
+	}
+
+	encoder, err := newEncoderForTest(t, fs, paths, 4)
+	require.NoError(t, err)
+
+	err = encoder.LoadFileData()
+	require.NoError(t, err)
+
+	err = encoder.ComputeParityData()
+	require.NoError(t, err)
+
+	require.Equal(t, [][]byte{
+		{0x45, 0x68, 0x83, 0xa6, 0xc1, 0xe4, 0x7f, 0x02},
+		{0xd0, 0x10, 0x20, 0x7f, 0x5c, 0xbc, 0xdc, 0xf3},
+		{0xec, 0x0c, 0xce, 0xac, 0x60, 0x00, 0x32, 0x70},
+		{0xe0, 0x34, 0x5f, 0xd8, 0x71, 0x9f, 0x1e, 0x19},
+	}, encoder.parityData)
+}
+
 func TestEncodeParityFilenameCollision(t *testing.T) {
 	fs := makeEncoderMemFS(memfs.RootDir())
 	require.NoError(t, fs.WriteFile(filepath.Join("dir6", "file.rar"), []byte{0x5, 0x6}))
@@ -76,7 +111,8 @@ func TestEncodeParityFilenameCollision(t *testing.T) {
 	paths := fs.Paths()
 
 	_, err := newEncoderForTest(t, fs, paths, 3)
-	require.Equal(t, errors.New("filename collision"), err)
+	require.Equal(t, &InvalidArgumentError{"filePaths", "must have distinct filenames, but file.rar appears more than once"}, err)
+	require.Equal(t, par2cmdline.ExitInvalidCommandLineArguments, ExitCodeForCreateErrorPar2CmdLine(err))
 }
 
 func testWriteParity(t *testing.T, workingDir string, useAbsPath bool) {
@@ -104,7 +140,7 @@ func testWriteParity(t *testing.T, workingDir string, useAbsPath bool) {
 		require.NoError(t, fs.MoveFile(path, filepath.Base(path)))
 	}
 
-	decoder, err := newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, parPath)
+	decoder, err := newDecoder(testFileIO{t, fs}, testDecoderDelegate{t}, parPath, 1)
 	require.NoError(t, err)
 
 	err = decoder.LoadFileData()
@@ -120,3 +156,33 @@ func testWriteParity(t *testing.T, workingDir string, useAbsPath bool) {
 func TestWriteParity(t *testing.T) {
 	runOnExampleWorkingDirs(t, testWriteParity)
 }
+
+// failingWriteFileIO is a fileIO whose WriteFile fails for
+// failingPath.
+type failingWriteFileIO struct {
+	fileIO
+	failingPath string
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (io failingWriteFileIO) WriteFile(path string, data []byte) error {
+	if path == io.failingPath {
+		return errWriteFailed
+	}
+	return io.fileIO.WriteFile(path, data)
+}
+
+func TestWriteParityCleanUpOnError(t *testing.T) {
+	dir := memfs.RootDir()
+	fs := makeEncoderMemFS(dir)
+	paths := fs.Paths()
+	fileIO := failingWriteFileIO{testFileIO{t, fs}, filepath.Join(dir, "parity.p02")}
+	encoder, err := newEncoder(fileIO, testEncoderDelegate{t}, paths, 3, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.Equal(t, errWriteFailed, encoder.Write(filepath.Join(dir, "parity.par")))
+	require.ElementsMatch(t, paths, fs.Paths())
+}
@@ -0,0 +1,125 @@
+package par1
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec8"
+)
+
+// A VolumeError is returned when a volume file can't be parsed or is
+// invalid.
+type VolumeError struct {
+	// Path is the path of the volume file.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *VolumeError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns e.Err.
+func (e *VolumeError) Unwrap() error {
+	return e.Err
+}
+
+// A MismatchError is returned when a value read from a volume file
+// doesn't match what's expected, e.g. a parity volume with a
+// different set hash from its index volume.
+type MismatchError struct {
+	// Path is the path of the volume file the value was read from.
+	Path string
+	// What describes the value, e.g. "set hash".
+	What string
+	// Expected and Actual are the expected and actual values.
+	Expected, Actual interface{}
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s: %s mismatch: expected %v, got %v", e.Path, e.What, e.Expected, e.Actual)
+}
+
+// An InvalidArgumentError is returned when an argument passed into a
+// function is invalid.
+type InvalidArgumentError struct {
+	// Arg is the name of the argument, e.g. "parPath".
+	Arg string
+	// Problem describes what's wrong with the argument, e.g.
+	// "must have a .par extension".
+	Problem string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.Arg + " " + e.Problem
+}
+
+// A RepairFailedError is returned when repaired data fails a
+// consistency check, which means that the volume files or the repair
+// itself are faulty.
+type RepairFailedError struct {
+	// Path is the path of the file whose repaired data failed
+	// the check, or empty if the check isn't for a particular
+	// file.
+	Path string
+	// Problem describes the failed check.
+	Problem string
+}
+
+func (e *RepairFailedError) Error() string {
+	if e.Path == "" {
+		return "repair failed: " + e.Problem
+	}
+	return fmt.Sprintf("repair of %s failed: %s", e.Path, e.Problem)
+}
+
+// exitCodeForErrorPar2CmdLine handles the errors common to all
+// commands for the ExitCodeFor*ErrorPar2CmdLine functions.
+func exitCodeForErrorPar2CmdLine(err error) int {
+	var invalidArgumentErr *InvalidArgumentError
+	var pathErr *fs.PathError
+	var volumeErr *VolumeError
+	var mismatchErr *MismatchError
+	switch {
+	case err == nil:
+		return par2cmdline.ExitSuccess
+	case errors.As(err, &invalidArgumentErr):
+		return par2cmdline.ExitInvalidCommandLineArguments
+	case errors.As(err, &volumeErr), errors.As(err, &mismatchErr):
+		return par2cmdline.ExitInsufficientCriticalData
+	case errors.As(err, &pathErr), errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return par2cmdline.ExitFileIOError
+	}
+	return par2cmdline.ExitLogicError
+}
+
+// ExitCodeForCreateErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Create.
+func ExitCodeForCreateErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForVerifyErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Verify. Note that a nil error doesn't mean that no repair is
+// needed; that has to be deduced from VerifyResult.FileCounts.
+func ExitCodeForVerifyErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForRepairErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Repair.
+func ExitCodeForRepairErrorPar2CmdLine(err error) int {
+	var repairFailedErr *RepairFailedError
+	if errors.As(err, &rsec8.NotEnoughParityShardsError{}) {
+		return par2cmdline.ExitRepairNotPossible
+	} else if errors.As(err, &repairFailedErr) {
+		return par2cmdline.ExitRepairFailed
+	}
+	return exitCodeForErrorPar2CmdLine(err)
+}
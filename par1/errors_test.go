@@ -0,0 +1,57 @@
+package par1
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeError(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	buildPARData(t, fs, 3)
+	perturbFile(t, fs, "file.par")
+
+	_, err := newDecoderForTest(t, fs, "file.par")
+	var volumeErr *VolumeError
+	require.True(t, errors.As(err, &volumeErr))
+	require.Equal(t, "file.par", volumeErr.Path)
+	require.Equal(t, par2cmdline.ExitInsufficientCriticalData, ExitCodeForVerifyErrorPar2CmdLine(err))
+}
+
+func TestExitCodeForErrorPar2CmdLine(t *testing.T) {
+	for _, test := range []struct {
+		err                error
+		createOrVerifyCode int
+		repairCode         int
+	}{
+		{nil, par2cmdline.ExitSuccess, par2cmdline.ExitSuccess},
+		{&InvalidArgumentError{"parPath", "must have a .par extension"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&VolumeError{"file.p01", errors.New("invalid control hash")}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.p01", "set hash", [16]byte{}, [16]byte{1}}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&VolumeError{"file.par", errors.New(`invalid filename "dir/file.rar"`)}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&VolumeError{"file.par", errors.New("no files saved in the volume set")}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.rar", "16k hash", [16]byte{}, [16]byte{1}}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&InvalidArgumentError{"filePaths", "must have distinct filenames, but file.rar appears more than once"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&InvalidArgumentError{"filePaths", "must contain at least one non-empty file"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&fs.PathError{Op: "open", Path: "file.par", Err: fs.ErrNotExist}, par2cmdline.ExitFileIOError, par2cmdline.ExitFileIOError},
+		{rsec8.NotEnoughParityShardsError{}, par2cmdline.ExitLogicError, par2cmdline.ExitRepairNotPossible},
+		{&RepairFailedError{"file.rar", "hash mismatch in reconstructed data"}, par2cmdline.ExitLogicError, par2cmdline.ExitRepairFailed},
+		{errors.New("some other error"), par2cmdline.ExitLogicError, par2cmdline.ExitLogicError},
+	} {
+		// Wrapping shouldn't change the exit code.
+		for _, err := range []error{test.err, fmt.Errorf("wrapped: %w", test.err)} {
+			if test.err == nil {
+				err = nil
+			}
+			require.Equal(t, test.createOrVerifyCode, ExitCodeForCreateErrorPar2CmdLine(err), "%v", err)
+			require.Equal(t, test.createOrVerifyCode, ExitCodeForVerifyErrorPar2CmdLine(err), "%v", err)
+			require.Equal(t, test.repairCode, ExitCodeForRepairErrorPar2CmdLine(err), "%v", err)
+		}
+	}
+}
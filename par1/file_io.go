@@ -1,10 +1,22 @@
 package par1
 
-import "io/ioutil"
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akalin/gopar/fsio"
+)
 
 type fileIO interface {
 	ReadFile(path string) ([]byte, error)
+	FindWithPrefixAndSuffix(prefix, suffix string) ([]string, error)
 	WriteFile(path string, data []byte) error
+	MoveFile(oldPath, newPath string) error
+	DeleteFile(path string) error
+	StatFile(path string) (fs.FileInfo, error)
+	SetFileInfo(path string, info fs.FileInfo) error
 }
 
 type defaultFileIO struct{}
@@ -13,6 +25,26 @@ func (io defaultFileIO) ReadFile(path string) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+func (io defaultFileIO) FindWithPrefixAndSuffix(prefix, suffix string) ([]string, error) {
+	return filepath.Glob(prefix + "*" + suffix)
+}
+
 func (io defaultFileIO) WriteFile(path string, data []byte) error {
-	return ioutil.WriteFile(path, data, 0600)
+	return fsio.WriteFileAtomic(path, data, 0600)
+}
+
+func (io defaultFileIO) MoveFile(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (io defaultFileIO) DeleteFile(path string) error {
+	return os.Remove(path)
+}
+
+func (io defaultFileIO) StatFile(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (io defaultFileIO) SetFileInfo(path string, info fs.FileInfo) error {
+	return fsio.SetFileInfo(path, info)
 }
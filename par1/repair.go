@@ -1,6 +1,11 @@
 package par1
 
-import "github.com/klauspost/reedsolomon"
+import (
+	"errors"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec8"
+)
 
 // RepairDelegate is just DecoderDelegate for now.
 type RepairDelegate interface {
@@ -18,9 +23,21 @@ type RepairOptions struct {
 	// If DoubleCheck is true, then extra checking is done after
 	// the repair to verify that the repaired shards are correct.
 	DoubleCheck bool
+	// The number of goroutines to use while reconstructing. If
+	// <= 0, NumGoroutinesDefault() is used.
+	NumGoroutines int
 	// The RepairDelegate to use. If nil, DoNothingRepairDelegate
 	// is used.
 	RepairDelegate RepairDelegate
+	// If KeepBackups is true, then a damaged data file is moved
+	// to the first of <path>.1, <path>.2, etc. that doesn't exist
+	// before the repaired file is written.
+	KeepBackups bool
+	// If Purge is true, then once the data files are intact,
+	// either because no repair was needed or because the repair
+	// succeeded, the par file, its parity volumes, and any
+	// backups made by the repair are removed.
+	Purge bool
 }
 
 // RepairResult holds the result of a Repair call.
@@ -28,6 +45,13 @@ type RepairResult struct {
 	// RepairedPaths contains the paths of the files that were
 	// repaired.
 	RepairedPaths []string
+	// BackupPaths contains the paths that damaged data files
+	// were moved to, if KeepBackups is set to true in
+	// RepairOptions.
+	BackupPaths []string
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in RepairOptions.
+	PurgedPaths []string
 }
 
 // Repair a par file at parPath with the given options. The returned
@@ -37,6 +61,25 @@ func Repair(parPath string, options RepairOptions) (RepairResult, error) {
 	return repair(defaultFileIO{}, parPath, options)
 }
 
+// RepairFS is like Repair, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the returned
+// RepairedPaths are names in fsys, but the paths passed to the
+// delegate are under fsio.Root().
+func RepairFS(fsys fsio.WriteFS, parPath string, options RepairOptions) (RepairResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	result, err := repair(p, p.Path(parPath), options)
+	for _, paths := range [][]string{result.RepairedPaths, result.BackupPaths, result.PurgedPaths} {
+		for i, path := range paths {
+			name, nameErr := p.Name(path)
+			if nameErr != nil {
+				return result, nameErr
+			}
+			paths[i] = name
+		}
+	}
+	return result, err
+}
+
 func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult, error) {
 	err := checkExtension(parPath)
 	if err != nil {
@@ -48,10 +91,16 @@ func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult,
 		delegate = DoNothingRepairDelegate{}
 	}
 
-	decoder, err := newDecoder(fileIO, delegate, parPath)
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	decoder, err := newDecoder(fileIO, delegate, parPath, numGoroutines)
 	if err != nil {
 		return RepairResult{}, err
 	}
+	decoder.keepBackups = options.KeepBackups
 
 	err = decoder.LoadFileData()
 	if err != nil {
@@ -64,14 +113,34 @@ func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult,
 	}
 
 	repairedPaths, err := decoder.Repair(options.DoubleCheck)
-	return RepairResult{
+	result := RepairResult{
 		RepairedPaths: repairedPaths,
-	}, err
+		BackupPaths:   decoder.backupPaths,
+	}
+	if err != nil || !options.Purge {
+		return result, err
+	}
+
+	// Repair checks the reconstructed data before writing it, so
+	// make sure that what was actually written matches, too,
+	// before removing the par files.
+	if len(repairedPaths) > 0 {
+		err = decoder.LoadFileData()
+		if err != nil {
+			return result, err
+		}
+		if decoder.FileCounts().RepairNeeded() {
+			return result, &RepairFailedError{Problem: "repaired files don't match their recorded hashes"}
+		}
+	}
+
+	result.PurgedPaths, err = decoder.Purge()
+	return result, err
 }
 
 // RepairErrorMeansRepairNecessaryButNotPossible returns true if the
 // error returned by Repair means that repair is necessary but not
 // possible.
 func RepairErrorMeansRepairNecessaryButNotPossible(err error) bool {
-	return err == reedsolomon.ErrTooFewShards
+	return errors.As(err, &rsec8.NotEnoughParityShardsError{})
 }
@@ -1,9 +1,18 @@
 package par1
 
 import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/memfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,6 +48,7 @@ func testRepair(t *testing.T, workingDir string, useAbsPath bool, options Repair
 	perturbFile(t, fs, "file.rar")
 	result, err = repair(testFileIO{t, fs}, parPath, options)
 	require.True(t, RepairErrorMeansRepairNecessaryButNotPossible(err))
+	require.True(t, RepairErrorMeansRepairNecessaryButNotPossible(fmt.Errorf("repair failed: %w", err)))
 	require.Equal(t, RepairResult{}, result)
 }
 
@@ -55,3 +65,150 @@ func TestRepairDefaults(t *testing.T) {
 		testRepair(t, workingDir, useAbsPath, RepairOptions{})
 	})
 }
+
+func TestRepairFS(t *testing.T) {
+	fs := makeDecoderMemFS(filepath.Join(memfs.RootDir(), "dir"))
+	buildPARData(t, fs, 3)
+
+	perturbFile(t, fs, "file.r04")
+	result, err := RepairFS(fs, "file.par", RepairOptions{
+		RepairDelegate: testRepairDelegate{testDecoderDelegate{t}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, RepairResult{
+		RepairedPaths: []string{"file.r04"},
+	}, result)
+
+	// Hide fs's WriteFile method.
+	readOnlyFS := struct{ iofs.FS }{fs}
+	perturbFile(t, fs, "file.r04")
+	decoder, err := NewDecoderFS(readOnlyFS, testDecoderDelegate{t}, "file.par")
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	_, err = decoder.Repair(false)
+	require.True(t, errors.Is(err, fsio.ErrReadOnly))
+}
+
+func TestRepairKeepBackupsAndPurge(t *testing.T) {
+	fs := makeDecoderMemFS(filepath.Join(memfs.RootDir(), "dir"))
+	buildPARData(t, fs, 3)
+
+	require.NoError(t, fs.WriteFile("file.r04.1", []byte{0x1}))
+	perturbFile(t, fs, "file.r04")
+	r04Data, err := fs.ReadFile("file.r04")
+	require.NoError(t, err)
+
+	result, err := RepairFS(fs, "file.par", RepairOptions{
+		RepairDelegate: testRepairDelegate{testDecoderDelegate{t}},
+		KeepBackups:    true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, RepairResult{
+		RepairedPaths: []string{"file.r04"},
+		BackupPaths:   []string{"file.r04.2"},
+	}, result)
+	backupData, err := fs.ReadFile("file.r04.2")
+	require.NoError(t, err)
+	require.Equal(t, r04Data, backupData)
+
+	// Missing files don't need a backup.
+	_, err = fs.RemoveFile("file.r02")
+	require.NoError(t, err)
+	result, err = RepairFS(fs, "file.par", RepairOptions{
+		RepairDelegate: testRepairDelegate{testDecoderDelegate{t}},
+		KeepBackups:    true,
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, RepairResult{
+		RepairedPaths: []string{"file.r02"},
+		PurgedPaths:   []string{"file.par", "file.p01", "file.p02", "file.p03"},
+	}, result)
+	require.ElementsMatch(t, []string{
+		"file.rar", "file.r01", "file.r02", "file.r03", "file.r04",
+		"file.r04.1", "file.r04.2",
+	}, memFSNames(t, fs))
+}
+
+// corruptingWriteFileIO is a fileIO whose WriteFile flips a bit of
+// the data written to corruptPath.
+type corruptingWriteFileIO struct {
+	fileIO
+	corruptPath string
+}
+
+func (io corruptingWriteFileIO) WriteFile(path string, data []byte) error {
+	if path == io.corruptPath && len(data) > 0 {
+		data = append([]byte(nil), data...)
+		data[0] ^= 0x1
+	}
+	return io.fileIO.WriteFile(path, data)
+}
+
+func TestRepairPurgeChecksRepairedFiles(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir")
+	fs := makeDecoderMemFS(workingDir)
+	buildPARData(t, fs, 3)
+
+	perturbFile(t, fs, "file.r04")
+	fileCount := fs.FileCount()
+	fileIO := corruptingWriteFileIO{testFileIO{t, fs}, filepath.Join(workingDir, "file.r04")}
+	result, err := repair(fileIO, filepath.Join(workingDir, "file.par"), RepairOptions{
+		RepairDelegate: testRepairDelegate{testDecoderDelegate{t}},
+		Purge:          true,
+	})
+	var repairFailedErr *RepairFailedError
+	require.True(t, errors.As(err, &repairFailedErr), "%v", err)
+	require.Equal(t, []string{filepath.Join(workingDir, "file.r04")}, result.RepairedPaths)
+	require.Nil(t, result.PurgedPaths)
+	require.Equal(t, fileCount, fs.FileCount())
+}
+
+func memFSNames(t *testing.T, fs memfs.MemFS) []string {
+	var names []string
+	for _, path := range fs.Paths() {
+		names = append(names, filepath.Base(path))
+	}
+	return names
+}
+
+func TestRepairFileInfo(t *testing.T) {
+	dir := t.TempDir()
+	rarPath := filepath.Join(dir, "file.rar")
+	r01Path := filepath.Join(dir, "file.r01")
+	require.NoError(t, ioutil.WriteFile(rarPath, []byte{0x1, 0x2, 0x3, 0x4, 0x5}, 0600))
+	require.NoError(t, ioutil.WriteFile(r01Path, []byte{0x6, 0x7, 0x8, 0x9}, 0600))
+
+	parPath := filepath.Join(dir, "file.par")
+	require.NoError(t, Create(parPath, []string{rarPath, r01Path}, CreateOptions{
+		NumParityFiles: 2,
+		CreateDelegate: testCreateDelegate{testEncoderDelegate{t}},
+	}))
+
+	// A damaged file keeps its metadata, and a missing one gets
+	// the defaults.
+	require.NoError(t, ioutil.WriteFile(r01Path, []byte{0x6, 0x7, 0x8, 0xa}, 0600))
+	require.NoError(t, os.Chmod(r01Path, 0640))
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(r01Path, modTime, modTime))
+	require.NoError(t, os.Remove(rarPath))
+
+	result, err := Repair(parPath, RepairOptions{
+		RepairDelegate: testRepairDelegate{testDecoderDelegate{t}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{rarPath, r01Path}, result.RepairedPaths)
+
+	r01Info, err := os.Stat(r01Path)
+	require.NoError(t, err)
+	require.True(t, modTime.Equal(r01Info.ModTime()))
+	rarInfo, err := os.Stat(rarPath)
+	require.NoError(t, err)
+	require.False(t, modTime.Equal(rarInfo.ModTime()))
+	// Windows only supports a read-only bit.
+	if runtime.GOOS != "windows" {
+		require.Equal(t, iofs.FileMode(0640), r01Info.Mode().Perm())
+		require.Equal(t, fsio.RestoredFilePerm, rarInfo.Mode().Perm())
+	}
+}
@@ -1,5 +1,11 @@
 package par1
 
+import (
+	"io/fs"
+
+	"github.com/akalin/gopar/fsio"
+)
+
 // VerifyDelegate is just DecoderDelegate for now.
 type VerifyDelegate interface {
 	DecoderDelegate
@@ -13,6 +19,9 @@ type DoNothingVerifyDelegate struct {
 
 // VerifyOptions holds all the options for Verify.
 type VerifyOptions struct {
+	// The number of goroutines to use while verifying. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
 	// If VerifyAllData is true, then check whether all data and
 	// parity files contain correct data even if no missing or
 	// corrupt files are detected.
@@ -20,6 +29,11 @@ type VerifyOptions struct {
 	// The VerifyDelegate to use. If nil, DoNothingVerifyDelegate
 	// is used.
 	VerifyDelegate VerifyDelegate
+	// If Purge is true, then if no repair is needed (and, if
+	// VerifyAllData is true, all data is ok), the par file and
+	// its parity volumes are removed. This requires the file
+	// system passed to VerifyFS to be a fsio.RemoveFS.
+	Purge bool
 }
 
 // VerifyResult holds the result of a Verify call.
@@ -32,6 +46,9 @@ type VerifyResult struct {
 	// FileCounts.AllFilesUsable() returns true, and contains
 	// false otherwise.
 	AllDataOk bool
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in VerifyOptions.
+	PurgedPaths []string
 }
 
 // Verify a par file at parPath with the given options. The returned
@@ -40,6 +57,22 @@ func Verify(parPath string, options VerifyOptions) (VerifyResult, error) {
 	return verify(defaultFileIO{}, parPath, options)
 }
 
+// VerifyFS is like Verify, except that it reads files from fsys
+// instead of the OS file system, and parPath is a name in fsys. The
+// paths passed to the delegate are under fsio.Root().
+func VerifyFS(fsys fs.FS, parPath string, options VerifyOptions) (VerifyResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	result, err := verify(p, p.Path(parPath), options)
+	for i, path := range result.PurgedPaths {
+		name, nameErr := p.Name(path)
+		if nameErr != nil {
+			return result, nameErr
+		}
+		result.PurgedPaths[i] = name
+	}
+	return result, err
+}
+
 func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult, error) {
 	err := checkExtension(parPath)
 	if err != nil {
@@ -51,7 +84,12 @@ func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult,
 		delegate = DoNothingVerifyDelegate{}
 	}
 
-	decoder, err := newDecoder(fileIO, delegate, parPath)
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	decoder, err := newDecoder(fileIO, delegate, parPath, numGoroutines)
 	if err != nil {
 		return VerifyResult{}, err
 	}
@@ -75,8 +113,16 @@ func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult,
 			return VerifyResult{}, err
 		}
 	}
+	var purgedPaths []string
+	if options.Purge && !fileCounts.RepairNeeded() && (allDataOk || !options.VerifyAllData) {
+		purgedPaths, err = decoder.Purge()
+		if err != nil {
+			return VerifyResult{}, err
+		}
+	}
 	return VerifyResult{
-		FileCounts: fileCounts,
-		AllDataOk:  allDataOk,
+		FileCounts:  fileCounts,
+		AllDataOk:   allDataOk,
+		PurgedPaths: purgedPaths,
 	}, nil
 }
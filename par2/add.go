@@ -0,0 +1,224 @@
+package par2
+
+import (
+	"crypto/md5"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/akalin/gopar/gf2p16"
+)
+
+// AddDelegate extends UpdateDelegate with methods that are called
+// while loading data files.
+type AddDelegate interface {
+	UpdateDelegate
+	OnDataFileLoad(i, n int, path string, byteCount int, err error)
+	OnShiftedDataFileLoad(path string, byteCount int, err error)
+}
+
+// DoNothingAddDelegate is an implementation of AddDelegate that does
+// nothing for all methods.
+type DoNothingAddDelegate struct {
+	DoNothingUpdateDelegate
+}
+
+// OnDataFileLoad implements the AddDelegate interface.
+func (DoNothingAddDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {}
+
+// OnShiftedDataFileLoad implements the AddDelegate interface.
+func (DoNothingAddDelegate) OnShiftedDataFileLoad(path string, byteCount int, err error) {}
+
+// AddOptions holds all the options for Add.
+type AddOptions struct {
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
+	// The AddDelegate to use. If nil, DoNothingAddDelegate is
+	// used.
+	AddDelegate AddDelegate
+}
+
+// AddResult holds the result of an Add call.
+type AddResult struct {
+	// ShiftedPaths contains the paths of the existing data files
+	// that had to be read again, since the added files were
+	// sorted before them in the recovery set.
+	ShiftedPaths []string
+}
+
+// Add adds the given data files to the recovery set of the par file
+// at parPath, rewriting it and all its parity volumes.
+//
+// In the PAR2 Vandermonde matrix, the data shard with index j
+// contributes g_j^e times itself to the recovery packet with exponent
+// e, independently of every other data shard. Therefore, the new
+// files' contributions can be added to the existing recovery packets
+// without reading the existing data files, as long as none of the
+// existing data shards change index. However, the recovery set is
+// ordered by file ID, so the new files may be sorted in between
+// existing files, which shifts the data shards of every existing file
+// after them to a new index, and thus a new generator. The
+// contributions of such shifted files must be recomputed, so they
+// are read again (and checked against their file descriptions); this
+// is reported through AddDelegate.OnShiftedDataFileLoad and
+// AddResult.ShiftedPaths.
+func Add(parPath string, filePaths []string, options AddOptions) (AddResult, error) {
+	return add(defaultFileIO{}, parPath, filePaths, options)
+}
+
+type addedFileInfo struct {
+	fileID                fileID
+	fileDescriptionPacket fileDescriptionPacket
+	ifscPacket            ifscPacket
+	dataShards            [][]byte
+}
+
+func add(fileIO fileIO, parPath string, filePaths []string, options AddOptions) (AddResult, error) {
+	if len(filePaths) == 0 {
+		return AddResult{}, &InvalidArgumentError{"filePaths", "must not be empty"}
+	}
+
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	delegate := options.AddDelegate
+	if delegate == nil {
+		delegate = DoNothingAddDelegate{}
+	}
+
+	indexFile, volumes, err := loadParitySet(fileIO, delegate, parPath)
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	absParPath, err := filepath.Abs(parPath)
+	if err != nil {
+		return AddResult{}, err
+	}
+	basePath := filepath.Dir(absParPath)
+
+	sliceByteCount := indexFile.mainPacket.sliceByteCount
+	recoverySet := indexFile.mainPacket.recoverySet
+
+	existing := make(map[fileID]bool)
+	for _, fileID := range recoverySet {
+		existing[fileID] = true
+	}
+	for _, fileID := range indexFile.mainPacket.nonRecoverySet {
+		existing[fileID] = true
+	}
+
+	var addedInfos []addedFileInfo
+	for i, path := range filePaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return AddResult{}, err
+		}
+		relPath, err := filepath.Rel(basePath, absPath)
+		if err != nil {
+			return AddResult{}, err
+		}
+		if relPath[0] == '.' {
+			return AddResult{}, &InvalidArgumentError{"filePaths", "must all lie in basePath"}
+		}
+
+		data, err := fileIO.ReadFile(absPath)
+		delegate.OnDataFileLoad(i+1, len(filePaths), absPath, len(data), err)
+		if err != nil {
+			return AddResult{}, err
+		}
+
+		fileID, fileDescriptionPacket, ifscPacket, dataShards := computeDataFileInfo(sliceByteCount, relPath, data)
+		if existing[fileID] {
+			return AddResult{}, &InvalidArgumentError{"filePaths", fmt.Sprintf("must not contain files already in %s, but %s is", parPath, absPath)}
+		}
+		existing[fileID] = true
+		addedInfos = append(addedInfos, addedFileInfo{fileID, fileDescriptionPacket, ifscPacket, dataShards})
+	}
+
+	oldStarts, _, err := dataShardStarts(recoverySet, indexFile.ifscPackets)
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	newRecoverySet := make([]fileID, len(recoverySet))
+	copy(newRecoverySet, recoverySet)
+	addedFileDescriptionPackets := make(map[fileID]fileDescriptionPacket)
+	addedIFSCPackets := make(map[fileID]ifscPacket)
+	newIFSCPackets := make(map[fileID]ifscPacket)
+	for fileID, packet := range indexFile.ifscPackets {
+		newIFSCPackets[fileID] = packet
+	}
+	for _, info := range addedInfos {
+		newRecoverySet = append(newRecoverySet, info.fileID)
+		addedFileDescriptionPackets[info.fileID] = info.fileDescriptionPacket
+		addedIFSCPackets[info.fileID] = info.ifscPacket
+		newIFSCPackets[info.fileID] = info.ifscPacket
+	}
+	sort.Slice(newRecoverySet, func(i, j int) bool {
+		return fileIDLess(newRecoverySet[i], newRecoverySet[j])
+	})
+
+	newStarts, newDataShardCount, err := dataShardStarts(newRecoverySet, newIFSCPackets)
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	coder, hasRecoveryPackets, err := newParityVolumeCoder(volumes, sliceByteCount, newDataShardCount, numGoroutines)
+	if err != nil {
+		return AddResult{}, err
+	}
+
+	var result AddResult
+	if hasRecoveryPackets {
+		for _, info := range addedInfos {
+			addToRecoveryPackets(volumes, newStarts[info.fileID], info.dataShards, coder.ParityCoefficient)
+		}
+
+		for _, fileID := range recoverySet {
+			oldStart := oldStarts[fileID]
+			newStart := newStarts[fileID]
+			if oldStart == newStart {
+				continue
+			}
+
+			description := indexFile.fileDescriptionPackets[fileID]
+			path := filepath.Join(basePath, description.filename)
+			data, err := fileIO.ReadFile(path)
+			if err == nil {
+				if len(data) != description.byteCount {
+					err = &MismatchError{path, "shifted data file byte count", description.byteCount, len(data)}
+				} else if hash := md5.Sum(data); hash != description.hash {
+					err = &MismatchError{path, "shifted data file hash", description.hash, hash}
+				}
+			}
+			delegate.OnShiftedDataFileLoad(path, len(data), err)
+			if err != nil {
+				return result, err
+			}
+			result.ShiftedPaths = append(result.ShiftedPaths, path)
+
+			// Remove the contribution from the old index and
+			// add the contribution from the new index in one
+			// go.
+			_, _, _, dataShards := computeDataFileInfo(sliceByteCount, description.filename, data)
+			addToRecoveryPackets(volumes, newStart, dataShards, func(e, j int) gf2p16.T {
+				return coder.ParityCoefficient(e, j).Plus(coder.ParityCoefficient(e, j-newStart+oldStart))
+			})
+		}
+	}
+
+	newMainPacket := mainPacket{
+		sliceByteCount: sliceByteCount,
+		recoverySet:    newRecoverySet,
+		nonRecoverySet: indexFile.mainPacket.nonRecoverySet,
+	}
+
+	err = writeParitySet(fileIO, delegate, parPath, indexFile, volumes, func(f file) file {
+		return replaceFilePackets(f, &newMainPacket, nil, addedFileDescriptionPackets, addedIFSCPackets)
+	})
+	return result, err
+}
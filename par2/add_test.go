@@ -0,0 +1,100 @@
+package par2
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/stretchr/testify/require"
+)
+
+type testAddDelegate struct {
+	testUpdateDelegate
+}
+
+func (d testAddDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnDataFileLoad(%d, %d, %s, byteCount=%d, %v)", i, n, path, byteCount, err)
+}
+
+func (d testAddDelegate) OnShiftedDataFileLoad(path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnShiftedDataFileLoad(%s, byteCount=%d, %v)", path, byteCount, err)
+}
+
+func testAdd(t *testing.T, newData []byte, expectedShiftedFilenames []string) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+	r03Path := "file.r03"
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	// Build the expected parity data from scratch.
+	expectedFS := makeUpdateMemFS(workingDir)
+	require.NoError(t, expectedFS.WriteFile(r03Path, newData))
+	buildPAR2Data(t, expectedFS, workingDir, 4, 3)
+
+	require.NoError(t, fs.WriteFile(r03Path, newData))
+	parPath := filepath.Join(workingDir, "file.par2")
+	result, err := add(testFileIO{t, fs}, parPath, []string{filepath.Join(workingDir, r03Path)}, AddOptions{
+		AddDelegate: testAddDelegate{testUpdateDelegate{t}},
+	})
+	require.NoError(t, err)
+
+	var expectedShiftedPaths []string
+	for _, filename := range expectedShiftedFilenames {
+		expectedShiftedPaths = append(expectedShiftedPaths, filepath.Join(workingDir, filename))
+	}
+	require.Equal(t, toSortedStrings(expectedShiftedPaths), toSortedStrings(result.ShiftedPaths))
+
+	for _, path := range expectedFS.Paths() {
+		expectedData, err := expectedFS.ReadFile(path)
+		require.NoError(t, err)
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expectedData, data, "path=%s", path)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	// The recovery set of the files in makeUpdateMemFS is
+	// ordered as file.r02, file.rar, file.r01. The data below is
+	// chosen to make file.r03 sort in various positions.
+	for _, tc := range []struct {
+		newData                  []byte
+		expectedShiftedFilenames []string
+	}{
+		{[]byte{0xd, 0xe, 0x0}, nil},
+		{[]byte{0xd, 0xe, 0x4}, []string{"file.rar", "file.r01"}},
+		{[]byte{0xd, 0xe, 0x8}, []string{"file.r02", "file.rar", "file.r01"}},
+	} {
+		tc := tc
+		t.Run(fmt.Sprintf("newData=%x", tc.newData), func(t *testing.T) {
+			testAdd(t, tc.newData, tc.expectedShiftedFilenames)
+		})
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	parPath := filepath.Join(workingDir, "file.par2")
+
+	_, err := add(testFileIO{t, fs}, parPath, []string{filepath.Join(workingDir, "file.rar")}, AddOptions{})
+	require.Equal(t, &InvalidArgumentError{"filePaths", fmt.Sprintf("must not contain files already in %s, but %s is", parPath, filepath.Join(workingDir, "file.rar"))}, err)
+
+	// This makes file.r03 sort first, so file.r02 has to be read
+	// again.
+	require.NoError(t, fs.WriteFile("file.r03", []byte{0xd, 0xe, 0x8}))
+	perturbFile(t, fs, "file.r02")
+	_, err = add(testFileIO{t, fs}, parPath, []string{filepath.Join(workingDir, "file.r03")}, AddOptions{})
+	var mismatchErr *MismatchError
+	require.True(t, errors.As(err, &mismatchErr), "%v", err)
+	require.Equal(t, filepath.Join(workingDir, "file.r02"), mismatchErr.Path)
+	require.Equal(t, "shifted data file hash", mismatchErr.What)
+}
@@ -1,75 +1,138 @@
 package par2
 
 import (
+	"encoding/binary"
 	"hash/crc32"
+	"math/bits"
+	"sync"
+
+	"github.com/akalin/gopar/gf2"
 )
 
 type crc32Window struct {
 	windowSize              int
 	crcOldLeaderMaskedTable [256]uint32
+	// leaderTables[k][i] is crcOldLeaderMaskedTable[i] shifted
+	// by k zero bytes; see rollStrideRegister.
+	leaderTables *[rollStride][256]uint32
+}
+
+// rollStride is the number of offsets that rollStrideRegister
+// advances by, which is the number of bytes in a uint64.
+const rollStride = 8
+
+var slicingTablesOnce sync.Once
+var slicingTables *[rollStride][256]uint32
+
+// crc32ShiftZeroByte returns the CRC register, i.e. the complement
+// of the crc as in crc32.simpleUpdate, after feeding a zero byte to
+// register t.
+func crc32ShiftZeroByte(t uint32) uint32 {
+	return crc32.IEEETable[byte(t)] ^ (t >> 8)
+}
+
+// getSlicingTables returns the tables for slicing-by-rollStride,
+// where getSlicingTables()[k][i] is the CRC register after feeding
+// byte i followed by k zero bytes to a zero register, computing them
+// the first time it's called, so that nothing is paid for them
+// unless they're needed.
+func getSlicingTables() *[rollStride][256]uint32 {
+	slicingTablesOnce.Do(func() {
+		var tables [rollStride][256]uint32
+		tables[0] = *crc32.IEEETable
+		for k := 1; k < rollStride; k++ {
+			for i := range tables[k] {
+				tables[k][i] = crc32ShiftZeroByte(tables[k-1][i])
+			}
+		}
+		slicingTables = &tables
+	})
+	return slicingTables
+}
+
+// ieeeModulus is the polynomial for crc32.IEEE, including its x^32
+// term, with its bits in non-reflected order, i.e.
+// 0x100000000 | bits.Reverse32(crc32.IEEE).
+const ieeeModulus gf2.Poly64 = 0x104c11db7
+
+// crcz32ByteShifted returns crcz(b.00..), where . denotes
+// concatenation, .. denotes n trailing 0s, and crcz is the function
+// such that
+//
+//	crc(a) = ffffffff ^ crcz(ffffffff.. ^ a),
+//
+// given xPow = x^(8n) mod ieeeModulus.
+func crcz32ByteShifted(b byte, xPow gf2.Poly64) uint32 {
+	// crcz treats its input as a polynomial with the low bit of
+	// the first byte as the leading coefficient, multiplies it by
+	// x^32, reduces it mod ieeeModulus, and returns the result
+	// with its bits reflected.
+	t := (gf2.Poly64(bits.Reverse8(b)) << 32).TimesMod(xPow, ieeeModulus)
+	return bits.Reverse32(uint32(t))
 }
 
 func newCRC32Window(windowSize int) *crc32Window {
 	if windowSize < 4 {
 		panic("window size too small")
 	}
-	a := make([]byte, windowSize+1)
-	crc0 := crc32.ChecksumIEEE(a)
 
 	// See comments in crc32Window.update below for why we need
-	// crcWindowMask.
-	a[0] = 0xff
-	a[4] = 0xff
-	crcWindowMask := crc32.ChecksumIEEE(a)
-
-	// Set baseTable[i] to crc((1 << i)..) for 0 <= i < 8,
-	// where .. denotes padding with trailing 0s to have length
-	// windowSize+1.
-	a[4] = 0
+	// maskedTable[i] = crc(i..) ^ crc(ff000000ff..) for
+	// 0 <= i < 256, where .. denotes padding with trailing 0s to
+	// have length windowSize+1.
+	//
+	// From the identity
+	//
+	//   crcz(a ^ b) = crcz(a) ^ crcz(b)
+	//
+	// we can deduce that
+	//
+	//   crc(a) ^ crc(b) = crcz(a) ^ crcz(b)
+	//
+	// for a and b of the same length, so we can compute
+	// maskedTable using crcz instead, which lets us avoid
+	// computing crcs of windowSize+1 bytes. Furthermore, leading
+	// 0s don't change crcz, so
+	//
+	//   crcz(ff000000ff..) = crcz(ff..) ^ crcz(ff...),
+	//
+	// where ... denotes padding with trailing 0s to have length
+	// windowSize-3.
+	xPow := gf2.Poly64(2).PowMod(8*uint64(windowSize), ieeeModulus)
+	xPowMinus4 := gf2.Poly64(2).PowMod(8*uint64(windowSize-4), ieeeModulus)
+	crczWindowMask := crcz32ByteShifted(0xff, xPow) ^ crcz32ByteShifted(0xff, xPowMinus4)
+
+	// Set baseTable[i] to crcz((1 << i)..) for 0 <= i < 8.
 	var baseTable [8]uint32
 	for i := uint(0); i < 8; i++ {
-		a[0] = byte(1 << i)
-		baseTable[i] = crc32.ChecksumIEEE(a)
+		baseTable[i] = crcz32ByteShifted(byte(1<<i), xPow)
 	}
 
 	var maskedTable [256]uint32
-	// Set maskedTable[i] to crc(i..) ^ crcWindowMask for
-	// 0 <= i < 256.
-	maskedTable[0] = crc0 ^ crcWindowMask
-	for i := 1; i < 256; i++ {
-		// Compute crc(i..) using baseTable and the identities
-		//
-		//   crc(a_1 ^ ... ^ a_n) = crc(a_1) ^ ... ^ crc(a^n)
-		//
-		// for odd n, and
-		//
-		//   crc(a_1 ^ ... ^ a_n) =
-		//     crc(a_1) ^ ... ^ crc(a^n) ^ crc(0..)
-		//
-		// for even n, which can be deduced from letting
-		//
-		//   crc(a) = ffffffff ^ crcz(ffffffff.. ^ a)
-		//
-		// and the identity
-		//
-		//   crcz(a ^ b) = crcz(a) ^ crcz(b).
-		var crc uint32
-		crcCount := 0
+	for i := 0; i < 256; i++ {
+		// Compute crcz(i..) from baseTable, using the
+		// identity for crcz(a ^ b) above.
+		var crcz uint32
 		for j := uint(0); j < 8; j++ {
 			if i&(1<<j) != 0 {
-				crc ^= baseTable[j]
-				crcCount++
+				crcz ^= baseTable[j]
 			}
 		}
-		if crcCount%2 == 0 {
-			crc ^= crc0
+		maskedTable[i] = crcz ^ crczWindowMask
+	}
+
+	var leaderTables [rollStride][256]uint32
+	leaderTables[0] = maskedTable
+	for k := 1; k < rollStride; k++ {
+		for i := range leaderTables[k] {
+			leaderTables[k][i] = crc32ShiftZeroByte(leaderTables[k-1][i])
 		}
-		maskedTable[i] = crc ^ crcWindowMask
 	}
 
 	return &crc32Window{
 		windowSize:              windowSize,
 		crcOldLeaderMaskedTable: maskedTable,
+		leaderTables:            &leaderTables,
 	}
 }
 
@@ -126,3 +189,154 @@ func (w *crc32Window) update(crc uint32, oldLeader, newTrailer byte) uint32 {
 	// table indexed by a[0], which is precisely crcOldLeaderMasked.
 	return crcExtended ^ crcOldLeaderMasked
 }
+
+// A crc32Filter is a bitset of CRCs, which is used to quickly rule
+// out most CRCs that aren't in a given set without having to look
+// them up in a map.
+type crc32Filter struct {
+	mask uint32
+	bits []uint64
+}
+
+func newCRC32Filter(crcs []uint32) crc32Filter {
+	// Use at least 64 bits per CRC, so that at most 1/64 of
+	// unrelated CRCs pass the filter. Each candidate costs a
+	// lookup, and ends rollUntil's fast path, so a sparse filter
+	// is worth its memory, which is still much less than that
+	// of the checksums themselves.
+	bitCount := 1 << 10
+	for bitCount < 64*len(crcs) && bitCount < 1<<30 {
+		bitCount <<= 1
+	}
+	f := crc32Filter{
+		mask: uint32(bitCount - 1),
+		bits: make([]uint64, bitCount/64),
+	}
+	for _, crc := range crcs {
+		i := crc & f.mask
+		f.bits[i/64] |= 1 << (i % 64)
+	}
+	return f
+}
+
+// mayContain returns false if crc is definitely not in the set the
+// filter was made from.
+func (f crc32Filter) mayContain(crc uint32) bool {
+	return f.bit(crc) != 0
+}
+
+// bit returns 1 if crc may be in the set the filter was made from,
+// and 0 if it's definitely not, so that the results for several CRCs
+// can be combined without branching.
+func (f crc32Filter) bit(crc uint32) uint {
+	i := crc & f.mask
+	return uint(f.bits[i/64]>>(i%64)) & 1
+}
+
+// rollStrideRegister returns the CRC register, i.e. the complement
+// of the crc, of a window after rolling it forward by rollStride
+// bytes, given its register t, the rollStride bytes leaving it as
+// the little-endian word leaders, and the rollStride bytes entering
+// it as the little-endian word trailers. It does so with a table
+// lookup per byte, all of which are independent of each other,
+// instead of a chain of rollStride updates.
+func (w *crc32Window) rollStrideRegister(slicingTables *[rollStride][256]uint32, t uint32, leaders, trailers uint64) uint32 {
+	// Rolling by one byte maps t to
+	//
+	//   T[byte(t) ^ newTrailer] ^ (t >> 8) ^ L[oldLeader],
+	//
+	// where T is crc32.IEEETable and L is
+	// crcOldLeaderMaskedTable; see update below. This is linear
+	// in t and in the table entries, so unrolling it rollStride
+	// times, as in slicing-by-8, gives the XOR of the entries of
+	// the slicing tables for the bytes of t XORed with the first
+	// four new trailers and for the remaining new trailers, and
+	// of the entries of the leader tables for the old leaders,
+	// each shifted by the number of bytes fed in after it.
+	s := slicingTables
+	l := w.leaderTables
+	x := uint64(t) ^ trailers
+	return s[7][byte(x)] ^
+		s[6][byte(x>>8)] ^
+		s[5][byte(x>>16)] ^
+		s[4][byte(x>>24)] ^
+		s[3][byte(x>>32)] ^
+		s[2][byte(x>>40)] ^
+		s[1][byte(x>>48)] ^
+		s[0][byte(x>>56)] ^
+		l[7][byte(leaders)] ^
+		l[6][byte(leaders>>8)] ^
+		l[5][byte(leaders>>16)] ^
+		l[4][byte(leaders>>24)] ^
+		l[3][byte(leaders>>32)] ^
+		l[2][byte(leaders>>40)] ^
+		l[1][byte(leaders>>48)] ^
+		l[0][byte(leaders>>56)]
+}
+
+// rollUntil rolls crc, the crc of the window starting at offset
+// start-1 of data, forward, and stops at the first offset j in
+// [start, end) whose window's crc may be in f, or at end. It returns
+// j and the crc of the window starting at j-1. Every window must fit
+// in data.
+//
+// Rolling one byte at a time is a chain of dependent table lookups,
+// each of which has to wait for the previous one. Instead, rollUntil
+// advances rollStride offsets at a time with rollStrideRegister,
+// whose lookups are independent, and then fills in the offsets in
+// between by rolling forward from the start of the stride, which is
+// off of the chain from stride to stride, so that it can run in
+// parallel with the following strides. The windows of a stride are
+// checked against f all at once, and only a stride with a candidate
+// is looked at offset by offset. The offsets left over at the end
+// are handled by rollUntilScalar.
+func (w *crc32Window) rollUntil(crc uint32, data []byte, start, end int, f crc32Filter) (int, uint32) {
+	n := w.windowSize
+	slicingTables := getSlicingTables()
+	table := crc32.IEEETable
+	leaderTable := &w.crcOldLeaderMaskedTable
+	t := ^crc
+	j := start
+	for ; j+rollStride <= end; j += rollStride {
+		leaders := binary.LittleEndian.Uint64(data[j-1:])
+		trailers := binary.LittleEndian.Uint64(data[j-1+n:])
+		next := w.rollStrideRegister(slicingTables, t, leaders, trailers)
+
+		// Check the windows in between and next against f
+		// all at once, and find the first candidate, if any,
+		// without branching on each window.
+		u1 := table[byte(t)^byte(trailers)] ^ (t >> 8) ^ leaderTable[byte(leaders)]
+		u2 := table[byte(u1)^byte(trailers>>8)] ^ (u1 >> 8) ^ leaderTable[byte(leaders>>8)]
+		u3 := table[byte(u2)^byte(trailers>>16)] ^ (u2 >> 8) ^ leaderTable[byte(leaders>>16)]
+		u4 := table[byte(u3)^byte(trailers>>24)] ^ (u3 >> 8) ^ leaderTable[byte(leaders>>24)]
+		u5 := table[byte(u4)^byte(trailers>>32)] ^ (u4 >> 8) ^ leaderTable[byte(leaders>>32)]
+		u6 := table[byte(u5)^byte(trailers>>40)] ^ (u5 >> 8) ^ leaderTable[byte(leaders>>40)]
+		u7 := table[byte(u6)^byte(trailers>>48)] ^ (u6 >> 8) ^ leaderTable[byte(leaders>>48)]
+		candidates := f.bit(^u1) | f.bit(^u2)<<1 | f.bit(^u3)<<2 | f.bit(^u4)<<3 |
+			f.bit(^u5)<<4 | f.bit(^u6)<<5 | f.bit(^u7)<<6 | f.bit(^next)<<7
+		if candidates != 0 {
+			k := bits.TrailingZeros(candidates)
+			prevs := [rollStride]uint32{t, u1, u2, u3, u4, u5, u6, u7}
+			return j + k, ^prevs[k]
+		}
+		t = next
+	}
+	return w.rollUntilScalar(^t, data, j, end, f)
+}
+
+// rollUntilScalar is like rollUntil, except that it calls w.update
+// to roll crc forward one byte at a time.
+func (w *crc32Window) rollUntilScalar(crc uint32, data []byte, start, end int, f crc32Filter) (int, uint32) {
+	n := w.windowSize
+	// Hint to the compiler that all accesses below are in
+	// bounds.
+	_ = data[start-1 : end-1+n]
+	for j := start; j < end; j++ {
+		next := w.update(crc, data[j-1], data[j-1+n])
+		if f.mayContain(next) {
+			return j, crc
+		}
+		crc = next
+	}
+	return end, crc
+}
@@ -3,31 +3,14 @@ package par2
 import (
 	"fmt"
 	"hash/crc32"
+	"math/bits"
+	"math/rand"
 	"testing"
 
 	"github.com/akalin/gopar/gf2"
 	"github.com/stretchr/testify/require"
 )
 
-// TODO: Use math.bits when it becomes available in Go 1.9.
-
-const m0 = 0x5555555555555555 // 01010101 ...
-const m1 = 0x3333333333333333 // 00110011 ...
-const m2 = 0x0f0f0f0f0f0f0f0f // 00001111 ...
-const m3 = 0x00ff00ff00ff00ff // etc.
-
-func reverse32(x uint32) uint32 {
-	const m = 1<<32 - 1
-	x = x>>1&(m0&m) | x&(m0&m)<<1
-	x = x>>2&(m1&m) | x&(m1&m)<<2
-	x = x>>4&(m2&m) | x&(m2&m)<<4
-	x = x>>8&(m3&m) | x&(m3&m)<<8
-	return x>>16 | x<<16
-}
-
-// ieeeModulus is 0x100000000 | reverse32(crc32.IEEE).
-const ieeeModulus = 0x104c11db7
-
 // crcz32 is the function such that
 //
 //   crc32.ChecksumIEEE(a) = ffffffff ^ crcz(ffffffff.. ^ a).
@@ -39,10 +22,10 @@ func crcz32(p []byte) uint32 {
 // where reverseBytes() maps math.bits.Reverse8 over all bytes of a,
 // given crcz32(a) and n. n must be less than 32.
 func crcz32ReverseBytesShiftLeft(crcz uint32, n uint) uint32 {
-	t := gf2.Poly64(reverse32(crcz))
+	t := gf2.Poly64(bits.Reverse32(crcz))
 	t <<= n
 	_, t = t.Div(ieeeModulus)
-	return reverse32(uint32(t))
+	return bits.Reverse32(uint32(t))
 }
 
 func TestCRCZ32ReverseBytesShiftLeft(t *testing.T) {
@@ -92,6 +75,32 @@ func TestCRCShiftLeftReversed(t *testing.T) {
 	require.Equal(t, crc32(aSL31), crc32ReverseBytesShiftLeft(crc, crc05, crc08, 31))
 }
 
+func TestCRCZ32ByteShifted(t *testing.T) {
+	for _, n := range []int{0, 1, 4, 5, 100} {
+		xPow := gf2.Poly64(2).PowMod(8*uint64(n), ieeeModulus)
+		for i := 0; i < 256; i++ {
+			a := make([]byte, n+1)
+			a[0] = byte(i)
+			require.Equal(t, crcz32(a), crcz32ByteShifted(byte(i), xPow), "n=%d, i=%d", n, i)
+		}
+	}
+}
+
+func TestNewCRC32WindowTable(t *testing.T) {
+	for _, windowSize := range []int{4, 5, 16, 100} {
+		w := newCRC32Window(windowSize)
+		a := make([]byte, windowSize+1)
+		a[0] = 0xff
+		a[4] = 0xff
+		crcWindowMask := crc32.ChecksumIEEE(a)
+		a[4] = 0
+		for i := 0; i < 256; i++ {
+			a[0] = byte(i)
+			require.Equal(t, crc32.ChecksumIEEE(a)^crcWindowMask, w.crcOldLeaderMaskedTable[i], "windowSize=%d, i=%d", windowSize, i)
+		}
+	}
+}
+
 func testCRC32Window(t *testing.T, windowSize, updateCount int) {
 	w := newCRC32Window(windowSize)
 
@@ -135,6 +144,67 @@ func TestCRC32Window(t *testing.T) {
 	})
 }
 
+func TestCRC32Filter(t *testing.T) {
+	crcs := []uint32{0, 1, 0xdeadbeef, 0xffffffff}
+	f := newCRC32Filter(crcs)
+	for _, crc := range crcs {
+		require.True(t, f.mayContain(crc))
+	}
+	require.False(t, f.mayContain(2))
+	require.False(t, f.mayContain(0xdeadbeee))
+}
+
+func TestCRC32WindowRollUntil(t *testing.T) {
+	windowSize := 8
+	w := newCRC32Window(windowSize)
+
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	target := 50
+	f := newCRC32Filter([]uint32{crc32.ChecksumIEEE(data[target : target+windowSize])})
+
+	j, crc := w.rollUntil(crc32.ChecksumIEEE(data[:windowSize]), data, 1, len(data)-windowSize+1, f)
+	require.Equal(t, target, j)
+	require.Equal(t, crc32.ChecksumIEEE(data[j-1:j-1+windowSize]), crc)
+
+	j, crc = w.rollUntil(crc32.ChecksumIEEE(data[:windowSize]), data, 1, 40, f)
+	require.Equal(t, 40, j)
+	require.Equal(t, crc32.ChecksumIEEE(data[j-1:j-1+windowSize]), crc)
+}
+
+func TestCRC32WindowRollUntilMatchesScalar(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for _, windowSize := range []int{4, 5, 16, 100} {
+		w := newCRC32Window(windowSize)
+		data := make([]byte, 1000)
+		_, err := rand.Read(data)
+		require.NoError(t, err)
+
+		// Try sparse and dense filters, so that candidates
+		// land in every position of a stride.
+		for _, crcCount := range []int{1, 10, 100, 1000} {
+			var crcs []uint32
+			for i := 0; i < crcCount; i++ {
+				j := rand.Intn(len(data) - windowSize + 1)
+				crcs = append(crcs, crc32.ChecksumIEEE(data[j:j+windowSize]))
+			}
+			f := newCRC32Filter(crcs)
+
+			end := len(data) - windowSize + 1
+			for start := 1; start < 20; start++ {
+				crc := crc32.ChecksumIEEE(data[start-1 : start-1+windowSize])
+				expectedJ, expectedCRC := w.rollUntilScalar(crc, data, start, end, f)
+				j, crc := w.rollUntil(crc, data, start, end, f)
+				require.Equal(t, expectedJ, j, "windowSize=%d, crcCount=%d, start=%d", windowSize, crcCount, start)
+				require.Equal(t, expectedCRC, crc, "windowSize=%d, crcCount=%d, start=%d", windowSize, crcCount, start)
+				require.Equal(t, crc32.ChecksumIEEE(data[j-1:j-1+windowSize]), crc)
+			}
+		}
+	}
+}
+
 func benchmarkCRC32(b *testing.B, windowSize int) {
 	b.SetBytes(int64(windowSize))
 
@@ -186,6 +256,81 @@ func BenchmarkCRC32Window(b *testing.B) {
 	}
 }
 
+func benchmarkCRC32WindowRollUntil(b *testing.B, windowSize int) {
+	w := newCRC32Window(windowSize)
+
+	bs := make([]byte, windowSize+64*1024)
+	for i := range bs {
+		bs[i] = ^byte(i)
+	}
+	crc := crc32.ChecksumIEEE(bs[:windowSize])
+	f := newCRC32Filter(nil)
+	b.SetBytes(int64(len(bs) - windowSize))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.rollUntil(crc, bs, 1, len(bs)-windowSize+1, f)
+	}
+}
+
+func BenchmarkCRC32WindowRollUntil(b *testing.B) {
+	for _, windowSize := range benchWindowSizes {
+		b.Run(fmt.Sprintf("ws=%d", windowSize), func(b *testing.B) {
+			benchmarkCRC32WindowRollUntil(b, windowSize)
+		})
+	}
+}
+
+// benchmarkCRC32WindowRollUntilInserted rolls through every offset
+// of a file with a byte inserted at its start, looking for the
+// slices of the original file, as when scanning a damaged file
+// offset by offset.
+func benchmarkCRC32WindowRollUntilInserted(b *testing.B, windowSize int, rollUntil func(*crc32Window, uint32, []byte, int, int, crc32Filter) (int, uint32)) {
+	w := newCRC32Window(windowSize)
+
+	rand := rand.New(rand.NewSource(1))
+	data := make([]byte, 1024*1024)
+	_, err := rand.Read(data)
+	require.NoError(b, err)
+	var crcs []uint32
+	for i := 0; i+windowSize <= len(data); i += windowSize {
+		crcs = append(crcs, crc32.ChecksumIEEE(data[i:i+windowSize]))
+	}
+	f := newCRC32Filter(crcs)
+
+	insertedData := append([]byte{0}, data...)
+	end := len(insertedData) - windowSize + 1
+	b.SetBytes(int64(end))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		crc := crc32.ChecksumIEEE(insertedData[:windowSize])
+		candidates := 0
+		for j := 1; j < end; {
+			j, crc = rollUntil(w, crc, insertedData, j, end, f)
+			if j < end {
+				candidates++
+				crc = w.update(crc, insertedData[j-1], insertedData[j-1+windowSize])
+				j++
+			}
+		}
+		if candidates < len(crcs) {
+			b.Fatalf("found %d candidates, expected at least %d", candidates, len(crcs))
+		}
+	}
+}
+
+func BenchmarkCRC32WindowRollUntilInserted(b *testing.B) {
+	for _, windowSize := range []int{64, 1024, 16384} {
+		b.Run(fmt.Sprintf("ws=%d,kernel=stride", windowSize), func(b *testing.B) {
+			benchmarkCRC32WindowRollUntilInserted(b, windowSize, (*crc32Window).rollUntil)
+		})
+		b.Run(fmt.Sprintf("ws=%d,kernel=scalar", windowSize), func(b *testing.B) {
+			benchmarkCRC32WindowRollUntilInserted(b, windowSize, (*crc32Window).rollUntilScalar)
+		})
+	}
+}
+
 func benchmarkNewCRC32Window(b *testing.B, windowSize int) {
 	for i := 0; i < b.N; i++ {
 		newCRC32Window(windowSize)
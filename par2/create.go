@@ -1,11 +1,11 @@
 package par2
 
 import (
-	"errors"
+	"io"
 	"path"
 	"path/filepath"
 
-	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/fsio"
 	"github.com/akalin/gopar/rsec16"
 )
 
@@ -52,28 +52,74 @@ type CreateOptions struct {
 	// The number of parity shards to create. If <= 0,
 	// NumParityShardsDefault is used.
 	NumParityShards int
-	// The number of goroutines to use while encoding. If <= 0,
-	// NumGoroutinesDefault() is used.
+	// If IndexOnly is true, no parity shards are created, so only
+	// the index file is written, like par2cmdline's -c0, and
+	// NumParityShards is ignored.
+	IndexOnly bool
+	// The number of goroutines to use while hashing, scanning
+	// and encoding. If <= 0, NumGoroutinesDefault() is used.
 	NumGoroutines int
 	// The CreateDelegate to use. If nil, DoNothingCreateDelegate
 	// is used.
 	CreateDelegate CreateDelegate
+	// If UseMmap is true, files are memory-mapped instead of
+	// being read into memory, if possible; see NewEncoderMmap.
+	UseMmap bool
+	// How to distribute the parity shards among recovery files;
+	// see Encoder.SetRecoveryFileScheme.
+	RecoveryFileScheme RecoveryFileScheme
+	// The number of recovery files to write. If <= 0, it's
+	// determined by RecoveryFileScheme; see
+	// Encoder.SetRecoveryFileScheme.
+	NumRecoveryFiles int
+	// The directory that the names of the data files in the par
+	// file are relative to, which must contain all the data
+	// files. If empty, the directory of parPath is used.
+	BasePath string
+	// If RecordFileInfo is true, the permissions and modification
+	// time of each data file are recorded, so that a repair can
+	// restore them if the file goes missing; see
+	// Encoder.SetRecordFileInfo.
+	RecordFileInfo bool
+	// Roughly how many bytes of parity data to hold in memory at
+	// once. If <= 0, there's no limit. See Encoder.SetMemoryLimit.
+	MemoryLimit int
 }
 
 // Create a par file for the given file paths at parPath with the
 // given options.
 func Create(parPath string, filePaths []string, options CreateOptions) error {
-	return create(defaultFileIO{}, parPath, filePaths, options)
+	return withFileIO(options.UseMmap, func(fileIO fileIO) error {
+		return create(fileIO, parPath, filePaths, options)
+	})
+}
+
+// CreateFS is like Create, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the elements of
+// filePaths are names in fsys.
+func CreateFS(fsys fsio.WriteFS, parPath string, filePaths []string, options CreateOptions) error {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	return create(p, p.Path(parPath), p.Paths(filePaths), options)
 }
 
 func checkExtension(parPath string) error {
 	ext := path.Ext(parPath)
 	if ext != ".par2" {
-		return errors.New("parPath must have a .par2 extension")
+		return &InvalidArgumentError{"parPath", "must have a .par2 extension"}
 	}
 	return nil
 }
 
+// CreateFromTar is like Create, except that the data files are the
+// regular files in the tar stream read from r, whose names are taken
+// to be relative to the directory of parPath.
+func CreateFromTar(parPath string, r io.Reader, options CreateOptions) error {
+	return createFromTar(defaultFileIO{}, parPath, r, options)
+}
+
 func create(fileIO fileIO, parPath string, filePaths []string, options CreateOptions) error {
 	err := checkExtension(parPath)
 	if err != nil {
@@ -81,16 +127,51 @@ func create(fileIO fileIO, parPath string, filePaths []string, options CreateOpt
 	}
 
 	if len(filePaths) == 0 {
-		return errors.New("filePaths must not be empty")
+		return &InvalidArgumentError{"filePaths", "must not be empty"}
+	}
+
+	encoder, err := newEncoderForCreate(fileIO, parPath, filePaths, options)
+	if err != nil {
+		return err
+	}
+
+	err = encoder.LoadFileData()
+	if err != nil {
+		return err
+	}
+
+	return computeParityDataAndWrite(encoder, parPath)
+}
+
+func createFromTar(fileIO fileIO, parPath string, r io.Reader, options CreateOptions) error {
+	err := checkExtension(parPath)
+	if err != nil {
+		return err
 	}
 
+	encoder, err := newEncoderForCreate(fileIO, parPath, nil, options)
+	if err != nil {
+		return err
+	}
+
+	err = encoder.LoadFileDataFromTar(r)
+	if err != nil {
+		return err
+	}
+
+	return computeParityDataAndWrite(encoder, parPath)
+}
+
+func newEncoderForCreate(fileIO fileIO, parPath string, filePaths []string, options CreateOptions) (*Encoder, error) {
 	sliceByteCount := options.SliceByteCount
 	if sliceByteCount <= 0 {
 		sliceByteCount = SliceByteCountDefault
 	}
 
 	numParityShards := options.NumParityShards
-	if numParityShards <= 0 {
+	if options.IndexOnly {
+		numParityShards = 0
+	} else if numParityShards <= 0 {
 		numParityShards = NumParityShardsDefault
 	}
 
@@ -104,44 +185,41 @@ func create(fileIO fileIO, parPath string, filePaths []string, options CreateOpt
 		delegate = DoNothingCreateDelegate{}
 	}
 
-	absParPath, err := filepath.Abs(parPath)
+	basePath := options.BasePath
+	if basePath == "" {
+		basePath = filepath.Dir(parPath)
+	}
+	basePath, err := filepath.Abs(basePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	basePath := filepath.Dir(absParPath)
 	absFilePaths := make([]string, len(filePaths))
 	for i, path := range filePaths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		absFilePaths[i] = absPath
 	}
 
 	encoder, err := newEncoder(fileIO, delegate, basePath, absFilePaths, sliceByteCount, numParityShards, numGoroutines)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = encoder.LoadFileData()
+	err = encoder.SetRecoveryFileScheme(options.RecoveryFileScheme, options.NumRecoveryFiles)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	encoder.SetRecordFileInfo(options.RecordFileInfo)
+	encoder.SetMemoryLimit(options.MemoryLimit)
+	return encoder, nil
+}
 
-	err = encoder.ComputeParityData()
+func computeParityDataAndWrite(encoder *Encoder, parPath string) error {
+	err := encoder.ComputeParityData()
 	if err != nil {
 		return err
 	}
 	return encoder.Write(parPath)
 }
-
-// ExitCodeForCreateErrorPar2CmdLine returns the error code
-// par2cmdline would have returned for the given error returned by
-// Create.
-func ExitCodeForCreateErrorPar2CmdLine(err error) int {
-	if err != nil {
-		// Map everything to eFileIOError for now.
-		return par2cmdline.ExitFileIOError
-	}
-	return par2cmdline.ExitSuccess
-}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/akalin/gopar/memfs"
 	"github.com/stretchr/testify/require"
@@ -63,3 +64,143 @@ func TestCreateDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateIndexOnly(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeEncoderMemFS(workingDir)
+	paths := fs.Paths()
+	parPath := filepath.Join(workingDir, "parity.par2")
+
+	err := create(testFileIO{t, fs}, parPath, paths, CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 3,
+		IndexOnly:       true,
+		CreateDelegate:  testEncoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, append(paths, parPath), fs.Paths())
+
+	decoder, err := newDecoderForTest(t, fs, parPath)
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	shardCounts := decoder.ShardCounts()
+	require.False(t, shardCounts.RepairNeeded())
+	require.Equal(t, 0, shardCounts.UsableParityShardCount)
+}
+
+func TestCreateFS(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+
+	err := CreateFS(fs, "file.par2", []string{
+		"file.rar", "dir1/file.r01", "dir1/file.r02", "dir2/dir3/file.r03", "dir4/dir5/file.r04",
+	}, CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 3,
+		CreateDelegate:  testEncoderDelegate{t},
+	})
+	require.NoError(t, err)
+
+	// Verify with a read-only copy of fs.
+	mapFS := make(fstest.MapFS)
+	for _, path := range fs.Paths() {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		relPath, err := filepath.Rel(workingDir, path)
+		require.NoError(t, err)
+		mapFS[filepath.ToSlash(relPath)] = &fstest.MapFile{Data: data}
+	}
+
+	result, err := VerifyFS(mapFS, "file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.False(t, result.ShardCounts.RepairNeeded())
+}
+
+func TestCreateAndVerifyFSWithBasePath(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+
+	// Put the par files in a different directory from the data
+	// files.
+	err := CreateFS(fs, "par/file.par2", []string{
+		"file.rar", "dir1/file.r01", "dir1/file.r02",
+	}, CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 3,
+		CreateDelegate:  testEncoderDelegate{t},
+		BasePath:        ".",
+	})
+	require.NoError(t, err)
+
+	result, err := VerifyFS(fs, "par/file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+		BasePath:       ".",
+	})
+	require.NoError(t, err)
+	require.False(t, result.ShardCounts.RepairNeeded())
+
+	// Without BasePath, the data files are looked up in par/.
+	result, err = VerifyFS(fs, "par/file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.True(t, result.ShardCounts.RepairNeeded())
+
+	_, err = fs.RemoveFile("file.rar")
+	require.NoError(t, err)
+	repairResult, err := RepairFS(fs, "par/file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		BasePath:       ".",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"file.rar"}, repairResult.RepairedPaths)
+}
+
+func TestCreateMemoryLimit(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	var expectedContents map[string][]byte
+	// There are 280 bytes of parity data, so all the non-zero
+	// limits but the last make Write compute the parity shards
+	// of each recovery file itself, and 1 forces passes of 4
+	// bytes.
+	for _, memoryLimit := range []int{0, 1, 100, 1 << 20} {
+		fs := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+			"file.rar": data,
+			"file.r01": data[:200],
+		})
+		err := CreateFS(fs, "file.par2", []string{"file.rar", "file.r01"}, CreateOptions{
+			SliceByteCount:  40,
+			NumParityShards: 7,
+			CreateDelegate:  testEncoderDelegate{t},
+			MemoryLimit:     memoryLimit,
+		})
+		require.NoError(t, err)
+
+		contents := make(map[string][]byte)
+		for _, path := range fs.Paths() {
+			contents[path], err = fs.ReadFile(path)
+			require.NoError(t, err)
+		}
+		if expectedContents == nil {
+			expectedContents = contents
+		} else {
+			require.Equal(t, expectedContents, contents, "memoryLimit=%d", memoryLimit)
+		}
+
+		_, err = fs.RemoveFile("file.r01")
+		require.NoError(t, err)
+		result, err := RepairFS(fs, "file.par2", RepairOptions{
+			DoubleCheck:    true,
+			RepairDelegate: testDecoderDelegate{t},
+			MemoryLimit:    memoryLimit,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"file.r01"}, result.RepairedPaths)
+	}
+}
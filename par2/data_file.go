@@ -3,31 +3,123 @@ package par2
 import (
 	"crypto/md5"
 	"encoding/binary"
+	"errors"
 	"hash/crc32"
+	"io"
 )
 
+func computeChecksumPair(slice []byte) checksumPair {
+	crc32 := crc32.ChecksumIEEE(slice)
+	var crc32Bytes [4]byte
+	binary.LittleEndian.PutUint32(crc32Bytes[:], crc32)
+	return checksumPair{
+		MD5:   md5.Sum(slice),
+		CRC32: crc32Bytes,
+	}
+}
+
 func computeDataFileInfo(sliceByteCount int, filename string, data []byte) (fileID, fileDescriptionPacket, ifscPacket, [][]byte) {
-	hash := md5.Sum(data)
+	return computeDataFileInfoParallel(sliceByteCount, filename, data, 1)
+}
+
+// computeDataFileInfoParallel is like computeDataFileInfo, except
+// that it hashes the file and its slices with up to numGoroutines
+// goroutines.
+func computeDataFileInfoParallel(sliceByteCount int, filename string, data []byte, numGoroutines int) (fileID, fileDescriptionPacket, ifscPacket, [][]byte) {
+	// Hash the whole file while the slices are being hashed.
+	hashCh := make(chan [md5.Size]byte, 1)
+	computeHash := func() {
+		hashCh <- md5.Sum(data)
+	}
+	if numGoroutines > 1 {
+		go computeHash()
+		numGoroutines--
+	} else {
+		computeHash()
+	}
+
+	sliceCount := (len(data) + sliceByteCount - 1) / sliceByteCount
+	var dataShards [][]byte
+	var checksumPairs []checksumPair
+	if sliceCount > 0 {
+		dataShards = make([][]byte, sliceCount)
+		checksumPairs = make([]checksumPair, sliceCount)
+	}
+	// Hash the slices in batches, so that each goroutine does a
+	// reasonable amount of work at a time.
+	const slicesPerBatch = 16
+	batchCount := (sliceCount + slicesPerBatch - 1) / slicesPerBatch
+	runParallel(batchCount, numGoroutines, func(batch int) {
+		end := (batch + 1) * slicesPerBatch
+		if end > sliceCount {
+			end = sliceCount
+		}
+		for i := batch * slicesPerBatch; i < end; i++ {
+			slice := sliceAndPadByteArray(data, i*sliceByteCount, (i+1)*sliceByteCount)
+			dataShards[i] = slice
+			checksumPairs[i] = computeChecksumPair(slice)
+		}
+	})
+
 	sixteenKHash := sixteenKHash(data)
 	fileID := computeFileID(sixteenKHash, uint64(len(data)), []byte(filename))
 	fileDescriptionPacket := fileDescriptionPacket{
-		hash:         hash,
+		hash:         <-hashCh,
 		sixteenKHash: sixteenKHash,
 		byteCount:    len(data),
 		filename:     filename,
 	}
+	return fileID, fileDescriptionPacket, ifscPacket{checksumPairs}, dataShards
+}
+
+// computeDataFileInfoFromReader is like computeDataFileInfo, except
+// that it reads the file data from r one slice at a time, so that
+// the data doesn't have to be in memory all at once other than in
+// the returned data shards.
+func computeDataFileInfoFromReader(sliceByteCount int, filename string, r io.Reader) (fileID, fileDescriptionPacket, ifscPacket, [][]byte, error) {
+	hasher := md5.New()
+	sixteenKHasher := md5.New()
+	byteCount := 0
 	var dataShards [][]byte
 	var checksumPairs []checksumPair
-	for i := 0; i < len(data); i += sliceByteCount {
-		slice := sliceAndPadByteArray(data, i, i+sliceByteCount)
+	for {
+		slice := make([]byte, sliceByteCount)
+		n, err := io.ReadFull(r, slice)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fileID{}, fileDescriptionPacket{}, ifscPacket{}, nil, err
+		}
+
+		// Hash writes never fail.
+		_, _ = hasher.Write(slice[:n])
+		if byteCount < 16*1024 {
+			sixteenKByteCount := 16*1024 - byteCount
+			if sixteenKByteCount > n {
+				sixteenKByteCount = n
+			}
+			_, _ = sixteenKHasher.Write(slice[:sixteenKByteCount])
+		}
+		byteCount += n
+
+		// slice is already zero-padded if n < sliceByteCount.
 		dataShards = append(dataShards, slice)
-		crc32 := crc32.ChecksumIEEE(slice)
-		var crc32Bytes [4]byte
-		binary.LittleEndian.PutUint32(crc32Bytes[:], crc32)
-		checksumPairs = append(checksumPairs, checksumPair{
-			MD5:   md5.Sum(slice),
-			CRC32: crc32Bytes,
-		})
+		checksumPairs = append(checksumPairs, computeChecksumPair(slice))
+
+		if n < sliceByteCount {
+			break
+		}
 	}
-	return fileID, fileDescriptionPacket, ifscPacket{checksumPairs}, dataShards
+
+	var hash, sixteenKHash [md5.Size]byte
+	copy(hash[:], hasher.Sum(nil))
+	copy(sixteenKHash[:], sixteenKHasher.Sum(nil))
+	fileID := computeFileID(sixteenKHash, uint64(byteCount), []byte(filename))
+	fileDescriptionPacket := fileDescriptionPacket{
+		hash:         hash,
+		sixteenKHash: sixteenKHash,
+		byteCount:    byteCount,
+		filename:     filename,
+	}
+	return fileID, fileDescriptionPacket, ifscPacket{checksumPairs}, dataShards, nil
 }
@@ -0,0 +1,58 @@
+package par2
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeDataFileInfoFromReader(t *testing.T) {
+	sliceByteCount := 4 * 1024
+	for _, byteCount := range []int{0, 1, sliceByteCount - 1, sliceByteCount, 16*1024 - 1, 16 * 1024, 16*1024 + 1, 50000} {
+		byteCount := byteCount
+		t.Run(fmt.Sprintf("byteCount=%d", byteCount), func(t *testing.T) {
+			data := make([]byte, byteCount)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+
+			fileID, fileDescriptionPacket, ifscPacket, dataShards := computeDataFileInfo(sliceByteCount, "file.rar", data)
+
+			readerFileID, readerFileDescriptionPacket, readerIFSCPacket, readerDataShards, err := computeDataFileInfoFromReader(sliceByteCount, "file.rar", iotest.OneByteReader(bytes.NewReader(data)))
+			require.NoError(t, err)
+			require.Equal(t, fileID, readerFileID)
+			require.Equal(t, fileDescriptionPacket, readerFileDescriptionPacket)
+			require.Equal(t, ifscPacket, readerIFSCPacket)
+			require.Equal(t, dataShards, readerDataShards)
+		})
+	}
+}
+
+func TestComputeDataFileInfoFromReaderError(t *testing.T) {
+	_, _, _, _, err := computeDataFileInfoFromReader(4, "file.rar", iotest.TimeoutReader(bytes.NewReader(make([]byte, 10))))
+	require.Equal(t, iotest.ErrTimeout, err)
+}
+
+func TestComputeDataFileInfoParallel(t *testing.T) {
+	sliceByteCount := 4
+	for _, byteCount := range []int{0, 1, 63, 64, 65, 1000} {
+		data := make([]byte, byteCount)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+
+		fileID, fileDescriptionPacket, ifscPacket, dataShards := computeDataFileInfo(sliceByteCount, "file.rar", data)
+		for _, numGoroutines := range []int{2, 3, 8} {
+			t.Run(fmt.Sprintf("byteCount=%d,numGoroutines=%d", byteCount, numGoroutines), func(t *testing.T) {
+				parallelFileID, parallelFileDescriptionPacket, parallelIFSCPacket, parallelDataShards := computeDataFileInfoParallel(sliceByteCount, "file.rar", data, numGoroutines)
+				require.Equal(t, fileID, parallelFileID)
+				require.Equal(t, fileDescriptionPacket, parallelFileDescriptionPacket)
+				require.Equal(t, ifscPacket, parallelIFSCPacket)
+				require.Equal(t, dataShards, parallelDataShards)
+			})
+		}
+	}
+}
@@ -5,13 +5,18 @@ import (
 	"crypto/md5"
 	"encoding/binary"
 	"errors"
-	"hash/crc32"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
+	"time"
 
+	"github.com/akalin/gopar/fsio"
 	"github.com/akalin/gopar/rsec16"
 )
 
@@ -19,6 +24,10 @@ type fileIO interface {
 	ReadFile(path string) ([]byte, error)
 	FindWithPrefixAndSuffix(prefix, suffix string) ([]string, error)
 	WriteFile(path string, data []byte) error
+	MoveFile(oldPath, newPath string) error
+	DeleteFile(path string) error
+	StatFile(path string) (fs.FileInfo, error)
+	SetFileInfo(path string, info fs.FileInfo) error
 }
 
 type defaultFileIO struct{}
@@ -32,7 +41,46 @@ func (io defaultFileIO) FindWithPrefixAndSuffix(prefix, suffix string) ([]string
 }
 
 func (io defaultFileIO) WriteFile(path string, data []byte) error {
-	return ioutil.WriteFile(path, data, 0600)
+	return fsio.WriteFileAtomic(path, data, 0600)
+}
+
+func (io defaultFileIO) CreatePendingFile(path string) (fsio.PendingFile, error) {
+	return fsio.CreatePendingFile(path, 0600)
+}
+
+func (io defaultFileIO) MoveFile(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (io defaultFileIO) DeleteFile(path string) error {
+	return os.Remove(path)
+}
+
+func (io defaultFileIO) StatFile(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (io defaultFileIO) SetFileInfo(path string, info fs.FileInfo) error {
+	return fsio.SetFileInfo(path, info)
+}
+
+// A pendingFileCreator is a fileIO that can also write files
+// piecewise, without holding them in memory.
+type pendingFileCreator interface {
+	CreatePendingFile(path string) (fsio.PendingFile, error)
+}
+
+// createPendingFile returns a PendingFile for the file at the given
+// path, using fileIO's CreatePendingFile method if it has one, and
+// otherwise holding the data in memory and passing it to
+// fileIO.WriteFile when committed.
+func createPendingFile(fileIO fileIO, path string) (fsio.PendingFile, error) {
+	if creator, ok := fileIO.(pendingFileCreator); ok {
+		return creator.CreatePendingFile(path)
+	}
+	return fsio.NewBufferedPendingFile(func(data []byte) error {
+		return fileIO.WriteFile(path, data)
+	}), nil
 }
 
 type decoderInputFileInfo struct {
@@ -42,6 +90,18 @@ type decoderInputFileInfo struct {
 	sixteenKHash  [md5.Size]byte
 	hash          [md5.Size]byte
 	checksumPairs []checksumPair
+	// Nil if no file info was recorded.
+	fileInfoPacket *fileInfoPacket
+}
+
+// fileIDsToArrays converts fileIDs to a type that can be exported,
+// e.g. in a MismatchError.
+func fileIDsToArrays(fileIDs []fileID) [][16]byte {
+	arrays := make([][16]byte, len(fileIDs))
+	for i, fileID := range fileIDs {
+		arrays[i] = fileID
+	}
+	return arrays
 }
 
 func decoderInputFileInfoIDs(infos []decoderInputFileInfo) []fileID {
@@ -52,16 +112,20 @@ func decoderInputFileInfoIDs(infos []decoderInputFileInfo) []fileID {
 	return fileIDs
 }
 
-func makeDecoderInputFileInfos(fileIDs []fileID, fileDescriptionPackets map[fileID]fileDescriptionPacket, ifscPackets map[fileID]ifscPacket) ([]decoderInputFileInfo, error) {
+func makeDecoderInputFileInfos(fileIDs []fileID, fileDescriptionPackets map[fileID]fileDescriptionPacket, ifscPackets map[fileID]ifscPacket, fileInfoPackets map[fileID]fileInfoPacket) ([]decoderInputFileInfo, error) {
 	var decoderInputFileInfos []decoderInputFileInfo
 	for _, fileID := range fileIDs {
 		descriptionPacket, ok := fileDescriptionPackets[fileID]
 		if !ok {
-			return nil, errors.New("file description packet not found")
+			return nil, &MissingPacketError{PacketType: fileDescriptionPacketType, FileID: fileID}
 		}
 		ifscPacket, ok := ifscPackets[fileID]
 		if !ok {
-			return nil, errors.New("input file slice checksum packet not found")
+			return nil, &MissingPacketError{PacketType: ifscPacketType, FileID: fileID}
+		}
+		var fileInfoPacketPtr *fileInfoPacket
+		if fileInfoPacket, ok := fileInfoPackets[fileID]; ok {
+			fileInfoPacketPtr = &fileInfoPacket
 		}
 		decoderInputFileInfos = append(decoderInputFileInfos, decoderInputFileInfo{
 			fileID,
@@ -70,6 +134,7 @@ func makeDecoderInputFileInfos(fileIDs []fileID, fileDescriptionPackets map[file
 			descriptionPacket.sixteenKHash,
 			descriptionPacket.hash,
 			ifscPacket.checksumPairs,
+			fileInfoPacketPtr,
 		})
 	}
 
@@ -107,6 +172,10 @@ func (m checksumShardLocationMap) get(crc32 uint32, data []byte) shardLocationSe
 	return byCRC[md5.Sum(data)]
 }
 
+func (m checksumShardLocationMap) getByChecksumPair(checksumPair checksumPair) shardLocationSet {
+	return m[binary.LittleEndian.Uint32(checksumPair.CRC32[:])][checksumPair.MD5]
+}
+
 func makeChecksumShardLocationMap(sliceByteCount int, infos []decoderInputFileInfo) checksumShardLocationMap {
 	m := make(checksumShardLocationMap)
 
@@ -162,6 +231,14 @@ type Decoder struct {
 	delegate DecoderDelegate
 
 	indexPath string
+	// The directory that the data files are looked up in, which
+	// is the directory of indexPath unless overridden.
+	basePath string
+	// If true, Repair moves damaged data files out of the way
+	// instead of overwriting them, and records their new paths
+	// in backupPaths.
+	keepBackups bool
+	backupPaths []string
 
 	setID          recoverySetID
 	clientID       string
@@ -170,6 +247,7 @@ type Decoder struct {
 	nonRecoverySet []decoderInputFileInfo
 
 	numGoroutines int
+	memoryLimit   int
 
 	checksumToLocation checksumShardLocationMap
 
@@ -177,6 +255,10 @@ type Decoder struct {
 	fileIntegrityInfos []fileIntegrityInfo
 
 	parityShards [][]byte
+	// Indexed the same as parityShards.
+	parityShardPaths []string
+	// The paths of the volumes that parityShards was loaded from.
+	parityVolumePaths []string
 }
 
 // DecoderDelegate holds methods that are called during the decode
@@ -197,6 +279,14 @@ type DecoderDelegate interface {
 	OnDataFileWrite(i, n int, path string, byteCount int, err error)
 }
 
+// A CorruptParityShardDelegate is a DecoderDelegate that also wants
+// to be told about each parity shard that VerifyAllData finds doesn't
+// match the data shards. It's separate from DecoderDelegate so that
+// existing implementations of the latter don't need to change.
+type CorruptParityShardDelegate interface {
+	OnDetectCorruptParityShard(exponent uint16, path string)
+}
+
 // DoNothingDecoderDelegate is an implementation of DecoderDelegate
 // that does nothing for all methods.
 type DoNothingDecoderDelegate struct{}
@@ -253,36 +343,39 @@ func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexPath string, numGo
 
 	setID, indexFile, err := readFile(delegate, nil, indexBytes)
 	if err != nil {
-		return nil, err
+		return nil, withPath(err, indexPath)
 	}
 
 	if indexFile.mainPacket == nil {
 		// TODO: Relax this check.
-		return nil, errors.New("no main packet found")
+		return nil, &MissingPacketError{Path: indexPath, PacketType: mainPacketType}
 	}
 
 	if len(indexFile.recoveryPackets) > 0 {
 		// TODO: Relax this check.
-		return nil, errors.New("recovery packets found in index file")
+		return nil, &MismatchError{indexPath, "index file recovery packet count", 0, len(indexFile.recoveryPackets)}
 	}
 
-	recoverySet, err := makeDecoderInputFileInfos(indexFile.mainPacket.recoverySet, indexFile.fileDescriptionPackets, indexFile.ifscPackets)
+	recoverySet, err := makeDecoderInputFileInfos(indexFile.mainPacket.recoverySet, indexFile.fileDescriptionPackets, indexFile.ifscPackets, indexFile.fileInfoPackets)
 	if err != nil {
-		return nil, err
+		return nil, withPath(err, indexPath)
 	}
 
-	nonRecoverySet, err := makeDecoderInputFileInfos(indexFile.mainPacket.nonRecoverySet, indexFile.fileDescriptionPackets, indexFile.ifscPackets)
+	nonRecoverySet, err := makeDecoderInputFileInfos(indexFile.mainPacket.nonRecoverySet, indexFile.fileDescriptionPackets, indexFile.ifscPackets, indexFile.fileInfoPackets)
 	if err != nil {
-		return nil, err
+		return nil, withPath(err, indexPath)
 	}
 
 	return &Decoder{
 		fileIO, delegate,
-		indexPath,
+		indexPath, filepath.Dir(indexPath),
+		false, nil,
 		setID,
 		indexFile.clientID, indexFile.mainPacket.sliceByteCount,
 		recoverySet, nonRecoverySet,
-		numGoroutines,
+		numGoroutines, 0,
+		nil,
+		nil,
 		nil,
 		nil,
 		nil,
@@ -302,93 +395,185 @@ func sliceAndPadByteArray(bs []byte, start, end int) []byte {
 		padLength = end - len(bs)
 		end = len(bs)
 	}
-	slice := bs[start:end]
+	// Limit the capacity so that the append below never writes
+	// into bs, which may be read-only if it's memory-mapped.
+	slice := bs[start:end:end]
 	if padLength > 0 {
 		slice = append(slice, make([]byte, padLength)...)
 	}
 	return slice
 }
 
-func fillShardInfos(sliceByteCount int, data []byte, checksumToLocation checksumShardLocationMap, fileID fileID, fileIntegrityInfos []fileIntegrityInfo, fileIDIndices map[fileID]int) (int, int) {
-	hits := 0
-	misses := 0
-
-	justMissed := false
-	window := newCRC32Window(sliceByteCount)
-	var crcSlice uint32
-	for j := 0; j < len(data); {
-		slice := sliceAndPadByteArray(data, j, j+sliceByteCount)
-		if justMissed {
-			crcSlice = window.update(crcSlice, data[j-1], slice[len(slice)-1])
-		} else {
-			crcSlice = crc32.ChecksumIEEE(slice)
-		}
-		foundLocations := checksumToLocation.get(crcSlice, slice)
-		if len(foundLocations) == 0 {
-			j++
-			misses++
-			justMissed = true
-			continue
-		}
-
-		location := shardLocation{fileID, j}
-		for foundLocation := range foundLocations {
+// applyScanMatches records the given matches, found by scanning the
+// file with the given ID, in fileIntegrityInfos.
+func applyScanMatches(sliceByteCount int, matches []scanMatch, fileID fileID, fileIntegrityInfos []fileIntegrityInfo, fileIDIndices map[fileID]int) {
+	for _, match := range matches {
+		location := shardLocation{fileID, match.start}
+		for foundLocation := range match.locations {
 			integrityInfo := fileIntegrityInfos[fileIDIndices[foundLocation.fileID]]
 			shardInfo := &integrityInfo.shardInfos[foundLocation.start/sliceByteCount]
 			if shardInfo.data == nil {
 				*shardInfo = shardIntegrityInfo{
-					slice,
+					match.slice,
 					shardLocationSet{},
 				}
 			}
 			shardInfo.locations[location] = true
 		}
+	}
+}
 
-		justMissed = false
-		j += sliceByteCount
-		hits++
+// scanChunkCount returns the number of chunks to split a file with
+// the given byte count into when scanning it with numGoroutines
+// goroutines.
+func scanChunkCount(sliceByteCount, byteCount, numGoroutines int) int {
+	if numGoroutines <= 1 {
+		return 1
 	}
+	// Keep chunks large enough that stitching them together is
+	// cheap compared to scanning them.
+	const minSlicesPerChunk = 16
+	chunkCount := byteCount / (minSlicesPerChunk * sliceByteCount)
+	if chunkCount > numGoroutines {
+		chunkCount = numGoroutines
+	}
+	return chunkCount
+}
 
-	return hits, misses
+func fillShardInfos(sliceByteCount int, data []byte, checksumToLocation checksumShardLocationMap, fileID fileID, fileIntegrityInfos []fileIntegrityInfo, fileIDIndices map[fileID]int, numGoroutines int) (int, int) {
+	m := newSliceMatcher(sliceByteCount, checksumToLocation)
+	chunkCount := scanChunkCount(sliceByteCount, len(data), numGoroutines)
+	matches, misses := scanData(m, data, chunkCount, numGoroutines)
+	applyScanMatches(sliceByteCount, matches, fileID, fileIntegrityInfos, fileIDIndices)
+	return len(matches), misses
 }
 
 func (d *Decoder) getFilePath(info decoderInputFileInfo) string {
-	// TODO: Make this configurable.
-	basePath := filepath.Dir(d.indexPath)
-	return filepath.Join(basePath, info.filename)
+	return filepath.Join(d.basePath, info.filename)
 }
 
-func (d *Decoder) fillFileIntegrityInfos(checksumToLocation checksumShardLocationMap, fileIntegrityInfos []fileIntegrityInfo, fileIDIndices map[fileID]int, i int, info decoderInputFileInfo) (int, int, int, error) {
-	path := d.getFilePath(info)
-	data, err := d.fileIO.ReadFile(path)
-	if os.IsNotExist(err) {
-		fileIntegrityInfos[i].missing = true
-		return 0, 0, 0, nil
+// A dataFileScan holds the results of reading and scanning a data
+// file, which are computed in parallel with other data files, and
+// then recorded in order.
+type dataFileScan struct {
+	byteCount    int
+	missing      bool
+	matches      []scanMatch
+	misses       int
+	hashMismatch bool
+	err          error
+}
+
+func (d *Decoder) scanDataFile(readFile func(string) ([]byte, error), m *sliceMatcher, info decoderInputFileInfo, numGoroutines int) dataFileScan {
+	data, err := readFile(d.getFilePath(info))
+	if errors.Is(err, fs.ErrNotExist) {
+		return dataFileScan{missing: true}
 	} else if err != nil {
-		return len(data), 0, 0, err
+		return dataFileScan{byteCount: len(data), err: err}
 	}
+	return d.scanDataFileBytes(data, m, info, numGoroutines)
+}
 
-	hits, misses := fillShardInfos(d.sliceByteCount, data, checksumToLocation, info.fileID, fileIntegrityInfos, fileIDIndices)
-
+// scanDataFileBytes scans data, which was read from the data file
+// described by info.
+func (d *Decoder) scanDataFileBytes(data []byte, m *sliceMatcher, info decoderInputFileInfo, numGoroutines int) dataFileScan {
+	// Most files are usually intact, so check the whole file
+	// first, which is much cheaper than scanning it.
 	hashMismatch := sixteenKHash(data) != info.sixteenKHash || md5.Sum(data) != info.hash
-	fileIntegrityInfos[i].hashMismatch = hashMismatch
-	if hashMismatch {
-		d.delegate.OnDetectDataFileHashMismatch(info.fileID, path)
+	if !hashMismatch && len(data) == info.byteCount {
+		matches, ok := intactDataFileMatches(d.sliceByteCount, data, m.checksumToLocation, info.checksumPairs)
+		if ok {
+			return dataFileScan{
+				byteCount: len(data),
+				matches:   matches,
+			}
+		}
 	}
 
-	hasWrongByteCount := len(data) != info.byteCount
-	fileIntegrityInfos[i].hasWrongByteCount = hasWrongByteCount
-	if hasWrongByteCount {
-		d.delegate.OnDetectDataFileWrongByteCount(info.fileID, path)
+	chunkCount := scanChunkCount(d.sliceByteCount, len(data), numGoroutines)
+	matches, misses := scanData(m, data, chunkCount, numGoroutines)
+	return dataFileScan{
+		byteCount:    len(data),
+		matches:      matches,
+		misses:       misses,
+		hashMismatch: hashMismatch,
 	}
-
-	return len(data), hits, misses, nil
 }
 
 // LoadFileData loads existing file data into memory.
 func (d *Decoder) LoadFileData() error {
-	checksumToLocation := makeChecksumShardLocationMap(d.sliceByteCount, d.recoverySet)
+	m := d.newDataFileMatcher()
+
+	// Read and scan the files in parallel, splitting the
+	// goroutines among them, but record the results and call the
+	// delegate in order, so that the results don't depend on the
+	// number of goroutines.
+	scans := make([]dataFileScan, len(d.recoverySet))
+	numGoroutinesPerFile := 1
+	if len(d.recoverySet) > 0 && d.numGoroutines > len(d.recoverySet) {
+		numGoroutinesPerFile = d.numGoroutines / len(d.recoverySet)
+	}
+	runParallel(len(d.recoverySet), d.numGoroutines, func(i int) {
+		scans[i] = d.scanDataFile(d.fileIO.ReadFile, m, d.recoverySet[i], numGoroutinesPerFile)
+	})
+
+	return d.recordDataFileScans(m, scans)
+}
+
+// LoadFileDataFromTar is like LoadFileData, except that the data
+// files are read from the given tar stream instead. Members of the
+// stream are matched to data files by their names, which are taken
+// to be relative to the directory of the index file; members that
+// don't match any data file are skipped, and data files without a
+// matching member are treated as missing. Each member is scanned as
+// soon as it's read, and only the slices found in it are kept, so
+// at most one member is held in memory at a time.
+func (d *Decoder) LoadFileDataFromTar(r io.Reader) error {
+	indices := make(map[string]int)
+	for i, info := range d.recoverySet {
+		indices[info.filename] = i
+	}
 
+	m := d.newDataFileMatcher()
+	scans := make([]dataFileScan, len(d.recoverySet))
+	for i := range scans {
+		scans[i] = dataFileScan{missing: true}
+	}
+	err := forEachTarMember(r, func(filename string, _ fs.FileInfo, r io.Reader) error {
+		i, ok := indices[filename]
+		if !ok {
+			return nil
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		scan := d.scanDataFileBytes(data, m, d.recoverySet[i], d.numGoroutines)
+		// The matched slices point into data, so copy them
+		// to let data be freed.
+		for j := range scan.matches {
+			scan.matches[j].slice = append([]byte(nil), scan.matches[j].slice...)
+		}
+		scans[i] = scan
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.recordDataFileScans(m, scans)
+}
+
+// newDataFileMatcher returns a sliceMatcher for the slices of the
+// data files in the recovery set.
+func (d *Decoder) newDataFileMatcher() *sliceMatcher {
+	return newSliceMatcher(d.sliceByteCount, makeChecksumShardLocationMap(d.sliceByteCount, d.recoverySet))
+}
+
+// recordDataFileScans records the results of scanning the data
+// files, indexed the same as the recovery set, in order, and calls
+// the delegate for each of them.
+func (d *Decoder) recordDataFileScans(m *sliceMatcher, scans []dataFileScan) error {
 	fileIntegrityInfos := make([]fileIntegrityInfo, len(d.recoverySet))
 	fileIDIndices := make(map[fileID]int)
 	for i, info := range d.recoverySet {
@@ -401,10 +586,28 @@ func (d *Decoder) LoadFileData() error {
 
 	for i, info := range d.recoverySet {
 		path := d.getFilePath(info)
-		byteCount, hits, misses, err := d.fillFileIntegrityInfos(checksumToLocation, fileIntegrityInfos, fileIDIndices, i, info)
-		d.delegate.OnDataFileLoad(i+1, len(d.recoverySet), path, byteCount, hits, misses, err)
-		if err != nil {
-			return err
+		scan := scans[i]
+		byteCount := scan.byteCount
+		if scan.missing {
+			fileIntegrityInfos[i].missing = true
+		} else if scan.err == nil {
+			applyScanMatches(d.sliceByteCount, scan.matches, info.fileID, fileIntegrityInfos, fileIDIndices)
+
+			fileIntegrityInfos[i].hashMismatch = scan.hashMismatch
+			if scan.hashMismatch {
+				d.delegate.OnDetectDataFileHashMismatch(info.fileID, path)
+			}
+
+			hasWrongByteCount := byteCount != info.byteCount
+			fileIntegrityInfos[i].hasWrongByteCount = hasWrongByteCount
+			if hasWrongByteCount {
+				d.delegate.OnDetectDataFileWrongByteCount(info.fileID, path)
+			}
+		}
+
+		d.delegate.OnDataFileLoad(i+1, len(d.recoverySet), path, byteCount, len(scan.matches), scan.misses, scan.err)
+		if scan.err != nil {
+			return scan.err
 		}
 
 		if byteCount != info.byteCount {
@@ -449,7 +652,7 @@ func (d *Decoder) LoadFileData() error {
 		}
 	}
 
-	d.checksumToLocation = checksumToLocation
+	d.checksumToLocation = m.checksumToLocation
 	d.fileIntegrityInfos = fileIntegrityInfos
 	return nil
 }
@@ -494,14 +697,13 @@ func (recoveryDelegate) OnDataFileWrite(i, n int, path string, byteCount int, er
 // LoadParityData searches for parity volumes and loads them into
 // memory.
 func (d *Decoder) LoadParityData() error {
-	ext := path.Ext(d.indexPath)
-	base := d.indexPath[:len(d.indexPath)-len(ext)]
-	matches, err := d.fileIO.FindWithPrefixAndSuffix(base+".", ext)
+	matches, err := findParityVolumes(d.fileIO, d.indexPath)
 	if err != nil {
 		return err
 	}
 
 	var parityFiles []file
+	var parityFilePaths []string
 	for i, match := range matches {
 		parityFile, err := func() (*file, error) {
 			volumeBytes, err := d.fileIO.ReadFile(match)
@@ -516,19 +718,25 @@ func (d *Decoder) LoadParityData() error {
 				return nil, nil
 			} else if err != nil {
 				// TODO: Relax this check.
-				return nil, err
+				return nil, withPath(err, match)
+			}
+
+			if parityFile.mainPacket == nil {
+				return nil, &MissingPacketError{Path: match, PacketType: mainPacketType}
 			}
 
 			if d.sliceByteCount != parityFile.mainPacket.sliceByteCount {
-				return nil, errors.New("slice byte count mismatch")
+				return nil, &MismatchError{match, "slice byte count", d.sliceByteCount, parityFile.mainPacket.sliceByteCount}
 			}
 
-			if !reflect.DeepEqual(decoderInputFileInfoIDs(d.recoverySet), parityFile.mainPacket.recoverySet) {
-				return nil, errors.New("recovery set mismatch")
+			recoverySet := decoderInputFileInfoIDs(d.recoverySet)
+			if !reflect.DeepEqual(recoverySet, parityFile.mainPacket.recoverySet) {
+				return nil, &MismatchError{match, "recovery set", fileIDsToArrays(recoverySet), fileIDsToArrays(parityFile.mainPacket.recoverySet)}
 			}
 
-			if !reflect.DeepEqual(decoderInputFileInfoIDs(d.nonRecoverySet), parityFile.mainPacket.nonRecoverySet) {
-				return nil, errors.New("non-recovery set mismatch")
+			nonRecoverySet := decoderInputFileInfoIDs(d.nonRecoverySet)
+			if !reflect.DeepEqual(nonRecoverySet, parityFile.mainPacket.nonRecoverySet) {
+				return nil, &MismatchError{match, "non-recovery set", fileIDsToArrays(nonRecoverySet), fileIDsToArrays(parityFile.mainPacket.nonRecoverySet)}
 			}
 
 			return &parityFile, nil
@@ -542,29 +750,41 @@ func (d *Decoder) LoadParityData() error {
 		}
 
 		parityFiles = append(parityFiles, *parityFile)
+		parityFilePaths = append(parityFilePaths, match)
 	}
 
 	var parityShards [][]byte
-	for _, file := range parityFiles {
+	var parityShardPaths []string
+	for i, file := range parityFiles {
 		for exponent, packet := range file.recoveryPackets {
 			if int(exponent) >= len(parityShards) {
 				parityShards = append(parityShards, make([][]byte, int(exponent+1)-len(parityShards))...)
+				parityShardPaths = append(parityShardPaths, make([]string, int(exponent+1)-len(parityShardPaths))...)
 			}
 			parityShards[exponent] = packet.data
+			parityShardPaths[exponent] = parityFilePaths[i]
 		}
 	}
 
 	d.parityShards = parityShards
+	d.parityShardPaths = parityShardPaths
+	d.parityVolumePaths = parityFilePaths
 	return nil
 }
 
 func (d *Decoder) newCoderAndShards() (rsec16.Coder, [][]byte, error) {
+	if len(d.recoverySet) == 0 {
+		return rsec16.Coder{}, nil, &MissingPacketError{Path: d.indexPath, PacketType: fileDescriptionPacketType}
+	}
+
 	if len(d.fileIntegrityInfos) == 0 {
+		// LoadFileData wasn't called, which is a bug in the
+		// caller.
 		return rsec16.Coder{}, nil, errors.New("no file integrity info")
 	}
 
 	if len(d.parityShards) == 0 {
-		return rsec16.Coder{}, nil, errors.New("no parity shards")
+		return rsec16.Coder{}, nil, &MissingPacketError{Path: d.indexPath, PacketType: recoveryPacketType}
 	}
 
 	var dataShards [][]byte
@@ -645,79 +865,313 @@ func (d *Decoder) ShardCounts() ShardCounts {
 	}
 }
 
+// VerifyAllData checks and returns whether all parity shards that are
+// present match the parity shards computed from the data shards,
+// calling OnDetectCorruptParityShard for each one that doesn't if
+// the delegate is a CorruptParityShardDelegate. Note that this is worth calling only when there are no
+// unusable data shards, since if there are, then false is guaranteed
+// to be returned for ok.
+func (d *Decoder) VerifyAllData() (ok bool, err error) {
+	coder, dataShards, err := d.newCoderAndShards()
+	if err != nil {
+		return false, err
+	}
+
+	for _, shard := range dataShards {
+		if shard == nil {
+			return false, nil
+		}
+	}
+
+	corruptParityShardDelegate, _ := d.delegate.(CorruptParityShardDelegate)
+	ok = true
+	for _, i := range d.mismatchedParityShards(coder, dataShards) {
+		if corruptParityShardDelegate != nil {
+			corruptParityShardDelegate.OnDetectCorruptParityShard(uint16(i), d.parityShardPaths[i])
+		}
+		ok = false
+	}
+	return ok, nil
+}
+
+// SetMemoryLimit sets roughly how many bytes of computed data the
+// Decoder may hold in memory at once, in VerifyAllData and in
+// Repair. If memoryLimit is <= 0, which is the default, there's no
+// limit. Otherwise, the parity shards checked by VerifyAllData, and
+// the data shards reconstructed by Repair along with the parity
+// shards it checks if checkParity is set, are computed in passes
+// over byte ranges of the slices, each of which is checked or
+// written out before the next one is computed. Either way, the
+// results are the same. The loaded data and parity shards aren't
+// counted.
+func (d *Decoder) SetMemoryLimit(memoryLimit int) {
+	d.memoryLimit = memoryLimit
+}
+
+// newParityMismatches returns a slice with an entry for each parity
+// shard in d.parityShards, which is initially true only for present
+// parity shards with the wrong size, to be filled in by
+// checkParityPass.
+func (d *Decoder) newParityMismatches() []bool {
+	mismatched := make([]bool, len(d.parityShards))
+	for i, shard := range d.parityShards {
+		mismatched[i] = len(shard) != 0 && len(shard) != d.sliceByteCount
+	}
+	return mismatched
+}
+
+// checkParityPass computes the bytes [start, end) of the parity
+// shards into computed from dataPass, which holds those bytes of
+// every data shard, and sets the entries of mismatched for the
+// present parity shards in d.parityShards that don't match.
+func (d *Decoder) checkParityPass(coder rsec16.Coder, dataPass, computed [][]byte, start, end int, mismatched []bool) {
+	coder.GenerateParityInto(dataPass, computed, 0)
+	for i, shard := range d.parityShards {
+		if len(shard) == 0 || mismatched[i] {
+			continue
+		}
+		mismatched[i] = !bytes.Equal(computed[i], shard[start:end])
+	}
+}
+
+// trueIndices returns the indices of the true entries of bs, in
+// increasing order.
+func trueIndices(bs []bool) []int {
+	var indices []int
+	for i, b := range bs {
+		if b {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// mismatchedParityShards computes the parity shards from dataShards,
+// which must all be present, in passes limited by d.memoryLimit, and
+// returns the indices of the present parity shards in d.parityShards
+// that don't match, in increasing order.
+func (d *Decoder) mismatchedParityShards(coder rsec16.Coder, dataShards [][]byte) []int {
+	mismatched := d.newParityMismatches()
+	passByteCount := passByteCount(d.sliceByteCount, len(d.parityShards), d.memoryLimit)
+	computedParityShards := make([][]byte, len(d.parityShards))
+	for i := range computedParityShards {
+		computedParityShards[i] = make([]byte, passByteCount)
+	}
+	forEachPass(d.sliceByteCount, passByteCount, func(start, end int) {
+		computed := shardRange(computedParityShards, 0, end-start)
+		d.checkParityPass(coder, shardRange(dataShards, start, end), computed, start, end, mismatched)
+	})
+	return trueIndices(mismatched)
+}
+
+// writeShardRange writes the bytes [start, end) of the jth data
+// shard of a file with the given size to f, dropping any bytes past
+// the end of the file, which are just padding.
+func writeShardRange(f fsio.PendingFile, byteCount, sliceByteCount, j int, data []byte, start, end int) error {
+	// TODO: Handle overflow.
+	offset := j*sliceByteCount + start
+	if offset >= byteCount {
+		return nil
+	}
+	if fileEnd := j*sliceByteCount + end; fileEnd > byteCount {
+		data = data[:len(data)-(fileEnd-byteCount)]
+	}
+	_, err := f.WriteAt(data, int64(offset))
+	return err
+}
+
 // Repair tries to repair any missing or corrupt data, using the
 // parity volumes. Returns a list of paths to files that were
 // successfully repaired (relative to the indexFile passed to
 // NewDecoder) in no particular order, which is present even if an
 // error is returned. If checkParity is true, extra checking is done
 // of the reconstructed parity data.
+//
+// The missing data shards are reconstructed in passes limited by the
+// memory limit (see SetMemoryLimit), and written out to the repaired
+// files as they're computed, and each one is checked against its
+// recorded hash before any file is replaced. The whole-file hashes
+// of the repaired files aren't checked, and the reconstructed data
+// isn't kept, so the Decoder's view of the data files isn't updated;
+// LoadFileData must be called again to check the repaired files,
+// which Repair (the function) does before purging.
 func (d *Decoder) Repair(checkParity bool) ([]string, error) {
 	coder, dataShards, err := d.newCoderAndShards()
 	if err != nil {
 		return nil, err
 	}
 
-	err = coder.ReconstructData(dataShards, d.parityShards)
+	// Map each data shard to its file and its index in that file.
+	shardFileIndices := make([]int, 0, len(dataShards))
+	shardIndices := make([]int, 0, len(dataShards))
+	wasOK := make([]bool, len(d.fileIntegrityInfos))
+	for i, info := range d.fileIntegrityInfos {
+		wasOK[i] = info.ok(d.sliceByteCount)
+		for j := range info.shardInfos {
+			shardFileIndices = append(shardFileIndices, i)
+			shardIndices = append(shardIndices, j)
+		}
+	}
+
+	// Parity shards of the wrong size can't be used.
+	parityShards := make([][]byte, len(d.parityShards))
+	for i, shard := range d.parityShards {
+		if len(shard) == d.sliceByteCount {
+			parityShards[i] = shard
+		}
+	}
+
+	var missing []int
+	for k, shard := range dataShards {
+		if shard == nil {
+			missing = append(missing, k)
+		}
+	}
+
+	// The reconstruction matrix depends only on which shards are
+	// present, so compute it once instead of once per pass, and
+	// do so now, with an empty pass, to check that repair is
+	// possible before writing anything.
+	coder.SetReconstructionCacheCapacity(1)
+	err = coder.ReconstructDataInto(shardRange(dataShards, 0, 0), shardRange(parityShards, 0, 0), make([][]byte, len(missing)))
 	if err != nil {
 		return nil, err
 	}
 
-	if checkParity {
-		computedParityShards := coder.GenerateParity(dataShards)
-		for i, shard := range d.parityShards {
-			if len(shard) == 0 {
-				continue
+	pendingFiles := make([]fsio.PendingFile, len(d.recoverySet))
+	defer func() {
+		for _, f := range pendingFiles {
+			if f != nil {
+				_ = f.Discard()
 			}
+		}
+	}()
+
+	for i, decoderInputFileInfo := range d.recoverySet {
+		if wasOK[i] {
+			continue
+		}
 
-			eq := reflect.DeepEqual(computedParityShards[i], shard)
-			if !eq {
-				return nil, errors.New("repair failed")
+		path := d.getFilePath(decoderInputFileInfo)
+		f, err := createPendingFile(d.fileIO, path)
+		if err != nil {
+			d.delegate.OnDataFileWrite(i+1, len(d.recoverySet), path, decoderInputFileInfo.byteCount, err)
+			return nil, err
+		}
+		pendingFiles[i] = f
+
+		for j, shardInfo := range d.fileIntegrityInfos[i].shardInfos {
+			if shardInfo.data == nil {
+				continue
+			}
+			err := writeShardRange(f, decoderInputFileInfo.byteCount, d.sliceByteCount, j, shardInfo.data, 0, d.sliceByteCount)
+			if err != nil {
+				return nil, err
 			}
 		}
 	}
 
-	wasOK := make([]bool, len(d.fileIntegrityInfos))
+	bufferShardCount := len(missing)
+	var mismatched []bool
+	if checkParity {
+		bufferShardCount += len(d.parityShards)
+		mismatched = d.newParityMismatches()
+	}
+	passByteCount := passByteCount(d.sliceByteCount, bufferShardCount, d.memoryLimit)
+	reconstructedShards := make([][]byte, len(missing))
+	hashes := make([]hash.Hash, len(missing))
+	for m := range reconstructedShards {
+		reconstructedShards[m] = make([]byte, passByteCount)
+		hashes[m] = md5.New()
+	}
+	var computedParityShards [][]byte
+	if checkParity {
+		computedParityShards = make([][]byte, len(d.parityShards))
+		for i := range computedParityShards {
+			computedParityShards[i] = make([]byte, passByteCount)
+		}
+	}
 
-	k := 0
-	for i, info := range d.fileIntegrityInfos {
-		wasOK[i] = info.ok(d.sliceByteCount)
-		shardCount := len(info.shardInfos)
-		for j, shard := range dataShards[k : k+shardCount] {
-			info.shardInfos[j] = shardIntegrityInfo{
-				data:      shard,
-				locations: d.checksumToLocation.get(crc32.ChecksumIEEE(shard), shard),
+	forEachPass(d.sliceByteCount, passByteCount, func(start, end int) {
+		if err != nil {
+			return
+		}
+
+		dataPass := shardRange(dataShards, start, end)
+		reconstructed := shardRange(reconstructedShards, 0, end-start)
+		err = coder.ReconstructDataInto(dataPass, shardRange(parityShards, start, end), reconstructed)
+		if err != nil {
+			return
+		}
+
+		for m, k := range missing {
+			dataPass[k] = reconstructed[m]
+			// Hash writes never fail.
+			_, _ = hashes[m].Write(reconstructed[m])
+			i := shardFileIndices[k]
+			err = writeShardRange(pendingFiles[i], d.recoverySet[i].byteCount, d.sliceByteCount, shardIndices[k], reconstructed[m], start, end)
+			if err != nil {
+				return
 			}
 		}
-		k += shardCount
-		d.fileIntegrityInfos[i] = info
+
+		if checkParity {
+			d.checkParityPass(coder, dataPass, shardRange(computedParityShards, 0, end-start), start, end, mismatched)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if checkParity {
+		if indices := trueIndices(mismatched); len(indices) > 0 {
+			return nil, &RepairFailedError{Problem: fmt.Sprintf("computed parity shard %d doesn't match", indices[0])}
+		}
+	}
+
+	for m, k := range missing {
+		i, j := shardFileIndices[k], shardIndices[k]
+		decoderInputFileInfo := d.recoverySet[i]
+		var sum [md5.Size]byte
+		copy(sum[:], hashes[m].Sum(nil))
+		if sum != decoderInputFileInfo.checksumPairs[j].MD5 {
+			return nil, &RepairFailedError{d.getFilePath(decoderInputFileInfo), "hash mismatch in reconstructed data"}
+		}
 	}
 
 	var repairedPaths []string
 
 	for i, decoderInputFileInfo := range d.recoverySet {
-		fileIntegrityInfo := d.fileIntegrityInfos[i]
-		if wasOK[i] {
+		f := pendingFiles[i]
+		if f == nil {
 			continue
 		}
 
-		buf := bytes.NewBuffer(nil)
-		for _, shardInfo := range fileIntegrityInfo.shardInfos {
-			err := binary.Write(buf, binary.LittleEndian, shardInfo.data)
+		// Keep the metadata of a damaged file, if it
+		// exists. Otherwise, restore the recorded file info,
+		// if any, or fall back to defaults.
+		path := d.getFilePath(decoderInputFileInfo)
+		info, err := d.fileIO.StatFile(path)
+		if err != nil {
+			info = restoredFileInfo(decoderInputFileInfo)
+		}
+
+		if d.keepBackups {
+			backupPath, err := fsio.BackUpFile(d.fileIO, path)
 			if err != nil {
 				return repairedPaths, err
 			}
+			if backupPath != "" {
+				d.backupPaths = append(d.backupPaths, backupPath)
+			}
 		}
 
-		data := buf.Bytes()[:decoderInputFileInfo.byteCount]
-		if sixteenKHash(data) != decoderInputFileInfo.sixteenKHash {
-			return repairedPaths, errors.New("hash mismatch (16k) in reconstructed data")
-		} else if md5.Sum(data) != decoderInputFileInfo.hash {
-			return repairedPaths, errors.New("hash mismatch in reconstructed data")
+		pendingFiles[i] = nil
+		err = f.Commit()
+		if err == nil {
+			err = d.fileIO.SetFileInfo(path, info)
 		}
-
-		path := d.getFilePath(decoderInputFileInfo)
-		err = d.fileIO.WriteFile(path, data)
-		d.delegate.OnDataFileWrite(i+1, len(d.recoverySet), path, len(data), err)
+		d.delegate.OnDataFileWrite(i+1, len(d.recoverySet), path, decoderInputFileInfo.byteCount, err)
 		if err != nil {
 			return repairedPaths, err
 		}
@@ -731,8 +1185,84 @@ func (d *Decoder) Repair(checkParity bool) ([]string, error) {
 	return repairedPaths, nil
 }
 
+// dataFilesOK returns whether every data file loaded by
+// LoadFileData is intact, i.e. present, of the right size, and
+// matching its recorded hashes and slice checksums.
+func (d *Decoder) dataFilesOK() bool {
+	for _, info := range d.fileIntegrityInfos {
+		if !info.ok(d.sliceByteCount) {
+			return false
+		}
+	}
+	return true
+}
+
+// restoredFileInfo returns the file info to give a missing file
+// restored by a repair, which is the recorded file info if there is
+// any, and otherwise fsio.RestoredFilePerm and the current time.
+func restoredFileInfo(info decoderInputFileInfo) fs.FileInfo {
+	perm, modTime := fsio.RestoredFilePerm, time.Now()
+	if info.fileInfoPacket != nil {
+		perm, modTime = info.fileInfoPacket.mode, info.fileInfoPacket.modTime
+	}
+	return fsio.NewFileInfo(path.Base(info.filename), int64(info.byteCount), perm, modTime)
+}
+
+// Purge removes the index file, the parity volumes loaded by
+// LoadParityData, and any backups of damaged data files made by
+// Repair, and returns the paths of the removed files, which is
+// present even if an error is returned. It should be called only
+// once the data files are known to be intact.
+func (d *Decoder) Purge() ([]string, error) {
+	paths := append([]string{d.indexPath}, d.parityVolumePaths...)
+	paths = append(paths, d.backupPaths...)
+
+	return fsio.DeleteFiles(d.fileIO, paths)
+}
+
 // NewDecoder reads the given index file, which usually has a .par2
 // extension.
 func NewDecoder(delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
 	return newDecoder(defaultFileIO{}, delegate, indexFile, numGoroutines)
 }
+
+// NewDecoderMmap is like NewDecoder, except that on Linux, files are
+// memory-mapped instead of being read into memory, so that their
+// pages are only loaded when needed, and can be evicted by the OS. If
+// mapping a file fails, or on other platforms, it's read into memory
+// as usual. Close must be called once the Decoder is no longer
+// needed.
+//
+// Since files are mapped shared, if another process truncates a file
+// while it's mapped, accessing the truncated part raises SIGBUS and
+// crashes the program, so only use this when nothing else modifies
+// the files in place.
+func NewDecoderMmap(delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
+	fileIO := newMmapFileIO()
+	decoder, err := newDecoder(fileIO, delegate, indexFile, numGoroutines)
+	if err != nil {
+		_ = fileIO.Close()
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// Close releases any resources held by the Decoder, e.g. the memory
+// mappings made by a Decoder returned by NewDecoderMmap. The Decoder
+// must not be used afterwards.
+func (d *Decoder) Close() error {
+	if closer, ok := d.fileIO.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewDecoderFS is like NewDecoder, except that it reads files from
+// fsys instead of the OS file system, and indexFile is a name in
+// fsys. The paths passed to the delegate and returned by Repair are
+// under fsio.Root(). Repair returns fsio.ErrReadOnly if fsys isn't a
+// fsio.WriteFS.
+func NewDecoderFS(fsys fs.FS, delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newDecoder(p, delegate, p.Path(indexFile), numGoroutines)
+}
@@ -4,7 +4,10 @@ import (
 	"crypto/md5"
 	"fmt"
 	"hash/crc32"
+	iofs "io/fs"
+	"io/ioutil"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"sort"
 	"testing"
@@ -49,12 +52,12 @@ func TestFillShardInfos(t *testing.T) {
 	dataByteCount := 50
 	id, data, checksumToLocation, fileIntegrityInfos, fileIDIndices, unrelatedData := makeTestFillShardInfoInputs(t, sliceByteCount, dataByteCount)
 
-	hits, misses := fillShardInfos(sliceByteCount, data, checksumToLocation, id, fileIntegrityInfos, fileIDIndices)
+	hits, misses := fillShardInfos(sliceByteCount, data, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, 1)
 	expectedHits := (dataByteCount + sliceByteCount - 1) / sliceByteCount
 	require.Equal(t, expectedHits, hits)
 	require.Equal(t, 0, misses)
 
-	hits, misses = fillShardInfos(sliceByteCount, unrelatedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices)
+	hits, misses = fillShardInfos(sliceByteCount, unrelatedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, 1)
 	require.Equal(t, 0, hits)
 	require.Equal(t, dataByteCount, misses)
 }
@@ -68,12 +71,25 @@ func BenchmarkFillShardInfos(b *testing.B) {
 
 	b.Run("related", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			fillShardInfos(sliceByteCount, data, checksumToLocation, id, fileIntegrityInfos, fileIDIndices)
+			fillShardInfos(sliceByteCount, data, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, 1)
 		}
 	})
 	b.Run("unrelated", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			fillShardInfos(sliceByteCount, unrelatedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices)
+			fillShardInfos(sliceByteCount, unrelatedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, 1)
+		}
+	})
+	// Inserting a byte at the start shifts every slice by one.
+	insertedData := append([]byte{0}, data...)
+	b.Run("inserted", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fillShardInfos(sliceByteCount, insertedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, 1)
+		}
+	})
+	b.Run("unrelated-parallel", func(b *testing.B) {
+		numGoroutines := rsec16.DefaultNumGoroutines()
+		for i := 0; i < b.N; i++ {
+			fillShardInfos(sliceByteCount, unrelatedData, checksumToLocation, id, fileIntegrityInfos, fileIDIndices, numGoroutines)
 		}
 	})
 }
@@ -110,7 +126,43 @@ func (io testFileIO) WriteFile(path string, data []byte) (err error) {
 	return io.fileIO.WriteFile(path, data)
 }
 
-func buildPAR2Data(t *testing.T, fs memfs.MemFS, basePath string, sliceByteCount, parityShardCount int) (dataShardCount int) {
+func (io testFileIO) MoveFile(oldPath, newPath string) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("MoveFile(%s, %s) => %v", oldPath, newPath, err)
+	}()
+	return io.fileIO.MoveFile(oldPath, newPath)
+}
+
+func (io testFileIO) DeleteFile(path string) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("DeleteFile(%s) => %v", path, err)
+	}()
+	return io.fileIO.DeleteFile(path)
+}
+
+func (io testFileIO) StatFile(path string) (info iofs.FileInfo, err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("StatFile(%s) => %v", path, err)
+	}()
+	return io.fileIO.StatFile(path)
+}
+
+func (io testFileIO) SetFileInfo(path string, info iofs.FileInfo) (err error) {
+	io.t.Helper()
+	defer func() {
+		io.t.Helper()
+		io.t.Logf("SetFileInfo(%s, %v, %v) => %v", path, info.Mode(), info.ModTime(), err)
+	}()
+	return io.fileIO.SetFileInfo(path, info)
+}
+
+func buildPAR2Data(t testing.TB, fs memfs.MemFS, basePath string, sliceByteCount, parityShardCount int) (dataShardCount int) {
 	var recoverySet []fileID
 	fileDescriptionPackets := make(map[fileID]fileDescriptionPacket)
 	ifscPackets := make(map[fileID]ifscPacket)
@@ -334,6 +386,148 @@ func TestDecoderVerify(t *testing.T) {
 	runOnExampleWorkingDirs(t, testDecoderVerify)
 }
 
+// corruptRecoveryPacket changes the recovery data in the volume file
+// at path while keeping it well-formed, so that the corruption can
+// only be detected by recomputing the parity data.
+func corruptRecoveryPacket(t *testing.T, fs memfs.MemFS, path string) {
+	corruptRecoveryPacketAt(t, fs, path, 0)
+}
+
+// corruptRecoveryPacketAt is like corruptRecoveryPacket, except that
+// it changes the byte at offset i of the recovery data.
+func corruptRecoveryPacketAt(t *testing.T, fs memfs.MemFS, path string, i int) {
+	volumeBytes, err := fs.ReadFile(path)
+	require.NoError(t, err)
+	_, volumeFile, err := readFile(DoNothingDecoderDelegate{}, nil, volumeBytes)
+	require.NoError(t, err)
+	for _, packet := range volumeFile.recoveryPackets {
+		packet.data[i]++
+	}
+	_, volumeBytes, err = writeFile(volumeFile)
+	require.NoError(t, err)
+	require.NoError(t, fs.WriteFile(path, volumeBytes))
+}
+
+func testDecoderVerifyAllData(t *testing.T, workingDir string, useAbsPath bool) {
+	fs := makeDecoderMemFS(workingDir)
+	r04Path := filepath.Join("dir4", "dir5", "file.r04")
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	parPath := "file.par2"
+	if useAbsPath {
+		parPath = filepath.Join(workingDir, parPath)
+	}
+
+	decoder, err := newDecoderForTest(t, fs, parPath)
+	require.NoError(t, err)
+	err = decoder.LoadFileData()
+	require.NoError(t, err)
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+
+	ok, err := decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	perturbFile(t, fs, r04Path)
+	err = decoder.LoadFileData()
+	require.NoError(t, err)
+	ok, err = decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	unperturbFile(t, fs, r04Path)
+	err = decoder.LoadFileData()
+	require.NoError(t, err)
+	_, err = fs.RemoveFile("file.vol02+01.par2")
+	require.NoError(t, err)
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+	ok, err = decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	corruptRecoveryPacket(t, fs, "file.vol01+01.par2")
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+	require.False(t, decoder.ShardCounts().RepairNeeded())
+	ok, err = decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestDecoderVerifyAllData(t *testing.T) {
+	runOnExampleWorkingDirs(t, testDecoderVerifyAllData)
+}
+
+func TestDecoderVerifyAllDataMemoryLimit(t *testing.T) {
+	data := make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fs := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+		"file.rar": data,
+	})
+	buildPAR2Data(t, fs, memfs.RootDir(), 16, 3)
+
+	decoder, err := newDecoderForTest(t, fs, "file.par2")
+	require.NoError(t, err)
+	// Check 4 bytes of each of the 3 parity shards at a time.
+	decoder.SetMemoryLimit(12)
+	err = decoder.LoadFileData()
+	require.NoError(t, err)
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+
+	ok, err := decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Corruption in the last pass should still be detected.
+	corruptRecoveryPacketAt(t, fs, "file.vol01+01.par2", 15)
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+	ok, err = decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// corruptParityShardRecorder is a DecoderDelegate that records the
+// corrupt parity shards it's told about.
+type corruptParityShardRecorder struct {
+	DoNothingDecoderDelegate
+	exponents *[]uint16
+}
+
+func (r corruptParityShardRecorder) OnDetectCorruptParityShard(exponent uint16, path string) {
+	*r.exponents = append(*r.exponents, exponent)
+}
+
+func TestDecoderVerifyAllDataCorruptParityShardDelegate(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+	corruptRecoveryPacket(t, fs, "file.vol01+01.par2")
+
+	var exponents []uint16
+	for _, delegate := range []DecoderDelegate{
+		// A delegate that isn't a CorruptParityShardDelegate
+		// still works.
+		DoNothingDecoderDelegate{},
+		corruptParityShardRecorder{exponents: &exponents},
+	} {
+		decoder, err := newDecoder(testFileIO{t, fs}, delegate, "file.par2", rsec16.DefaultNumGoroutines())
+		require.NoError(t, err)
+		require.NoError(t, decoder.LoadFileData())
+		require.NoError(t, decoder.LoadParityData())
+		ok, err := decoder.VerifyAllData()
+		require.NoError(t, err)
+		require.False(t, ok)
+	}
+	require.Equal(t, []uint16{1}, exponents)
+}
+
 func TestSetIDMismatch(t *testing.T) {
 	workingDir := memfs.RootDir()
 	fs1 := makeDecoderMemFS(workingDir)
@@ -534,3 +728,50 @@ func TestRepairSwappedFiles(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, r01Data, repairedR01Data)
 }
+
+func TestRepairMemoryLimit(t *testing.T) {
+	const sliceByteCount = 64 * 1024
+	const memoryLimit = 256 * 1024
+	dir := t.TempDir()
+	paths := writeTestDataFiles(t, dir, 2, 8*sliceByteCount)
+	data, err := ioutil.ReadFile(paths[0])
+	require.NoError(t, err)
+
+	parPath := filepath.Join(dir, "file.par2")
+	encoder, err := NewEncoder(testEncoderDelegate{t}, dir, paths, sliceByteCount, 8, 1)
+	require.NoError(t, err)
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.NoError(t, encoder.Write(parPath))
+
+	// The first repair fills in gf2p16's multiplication tables,
+	// which are shared and don't depend on the data size, so
+	// only measure the later ones.
+	for i, checkParity := range []bool{false, false, true} {
+		// Reconstructing the missing file whole would take
+		// 512 KiB.
+		require.NoError(t, os.Remove(paths[0]))
+
+		decoder, err := NewDecoder(testDecoderDelegate{t}, parPath, 1)
+		require.NoError(t, err)
+		decoder.SetMemoryLimit(memoryLimit)
+		require.NoError(t, decoder.LoadFileData())
+		require.NoError(t, decoder.LoadParityData())
+
+		var repairedPaths []string
+		allocated := allocatedByteCount(func() {
+			repairedPaths, err = decoder.Repair(checkParity)
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{paths[0]}, repairedPaths)
+		// Leave some slack for the reconstruction matrix and
+		// the hashes.
+		if i > 0 {
+			require.Less(t, allocated, uint64(memoryLimit+64*1024), "checkParity=%t", checkParity)
+		}
+
+		repairedData, err := ioutil.ReadFile(paths[0])
+		require.NoError(t, err)
+		require.Equal(t, data, repairedData)
+	}
+}
@@ -1,19 +1,28 @@
 package par2
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/fs"
 	"path"
 	"path/filepath"
 	"sort"
 
+	"github.com/akalin/gopar/fsio"
 	"github.com/akalin/gopar/rsec16"
 )
 
 type encoderInputFileInfo struct {
 	fileDescriptionPacket fileDescriptionPacket
 	ifscPacket            ifscPacket
-	dataShards            [][]byte
+	// Nil unless file info is being recorded.
+	fileInfoPacket *fileInfoPacket
+	dataShards     [][]byte
 }
 
 // An Encoder keeps track of all information needed to create parity
@@ -29,11 +38,21 @@ type Encoder struct {
 	sliceByteCount   int
 	parityShardCount int
 
+	recoveryFileScheme RecoveryFileScheme
+	numRecoveryFiles   int
+
+	recordFileInfo bool
+
 	numGoroutines int
+	memoryLimit   int
 
 	recoverySet      []fileID
 	recoverySetInfos map[fileID]encoderInputFileInfo
 
+	coder      rsec16.Coder
+	dataShards [][]byte
+	// Nil if the parity shards are computed in Write instead,
+	// because of memoryLimit.
 	parityShards [][]byte
 }
 
@@ -47,67 +66,310 @@ type EncoderDelegate interface {
 
 func newEncoder(fileIO fileIO, delegate EncoderDelegate, basePath string, filePaths []string, sliceByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
 	if !filepath.IsAbs(basePath) {
-		return nil, errors.New("basePath must be absolute")
+		return nil, &InvalidArgumentError{"basePath", "must be absolute"}
 	}
 
 	relFilePaths := make([]string, len(filePaths))
 	for i, path := range filePaths {
 		var relPath string
 		if !filepath.IsAbs(path) {
-			return nil, errors.New("all elements of filePaths must be absolute")
+			return nil, &InvalidArgumentError{"filePaths", "must all be absolute"}
 		}
 		relPath, err := filepath.Rel(basePath, path)
 		if err != nil {
 			return nil, err
 		}
 		if relPath[0] == '.' {
-			return nil, errors.New("data files must lie in basePath")
+			return nil, &InvalidArgumentError{"filePaths", "must all lie in basePath"}
 		}
 		relFilePaths[i] = relPath
 	}
 
-	// TODO: Check parityShardCount.
+	if parityShardCount < 0 {
+		return nil, &InvalidArgumentError{"parityShardCount", "must not be negative"}
+	}
 	if sliceByteCount == 0 || sliceByteCount%4 != 0 {
-		return nil, errors.New("invalid slice byte count")
+		return nil, &InvalidArgumentError{"sliceByteCount", "must be a positive multiple of 4"}
+	}
+	return &Encoder{fileIO, delegate, basePath, relFilePaths, sliceByteCount, parityShardCount, RecoveryFileSchemeVariable, 0, false, numGoroutines, 0, nil, nil, rsec16.Coder{}, nil, nil}, nil
+}
+
+// RecoveryFileScheme determines how Encoder.Write distributes the
+// parity shards among recovery files, like par2cmdline's -u and -l
+// options.
+type RecoveryFileScheme int
+
+const (
+	// RecoveryFileSchemeVariable gives each recovery file twice
+	// as many parity shards as the previous one. This is the
+	// default.
+	RecoveryFileSchemeVariable RecoveryFileScheme = iota
+	// RecoveryFileSchemeUniform gives each recovery file the
+	// same number of parity shards, give or take one.
+	RecoveryFileSchemeUniform
+	// RecoveryFileSchemeLimited is like
+	// RecoveryFileSchemeVariable, except that no recovery file
+	// gets more parity shards than the largest data file has
+	// slices.
+	RecoveryFileSchemeLimited
+)
+
+// SetRecoveryFileScheme sets how Write distributes the parity shards
+// among recovery files. If numRecoveryFiles is <= 0, the number of
+// recovery files is determined by scheme. Otherwise, it's the exact
+// number of recovery files for RecoveryFileSchemeUniform, and an
+// upper bound for RecoveryFileSchemeVariable, and it can't be set
+// for RecoveryFileSchemeLimited.
+func (e *Encoder) SetRecoveryFileScheme(scheme RecoveryFileScheme, numRecoveryFiles int) error {
+	switch scheme {
+	case RecoveryFileSchemeVariable, RecoveryFileSchemeUniform:
+	case RecoveryFileSchemeLimited:
+		if numRecoveryFiles > 0 {
+			return &InvalidArgumentError{"numRecoveryFiles", "can't be set for RecoveryFileSchemeLimited"}
+		}
+	default:
+		return &InvalidArgumentError{"scheme", "is unknown"}
+	}
+	if numRecoveryFiles > e.parityShardCount {
+		return &InvalidArgumentError{"numRecoveryFiles", "must not be greater than the parity shard count"}
 	}
-	return &Encoder{fileIO, delegate, basePath, relFilePaths, sliceByteCount, parityShardCount, numGoroutines, nil, nil, nil}, nil
+	e.recoveryFileScheme = scheme
+	e.numRecoveryFiles = numRecoveryFiles
+	return nil
+}
+
+// SetRecordFileInfo sets whether Write records the permissions and
+// modification time of each data file loaded by LoadFileData (or
+// LoadFileDataFromTar, which takes them from the tar headers) in a
+// gopar-specific packet, so that a repair can restore them if the
+// file goes missing. It must be called before LoadFileData.
+func (e *Encoder) SetRecordFileInfo(recordFileInfo bool) {
+	e.recordFileInfo = recordFileInfo
+}
+
+// SetMemoryLimit sets roughly how many bytes of parity data the
+// Encoder may hold in memory at once, not counting the data files
+// themselves. If memoryLimit is <= 0, which is the default, there's
+// no limit. Otherwise, if the parity data doesn't fit,
+// ComputeParityData doesn't compute it, and Write instead computes
+// the parity shards for each recovery file while writing it, in
+// passes over byte ranges of the slices, writing out each pass of
+// each recovery packet before computing the next, so that at most
+// about memoryLimit bytes of parity data are held in memory at once.
+// Either way, the written files are the same. It must be called
+// before ComputeParityData.
+func (e *Encoder) SetMemoryLimit(memoryLimit int) {
+	e.memoryLimit = memoryLimit
+}
+
+// recoveryFileShardCounts returns the number of parity shards in each
+// recovery file for the given scheme; see SetRecoveryFileScheme.
+// maxShardCount is the maximum number of parity shards per file for
+// RecoveryFileSchemeLimited.
+func recoveryFileShardCounts(scheme RecoveryFileScheme, parityShardCount, numRecoveryFiles, maxShardCount int) []int {
+	if scheme == RecoveryFileSchemeUniform {
+		if numRecoveryFiles <= 0 {
+			numRecoveryFiles = len(recoveryFileShardCounts(RecoveryFileSchemeVariable, parityShardCount, 0, 0))
+		}
+		counts := make([]int, numRecoveryFiles)
+		for i := range counts {
+			counts[i] = parityShardCount / numRecoveryFiles
+			if i < parityShardCount%numRecoveryFiles {
+				counts[i]++
+			}
+		}
+		return counts
+	}
+
+	// Pick the smallest first count such that the counts of
+	// numRecoveryFiles files add up to at least parityShardCount,
+	// i.e. count * (2^numRecoveryFiles - 1) >= parityShardCount.
+	count := 1
+	if numRecoveryFiles > 0 && numRecoveryFiles < 31 {
+		total := 1<<uint(numRecoveryFiles) - 1
+		count = (parityShardCount + total - 1) / total
+	}
+
+	var counts []int
+	for i := 0; i < parityShardCount; {
+		if scheme == RecoveryFileSchemeLimited && maxShardCount > 0 && count > maxShardCount {
+			count = maxShardCount
+		}
+		if i+count > parityShardCount {
+			count = parityShardCount - i
+		}
+		counts = append(counts, count)
+		i += count
+		count *= 2
+	}
+	return counts
 }
 
 // NewEncoder creates an encoder with the given list of file paths,
-// and with the given number of intended parity volumes. basePath must
+// and with the given number of intended parity volumes, which may be
+// 0, in which case Write only writes the index file. basePath must
 // be absolute. Elements of filePaths must be absolute, and must also
 // lie in basePath.
 func NewEncoder(delegate EncoderDelegate, basePath string, filePaths []string, sliceByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
 	return newEncoder(defaultFileIO{}, delegate, basePath, filePaths, sliceByteCount, parityShardCount, numGoroutines)
 }
 
+// NewEncoderMmap is like NewEncoder, except that on Linux, the data
+// files are memory-mapped instead of being read into memory, so that
+// their pages are only loaded when needed, and can be evicted by the
+// OS. If mapping a file fails, or on other platforms, it's read into
+// memory as usual. Close must be called once the Encoder is no longer
+// needed.
+//
+// Since files are mapped shared, if another process truncates a file
+// while it's mapped, accessing the truncated part raises SIGBUS and
+// crashes the program, so only use this when nothing else modifies
+// the files in place.
+func NewEncoderMmap(delegate EncoderDelegate, basePath string, filePaths []string, sliceByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
+	return newEncoder(newMmapFileIO(), delegate, basePath, filePaths, sliceByteCount, parityShardCount, numGoroutines)
+}
+
+// Close releases any resources held by the Encoder, e.g. the memory
+// mappings made by an Encoder returned by NewEncoderMmap. The Encoder
+// must not be used afterwards.
+func (e *Encoder) Close() error {
+	if closer, ok := e.fileIO.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// NewEncoderFS is like NewEncoder, except that it reads and writes
+// files in fsys instead of the OS file system. basePath and the
+// elements of filePaths are names in fsys. The paths passed to the
+// delegate are under fsio.Root(), and so must be the path passed to
+// Write, e.g. as returned by fsio.PathFS.Path.
+func NewEncoderFS(fsys fsio.WriteFS, delegate EncoderDelegate, basePath string, filePaths []string, sliceByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newEncoder(p, delegate, p.Path(basePath), p.Paths(filePaths), sliceByteCount, parityShardCount, numGoroutines)
+}
+
 // LoadFileData loads the file data into memory.
 func (e *Encoder) LoadFileData() error {
 	var recoverySet []fileID
 	recoverySetInfos := make(map[fileID]encoderInputFileInfo)
 
-	for i, relPath := range e.relFilePaths {
+	// Read and hash the files in parallel, splitting the
+	// goroutines among them, but call the delegate in order.
+	type loadedFile struct {
+		byteCount int
+		err       error
+		fileID    fileID
+		info      encoderInputFileInfo
+	}
+	loadedFiles := make([]loadedFile, len(e.relFilePaths))
+	numGoroutinesPerFile := 1
+	if len(e.relFilePaths) > 0 && e.numGoroutines > len(e.relFilePaths) {
+		numGoroutinesPerFile = e.numGoroutines / len(e.relFilePaths)
+	}
+	runParallel(len(e.relFilePaths), e.numGoroutines, func(i int) {
+		relPath := e.relFilePaths[i]
 		path := filepath.Join(e.basePath, relPath)
 		data, err := e.fileIO.ReadFile(path)
-		e.delegate.OnDataFileLoad(i+1, len(e.relFilePaths), path, len(data), err)
+		if err != nil {
+			loadedFiles[i] = loadedFile{byteCount: len(data), err: err}
+			return
+		}
+
+		var fileInfoPacket *fileInfoPacket
+		if e.recordFileInfo {
+			info, err := e.fileIO.StatFile(path)
+			if err != nil {
+				loadedFiles[i] = loadedFile{byteCount: len(data), err: err}
+				return
+			}
+			packet := makeFileInfoPacket(info)
+			fileInfoPacket = &packet
+		}
+
+		fileID, fileDescriptionPacket, ifscPacket, dataShards := computeDataFileInfoParallel(e.sliceByteCount, relPath, data, numGoroutinesPerFile)
+		loadedFiles[i] = loadedFile{
+			byteCount: len(data),
+			fileID:    fileID,
+			info: encoderInputFileInfo{
+				fileDescriptionPacket, ifscPacket, fileInfoPacket, dataShards,
+			},
+		}
+	})
+
+	for i, relPath := range e.relFilePaths {
+		path := filepath.Join(e.basePath, relPath)
+		loadedFile := loadedFiles[i]
+		e.delegate.OnDataFileLoad(i+1, len(e.relFilePaths), path, loadedFile.byteCount, loadedFile.err)
+		if loadedFile.err != nil {
+			return loadedFile.err
+		}
+
+		recoverySet = append(recoverySet, loadedFile.fileID)
+		recoverySetInfos[loadedFile.fileID] = loadedFile.info
+	}
+
+	e.setRecoverySet(recoverySet, recoverySetInfos)
+	return nil
+}
+
+// LoadFileDataFromTar is like LoadFileData, except that the data
+// files are the regular files in the given tar stream, which are
+// read one slice at a time. The file paths passed into NewEncoder
+// are ignored, and the names of the tar members are taken to be
+// relative to basePath. Since the number of files isn't known in
+// advance, the delegate's OnDataFileLoad is called with n = 0.
+func (e *Encoder) LoadFileDataFromTar(r io.Reader) error {
+	var recoverySet []fileID
+	recoverySetInfos := make(map[fileID]encoderInputFileInfo)
+	var relFilePaths []string
+	seenRelPaths := make(map[string]bool)
+
+	err := forEachTarMember(r, func(relPath string, info fs.FileInfo, r io.Reader) error {
+		if seenRelPaths[relPath] {
+			return errors.New("duplicate tar member " + relPath)
+		}
+		seenRelPaths[relPath] = true
+
+		fileID, fileDescriptionPacket, ifscPacket, dataShards, err := computeDataFileInfoFromReader(e.sliceByteCount, relPath, r)
+		e.delegate.OnDataFileLoad(len(relFilePaths)+1, 0, filepath.Join(e.basePath, relPath), fileDescriptionPacket.byteCount, err)
 		if err != nil {
 			return err
 		}
 
-		fileID, fileDescriptionPacket, ifscPacket, dataShards := computeDataFileInfo(e.sliceByteCount, relPath, data)
+		relFilePaths = append(relFilePaths, relPath)
 		recoverySet = append(recoverySet, fileID)
+		var fileInfoPacket *fileInfoPacket
+		if e.recordFileInfo {
+			packet := makeFileInfoPacket(info)
+			fileInfoPacket = &packet
+		}
+
 		recoverySetInfos[fileID] = encoderInputFileInfo{
-			fileDescriptionPacket, ifscPacket, dataShards,
+			fileDescriptionPacket, ifscPacket, fileInfoPacket, dataShards,
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(relFilePaths) == 0 {
+		return errors.New("no files found in tar stream")
 	}
 
+	e.relFilePaths = relFilePaths
+	e.setRecoverySet(recoverySet, recoverySetInfos)
+	return nil
+}
+
+func (e *Encoder) setRecoverySet(recoverySet []fileID, recoverySetInfos map[fileID]encoderInputFileInfo) {
 	sort.Slice(recoverySet, func(i, j int) bool {
 		return fileIDLess(recoverySet[i], recoverySet[j])
 	})
 
 	e.recoverySet = recoverySet
 	e.recoverySetInfos = recoverySetInfos
-	return nil
 }
 
 // ComputeParityData computes the parity data for the files.
@@ -117,18 +379,140 @@ func (e *Encoder) ComputeParityData() error {
 		dataShards = append(dataShards, e.recoverySetInfos[fileID].dataShards...)
 	}
 
+	e.dataShards = dataShards
+	if e.parityShardCount == 0 {
+		// Only the index file will be written.
+		e.coder = rsec16.Coder{}
+		e.parityShards = [][]byte{}
+		return nil
+	}
+
 	coder, err := rsec16.NewCoderPAR2Vandermonde(len(dataShards), e.parityShardCount, e.numGoroutines)
 	if err != nil {
 		return err
 	}
 
+	e.coder = coder
+	if e.memoryLimit > 0 && e.parityShardCount*e.sliceByteCount > e.memoryLimit {
+		e.parityShards = nil
+		return nil
+	}
 	e.parityShards = coder.GenerateParity(dataShards)
 	return nil
 }
 
+// writeRecoveryFile writes the recovery file at path, which is made
+// up of criticalBytes followed by the recovery packets for the count
+// parity shards starting at the one with index start, to a pending
+// file, and returns it uncommitted along with its size. If
+// ComputeParityData didn't compute the parity shards, they're
+// computed in passes, each of which is written out before the next
+// one is computed, and the packet headers, which need the hash of the
+// whole packet, are written last. The size is returned even if
+// writing fails, in which case the pending file is discarded.
+func (e *Encoder) writeRecoveryFile(path string, setID recoverySetID, criticalBytes []byte, start, count int) (f fsio.PendingFile, byteCount int, err error) {
+	headerByteCount := int(sizeOfPacketHeader())
+	packetByteCount := headerByteCount + 4 + e.sliceByteCount
+	packetOffset := func(j int) int64 {
+		return int64(len(criticalBytes)) + int64(j)*int64(packetByteCount)
+	}
+
+	byteCount = int(packetOffset(count))
+
+	f, err = createPendingFile(e.fileIO, path)
+	if err != nil {
+		return nil, byteCount, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Discard()
+		}
+	}()
+
+	_, err = f.WriteAt(criticalBytes, 0)
+	if err != nil {
+		return nil, byteCount, err
+	}
+
+	// The hash of a packet covers the recovery set ID, the packet
+	// type, and the body, which is the exponent followed by the
+	// recovery data.
+	hashes := make([]hash.Hash, count)
+	expBytes := make([][4]byte, count)
+	for j := range hashes {
+		binary.LittleEndian.PutUint32(expBytes[j][:], uint32(start+j))
+		hashes[j] = md5.New()
+		_, _ = hashes[j].Write(setID[:])
+		_, _ = hashes[j].Write(recoveryPacketType[:])
+		_, _ = hashes[j].Write(expBytes[j][:])
+	}
+
+	passBytes := e.sliceByteCount
+	var passBuffers [][]byte
+	if e.parityShards == nil {
+		passBytes = passByteCount(e.sliceByteCount, count, e.memoryLimit)
+		passBuffers = make([][]byte, count)
+		for j := range passBuffers {
+			passBuffers[j] = make([]byte, passBytes)
+		}
+	}
+	forEachPass(e.sliceByteCount, passBytes, func(passStart, passEnd int) {
+		if err != nil {
+			return
+		}
+		var parityShards [][]byte
+		if e.parityShards != nil {
+			parityShards = shardRange(e.parityShards[start:start+count], passStart, passEnd)
+		} else {
+			parityShards = shardRange(passBuffers, 0, passEnd-passStart)
+			e.coder.GenerateParityInto(shardRange(e.dataShards, passStart, passEnd), parityShards, start)
+		}
+		for j, parityShard := range parityShards {
+			_, _ = hashes[j].Write(parityShard)
+			_, err = f.WriteAt(parityShard, packetOffset(j)+int64(headerByteCount+4+passStart))
+			if err != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, byteCount, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for j, h := range hashes {
+		buf.Reset()
+		header := packetHeader{
+			Magic:         expectedMagic,
+			Length:        uint64(packetByteCount),
+			RecoverySetID: setID,
+			Type:          recoveryPacketType,
+		}
+		copy(header.Hash[:], h.Sum(nil))
+		err = writePacketHeader(buf, header)
+		if err != nil {
+			return nil, byteCount, err
+		}
+		_, _ = buf.Write(expBytes[j][:])
+		_, err = f.WriteAt(buf.Bytes(), packetOffset(j))
+		if err != nil {
+			return nil, byteCount, err
+		}
+	}
+
+	return f, byteCount, nil
+}
+
 const clientID = "gopar"
 
-func (e *Encoder) Write(indexPath string) error {
+// Write writes the index file and the recovery files next to
+// indexPath. All of them are written to pending files first, which
+// are only committed once all of them have been written
+// successfully, and the index file is committed last, so that a
+// failure never replaces the index file of an existing set. If
+// committing a file fails, the files committed so far that didn't
+// exist before are removed.
+func (e *Encoder) Write(indexPath string) (err error) {
 	mainPacket := mainPacket{
 		sliceByteCount: e.sliceByteCount,
 		recoverySet:    e.recoverySet,
@@ -136,9 +520,13 @@ func (e *Encoder) Write(indexPath string) error {
 
 	fileDescriptionPackets := make(map[fileID]fileDescriptionPacket)
 	ifscPackets := make(map[fileID]ifscPacket)
+	fileInfoPackets := make(map[fileID]fileInfoPacket)
 	for fileID, info := range e.recoverySetInfos {
 		fileDescriptionPackets[fileID] = info.fileDescriptionPacket
 		ifscPackets[fileID] = info.ifscPacket
+		if info.fileInfoPacket != nil {
+			fileInfoPackets[fileID] = *info.fileInfoPacket
+		}
 	}
 
 	parityFile := file{
@@ -146,9 +534,10 @@ func (e *Encoder) Write(indexPath string) error {
 		mainPacket:             &mainPacket,
 		fileDescriptionPackets: fileDescriptionPackets,
 		ifscPackets:            ifscPackets,
+		fileInfoPackets:        fileInfoPackets,
 	}
 
-	_, parityFileBytes, err := writeFile(parityFile)
+	setID, parityFileBytes, err := writeFile(parityFile)
 	if err != nil {
 		return err
 	}
@@ -157,40 +546,71 @@ func (e *Encoder) Write(indexPath string) error {
 	ext := path.Ext(indexPath)
 	base = indexPath[:len(indexPath)-len(ext)]
 
-	filename := base + ".par2"
-	err = e.fileIO.WriteFile(filename, parityFileBytes)
-	e.delegate.OnIndexFileWrite(filename, len(parityFileBytes), err)
+	// Don't leave a partial set of files behind if writing one
+	// of them fails. Discard does nothing for pending files that
+	// were already committed.
+	var pendingFiles []fsio.PendingFile
+	var pendingPaths []string
+	var createdPaths []string
+	defer func() {
+		if err != nil {
+			for _, f := range pendingFiles {
+				_ = f.Discard()
+			}
+			for _, path := range createdPaths {
+				_ = e.fileIO.DeleteFile(path)
+			}
+		}
+	}()
+
+	indexFilename := base + ".par2"
+	indexFile, err := createPendingFile(e.fileIO, indexFilename)
+	if err == nil {
+		pendingFiles = append(pendingFiles, indexFile)
+		pendingPaths = append(pendingPaths, indexFilename)
+		_, err = indexFile.WriteAt(parityFileBytes, 0)
+	}
+	e.delegate.OnIndexFileWrite(indexFilename, len(parityFileBytes), err)
 	if err != nil {
 		return err
 	}
 
-	volumeCount := 1
-	for i := 0; i < e.parityShardCount; {
-		recoveryFile := parityFile
-		recoveryFile.recoveryPackets = make(map[exponent]recoveryPacket, volumeCount)
-		if i+volumeCount > e.parityShardCount {
-			volumeCount = e.parityShardCount - i
-		}
-		for j := 0; j < volumeCount; j++ {
-			recoveryFile.recoveryPackets[exponent(i+j)] = recoveryPacket{data: e.parityShards[i+j]}
-		}
-
-		_, recoveryFileBytes, err := writeFile(recoveryFile)
-		if err != nil {
-			return err
+	maxDataShardCount := 0
+	for _, info := range e.recoverySetInfos {
+		if len(info.dataShards) > maxDataShardCount {
+			maxDataShardCount = len(info.dataShards)
 		}
+	}
 
+	i := 0
+	for _, volumeCount := range recoveryFileShardCounts(e.recoveryFileScheme, e.parityShardCount, e.numRecoveryFiles, maxDataShardCount) {
 		// TODO: Figure out how to handle when either i or
 		// volumeCount is >= 100.
 		filename := fmt.Sprintf("%s.vol%02d+%02d.par2", base, i, volumeCount)
-		err = e.fileIO.WriteFile(filename, recoveryFileBytes)
-		e.delegate.OnRecoveryFileWrite(i, volumeCount, e.parityShardCount, filename, len(recoveryFileBytes)-len(parityFileBytes), len(recoveryFileBytes), err)
+		f, byteCount, err := e.writeRecoveryFile(filename, setID, parityFileBytes, i, volumeCount)
+		e.delegate.OnRecoveryFileWrite(i, volumeCount, e.parityShardCount, filename, byteCount-len(parityFileBytes), byteCount, err)
 		if err != nil {
 			return err
 		}
+		pendingFiles = append(pendingFiles, f)
+		pendingPaths = append(pendingPaths, filename)
 
 		i += volumeCount
-		volumeCount *= 2
+	}
+
+	// Commit the recovery files first, and then the index file,
+	// which is the first pending file.
+	for k := range pendingFiles {
+		j := (k + 1) % len(pendingFiles)
+		_, statErr := e.fileIO.StatFile(pendingPaths[j])
+		existed := statErr == nil
+		err = pendingFiles[j].Commit()
+		if err != nil {
+			return err
+		}
+		if !existed {
+			createdPaths = append(createdPaths, pendingPaths[j])
+		}
 	}
 
 	return nil
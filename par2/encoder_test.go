@@ -175,5 +175,148 @@ func TestWriteParityFilesOutOfBasePath(t *testing.T) {
 	sliceByteCount := 4
 	parityShardCount := 100
 	_, err := newEncoderForTest(t, fs, filepath.Join(dir, "somedir"), paths, sliceByteCount, parityShardCount)
-	require.Equal(t, errors.New("data files must lie in basePath"), err)
+	require.Equal(t, &InvalidArgumentError{"filePaths", "must all lie in basePath"}, err)
+}
+
+func TestRecoveryFileShardCounts(t *testing.T) {
+	for _, test := range []struct {
+		scheme           RecoveryFileScheme
+		parityShardCount int
+		numRecoveryFiles int
+		maxShardCount    int
+		expectedCounts   []int
+	}{
+		{RecoveryFileSchemeVariable, 1, 0, 0, []int{1}},
+		{RecoveryFileSchemeVariable, 10, 0, 0, []int{1, 2, 4, 3}},
+		{RecoveryFileSchemeVariable, 10, 2, 0, []int{4, 6}},
+		{RecoveryFileSchemeVariable, 10, 3, 0, []int{2, 4, 4}},
+		{RecoveryFileSchemeVariable, 10, 10, 0, []int{1, 2, 4, 3}},
+		{RecoveryFileSchemeUniform, 10, 0, 0, []int{3, 3, 2, 2}},
+		{RecoveryFileSchemeUniform, 10, 3, 0, []int{4, 3, 3}},
+		{RecoveryFileSchemeUniform, 10, 10, 0, []int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{RecoveryFileSchemeLimited, 10, 0, 0, []int{1, 2, 4, 3}},
+		{RecoveryFileSchemeLimited, 10, 0, 2, []int{1, 2, 2, 2, 2, 1}},
+		{RecoveryFileSchemeLimited, 10, 0, 3, []int{1, 2, 3, 3, 1}},
+	} {
+		counts := recoveryFileShardCounts(test.scheme, test.parityShardCount, test.numRecoveryFiles, test.maxShardCount)
+		require.Equal(t, test.expectedCounts, counts, "%+v", test)
+	}
+}
+
+func TestSetRecoveryFileScheme(t *testing.T) {
+	dir := memfs.RootDir()
+	fs := makeEncoderMemFS(dir)
+	encoder, err := newEncoderForTest(t, fs, dir, fs.Paths(), 4, 10)
+	require.NoError(t, err)
+
+	require.NoError(t, encoder.SetRecoveryFileScheme(RecoveryFileSchemeUniform, 10))
+	require.Equal(t, &InvalidArgumentError{"numRecoveryFiles", "must not be greater than the parity shard count"}, encoder.SetRecoveryFileScheme(RecoveryFileSchemeUniform, 11))
+	require.Equal(t, &InvalidArgumentError{"numRecoveryFiles", "can't be set for RecoveryFileSchemeLimited"}, encoder.SetRecoveryFileScheme(RecoveryFileSchemeLimited, 2))
+
+	require.NoError(t, encoder.SetRecoveryFileScheme(RecoveryFileSchemeUniform, 2))
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.NoError(t, encoder.Write(filepath.Join(dir, "parity.par2")))
+	var parPaths []string
+	for _, path := range fs.Paths() {
+		if filepath.Ext(path) == ".par2" {
+			parPaths = append(parPaths, path)
+		}
+	}
+	require.ElementsMatch(t, []string{
+		filepath.Join(dir, "parity.par2"),
+		filepath.Join(dir, "parity.vol00+05.par2"),
+		filepath.Join(dir, "parity.vol05+05.par2"),
+	}, parPaths)
+}
+
+// failingWriteFileIO is a fileIO whose WriteFile fails for
+// failingPath.
+type failingWriteFileIO struct {
+	fileIO
+	failingPath string
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (io failingWriteFileIO) WriteFile(path string, data []byte) error {
+	if path == io.failingPath {
+		return errWriteFailed
+	}
+	return io.fileIO.WriteFile(path, data)
+}
+
+func TestWriteParityCleanUpOnError(t *testing.T) {
+	dir := memfs.RootDir()
+	fs := makeEncoderMemFS(dir)
+	paths := fs.Paths()
+	fileIO := failingWriteFileIO{testFileIO{t, fs}, filepath.Join(dir, "parity.vol01+02.par2")}
+	encoder, err := newEncoder(fileIO, testEncoderDelegate{t}, dir, paths, 4, 3, rsec16.DefaultNumGoroutines())
+	require.NoError(t, err)
+
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.Equal(t, errWriteFailed, encoder.Write(filepath.Join(dir, "parity.par2")))
+	require.ElementsMatch(t, paths, fs.Paths())
+}
+
+func TestWriteParityKeepExistingIndexFileOnError(t *testing.T) {
+	dir := memfs.RootDir()
+	fs := makeEncoderMemFS(dir)
+	indexPath := filepath.Join(dir, "parity.par2")
+	oldIndexData := []byte("old index file")
+	require.NoError(t, fs.WriteFile(indexPath, oldIndexData))
+	paths := fs.Paths()
+	var dataPaths []string
+	for _, path := range paths {
+		if path != indexPath {
+			dataPaths = append(dataPaths, path)
+		}
+	}
+	fileIO := failingWriteFileIO{testFileIO{t, fs}, filepath.Join(dir, "parity.vol01+02.par2")}
+	encoder, err := newEncoder(fileIO, testEncoderDelegate{t}, dir, dataPaths, 4, 3, rsec16.DefaultNumGoroutines())
+	require.NoError(t, err)
+
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.Equal(t, errWriteFailed, encoder.Write(indexPath))
+	require.ElementsMatch(t, paths, fs.Paths())
+	data, err := fs.ReadFile(indexPath)
+	require.NoError(t, err)
+	require.Equal(t, oldIndexData, data)
+}
+
+func TestWriteParityMemoryLimit(t *testing.T) {
+	const sliceByteCount = 64 * 1024
+	const memoryLimit = 256 * 1024
+	dir := t.TempDir()
+	paths := writeTestDataFiles(t, dir, 2, 8*sliceByteCount)
+
+	encoder, err := NewEncoder(testEncoderDelegate{t}, dir, paths, sliceByteCount, 32, 1)
+	require.NoError(t, err)
+	// Put all the parity shards, 2 MiB of them, in a single
+	// recovery file.
+	require.NoError(t, encoder.SetRecoveryFileScheme(RecoveryFileSchemeUniform, 1))
+	encoder.SetMemoryLimit(memoryLimit)
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+
+	// The first write fills in gf2p16's multiplication tables,
+	// which are shared and don't depend on the data size, so
+	// measure the second one.
+	require.NoError(t, encoder.Write(filepath.Join(dir, "warmup.par2")))
+	parPath := filepath.Join(dir, "file.par2")
+	allocated := allocatedByteCount(func() {
+		require.NoError(t, encoder.Write(parPath))
+	})
+	// Leave some slack for the critical packets and the hashes.
+	require.Less(t, allocated, uint64(memoryLimit+64*1024))
+
+	decoder, err := NewDecoder(testDecoderDelegate{t}, parPath, 1)
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	ok, err := decoder.VerifyAllData()
+	require.NoError(t, err)
+	require.True(t, ok)
 }
@@ -0,0 +1,193 @@
+package par2
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec16"
+)
+
+func packetTypeName(packetType [16]byte) string {
+	switch packetType {
+	case creatorPacketType:
+		return "creator"
+	case mainPacketType:
+		return "main"
+	case fileDescriptionPacketType:
+		return "file description"
+	case ifscPacketType:
+		return "input file slice checksum"
+	case recoveryPacketType:
+		return "recovery"
+	}
+	return fmt.Sprintf("%q", packetType[:])
+}
+
+// A PacketError is returned when a packet in a par file can't be
+// read or is invalid.
+type PacketError struct {
+	// Path is the path of the par file, or empty if the bytes of
+	// the file were read from somewhere else.
+	Path string
+	// Offset is the byte offset of the packet in the file.
+	Offset int
+	// PacketType is the type of the packet, or all zeroes if the
+	// packet header couldn't be read.
+	PacketType [16]byte
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *PacketError) Error() string {
+	var location string
+	if e.Path != "" {
+		location = e.Path + ": "
+	}
+	if e.PacketType == ([16]byte{}) {
+		return fmt.Sprintf("%spacket at offset %d: %s", location, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s%s packet at offset %d: %s", location, packetTypeName(e.PacketType), e.Offset, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// A MissingPacketError is returned when a par file doesn't contain a
+// packet that's needed.
+type MissingPacketError struct {
+	// Path is the path of the par file, or empty if the bytes of
+	// the file were read from somewhere else.
+	Path string
+	// PacketType is the type of the missing packet.
+	PacketType [16]byte
+	// FileID is the ID of the file the missing packet is for, or
+	// all zeroes if the packet isn't for a particular file.
+	FileID [16]byte
+}
+
+func (e *MissingPacketError) Error() string {
+	var location, forFile string
+	if e.Path != "" {
+		location = e.Path + ": "
+	}
+	if e.FileID != ([16]byte{}) {
+		forFile = fmt.Sprintf(" for file ID %x", e.FileID)
+	}
+	return fmt.Sprintf("%sno %s packet found%s", location, packetTypeName(e.PacketType), forFile)
+}
+
+// withPath fills in the path of err if it's a PacketError or a
+// MissingPacketError without one.
+func withPath(err error, path string) error {
+	var packetErr *PacketError
+	if errors.As(err, &packetErr) && packetErr.Path == "" {
+		packetErr.Path = path
+	}
+	var missingPacketErr *MissingPacketError
+	if errors.As(err, &missingPacketErr) && missingPacketErr.Path == "" {
+		missingPacketErr.Path = path
+	}
+	return err
+}
+
+// A MismatchError is returned when a value read from a file doesn't
+// match what's expected, e.g. a parity volume with a different slice
+// byte count from its index file.
+type MismatchError struct {
+	// Path is the path of the file the value was read from.
+	Path string
+	// What describes the value, e.g. "slice byte count".
+	What string
+	// Expected and Actual are the expected and actual values.
+	Expected, Actual interface{}
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s: %s mismatch: expected %v, got %v", e.Path, e.What, e.Expected, e.Actual)
+}
+
+// An InvalidArgumentError is returned when an argument passed into a
+// function is invalid.
+type InvalidArgumentError struct {
+	// Arg is the name of the argument, e.g. "parPath".
+	Arg string
+	// Problem describes what's wrong with the argument, e.g.
+	// "must have a .par2 extension".
+	Problem string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.Arg + " " + e.Problem
+}
+
+// A RepairFailedError is returned when repaired data fails a
+// consistency check, which means that the par files or the repair
+// itself are faulty.
+type RepairFailedError struct {
+	// Path is the path of the file whose repaired data failed
+	// the check, or empty if the check isn't for a particular
+	// file.
+	Path string
+	// Problem describes the failed check.
+	Problem string
+}
+
+func (e *RepairFailedError) Error() string {
+	if e.Path == "" {
+		return "repair failed: " + e.Problem
+	}
+	return fmt.Sprintf("repair of %s failed: %s", e.Path, e.Problem)
+}
+
+// exitCodeForErrorPar2CmdLine handles the errors common to all
+// commands for the ExitCodeFor*ErrorPar2CmdLine functions.
+func exitCodeForErrorPar2CmdLine(err error) int {
+	var invalidArgumentErr *InvalidArgumentError
+	var pathErr *fs.PathError
+	var packetErr *PacketError
+	var missingPacketErr *MissingPacketError
+	var mismatchErr *MismatchError
+	switch {
+	case err == nil:
+		return par2cmdline.ExitSuccess
+	case errors.As(err, &invalidArgumentErr):
+		return par2cmdline.ExitInvalidCommandLineArguments
+	case errors.As(err, &packetErr), errors.As(err, &missingPacketErr), errors.As(err, &mismatchErr):
+		return par2cmdline.ExitInsufficientCriticalData
+	case errors.As(err, &pathErr), errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return par2cmdline.ExitFileIOError
+	}
+	return par2cmdline.ExitLogicError
+}
+
+// ExitCodeForCreateErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Create.
+func ExitCodeForCreateErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForVerifyErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Verify. Note that a nil error doesn't mean that no repair is
+// needed; that has to be deduced from VerifyResult.ShardCounts.
+func ExitCodeForVerifyErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForRepairErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Repair.
+func ExitCodeForRepairErrorPar2CmdLine(err error) int {
+	var repairFailedErr *RepairFailedError
+	if errors.As(err, &rsec16.NotEnoughParityShardsError{}) {
+		return par2cmdline.ExitRepairNotPossible
+	} else if errors.As(err, &repairFailedErr) {
+		return par2cmdline.ExitRepairFailed
+	}
+	return exitCodeForErrorPar2CmdLine(err)
+}
@@ -0,0 +1,116 @@
+package par2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec16"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketError(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+	perturbFile(t, fs, "file.par2")
+
+	_, err := newDecoderForTest(t, fs, "file.par2")
+	var packetErr *PacketError
+	require.True(t, errors.As(err, &packetErr))
+	require.Equal(t, "file.par2", packetErr.Path)
+	require.NotZero(t, packetErr.Offset)
+	require.NotEqual(t, [16]byte{}, packetErr.PacketType)
+	require.Equal(t, par2cmdline.ExitInsufficientCriticalData, ExitCodeForVerifyErrorPar2CmdLine(err))
+}
+
+func TestMissingPacketError(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	// Strip the main packet out of the index file.
+	data, err := fs.ReadFile("file.par2")
+	require.NoError(t, err)
+	var strippedData []byte
+	for offset := 0; offset < len(data); {
+		var h packetHeader
+		require.NoError(t, binary.Read(bytes.NewReader(data[offset:]), binary.LittleEndian, &h))
+		next := offset + int(h.Length)
+		if h.Type != mainPacketType {
+			strippedData = append(strippedData, data[offset:next]...)
+		}
+		offset = next
+	}
+	require.NoError(t, fs.WriteFile("file.par2", strippedData))
+
+	_, err = newDecoderForTest(t, fs, "file.par2")
+	require.Equal(t, &MissingPacketError{
+		Path:       "file.par2",
+		PacketType: mainPacketType,
+	}, err)
+	require.Equal(t, par2cmdline.ExitInsufficientCriticalData, ExitCodeForVerifyErrorPar2CmdLine(err))
+}
+
+func TestExitCodeForErrorPar2CmdLine(t *testing.T) {
+	for _, test := range []struct {
+		err                error
+		createOrVerifyCode int
+		repairCode         int
+	}{
+		{nil, par2cmdline.ExitSuccess, par2cmdline.ExitSuccess},
+		{&InvalidArgumentError{"parPath", "must have a .par2 extension"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&PacketError{Err: errors.New("hash mismatch")}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MissingPacketError{PacketType: mainPacketType}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.vol00+01.par2", "slice byte count", 4, 8}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.par2", "index file recovery packet count", 0, 2}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MissingPacketError{Path: "file.par2", PacketType: recoveryPacketType}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.rar", "old data hash", [16]byte{}, [16]byte{1}}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.rar", "slice count", 3, 4}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.rar", "recovery set position", 1, 0}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&MismatchError{"file.r02", "shifted data file hash", [16]byte{}, [16]byte{1}}, par2cmdline.ExitInsufficientCriticalData, par2cmdline.ExitInsufficientCriticalData},
+		{&InvalidArgumentError{"filePath", "must be in the recovery set of file.par2, but file.r05 isn't"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&InvalidArgumentError{"filePaths", "must not contain files already in file.par2, but file.rar is"}, par2cmdline.ExitInvalidCommandLineArguments, par2cmdline.ExitInvalidCommandLineArguments},
+		{&fs.PathError{Op: "open", Path: "file.par2", Err: fs.ErrNotExist}, par2cmdline.ExitFileIOError, par2cmdline.ExitFileIOError},
+		{rsec16.NotEnoughParityShardsError{}, par2cmdline.ExitLogicError, par2cmdline.ExitRepairNotPossible},
+		{&RepairFailedError{"file.rar", "hash mismatch in reconstructed data"}, par2cmdline.ExitLogicError, par2cmdline.ExitRepairFailed},
+		{errors.New("some other error"), par2cmdline.ExitLogicError, par2cmdline.ExitLogicError},
+	} {
+		// Wrapping shouldn't change the exit code.
+		for _, err := range []error{test.err, fmt.Errorf("wrapped: %w", test.err)} {
+			if test.err == nil {
+				err = nil
+			}
+			require.Equal(t, test.createOrVerifyCode, ExitCodeForCreateErrorPar2CmdLine(err), "%v", err)
+			require.Equal(t, test.createOrVerifyCode, ExitCodeForVerifyErrorPar2CmdLine(err), "%v", err)
+			require.Equal(t, test.repairCode, ExitCodeForRepairErrorPar2CmdLine(err), "%v", err)
+		}
+	}
+}
+
+func TestRepairWithoutParityVolumesError(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+	for _, path := range fs.Paths() {
+		if strings.Contains(path, ".vol") {
+			_, err := fs.RemoveFile(path)
+			require.NoError(t, err)
+		}
+	}
+	perturbFile(t, fs, "file.rar")
+
+	decoder, err := newDecoderForTest(t, fs, "file.par2")
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	_, err = decoder.Repair(false)
+	require.Equal(t, &MissingPacketError{Path: "file.par2", PacketType: recoveryPacketType}, err)
+	require.Equal(t, par2cmdline.ExitInsufficientCriticalData, ExitCodeForRepairErrorPar2CmdLine(err))
+}
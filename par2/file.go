@@ -14,6 +14,7 @@ type file struct {
 	mainPacket             *mainPacket
 	fileDescriptionPackets map[fileID]fileDescriptionPacket
 	ifscPackets            map[fileID]ifscPacket
+	fileInfoPackets        map[fileID]fileInfoPacket
 	recoveryPackets        map[exponent]recoveryPacket
 	unknownPackets         map[packetType][][]byte
 }
@@ -40,15 +41,17 @@ func readFile(delegate DecoderDelegate, expectedSetID *recoverySetID, fileBytes
 	var mainPacket *mainPacket
 	fileDescriptionPackets := make(map[fileID]fileDescriptionPacket)
 	ifscPackets := make(map[fileID]ifscPacket)
+	fileInfoPackets := make(map[fileID]fileInfoPacket)
 	recoveryPackets := make(map[exponent]recoveryPacket)
 	unknownPackets := make(map[packetType][][]byte)
 	for {
+		offset := len(fileBytes) - buf.Len()
 		packetSetID, packetType, body, err := readNextPacket(buf)
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			// TODO: Relax this check.
-			return recoverySetID{}, file{}, err
+			return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
 		}
 		if hasSetID {
 			if packetSetID != setID {
@@ -74,7 +77,7 @@ func readFile(delegate DecoderDelegate, expectedSetID *recoverySetID, fileBytes
 			mainPacketRead, err := readMainPacket(body)
 			if err != nil {
 				// TODO: Relax this check.
-				return recoverySetID{}, file{}, err
+				return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
 			}
 
 			mainPacket = &mainPacketRead
@@ -84,7 +87,7 @@ func readFile(delegate DecoderDelegate, expectedSetID *recoverySetID, fileBytes
 			fileID, fileDescriptionPacket, err := readFileDescriptionPacket(body)
 			if err != nil {
 				// TODO: Relax this check.
-				return recoverySetID{}, file{}, err
+				return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
 			}
 
 			delegate.OnFileDescriptionPacketLoad(fileID, fileDescriptionPacket.filename, fileDescriptionPacket.byteCount)
@@ -94,23 +97,32 @@ func readFile(delegate DecoderDelegate, expectedSetID *recoverySetID, fileBytes
 			fileID, ifscPacket, err := readIFSCPacket(body)
 			if err != nil {
 				// TODO: Relax this check.
-				return recoverySetID{}, file{}, err
+				return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
 			}
 
 			delegate.OnIFSCPacketLoad(fileID)
 			ifscPackets[fileID] = ifscPacket
 
+		case fileInfoPacketType:
+			fileID, fileInfoPacket, err := readFileInfoPacket(body)
+			if err != nil {
+				// TODO: Relax this check.
+				return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
+			}
+
+			fileInfoPackets[fileID] = fileInfoPacket
+
 		case recoveryPacketType:
 			exponent, recoveryPacket, err := readRecoveryPacket(body)
 			if err != nil {
 				// TODO: Relax this check.
-				return recoverySetID{}, file{}, err
+				return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
 			}
 
 			delegate.OnRecoveryPacketLoad(uint16(exponent), len(recoveryPacket.data))
 			if existingPacket, ok := recoveryPackets[exponent]; ok {
 				if !reflect.DeepEqual(existingPacket, recoveryPacket) {
-					return recoverySetID{}, file{}, errors.New("recovery packet with duplicate exponent but differing contents")
+					return recoverySetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: errors.New("duplicate exponent but differing contents")}
 				}
 			}
 			recoveryPackets[exponent] = recoveryPacket
@@ -126,10 +138,10 @@ func readFile(delegate DecoderDelegate, expectedSetID *recoverySetID, fileBytes
 	}
 
 	if !foundClientID {
-		return recoverySetID{}, file{}, errors.New("no creator packet found")
+		return recoverySetID{}, file{}, &MissingPacketError{PacketType: creatorPacketType}
 	}
 
-	return setID, file{clientID, mainPacket, fileDescriptionPackets, ifscPackets, recoveryPackets, unknownPackets}, nil
+	return setID, file{clientID, mainPacket, fileDescriptionPackets, ifscPackets, fileInfoPackets, recoveryPackets, unknownPackets}, nil
 }
 
 func padPacketBytes(packetBytes []byte) []byte {
@@ -201,6 +213,21 @@ func writeFile(file file) (recoverySetID, []byte, error) {
 		if err != nil {
 			return recoverySetID{}, nil, err
 		}
+
+		// File info packets are optional.
+		fileInfoPacket, ok := file.fileInfoPackets[fileID]
+		if !ok {
+			continue
+		}
+
+		fileInfoPacketBytes, err := writeFileInfoPacket(fileID, fileInfoPacket)
+		if err != nil {
+			return recoverySetID{}, nil, err
+		}
+		err = writeNextPacket(buf, setID, fileInfoPacketType, fileInfoPacketBytes)
+		if err != nil {
+			return recoverySetID{}, nil, err
+		}
 	}
 
 	var exponents []int
@@ -0,0 +1,67 @@
+package par2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// fileInfoPacketType is the type of gopar's own packet that records
+// the permissions and modification time of a data file, so that a
+// repair can restore them if the file is missing. Since it's
+// application-specific, it doesn't start with "PAR 2.0\0", and other
+// clients skip it as unknown.
+var fileInfoPacketType = packetType{'G', 'o', 'p', 'a', 'r', '\x00', '\x00', '\x00', 'F', 'i', 'l', 'e', 'I', 'n', 'f', 'o'}
+
+type fileInfoPacketBody struct {
+	FileID [16]byte
+	// Only the permission bits are stored.
+	Mode     uint32
+	Reserved uint32
+	// Nanoseconds since the Unix epoch.
+	ModTime int64
+}
+
+type fileInfoPacket struct {
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func readFileInfoPacket(body []byte) (fileID, fileInfoPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var b fileInfoPacketBody
+	err := binary.Read(buf, binary.LittleEndian, &b)
+	if err != nil {
+		return fileID{}, fileInfoPacket{}, err
+	}
+
+	if buf.Len() != 0 {
+		return fileID{}, fileInfoPacket{}, errors.New("invalid size")
+	}
+
+	if fs.FileMode(b.Mode) != fs.FileMode(b.Mode).Perm() {
+		return fileID{}, fileInfoPacket{}, errors.New("invalid mode")
+	}
+
+	return b.FileID, fileInfoPacket{fs.FileMode(b.Mode), time.Unix(0, b.ModTime)}, nil
+}
+
+func writeFileInfoPacket(id fileID, packet fileInfoPacket) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	err := binary.Write(buf, binary.LittleEndian, fileInfoPacketBody{
+		FileID:  id,
+		Mode:    uint32(packet.mode.Perm()),
+		ModTime: packet.modTime.UnixNano(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func makeFileInfoPacket(info fs.FileInfo) fileInfoPacket {
+	return fileInfoPacket{info.Mode().Perm(), info.ModTime()}
+}
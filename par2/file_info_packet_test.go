@@ -0,0 +1,23 @@
+package par2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileInfoPacketRoundTrip(t *testing.T) {
+	packet := fileInfoPacket{
+		mode:    0640,
+		modTime: time.Unix(1600000000, 123456789),
+	}
+	fileID := fileID{0x1, 0x2}
+	packetBytes, err := writeFileInfoPacket(fileID, packet)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(packetBytes)%4)
+	roundTripFileID, roundTripPacket, err := readFileInfoPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, fileID, roundTripFileID)
+	require.Equal(t, packet, roundTripPacket)
+}
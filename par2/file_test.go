@@ -3,6 +3,7 @@ package par2
 import (
 	"crypto/md5"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -71,6 +72,11 @@ func (d testDecoderDelegate) OnDetectDataFileWrongByteCount(fileID [16]byte, pat
 	d.t.Logf("OnDetectDataFileWrongByteCount(%x, %s)", fileID, path)
 }
 
+func (d testDecoderDelegate) OnDetectCorruptParityShard(exponent uint16, path string) {
+	d.t.Helper()
+	d.t.Logf("OnDetectCorruptParityShard(%d, %s)", exponent, path)
+}
+
 func (d testDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount int, err error) {
 	d.t.Helper()
 	d.t.Logf("OnDataFileWrite(%d, %d, %s, %d, %v)", i, n, path, byteCount, err)
@@ -105,6 +111,9 @@ func TestFileRoundTrip(t *testing.T) {
 			fileID2: ifscPacket2,
 			fileID3: ifscPacket3,
 		},
+		fileInfoPackets: map[fileID]fileInfoPacket{
+			fileID2: {0640, time.Unix(1600000000, 0)},
+		},
 		recoveryPackets: map[exponent]recoveryPacket{
 			// TODO: Change this to match sliceByteCount.
 			0: {data: []byte{0xff, 0xaa, 0xfe, 0xab, 0xfd, 0xac, 0xfc, 0xad}},
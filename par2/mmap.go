@@ -0,0 +1,90 @@
+package par2
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+
+	"github.com/akalin/gopar/fsio"
+)
+
+var errMmapUnsupported = errors.New("mmap not supported")
+
+// mmapFileIO is a fileIO that memory-maps files for reading instead
+// of copying them into memory, falling back to defaultFileIO if that
+// fails. The returned data is read-only, and stays valid until Close
+// is called. Writing a file that's mapped is safe, since WriteFile
+// writes to a temporary file and renames it over the original, which
+// leaves any existing mapping pointing to the old contents.
+//
+// However, files are mapped with MAP_SHARED, so if another process
+// truncates a mapped file, reading the mapped data past the new end
+// of the file raises SIGBUS, which crashes the program. Therefore,
+// mmapFileIO should only be used when the files being read won't be
+// modified in place by anything else.
+type mmapFileIO struct {
+	defaultFileIO
+
+	lock     *sync.Mutex
+	mappings *[][]byte
+}
+
+func newMmapFileIO() mmapFileIO {
+	return mmapFileIO{lock: &sync.Mutex{}, mappings: &[][]byte{}}
+}
+
+func (io mmapFileIO) ReadFile(path string) ([]byte, error) {
+	data, err := mmapFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return io.defaultFileIO.ReadFile(path)
+	}
+
+	if len(data) > 0 {
+		io.lock.Lock()
+		defer io.lock.Unlock()
+		*io.mappings = append(*io.mappings, data)
+	}
+	return data, nil
+}
+
+// WriteFile writes data to the file at path atomically, so that it
+// never modifies a file that may be mapped in place.
+func (io mmapFileIO) WriteFile(path string, data []byte) error {
+	return fsio.WriteFileAtomic(path, data, 0600)
+}
+
+// withFileIO calls fn with a new mmapFileIO if useMmap is true, and
+// defaultFileIO otherwise, and closes the former afterwards.
+func withFileIO(useMmap bool, fn func(fileIO) error) error {
+	if !useMmap {
+		return fn(defaultFileIO{})
+	}
+
+	fileIO := newMmapFileIO()
+	err := fn(fileIO)
+	closeErr := fileIO.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Close unmaps all the files mapped by ReadFile, which makes any data
+// returned by it invalid.
+func (io mmapFileIO) Close() error {
+	io.lock.Lock()
+	defer io.lock.Unlock()
+
+	var firstErr error
+	for _, mapping := range *io.mappings {
+		err := munmap(mapping)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	*io.mappings = nil
+	return firstErr
+}
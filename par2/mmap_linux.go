@@ -0,0 +1,40 @@
+// +build linux
+
+package par2
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Closing the file doesn't affect the mapping, and
+		// there's nothing to flush.
+		_ = f.Close()
+	}()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		// Empty mappings aren't allowed.
+		return []byte{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, errMmapUnsupported
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package par2
+
+func mmapFile(path string) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(data []byte) error {
+	return errMmapUnsupported
+}
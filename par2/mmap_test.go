@@ -0,0 +1,94 @@
+package par2
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMmapFileIO(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.rar")
+	emptyPath := filepath.Join(dir, "file.r01")
+	require.NoError(t, ioutil.WriteFile(path, []byte{0x1, 0x2, 0x3}, 0600))
+	require.NoError(t, ioutil.WriteFile(emptyPath, nil, 0600))
+
+	fileIO := newMmapFileIO()
+	data, err := fileIO.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x1, 0x2, 0x3}, data)
+
+	emptyData, err := fileIO.ReadFile(emptyPath)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(emptyData))
+
+	_, err = fileIO.ReadFile(filepath.Join(dir, "file.r02"))
+	require.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// Overwriting the file with less data shouldn't affect the
+	// existing data.
+	require.NoError(t, fileIO.WriteFile(path, []byte{0x4}))
+	require.Equal(t, []byte{0x1, 0x2, 0x3}, data)
+
+	newData, err := fileIO.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x4}, newData)
+
+	require.NoError(t, fileIO.Close())
+}
+
+func TestCreateVerifyRepairMmap(t *testing.T) {
+	dir := t.TempDir()
+	fileData := map[string][]byte{
+		"file.rar": {0x1, 0x2, 0x3, 0x4, 0x5},
+		"file.r01": {0x6, 0x7, 0x8, 0x9},
+		"file.r02": {0xa, 0xb, 0xc},
+	}
+	var paths []string
+	for filename, data := range fileData {
+		path := filepath.Join(dir, filename)
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		paths = append(paths, path)
+	}
+
+	parPath := filepath.Join(dir, "file.par2")
+	err := Create(parPath, paths, CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 2,
+		CreateDelegate:  testEncoderDelegate{t},
+		UseMmap:         true,
+	})
+	require.NoError(t, err)
+
+	verifyOptions := VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+		UseMmap:        true,
+	}
+	result, err := Verify(parPath, verifyOptions)
+	require.NoError(t, err)
+	require.False(t, result.ShardCounts.RepairNeeded())
+
+	// Swap the contents of two files, so that repairing one
+	// needs the old contents of the other, which is mapped.
+	r01Path := filepath.Join(dir, "file.r01")
+	r02Path := filepath.Join(dir, "file.r02")
+	require.NoError(t, ioutil.WriteFile(r01Path, fileData["file.r02"], 0600))
+	require.NoError(t, ioutil.WriteFile(r02Path, fileData["file.r01"], 0600))
+
+	repairResult, err := Repair(parPath, RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		UseMmap:        true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{r01Path, r02Path}, toSortedStrings(repairResult.RepairedPaths))
+
+	for filename, expectedData := range fileData {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filename))
+		require.NoError(t, err)
+		require.Equal(t, expectedData, data)
+	}
+}
@@ -79,11 +79,11 @@ func readNextPacket(buf *bytes.Buffer) (recoverySetID, packetType, []byte, error
 	bodyLength := int(h.Length - sizeOfPacketHeader())
 	body := buf.Next(bodyLength)
 	if len(body) != bodyLength {
-		return [16]byte{}, packetType{}, nil, errors.New("could not read body")
+		return [16]byte{}, h.Type, nil, errors.New("could not read body")
 	}
 
 	if computePacketHash(h.RecoverySetID, h.Type, body) != h.Hash {
-		return [16]byte{}, packetType{}, nil, errors.New("hash mismatch")
+		return [16]byte{}, h.Type, nil, errors.New("hash mismatch")
 	}
 
 	bodyCopy := make([]byte, len(body))
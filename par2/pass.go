@@ -0,0 +1,45 @@
+package par2
+
+// passByteCount returns how many bytes of each slice to process per
+// pass so that bufferShardCount shards' worth of per-pass buffers
+// take up at most memoryLimit bytes. The result is a positive
+// multiple of 4 that's at most sliceByteCount, and is equal to it if
+// memoryLimit <= 0, i.e. if there's no limit.
+func passByteCount(sliceByteCount, bufferShardCount, memoryLimit int) int {
+	if memoryLimit <= 0 || bufferShardCount <= 0 {
+		return sliceByteCount
+	}
+	byteCount := memoryLimit / bufferShardCount
+	byteCount -= byteCount % 4
+	if byteCount < 4 {
+		byteCount = 4
+	}
+	if byteCount > sliceByteCount {
+		byteCount = sliceByteCount
+	}
+	return byteCount
+}
+
+// forEachPass calls fn with consecutive byte ranges [start, end) of
+// at most passByteCount bytes that cover [0, sliceByteCount).
+func forEachPass(sliceByteCount, passByteCount int, fn func(start, end int)) {
+	for start := 0; start < sliceByteCount; start += passByteCount {
+		end := start + passByteCount
+		if end > sliceByteCount {
+			end = sliceByteCount
+		}
+		fn(start, end)
+	}
+}
+
+// shardRange returns the bytes [start, end) of each shard, with nil
+// shards staying nil.
+func shardRange(shards [][]byte, start, end int) [][]byte {
+	ranges := make([][]byte, len(shards))
+	for i, shard := range shards {
+		if shard != nil {
+			ranges[i] = shard[start:end]
+		}
+	}
+	return ranges
+}
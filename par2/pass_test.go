@@ -0,0 +1,65 @@
+package par2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassByteCount(t *testing.T) {
+	for _, test := range []struct {
+		sliceByteCount, bufferShardCount, memoryLimit int
+		expected                                      int
+	}{
+		{100, 3, 0, 100},
+		{100, 3, -1, 100},
+		{100, 3, 1000, 100},
+		{100, 3, 300, 100},
+		{100, 3, 299, 96},
+		{100, 3, 100, 32},
+		{100, 3, 1, 4},
+		{100, 0, 1, 100},
+	} {
+		require.Equal(t, test.expected, passByteCount(test.sliceByteCount, test.bufferShardCount, test.memoryLimit), "%+v", test)
+	}
+}
+
+func TestForEachPass(t *testing.T) {
+	var ranges [][2]int
+	forEachPass(10, 4, func(start, end int) {
+		ranges = append(ranges, [2]int{start, end})
+	})
+	require.Equal(t, [][2]int{{0, 4}, {4, 8}, {8, 10}}, ranges)
+}
+
+// allocatedByteCount returns the number of bytes allocated on the
+// heap while running fn, which bounds from above the most memory fn
+// held at once.
+func allocatedByteCount(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// writeTestDataFiles writes fileCount files of byteCount bytes each
+// to dir, and returns their paths.
+func writeTestDataFiles(t *testing.T, dir string, fileCount, byteCount int) []string {
+	var paths []string
+	for i := 0; i < fileCount; i++ {
+		data := make([]byte, byteCount)
+		for j := range data {
+			data[j] = byte(i*7 + j*13 + j>>8)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("file%d.bin", i))
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		paths = append(paths, path)
+	}
+	return paths
+}
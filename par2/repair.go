@@ -1,6 +1,9 @@
 package par2
 
 import (
+	"errors"
+
+	"github.com/akalin/gopar/fsio"
 	"github.com/akalin/gopar/rsec16"
 )
 
@@ -20,12 +23,31 @@ type RepairOptions struct {
 	// If DoubleCheck is true, then extra checking is done after
 	// the repair to verify that the repaired shards are correct.
 	DoubleCheck bool
-	// The number of goroutines to use while encoding. If <= 0,
-	// NumGoroutinesDefault() is used.
+	// The number of goroutines to use while hashing, scanning
+	// and encoding. If <= 0, NumGoroutinesDefault() is used.
 	NumGoroutines int
 	// The RepairDelegate to use. If nil, DoNothingRepairDelegate
 	// is used.
 	RepairDelegate RepairDelegate
+	// If UseMmap is true, files are memory-mapped instead of
+	// being read into memory, if possible; see NewDecoderMmap.
+	UseMmap bool
+	// The directory that the data files are looked up in. If
+	// empty, the directory of parPath is used.
+	BasePath string
+	// If KeepBackups is true, then a damaged data file is moved
+	// to the first of <path>.1, <path>.2, etc. that doesn't exist
+	// before the repaired file is written.
+	KeepBackups bool
+	// If Purge is true, then once the data files are intact,
+	// either because no repair was needed or because the repair
+	// succeeded, the par file, its parity volumes, and any
+	// backups made by the repair are removed.
+	Purge bool
+	// Roughly how many bytes of reconstructed data and parity
+	// data to hold in memory at once. If <= 0, there's no
+	// limit. See Decoder.SetMemoryLimit.
+	MemoryLimit int
 }
 
 // RepairResult holds the result of a Repair call.
@@ -33,13 +55,48 @@ type RepairResult struct {
 	// RepairedPaths contains the paths of the files that were
 	// repaired.
 	RepairedPaths []string
+	// BackupPaths contains the paths that damaged data files
+	// were moved to, if KeepBackups is set to true in
+	// RepairOptions.
+	BackupPaths []string
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in RepairOptions.
+	PurgedPaths []string
 }
 
 // Repair a par file at parPath with the given options. The returned
 // RepairResult may be partially or not filled in if an error is
 // returned.
 func Repair(parPath string, options RepairOptions) (RepairResult, error) {
-	return repair(defaultFileIO{}, parPath, options)
+	var result RepairResult
+	err := withFileIO(options.UseMmap, func(fileIO fileIO) error {
+		var err error
+		result, err = repair(fileIO, parPath, options)
+		return err
+	})
+	return result, err
+}
+
+// RepairFS is like Repair, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the returned
+// RepairedPaths are names in fsys, but the paths passed to the
+// delegate are under fsio.Root().
+func RepairFS(fsys fsio.WriteFS, parPath string, options RepairOptions) (RepairResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	result, err := repair(p, p.Path(parPath), options)
+	for _, paths := range [][]string{result.RepairedPaths, result.BackupPaths, result.PurgedPaths} {
+		for i, path := range paths {
+			name, nameErr := p.Name(path)
+			if nameErr != nil {
+				return result, nameErr
+			}
+			paths[i] = name
+		}
+	}
+	return result, err
 }
 
 func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult, error) {
@@ -62,6 +119,11 @@ func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult,
 	if err != nil {
 		return RepairResult{}, err
 	}
+	if options.BasePath != "" {
+		decoder.basePath = options.BasePath
+	}
+	decoder.keepBackups = options.KeepBackups
+	decoder.SetMemoryLimit(options.MemoryLimit)
 
 	err = decoder.LoadFileData()
 	if err != nil {
@@ -74,15 +136,34 @@ func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult,
 	}
 
 	repairedPaths, err := decoder.Repair(options.DoubleCheck)
-	return RepairResult{
+	result := RepairResult{
 		RepairedPaths: repairedPaths,
-	}, err
+		BackupPaths:   decoder.backupPaths,
+	}
+	if err != nil || !options.Purge {
+		return result, err
+	}
+
+	// Repair checks only the reconstructed slices, so make sure
+	// that the repaired files match their recorded hashes before
+	// removing the par files.
+	if len(repairedPaths) > 0 {
+		err = decoder.LoadFileData()
+		if err != nil {
+			return result, err
+		}
+		if decoder.ShardCounts().RepairNeeded() || !decoder.dataFilesOK() {
+			return result, &RepairFailedError{Problem: "repaired files don't match their recorded hashes"}
+		}
+	}
+
+	result.PurgedPaths, err = decoder.Purge()
+	return result, err
 }
 
 // RepairErrorMeansRepairNecessaryButNotPossible returns true if the
 // error returned by Repair means that repair is necessary but not
 // possible.
 func RepairErrorMeansRepairNecessaryButNotPossible(err error) bool {
-	_, ok := err.(rsec16.NotEnoughParityShardsError)
-	return ok
+	return errors.As(err, &rsec16.NotEnoughParityShardsError{})
 }
@@ -1,10 +1,17 @@
 package par2
 
 import (
+	"errors"
 	"fmt"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/akalin/gopar/fsio"
 	"github.com/akalin/gopar/memfs"
 	"github.com/stretchr/testify/require"
 )
@@ -37,6 +44,7 @@ func testRepair(t *testing.T, workingDir string, options RepairOptions) {
 	perturbFile(t, fs, r04Path)
 	result, err = repair(testFileIO{t, fs}, parPath, options)
 	require.True(t, RepairErrorMeansRepairNecessaryButNotPossible(err))
+	require.True(t, RepairErrorMeansRepairNecessaryButNotPossible(fmt.Errorf("repair failed: %w", err)))
 	require.Equal(t, RepairResult{}, result)
 }
 
@@ -69,3 +77,247 @@ func TestRepairDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestRepairFS(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	r04Path := filepath.Join("dir4", "dir5", "file.r04")
+	perturbFile(t, fs, r04Path)
+	result, err := RepairFS(fs, "file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.Equal(t, RepairResult{
+		RepairedPaths: []string{"dir4/dir5/file.r04"},
+	}, result)
+
+	decoder, err := NewDecoderFS(fs, testDecoderDelegate{t}, "file.par2", NumGoroutinesDefault())
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	require.False(t, decoder.ShardCounts().RepairNeeded())
+}
+
+func TestRepairFSReadOnly(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	perturbFile(t, fs, filepath.Join("dir4", "dir5", "file.r04"))
+
+	// Hide fs's WriteFile method.
+	readOnlyFS := struct{ iofs.FS }{fs}
+	decoder, err := NewDecoderFS(readOnlyFS, testDecoderDelegate{t}, "file.par2", NumGoroutinesDefault())
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	_, err = decoder.Repair(false)
+	require.True(t, errors.Is(err, fsio.ErrReadOnly))
+}
+
+func TestRepairKeepBackupsAndPurge(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	r03Path := filepath.Join("dir2", "dir3", "file.r03")
+	r04Path := filepath.Join("dir4", "dir5", "file.r04")
+	require.NoError(t, fs.WriteFile(r04Path+".1", []byte{0x1}))
+	perturbFile(t, fs, r04Path)
+	r04Data, err := fs.ReadFile(r04Path)
+	require.NoError(t, err)
+	// Missing files don't need a backup.
+	_, err = fs.RemoveFile(r03Path)
+	require.NoError(t, err)
+
+	result, err := RepairFS(fs, "file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		KeepBackups:    true,
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"dir2/dir3/file.r03", "dir4/dir5/file.r04"}, result.RepairedPaths)
+	require.Equal(t, []string{"dir4/dir5/file.r04.2"}, result.BackupPaths)
+	require.Nil(t, result.PurgedPaths)
+	backupData, err := fs.ReadFile(r04Path + ".2")
+	require.NoError(t, err)
+	require.Equal(t, r04Data, backupData)
+
+	perturbFile(t, fs, r04Path)
+	result, err = RepairFS(fs, "file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		KeepBackups:    true,
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"dir4/dir5/file.r04"}, result.RepairedPaths)
+	require.Equal(t, []string{"dir4/dir5/file.r04.3"}, result.BackupPaths)
+	require.ElementsMatch(t, []string{
+		"file.par2",
+		"file.vol00+01.par2",
+		"file.vol01+01.par2",
+		"file.vol02+01.par2",
+		"dir4/dir5/file.r04.3",
+	}, result.PurgedPaths)
+	// Only the backup made by the repair is purged.
+	require.Equal(t, 7, fs.FileCount())
+}
+
+func TestRepairPurgeOnFailure(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 1)
+
+	perturbFile(t, fs, "file.rar")
+	perturbFile(t, fs, filepath.Join("dir1", "file.r01"))
+	fileCount := fs.FileCount()
+	result, err := RepairFS(fs, "file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	require.True(t, RepairErrorMeansRepairNecessaryButNotPossible(err))
+	require.Equal(t, RepairResult{}, result)
+	require.Equal(t, fileCount, fs.FileCount())
+}
+
+// corruptingWriteFileIO is a fileIO whose WriteFile flips a bit of
+// the data written to corruptPath.
+type corruptingWriteFileIO struct {
+	fileIO
+	corruptPath string
+}
+
+func (io corruptingWriteFileIO) WriteFile(path string, data []byte) error {
+	if path == io.corruptPath && len(data) > 0 {
+		data = append([]byte(nil), data...)
+		data[0] ^= 0x1
+	}
+	return io.fileIO.WriteFile(path, data)
+}
+
+func TestRepairPurgeChecksRepairedFiles(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	perturbFile(t, fs, "file.rar")
+	fileCount := fs.FileCount()
+	fileIO := corruptingWriteFileIO{testFileIO{t, fs}, filepath.Join(workingDir, "file.rar")}
+	result, err := repair(fileIO, filepath.Join(workingDir, "file.par2"), RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	var repairFailedErr *RepairFailedError
+	require.True(t, errors.As(err, &repairFailedErr), "%v", err)
+	require.Equal(t, []string{filepath.Join(workingDir, "file.rar")}, result.RepairedPaths)
+	require.Nil(t, result.PurgedPaths)
+	require.Equal(t, fileCount, fs.FileCount())
+}
+
+func TestRepairKeepsFileInfo(t *testing.T) {
+	dir := t.TempDir()
+	fileData := map[string][]byte{
+		"file.rar": {0x1, 0x2, 0x3, 0x4, 0x5},
+		"file.r01": {0x6, 0x7, 0x8, 0x9},
+	}
+	var paths []string
+	for filename, data := range fileData {
+		path := filepath.Join(dir, filename)
+		require.NoError(t, ioutil.WriteFile(path, data, 0600))
+		paths = append(paths, path)
+	}
+
+	parPath := filepath.Join(dir, "file.par2")
+	require.NoError(t, Create(parPath, paths, CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 2,
+		CreateDelegate:  testEncoderDelegate{t},
+	}))
+
+	r01Path := filepath.Join(dir, "file.r01")
+	require.NoError(t, ioutil.WriteFile(r01Path, []byte{0x6, 0x7, 0x8, 0xa}, 0600))
+	// Windows only supports a read-only bit.
+	mode := iofs.FileMode(0600)
+	if runtime.GOOS != "windows" {
+		mode = 0640
+		require.NoError(t, os.Chmod(r01Path, mode))
+	}
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(r01Path, modTime, modTime))
+
+	for _, keepBackups := range []bool{false, true} {
+		result, err := Repair(parPath, RepairOptions{
+			RepairDelegate: testDecoderDelegate{t},
+			KeepBackups:    keepBackups,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{r01Path}, result.RepairedPaths)
+
+		data, err := ioutil.ReadFile(r01Path)
+		require.NoError(t, err)
+		require.Equal(t, fileData["file.r01"], data)
+		info, err := os.Stat(r01Path)
+		require.NoError(t, err)
+		require.Equal(t, mode, info.Mode().Perm())
+		require.True(t, modTime.Equal(info.ModTime()))
+
+		// Damage the file again for the next iteration.
+		require.NoError(t, ioutil.WriteFile(r01Path, []byte{0x6, 0x7, 0x8, 0xa}, 0600))
+		require.NoError(t, os.Chtimes(r01Path, modTime, modTime))
+	}
+
+	// No temporary files should be left behind.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"file.par2", "file.vol00+01.par2", "file.vol01+01.par2", "file.rar", "file.r01", "file.r01.1"}, names)
+}
+
+func TestRepairRestoresMissingFileInfo(t *testing.T) {
+	for _, recordFileInfo := range []bool{false, true} {
+		dir := t.TempDir()
+		rarPath := filepath.Join(dir, "file.rar")
+		r01Path := filepath.Join(dir, "file.r01")
+		require.NoError(t, ioutil.WriteFile(rarPath, []byte{0x1, 0x2, 0x3, 0x4, 0x5}, 0600))
+		require.NoError(t, ioutil.WriteFile(r01Path, []byte{0x6, 0x7, 0x8, 0x9}, 0600))
+		require.NoError(t, os.Chmod(r01Path, 0640))
+		modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+		require.NoError(t, os.Chtimes(r01Path, modTime, modTime))
+
+		parPath := filepath.Join(dir, "file.par2")
+		require.NoError(t, Create(parPath, []string{rarPath, r01Path}, CreateOptions{
+			SliceByteCount:  4,
+			NumParityShards: 2,
+			CreateDelegate:  testEncoderDelegate{t},
+			RecordFileInfo:  recordFileInfo,
+		}))
+
+		require.NoError(t, os.Remove(r01Path))
+
+		result, err := Repair(parPath, RepairOptions{
+			RepairDelegate: testDecoderDelegate{t},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{r01Path}, result.RepairedPaths)
+
+		info, err := os.Stat(r01Path)
+		require.NoError(t, err)
+		if recordFileInfo {
+			require.True(t, modTime.Equal(info.ModTime()))
+		} else {
+			require.False(t, modTime.Equal(info.ModTime()))
+		}
+		// Windows only supports a read-only bit.
+		if runtime.GOOS != "windows" {
+			expectedMode := fsio.RestoredFilePerm
+			if recordFileInfo {
+				expectedMode = 0640
+			}
+			require.Equal(t, expectedMode, info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package par2
+
+import (
+	"hash/crc32"
+	"sort"
+	"sync"
+)
+
+// runParallel calls fn(i) for 0 <= i < n, with at most numGoroutines
+// calls running at once, and returns once all of them have returned.
+func runParallel(n, numGoroutines int, fn func(i int)) {
+	if numGoroutines > n {
+		numGoroutines = n
+	}
+	if numGoroutines <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for g := 0; g < numGoroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// A scanMatch is a slice of a data file whose checksums match those
+// of the data shards at locations.
+type scanMatch struct {
+	start     int
+	slice     []byte
+	locations shardLocationSet
+}
+
+// A sliceMatcher looks up slices of data by their checksums.
+type sliceMatcher struct {
+	sliceByteCount     int
+	checksumToLocation checksumShardLocationMap
+	window             *crc32Window
+	filter             crc32Filter
+}
+
+func newSliceMatcher(sliceByteCount int, checksumToLocation checksumShardLocationMap) *sliceMatcher {
+	crcs := make([]uint32, 0, len(checksumToLocation))
+	for crc := range checksumToLocation {
+		crcs = append(crcs, crc)
+	}
+	return &sliceMatcher{
+		sliceByteCount:     sliceByteCount,
+		checksumToLocation: checksumToLocation,
+		window:             newCRC32Window(sliceByteCount),
+		filter:             newCRC32Filter(crcs),
+	}
+}
+
+// A sliceScanner looks for slices of data whose checksums match
+// those in a sliceMatcher, at every byte offset.
+type sliceScanner struct {
+	*sliceMatcher
+	data []byte
+
+	// If justMissed is true, crc is the checksum of the slice
+	// starting at the previously scanned offset.
+	justMissed bool
+	crc        uint32
+}
+
+// scan scans data starting at offset j: if the slice at j matches,
+// it's appended to matches and scanning continues right after it;
+// otherwise, it continues at j+1. It stops at the first offset >= end,
+// which must be at most len(data), and returns it along with the
+// number of offsets that didn't match.
+func (s *sliceScanner) scan(j, end int, matches []scanMatch) ([]scanMatch, int, int) {
+	misses := 0
+	// Offsets before rollEnd start slices that don't need
+	// padding.
+	rollEnd := len(s.data) - s.sliceByteCount + 1
+	if rollEnd > end {
+		rollEnd = end
+	}
+	for j < end {
+		if s.justMissed && j < rollEnd {
+			// Skip over offsets whose slices can't
+			// match.
+			var next int
+			next, s.crc = s.window.rollUntil(s.crc, s.data, j, rollEnd, s.filter)
+			misses += next - j
+			j = next
+			if j >= end {
+				break
+			}
+		}
+
+		slice := sliceAndPadByteArray(s.data, j, j+s.sliceByteCount)
+		if s.justMissed {
+			s.crc = s.window.update(s.crc, s.data[j-1], slice[len(slice)-1])
+		} else {
+			s.crc = crc32.ChecksumIEEE(slice)
+		}
+		foundLocations := s.checksumToLocation.get(s.crc, slice)
+		if len(foundLocations) == 0 {
+			j++
+			misses++
+			s.justMissed = true
+			continue
+		}
+
+		matches = append(matches, scanMatch{j, slice, foundLocations})
+		s.justMissed = false
+		j += s.sliceByteCount
+	}
+	return matches, misses, j
+}
+
+// A scanChunk holds the results of scanning a chunk of data starting
+// at its start offset.
+type scanChunk struct {
+	start   int
+	matches []scanMatch
+	misses  int
+	// The offset the scan stopped at, which is at least the start
+	// of the next chunk, and which may be past the end of the data
+	// if the last match is padded.
+	stop int
+}
+
+// onPath returns whether the scan of c visits offset j, which must
+// be in [c.start, c.stop).
+func (c scanChunk) onPath(j, sliceByteCount int) bool {
+	// Find the last match starting at or before j.
+	k := sort.Search(len(c.matches), func(k int) bool {
+		return c.matches[k].start > j
+	}) - 1
+	return k < 0 || c.matches[k].start == j || j >= c.matches[k].start+sliceByteCount
+}
+
+// scanData scans data for slices whose checksums match those in m,
+// in the same way as a single sliceScanner would
+// starting at offset 0, and returns the matches in order along with
+// the number of misses. The data is split into up to numChunks
+// chunks, which are scanned with up to numGoroutines goroutines.
+func scanData(m *sliceMatcher, data []byte, numChunks, numGoroutines int) ([]scanMatch, int) {
+	sliceByteCount := m.sliceByteCount
+	newScanner := func() *sliceScanner {
+		return &sliceScanner{sliceMatcher: m, data: data}
+	}
+
+	// Make the chunks start at multiples of sliceByteCount, so
+	// that for intact data, the scans of the chunks line up
+	// exactly with a single scan.
+	sliceCount := (len(data) + sliceByteCount - 1) / sliceByteCount
+	if numChunks > sliceCount {
+		numChunks = sliceCount
+	}
+	if numChunks <= 1 {
+		matches, misses, _ := newScanner().scan(0, len(data), nil)
+		return matches, misses
+	}
+
+	chunks := make([]scanChunk, numChunks)
+	runParallel(numChunks, numGoroutines, func(i int) {
+		start := (i * sliceCount / numChunks) * sliceByteCount
+		end := ((i + 1) * sliceCount / numChunks) * sliceByteCount
+		if end > len(data) {
+			end = len(data)
+		}
+		matches, misses, stop := newScanner().scan(start, end, nil)
+		chunks[i] = scanChunk{start, matches, misses, stop}
+	})
+
+	// Stitch the chunks together. A single scan would enter
+	// each chunk at some offset j, and from the first offset on
+	// the path of the chunk's scan, the paths are the same. Until
+	// then, scan sequentially, which usually takes at most a
+	// slice's worth of offsets.
+	matches := chunks[0].matches
+	misses := chunks[0].misses
+	j := chunks[0].stop
+	for _, chunk := range chunks[1:] {
+		if j >= chunk.stop {
+			// A match skipped past the whole chunk.
+			continue
+		}
+
+		s := newScanner()
+		for j < chunk.stop && j < len(data) && !chunk.onPath(j, sliceByteCount) {
+			var stepMisses int
+			matches, stepMisses, j = s.scan(j, j+1, matches)
+			misses += stepMisses
+		}
+		if j >= chunk.stop || j >= len(data) {
+			continue
+		}
+
+		k := sort.Search(len(chunk.matches), func(k int) bool {
+			return chunk.matches[k].start >= j
+		})
+		matches = append(matches, chunk.matches[k:]...)
+		// Each offset on the path either starts a match,
+		// which skips sliceByteCount offsets, or is a miss.
+		misses += (chunk.stop - j) - len(chunk.matches[k:])*sliceByteCount
+		j = chunk.stop
+	}
+	return matches, misses
+}
+
+// intactDataFileMatches returns the matches that scanning data would
+// find, given that data is already known to match the file with the
+// given slice checksums, e.g. by its hash and byte count. Instead of
+// hashing every slice, it looks up the given checksums, so it returns
+// false if any of them aren't in checksumToLocation, or if there are
+// the wrong number of them, in which case data has to be scanned
+// instead.
+func intactDataFileMatches(sliceByteCount int, data []byte, checksumToLocation checksumShardLocationMap, checksumPairs []checksumPair) ([]scanMatch, bool) {
+	sliceCount := (len(data) + sliceByteCount - 1) / sliceByteCount
+	if len(checksumPairs) != sliceCount {
+		return nil, false
+	}
+
+	var matches []scanMatch
+	for i, checksumPair := range checksumPairs {
+		locations := checksumToLocation.getByChecksumPair(checksumPair)
+		if len(locations) == 0 {
+			return nil, false
+		}
+		start := i * sliceByteCount
+		slice := sliceAndPadByteArray(data, start, start+sliceByteCount)
+		matches = append(matches, scanMatch{start, slice, locations})
+	}
+	return matches, true
+}
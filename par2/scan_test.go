@@ -0,0 +1,131 @@
+package par2
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunParallel(t *testing.T) {
+	for _, numGoroutines := range []int{0, 1, 2, 5, 20} {
+		counts := make([]int32, 10)
+		runParallel(len(counts), numGoroutines, func(i int) {
+			atomic.AddInt32(&counts[i], 1)
+		})
+		for i, count := range counts {
+			require.Equal(t, int32(1), count, "numGoroutines=%d, i=%d", numGoroutines, i)
+		}
+	}
+}
+
+func TestScanDataChunks(t *testing.T) {
+	sliceByteCount := 4
+	dataByteCount := 200
+	_, data, checksumToLocation, _, _, unrelatedData := makeTestFillShardInfoInputs(t, sliceByteCount, dataByteCount)
+
+	rand := rand.New(rand.NewSource(1))
+	// Insert and delete bytes at random places, so that matches
+	// are displaced relative to the chunk boundaries.
+	var damagedData []byte
+	for i := 0; i < len(data); i++ {
+		switch rand.Intn(20) {
+		case 0:
+			damagedData = append(damagedData, byte(rand.Intn(256)))
+			damagedData = append(damagedData, data[i])
+		case 1:
+		default:
+			damagedData = append(damagedData, data[i])
+		}
+	}
+
+	// Repeat data, so that slices match at several places.
+	repeatedData := append(append([]byte(nil), data[:103]...), data[1:]...)
+
+	m := newSliceMatcher(sliceByteCount, checksumToLocation)
+	for name, data := range map[string][]byte{
+		"intact":    data,
+		"unrelated": unrelatedData,
+		"damaged":   damagedData,
+		"repeated":  repeatedData,
+		"short":     data[:3],
+		"empty":     nil,
+	} {
+		expectedMatches, expectedMisses := scanData(m, data, 1, 1)
+		for _, numChunks := range []int{2, 3, 7, 50, 1000} {
+			t.Run(fmt.Sprintf("%s,numChunks=%d", name, numChunks), func(t *testing.T) {
+				matches, misses := scanData(m, data, numChunks, 4)
+				require.Equal(t, expectedMatches, matches)
+				require.Equal(t, expectedMisses, misses)
+			})
+		}
+	}
+}
+
+func TestIntactDataFileMatches(t *testing.T) {
+	sliceByteCount := 4
+	for _, dataByteCount := range []int{1, 4, 50} {
+		_, data, checksumToLocation, _, _, _ := makeTestFillShardInfoInputs(t, sliceByteCount, dataByteCount)
+		_, _, ifscPacket, _ := computeDataFileInfo(sliceByteCount, "file.rar", data)
+
+		m := newSliceMatcher(sliceByteCount, checksumToLocation)
+		expectedMatches, misses := scanData(m, data, 1, 1)
+		require.Equal(t, 0, misses)
+
+		matches, ok := intactDataFileMatches(sliceByteCount, data, checksumToLocation, ifscPacket.checksumPairs)
+		require.True(t, ok)
+		require.Equal(t, expectedMatches, matches)
+
+		_, ok = intactDataFileMatches(sliceByteCount, data, checksumToLocation, ifscPacket.checksumPairs[1:])
+		require.False(t, ok)
+
+		_, ok = intactDataFileMatches(sliceByteCount, data, checksumShardLocationMap{}, ifscPacket.checksumPairs)
+		require.False(t, ok)
+	}
+}
+
+// BenchmarkScanDataFileBytes compares the intact-file fast path of
+// scanDataFileBytes with the full rolling scan, which is what it
+// falls back to if the file doesn't match its recorded hash.
+func BenchmarkScanDataFileBytes(b *testing.B) {
+	const sliceByteCount = 2000
+	const dataByteCount = 16 * 1024 * 1024
+	data := make([]byte, dataByteCount)
+	_, err := rand.New(rand.NewSource(1)).Read(data)
+	require.NoError(b, err)
+
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"file.rar": data,
+	})
+	buildPAR2Data(b, fs, workingDir, sliceByteCount, 1)
+	decoder, err := newDecoder(fs, DoNothingDecoderDelegate{}, "file.par2", 1)
+	require.NoError(b, err)
+	m := decoder.newDataFileMatcher()
+	info := decoder.recoverySet[0]
+
+	// Pretend that the recorded hash is different, so that the
+	// unmodified file is scanned anyway.
+	scanInfo := info
+	scanInfo.hash[0]++
+
+	for _, bm := range []struct {
+		name string
+		info decoderInputFileInfo
+	}{
+		{"intact", info},
+		{"scan", scanInfo},
+	} {
+		bm := bm
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(dataByteCount)
+			for i := 0; i < b.N; i++ {
+				scan := decoder.scanDataFileBytes(data, m, bm.info, 1)
+				require.Equal(b, dataByteCount/sliceByteCount+1, len(scan.matches))
+			}
+		})
+	}
+}
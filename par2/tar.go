@@ -0,0 +1,41 @@
+package par2
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+)
+
+// forEachTarMember calls fn for each regular file in the tar stream
+// read from r, with the member's name converted to a relative
+// OS-specific path, its header info, and a reader for the member's
+// data.
+func forEachTarMember(r io.Reader, fn func(filename string, info fs.FileInfo, r io.Reader) error) error {
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		info := header.FileInfo()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if !fs.ValidPath(name) || name == "." {
+			return errors.New("tar member names must be relative paths that don't go above the current directory")
+		}
+
+		err = fn(filepath.FromSlash(name), info, tarReader)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package par2
+
+import (
+	"archive/tar"
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTar returns a tar stream containing the files in fs, with names
+// relative to workingDir, except for those in skippedPaths.
+func makeTar(t *testing.T, fs memfs.MemFS, workingDir string, skippedPaths ...string) *bytes.Buffer {
+	skipped := make(map[string]bool)
+	for _, path := range skippedPaths {
+		skipped[filepath.Join(workingDir, path)] = true
+	}
+
+	paths := fs.Paths()
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     "dir/",
+		Mode:     0755,
+	}))
+	for _, path := range paths {
+		if skipped[path] {
+			continue
+		}
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		relPath, err := filepath.Rel(workingDir, path)
+		require.NoError(t, err)
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(relPath),
+			Mode:     0644,
+			Size:     int64(len(data)),
+		}))
+		_, err = tarWriter.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	return &buf
+}
+
+func TestCreateAndVerifyFromTar(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	dataFS := makeEncoderMemFS(workingDir)
+	parFS := memfs.MakeMemFS(workingDir, nil)
+	parPath := filepath.Join(workingDir, "file.par2")
+
+	err := createFromTar(testFileIO{t, parFS}, parPath, makeTar(t, dataFS, workingDir), CreateOptions{
+		SliceByteCount:  4,
+		NumParityShards: 2,
+		CreateDelegate:  testEncoderDelegate{t},
+	})
+	require.NoError(t, err)
+
+	// The par files created from the tar stream should be
+	// usable by the regular decoder.
+	for _, path := range parFS.Paths() {
+		data, err := parFS.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, dataFS.WriteFile(path, data))
+	}
+	decoder, err := newDecoderForTest(t, dataFS, parPath)
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	require.Equal(t, ShardCounts{
+		UsableDataShardCount:   5,
+		UsableParityShardCount: 2,
+	}, decoder.ShardCounts())
+
+	verifyFromTar := func(r *bytes.Buffer) VerifyResult {
+		result, err := verifyWith(testFileIO{t, parFS}, parPath, VerifyOptions{
+			VerifyDelegate: testDecoderDelegate{t},
+		}, func(decoder *Decoder) error {
+			return decoder.LoadFileDataFromTar(r)
+		})
+		require.NoError(t, err)
+		return result
+	}
+
+	r03Path := filepath.Join("dir2", "dir3", "file.r03")
+	require.Equal(t, VerifyResult{
+		ShardCounts: ShardCounts{
+			UsableDataShardCount:   5,
+			UsableParityShardCount: 2,
+		},
+		DataFilesOk: true,
+	}, verifyFromTar(makeTar(t, dataFS, workingDir, "file.par2")))
+
+	require.Equal(t, VerifyResult{
+		ShardCounts: ShardCounts{
+			UsableDataShardCount:   4,
+			UnusableDataShardCount: 1,
+			UsableParityShardCount: 2,
+		},
+	}, verifyFromTar(makeTar(t, dataFS, workingDir, r03Path)))
+
+	perturbFile(t, dataFS, r03Path)
+	require.Equal(t, VerifyResult{
+		ShardCounts: ShardCounts{
+			UsableDataShardCount:   4,
+			UnusableDataShardCount: 1,
+			UsableParityShardCount: 2,
+		},
+	}, verifyFromTar(makeTar(t, dataFS, workingDir)))
+}
+
+func TestCreateFromTarInvalidName(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, nil)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "../file.rar",
+		Mode:     0644,
+		Size:     1,
+	}))
+	_, err := tarWriter.Write([]byte{0x1})
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+
+	err = createFromTar(testFileIO{t, fs}, filepath.Join(workingDir, "file.par2"), &buf, CreateOptions{})
+	require.Error(t, err)
+	require.Equal(t, 0, fs.FileCount())
+}
+
+func TestLoadFileDataFromTarKeepsOnlyFoundSlices(t *testing.T) {
+	const sliceByteCount = 1024
+	workingDir := memfs.RootDir()
+	fileData := make([]byte, 16*sliceByteCount)
+	for i := range fileData {
+		fileData[i] = byte(i * 7)
+	}
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"file.rar": fileData,
+	})
+	buildPAR2Data(t, fs, workingDir, sliceByteCount, 1)
+
+	// Put the file's data after a lot of junk, so that the tar
+	// member is much bigger than the slices found in it.
+	const junkByteCount = 8 * 1024 * 1024
+	memberData := append(make([]byte, junkByteCount), fileData...)
+	require.NoError(t, fs.WriteFile(filepath.Join(workingDir, "file.rar"), memberData))
+	r := makeTar(t, fs, workingDir, "file.par2", "file.vol00+01.par2")
+	memberData = nil
+	require.NoError(t, fs.WriteFile(filepath.Join(workingDir, "file.rar"), nil))
+
+	decoder, err := newDecoderForTest(t, fs, filepath.Join(workingDir, "file.par2"))
+	require.NoError(t, err)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	require.NoError(t, decoder.LoadFileDataFromTar(r))
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	require.Equal(t, 16, decoder.ShardCounts().UsableDataShardCount)
+	require.Less(t, int64(after.HeapAlloc)-int64(before.HeapAlloc), int64(junkByteCount/2))
+	// Keep the tar stream's buffer alive, too, so that freeing
+	// it doesn't hide the retained member data.
+	runtime.KeepAlive(r)
+	runtime.KeepAlive(decoder)
+}
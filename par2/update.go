@@ -0,0 +1,459 @@
+package par2
+
+import (
+	"crypto/md5"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/akalin/gopar/gf2p16"
+	"github.com/akalin/gopar/rsec16"
+)
+
+// UpdateDelegate holds methods that are called during the update
+// process.
+type UpdateDelegate interface {
+	OnParityFileLoad(i int, path string, err error)
+	OnParityFileWrite(i int, path string, byteCount int, err error)
+}
+
+// DoNothingUpdateDelegate is an implementation of UpdateDelegate that
+// does nothing for all methods.
+type DoNothingUpdateDelegate struct{}
+
+// OnParityFileLoad implements the UpdateDelegate interface.
+func (DoNothingUpdateDelegate) OnParityFileLoad(i int, path string, err error) {}
+
+// OnParityFileWrite implements the UpdateDelegate interface.
+func (DoNothingUpdateDelegate) OnParityFileWrite(i int, path string, byteCount int, err error) {}
+
+// UpdateOptions holds all the options for UpdateParity.
+type UpdateOptions struct {
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
+	// The UpdateDelegate to use. If nil, DoNothingUpdateDelegate
+	// is used.
+	UpdateDelegate UpdateDelegate
+}
+
+// UpdateParity rewrites the par file at parPath and all its parity
+// volumes to reflect the data file at filePath changing from oldData
+// to newData, without reading any other data file. The data file
+// itself is not touched.
+//
+// Since parity data is linear in the data slices, this is done by
+// adding coefficient * (old slice ^ new slice) to every recovery
+// packet. This only works if the file keeps the same number of
+// slices and the same position in the recovery set; otherwise, an
+// error is returned and the par file has to be created again.
+func UpdateParity(parPath, filePath string, oldData, newData []byte, options UpdateOptions) error {
+	return updateParity(defaultFileIO{}, parPath, filePath, oldData, newData, options)
+}
+
+type parityVolume struct {
+	path string
+	file file
+}
+
+// findParityVolumes returns the paths of all the parity volumes that
+// might go with the index file at indexPath.
+func findParityVolumes(fileIO fileIO, indexPath string) ([]string, error) {
+	ext := path.Ext(indexPath)
+	base := indexPath[:len(indexPath)-len(ext)]
+	return fileIO.FindWithPrefixAndSuffix(base+".", ext)
+}
+
+func loadParityVolumes(fileIO fileIO, delegate UpdateDelegate, indexPath string, setID recoverySetID) ([]parityVolume, error) {
+	matches, err := findParityVolumes(fileIO, indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []parityVolume
+	for i, match := range matches {
+		parityFile, err := func() (*file, error) {
+			volumeBytes, err := fileIO.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+
+			_, parityFile, err := readFile(DoNothingDecoderDelegate{}, &setID, volumeBytes)
+			if _, ok := err.(noPacketsFoundError); ok {
+				return nil, nil
+			} else if err != nil {
+				return nil, withPath(err, match)
+			}
+
+			if parityFile.mainPacket == nil {
+				return nil, &MissingPacketError{Path: match, PacketType: mainPacketType}
+			}
+
+			return &parityFile, nil
+		}()
+		delegate.OnParityFileLoad(i+1, match, err)
+		if err != nil {
+			return nil, err
+		}
+		if parityFile == nil {
+			continue
+		}
+
+		volumes = append(volumes, parityVolume{match, *parityFile})
+	}
+
+	return volumes, nil
+}
+
+// loadParitySet reads the index file at parPath and all of its
+// parity volumes.
+func loadParitySet(fileIO fileIO, delegate UpdateDelegate, parPath string) (file, []parityVolume, error) {
+	err := checkExtension(parPath)
+	if err != nil {
+		return file{}, nil, err
+	}
+
+	indexBytes, err := fileIO.ReadFile(parPath)
+	if err != nil {
+		return file{}, nil, err
+	}
+
+	setID, indexFile, err := readFile(DoNothingDecoderDelegate{}, nil, indexBytes)
+	if err != nil {
+		return file{}, nil, withPath(err, parPath)
+	}
+
+	if indexFile.mainPacket == nil {
+		return file{}, nil, &MissingPacketError{Path: parPath, PacketType: mainPacketType}
+	}
+
+	volumes, err := loadParityVolumes(fileIO, delegate, parPath, setID)
+	if err != nil {
+		return file{}, nil, err
+	}
+
+	return indexFile, volumes, nil
+}
+
+// dataShardStarts returns the index of the first data shard of each
+// file in recoverySet, along with the total number of data shards.
+func dataShardStarts(recoverySet []fileID, ifscPackets map[fileID]ifscPacket) (map[fileID]int, int, error) {
+	starts := make(map[fileID]int)
+	dataShardCount := 0
+	for _, fileID := range recoverySet {
+		ifscPacket, ok := ifscPackets[fileID]
+		if !ok {
+			return nil, 0, &MissingPacketError{PacketType: ifscPacketType, FileID: fileID}
+		}
+		starts[fileID] = dataShardCount
+		dataShardCount += len(ifscPacket.checksumPairs)
+	}
+	return starts, dataShardCount, nil
+}
+
+// newParityVolumeCoder returns a Coder that has enough parity rows
+// for all the recovery packets in volumes, or false if there are no
+// recovery packets.
+func newParityVolumeCoder(volumes []parityVolume, sliceByteCount, dataShardCount, numGoroutines int) (rsec16.Coder, bool, error) {
+	maxExponent := -1
+	for _, volume := range volumes {
+		for exp, packet := range volume.file.recoveryPackets {
+			if len(packet.data) != sliceByteCount {
+				return rsec16.Coder{}, false, &MismatchError{volume.path, "recovery packet byte count", sliceByteCount, len(packet.data)}
+			}
+			if int(exp) > maxExponent {
+				maxExponent = int(exp)
+			}
+		}
+	}
+
+	if maxExponent < 0 {
+		return rsec16.Coder{}, false, nil
+	}
+
+	coder, err := rsec16.NewCoderPAR2Vandermonde(dataShardCount, maxExponent+1, numGoroutines)
+	if err != nil {
+		return rsec16.Coder{}, false, err
+	}
+	return coder, true, nil
+}
+
+// addToRecoveryPackets adds c(e, j) * shards[j-startShard] to the
+// recovery packet with exponent e in every volume, where c(e, j) is
+// computed by coefficientFn.
+func addToRecoveryPackets(volumes []parityVolume, startShard int, shards [][]byte, coefficientFn func(e, j int) gf2p16.T) {
+	for _, volume := range volumes {
+		for exp, packet := range volume.file.recoveryPackets {
+			for i, shard := range shards {
+				c := coefficientFn(int(exp), startShard+i)
+				gf2p16.MulAndAddByteSliceLE(c, shard, packet.data)
+			}
+		}
+	}
+}
+
+// replaceFilePackets returns a copy of f with the given main packet,
+// without the packets for the file IDs in removedIDs, and with the
+// given file description and IFSC packets added.
+func replaceFilePackets(f file, mainPacket *mainPacket, removedIDs []fileID, fileDescriptionPackets map[fileID]fileDescriptionPacket, ifscPackets map[fileID]ifscPacket) file {
+	removed := make(map[fileID]bool)
+	for _, fileID := range removedIDs {
+		removed[fileID] = true
+	}
+
+	newFileDescriptionPackets := make(map[fileID]fileDescriptionPacket)
+	for fileID, packet := range f.fileDescriptionPackets {
+		if !removed[fileID] {
+			newFileDescriptionPackets[fileID] = packet
+		}
+	}
+	for fileID, packet := range fileDescriptionPackets {
+		newFileDescriptionPackets[fileID] = packet
+	}
+
+	newIFSCPackets := make(map[fileID]ifscPacket)
+	for fileID, packet := range f.ifscPackets {
+		if !removed[fileID] {
+			newIFSCPackets[fileID] = packet
+		}
+	}
+	for fileID, packet := range ifscPackets {
+		newIFSCPackets[fileID] = packet
+	}
+
+	// File info packets are only written at creation, so just
+	// drop those of removed files.
+	newFileInfoPackets := make(map[fileID]fileInfoPacket)
+	for fileID, packet := range f.fileInfoPackets {
+		if !removed[fileID] {
+			newFileInfoPackets[fileID] = packet
+		}
+	}
+
+	f.mainPacket = mainPacket
+	f.fileDescriptionPackets = newFileDescriptionPackets
+	f.ifscPackets = newIFSCPackets
+	f.fileInfoPackets = newFileInfoPackets
+	return f
+}
+
+// tempParityPath returns the path that writeParitySet writes the
+// new contents of the parity file at path to before moving it into
+// place. It doesn't end in .par2, so that a leftover temporary file
+// isn't mistaken for a parity volume.
+func tempParityPath(path string) string {
+	return path + ".tmp"
+}
+
+// backupParityPath returns the path that writeParitySet moves the
+// old parity file at path to while the new one is moved into place.
+// Like tempParityPath, it doesn't end in .par2.
+func backupParityPath(path string) string {
+	return path + ".old"
+}
+
+// writeParitySet passes the index file and each parity volume
+// through updateFn and writes them back out. So that a failed write
+// doesn't leave a mix of old and new parity files behind, each file
+// is first written to a temporary path, and once all of them have
+// been written, the old files are moved to backup paths, the
+// temporary files are moved into place, and the backups are removed.
+// If moving a file fails, the old files are moved back from their
+// backups; if that fails, too, the returned error names the files
+// that are left inconsistent and their backups.
+func writeParitySet(fileIO fileIO, delegate UpdateDelegate, parPath string, indexFile file, volumes []parityVolume, updateFn func(file) file) (err error) {
+	paths := []string{parPath}
+	files := []file{indexFile}
+	for _, volume := range volumes {
+		paths = append(paths, volume.path)
+		files = append(files, volume.file)
+	}
+
+	var tempPaths []string
+	defer func() {
+		if err != nil {
+			for _, tempPath := range tempPaths {
+				_ = fileIO.DeleteFile(tempPath)
+			}
+		}
+	}()
+
+	for i, f := range files {
+		_, fileBytes, err := writeFile(updateFn(f))
+		if err != nil {
+			return err
+		}
+		tempPath := tempParityPath(paths[i])
+		err = fileIO.WriteFile(tempPath, fileBytes)
+		delegate.OnParityFileWrite(i+1, paths[i], len(fileBytes), err)
+		if err != nil {
+			return err
+		}
+		tempPaths = append(tempPaths, tempPath)
+	}
+
+	// The paths whose old files have been moved to their backup
+	// paths.
+	var backedUpPaths []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		var inconsistentPaths, backupPaths []string
+		for _, path := range backedUpPaths {
+			backupPath := backupParityPath(path)
+			if restoreErr := fileIO.MoveFile(backupPath, path); restoreErr != nil {
+				inconsistentPaths = append(inconsistentPaths, path)
+				backupPaths = append(backupPaths, backupPath)
+			}
+		}
+		if len(inconsistentPaths) > 0 {
+			err = fmt.Errorf("parity set left inconsistent: restore %v from %v: %w", inconsistentPaths, backupPaths, err)
+		}
+	}()
+
+	for _, path := range paths {
+		err := fileIO.MoveFile(path, backupParityPath(path))
+		if err != nil {
+			return err
+		}
+		backedUpPaths = append(backedUpPaths, path)
+	}
+
+	for _, path := range paths {
+		err := fileIO.MoveFile(tempPaths[0], path)
+		if err != nil {
+			return err
+		}
+		// The temporary file is gone now, so there's
+		// nothing to clean up for it.
+		tempPaths = tempPaths[1:]
+	}
+
+	// The new set is in place, so the backups are no longer
+	// needed, and failing to remove them doesn't affect the
+	// set.
+	for _, path := range paths {
+		_ = fileIO.DeleteFile(backupParityPath(path))
+	}
+
+	return nil
+}
+
+// xorShards returns the slice-wise xor of a and b, which must have
+// the same number of equally-sized slices.
+func xorShards(a, b [][]byte) [][]byte {
+	delta := make([][]byte, len(a))
+	for i := range a {
+		delta[i] = make([]byte, len(a[i]))
+		for j := range a[i] {
+			delta[i][j] = a[i][j] ^ b[i][j]
+		}
+	}
+	return delta
+}
+
+func updateParity(fileIO fileIO, parPath, filePath string, oldData, newData []byte, options UpdateOptions) error {
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	delegate := options.UpdateDelegate
+	if delegate == nil {
+		delegate = DoNothingUpdateDelegate{}
+	}
+
+	indexFile, volumes, err := loadParitySet(fileIO, delegate, parPath)
+	if err != nil {
+		return err
+	}
+
+	absParPath, err := filepath.Abs(parPath)
+	if err != nil {
+		return err
+	}
+	absFilePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	filename, err := filepath.Rel(filepath.Dir(absParPath), absFilePath)
+	if err != nil {
+		return err
+	}
+
+	sliceByteCount := indexFile.mainPacket.sliceByteCount
+	recoverySet := indexFile.mainPacket.recoverySet
+
+	oldFileIndex := -1
+	var oldFileID fileID
+	for i, fileID := range recoverySet {
+		if indexFile.fileDescriptionPackets[fileID].filename == filename {
+			oldFileIndex = i
+			oldFileID = fileID
+			break
+		}
+	}
+	if oldFileIndex == -1 {
+		return &InvalidArgumentError{"filePath", fmt.Sprintf("must be in the recovery set of %s, but %s isn't", parPath, filePath)}
+	}
+
+	oldDescription := indexFile.fileDescriptionPackets[oldFileID]
+	if len(oldData) != oldDescription.byteCount {
+		return &MismatchError{filePath, "old data byte count", oldDescription.byteCount, len(oldData)}
+	}
+	if oldHash := md5.Sum(oldData); oldHash != oldDescription.hash {
+		return &MismatchError{filePath, "old data hash", oldDescription.hash, oldHash}
+	}
+
+	newFileID, newDescription, newIFSCPacket, newShards := computeDataFileInfo(sliceByteCount, filename, newData)
+	_, _, _, oldShards := computeDataFileInfo(sliceByteCount, filename, oldData)
+	if len(newShards) != len(oldShards) {
+		return &MismatchError{filePath, "slice count", len(oldShards), len(newShards)}
+	}
+
+	newRecoverySet := make([]fileID, len(recoverySet))
+	copy(newRecoverySet, recoverySet)
+	newRecoverySet[oldFileIndex] = newFileID
+	if !sort.SliceIsSorted(newRecoverySet, func(i, j int) bool {
+		return fileIDLess(newRecoverySet[i], newRecoverySet[j])
+	}) {
+		newFileIndex := 0
+		for i, fileID := range recoverySet {
+			if i != oldFileIndex && fileIDLess(fileID, newFileID) {
+				newFileIndex++
+			}
+		}
+		return &MismatchError{filePath, "recovery set position", oldFileIndex, newFileIndex}
+	}
+
+	starts, dataShardCount, err := dataShardStarts(recoverySet, indexFile.ifscPackets)
+	if err != nil {
+		return err
+	}
+
+	coder, hasRecoveryPackets, err := newParityVolumeCoder(volumes, sliceByteCount, dataShardCount, numGoroutines)
+	if err != nil {
+		return err
+	}
+
+	if hasRecoveryPackets {
+		delta := xorShards(oldShards, newShards)
+		addToRecoveryPackets(volumes, starts[oldFileID], delta, coder.ParityCoefficient)
+	}
+
+	newMainPacket := mainPacket{
+		sliceByteCount: sliceByteCount,
+		recoverySet:    newRecoverySet,
+		nonRecoverySet: indexFile.mainPacket.nonRecoverySet,
+	}
+
+	return writeParitySet(fileIO, delegate, parPath, indexFile, volumes, func(f file) file {
+		return replaceFilePackets(f, &newMainPacket, []fileID{oldFileID}, map[fileID]fileDescriptionPacket{
+			newFileID: newDescription,
+		}, map[fileID]ifscPacket{
+			newFileID: newIFSCPacket,
+		})
+	})
+}
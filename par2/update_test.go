@@ -0,0 +1,208 @@
+package par2
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/stretchr/testify/require"
+)
+
+type testUpdateDelegate struct {
+	t *testing.T
+}
+
+func (d testUpdateDelegate) OnParityFileLoad(i int, path string, err error) {
+	d.t.Helper()
+	d.t.Logf("OnParityFileLoad(%d, %s, %v)", i, path, err)
+}
+
+func (d testUpdateDelegate) OnParityFileWrite(i int, path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnParityFileWrite(%d, %s, %d, %v)", i, path, byteCount, err)
+}
+
+func makeUpdateMemFS(workingDir string) memfs.MemFS {
+	return memfs.MakeMemFS(workingDir, map[string][]byte{
+		"file.rar": {0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9},
+		"file.r01": {0x5, 0x6, 0x7},
+		"file.r02": {0x8, 0x9, 0xa, 0xb, 0xc},
+	})
+}
+
+func TestUpdateParity(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+	rarPath := "file.rar"
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	oldData, err := fs.ReadFile(rarPath)
+	require.NoError(t, err)
+	// This is chosen so that file.rar stays in the middle of the
+	// recovery set.
+	newData := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x4}
+
+	// Build the expected parity data from scratch.
+	expectedFS := makeUpdateMemFS(workingDir)
+	require.NoError(t, expectedFS.WriteFile(rarPath, newData))
+	buildPAR2Data(t, expectedFS, workingDir, 4, 3)
+
+	require.NoError(t, fs.WriteFile(rarPath, newData))
+	parPath := filepath.Join(workingDir, "file.par2")
+	err = updateParity(testFileIO{t, fs}, parPath, filepath.Join(workingDir, rarPath), oldData, newData, UpdateOptions{
+		UpdateDelegate: testUpdateDelegate{t},
+	})
+	require.NoError(t, err)
+
+	for _, path := range expectedFS.Paths() {
+		expectedData, err := expectedFS.ReadFile(path)
+		require.NoError(t, err)
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expectedData, data, "path=%s", path)
+	}
+
+	decoder, err := newDecoderForTest(t, fs, parPath)
+	require.NoError(t, err)
+	err = decoder.LoadFileData()
+	require.NoError(t, err)
+	err = decoder.LoadParityData()
+	require.NoError(t, err)
+	require.False(t, decoder.ShardCounts().RepairNeeded())
+}
+
+func TestUpdateParityErrors(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	parPath := filepath.Join(workingDir, "file.par2")
+	rarPath := filepath.Join(workingDir, "file.rar")
+	oldData, err := fs.ReadFile(rarPath)
+	require.NoError(t, err)
+
+	err = updateParity(testFileIO{t, fs}, parPath, filepath.Join(workingDir, "file.r05"), oldData, oldData, UpdateOptions{})
+	require.Equal(t, &InvalidArgumentError{"filePath", fmt.Sprintf("must be in the recovery set of %s, but %s isn't", parPath, filepath.Join(workingDir, "file.r05"))}, err)
+
+	err = updateParity(testFileIO{t, fs}, parPath, rarPath, oldData[1:], oldData, UpdateOptions{})
+	require.Equal(t, &MismatchError{rarPath, "old data byte count", len(oldData), len(oldData) - 1}, err)
+
+	badOldData := append([]byte(nil), oldData...)
+	badOldData[0]++
+	err = updateParity(testFileIO{t, fs}, parPath, rarPath, badOldData, oldData, UpdateOptions{})
+	require.Equal(t, &MismatchError{rarPath, "old data hash", md5.Sum(oldData), md5.Sum(badOldData)}, err)
+
+	err = updateParity(testFileIO{t, fs}, parPath, rarPath, oldData, append(oldData, 0x1, 0x2, 0x3, 0x4), UpdateOptions{})
+	require.Equal(t, &MismatchError{rarPath, "slice count", 3, 4}, err)
+
+	err = updateParity(testFileIO{t, fs}, parPath, rarPath, oldData, []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x0}, UpdateOptions{})
+	var mismatchErr *MismatchError
+	require.True(t, errors.As(err, &mismatchErr), "%v", err)
+	require.Equal(t, "recovery set position", mismatchErr.What)
+	require.NotEqual(t, mismatchErr.Expected, mismatchErr.Actual)
+}
+
+func TestUpdateParityWriteFailure(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+	rarPath := filepath.Join(workingDir, "file.rar")
+	parPath := filepath.Join(workingDir, "file.par2")
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	_, volumes, err := loadParitySet(testFileIO{t, fs}, testUpdateDelegate{t}, parPath)
+	require.NoError(t, err)
+	require.True(t, len(volumes) >= 2)
+
+	paths := fs.Paths()
+	expectedContents := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		expectedContents[path] = data
+	}
+
+	oldData := expectedContents[rarPath]
+	newData := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x4}
+	fileIO := failingWriteFileIO{testFileIO{t, fs}, tempParityPath(volumes[1].path)}
+	err = updateParity(fileIO, parPath, rarPath, oldData, newData, UpdateOptions{
+		UpdateDelegate: testUpdateDelegate{t},
+	})
+	require.Equal(t, errWriteFailed, err)
+
+	// Neither the index file nor the first volume may have been
+	// replaced, and no temporary files may be left behind.
+	require.ElementsMatch(t, paths, fs.Paths())
+	for path, expectedData := range expectedContents {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expectedData, data, "path=%s", path)
+	}
+
+	decoder, err := newDecoderForTest(t, fs, parPath)
+	require.NoError(t, err)
+	require.NoError(t, decoder.LoadFileData())
+	require.NoError(t, decoder.LoadParityData())
+	require.False(t, decoder.ShardCounts().RepairNeeded())
+}
+
+// failingMoveFileIO is a fileIO whose MoveFile fails when moving
+// failingPath.
+type failingMoveFileIO struct {
+	fileIO
+	failingPath string
+}
+
+var errMoveFailed = errors.New("move failed")
+
+func (io failingMoveFileIO) MoveFile(oldPath, newPath string) error {
+	if oldPath == io.failingPath {
+		return errMoveFailed
+	}
+	return io.fileIO.MoveFile(oldPath, newPath)
+}
+
+func TestUpdateParityMoveFailure(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := makeUpdateMemFS(workingDir)
+	rarPath := filepath.Join(workingDir, "file.rar")
+	parPath := filepath.Join(workingDir, "file.par2")
+
+	buildPAR2Data(t, fs, workingDir, 4, 3)
+
+	_, volumes, err := loadParitySet(testFileIO{t, fs}, testUpdateDelegate{t}, parPath)
+	require.NoError(t, err)
+	require.True(t, len(volumes) >= 2)
+
+	paths := fs.Paths()
+	expectedContents := make(map[string][]byte)
+	for _, path := range paths {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		expectedContents[path] = data
+	}
+
+	oldData := expectedContents[rarPath]
+	newData := []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x4}
+	// Fail after the index file and the first volume have been
+	// moved into place.
+	fileIO := failingMoveFileIO{testFileIO{t, fs}, tempParityPath(volumes[1].path)}
+	err = updateParity(fileIO, parPath, rarPath, oldData, newData, UpdateOptions{
+		UpdateDelegate: testUpdateDelegate{t},
+	})
+	require.Equal(t, errMoveFailed, err)
+
+	// The old files must have been restored, and no temporary
+	// or backup files may be left behind.
+	require.ElementsMatch(t, paths, fs.Paths())
+	for path, expectedData := range expectedContents {
+		data, err := fs.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, expectedData, data, "path=%s", path)
+	}
+}
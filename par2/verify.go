@@ -1,5 +1,12 @@
 package par2
 
+import (
+	"io"
+	"io/fs"
+
+	"github.com/akalin/gopar/fsio"
+)
+
 // VerifyDelegate is just DecoderDelegate for now.
 type VerifyDelegate interface {
 	DecoderDelegate
@@ -13,12 +20,31 @@ type DoNothingVerifyDelegate struct {
 
 // VerifyOptions holds all the options for Verify.
 type VerifyOptions struct {
-	// The number of goroutines to use while encoding. If <= 0,
-	// NumGoroutinesDefault() is used.
+	// The number of goroutines to use while hashing, scanning
+	// and encoding. If <= 0, NumGoroutinesDefault() is used.
 	NumGoroutines int
+	// If VerifyAllData is true, then check whether all parity
+	// shards contain correct data even if no missing or corrupt
+	// data files are detected.
+	VerifyAllData bool
 	// The VerifyDelegate to use. If nil, DoNothingVerifyDelegate
 	// is used.
 	VerifyDelegate VerifyDelegate
+	// If UseMmap is true, files are memory-mapped instead of
+	// being read into memory, if possible; see NewDecoderMmap.
+	UseMmap bool
+	// The directory that the data files are looked up in. If
+	// empty, the directory of parPath is used.
+	BasePath string
+	// If Purge is true, then if no repair is needed, every data
+	// file matches its recorded hash, and, if VerifyAllData is
+	// true, all data is ok, the par file and its parity volumes
+	// are removed. This requires the file
+	// system passed to VerifyFS to be a fsio.RemoveFS.
+	Purge bool
+	// Roughly how many bytes of parity data to hold in memory at
+	// once. If <= 0, there's no limit. See Decoder.SetMemoryLimit.
+	MemoryLimit int
 }
 
 // VerifyResult holds the result of a Verify call.
@@ -26,15 +52,69 @@ type VerifyResult struct {
 	// ShardCounts contains shard counts which can be used to deduce
 	// whether repair is necessary and/or possible.
 	ShardCounts ShardCounts
+	// AllDataOk contains the result of calling VerifyAllData(),
+	// when VerifyAllData is set to true in VerifyOptions,
+	// ShardCounts.RepairNeeded() returns false, and there is at
+	// least one usable parity shard, and contains false
+	// otherwise.
+	AllDataOk bool
+	// DataFilesOk is true if every data file matches its
+	// recorded hash. It can be false even if
+	// ShardCounts.RepairNeeded() returns false, e.g. if a data
+	// file is missing but all of its slices are found in other
+	// files, in which case repair is still needed to restore it.
+	DataFilesOk bool
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in VerifyOptions.
+	PurgedPaths []string
 }
 
 // Verify a par file at parPath with the given options. The returned
 // VerifyResult is not filled in if an error is returned.
 func Verify(parPath string, options VerifyOptions) (VerifyResult, error) {
-	return verify(defaultFileIO{}, parPath, options)
+	var result VerifyResult
+	err := withFileIO(options.UseMmap, func(fileIO fileIO) error {
+		var err error
+		result, err = verify(fileIO, parPath, options)
+		return err
+	})
+	return result, err
+}
+
+// VerifyFS is like Verify, except that it reads files from fsys
+// instead of the OS file system, and parPath is a name in fsys. The
+// paths passed to the delegate are under fsio.Root().
+func VerifyFS(fsys fs.FS, parPath string, options VerifyOptions) (VerifyResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	result, err := verify(p, p.Path(parPath), options)
+	for i, path := range result.PurgedPaths {
+		name, nameErr := p.Name(path)
+		if nameErr != nil {
+			return result, nameErr
+		}
+		result.PurgedPaths[i] = name
+	}
+	return result, err
+}
+
+// VerifyFromTar is like Verify, except that the data files are read
+// from the tar stream read from r; see Decoder.LoadFileDataFromTar.
+// The par file and its parity volumes are still read from the file
+// system.
+func VerifyFromTar(parPath string, r io.Reader, options VerifyOptions) (VerifyResult, error) {
+	return verifyWith(defaultFileIO{}, parPath, options, func(decoder *Decoder) error {
+		return decoder.LoadFileDataFromTar(r)
+	})
 }
 
 func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult, error) {
+	return verifyWith(fileIO, parPath, options, (*Decoder).LoadFileData)
+}
+
+func verifyWith(fileIO fileIO, parPath string, options VerifyOptions, loadFileData func(*Decoder) error) (VerifyResult, error) {
 	err := checkExtension(parPath)
 	if err != nil {
 		return VerifyResult{}, err
@@ -54,8 +134,12 @@ func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult,
 	if err != nil {
 		return VerifyResult{}, err
 	}
+	if options.BasePath != "" {
+		decoder.basePath = options.BasePath
+	}
+	decoder.SetMemoryLimit(options.MemoryLimit)
 
-	err = decoder.LoadFileData()
+	err = loadFileData(decoder)
 	if err != nil {
 		return VerifyResult{}, err
 	}
@@ -65,7 +149,27 @@ func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult,
 		return VerifyResult{}, err
 	}
 
+	shardCounts := decoder.ShardCounts()
+
+	allDataOk := false
+	if options.VerifyAllData && !shardCounts.RepairNeeded() && shardCounts.UsableParityShardCount > 0 {
+		allDataOk, err = decoder.VerifyAllData()
+		if err != nil {
+			return VerifyResult{}, err
+		}
+	}
+	dataFilesOk := decoder.dataFilesOK()
+	var purgedPaths []string
+	if options.Purge && !shardCounts.RepairNeeded() && dataFilesOk && (allDataOk || !options.VerifyAllData) {
+		purgedPaths, err = decoder.Purge()
+		if err != nil {
+			return VerifyResult{}, err
+		}
+	}
 	return VerifyResult{
-		ShardCounts: decoder.ShardCounts(),
+		ShardCounts: shardCounts,
+		AllDataOk:   allDataOk,
+		DataFilesOk: dataFilesOk,
+		PurgedPaths: purgedPaths,
 	}, nil
 }
@@ -25,6 +25,8 @@ func testVerify(t *testing.T, workingDir string, options VerifyOptions) {
 			UsableDataShardCount:   dataShardCount,
 			UsableParityShardCount: parityShardCount,
 		},
+		AllDataOk:   options.VerifyAllData,
+		DataFilesOk: true,
 	}, result)
 
 	fileData5, err := fs.ReadFile(r04Path)
@@ -38,6 +40,20 @@ func testVerify(t *testing.T, workingDir string, options VerifyOptions) {
 			UnusableDataShardCount: 1,
 			UsableParityShardCount: parityShardCount,
 		},
+		AllDataOk: false,
+	}, result)
+
+	fileData5[len(fileData5)-1]--
+	corruptRecoveryPacket(t, fs, filepath.Join(workingDir, "file.vol01+01.par2"))
+	result, err = verify(testFileIO{t, fs}, parPath, options)
+	require.NoError(t, err)
+	require.Equal(t, VerifyResult{
+		ShardCounts: ShardCounts{
+			UsableDataShardCount:   dataShardCount,
+			UsableParityShardCount: parityShardCount,
+		},
+		AllDataOk:   false,
+		DataFilesOk: true,
 	}, result)
 }
 
@@ -52,6 +68,7 @@ func TestVerify(t *testing.T) {
 		t.Run(fmt.Sprintf("workingDir=%s", workingDir), func(t *testing.T) {
 			testVerify(t, workingDir, VerifyOptions{
 				NumGoroutines: NumGoroutinesDefault(),
+				VerifyAllData: true,
 			})
 		})
 	}
@@ -70,3 +87,70 @@ func TestVerifyDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyPurge(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir1")
+	fs := makeDecoderMemFS(workingDir)
+	dataFileCount := fs.FileCount()
+	buildPAR2Data(t, fs, workingDir, 4, 2)
+
+	r04Path := filepath.Join("dir4", "dir5", "file.r04")
+	perturbFile(t, fs, r04Path)
+	result, err := VerifyFS(fs, "file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.True(t, result.ShardCounts.RepairNeeded())
+	require.Nil(t, result.PurgedPaths)
+	require.Equal(t, dataFileCount+3, fs.FileCount())
+
+	unperturbFile(t, fs, r04Path)
+	result, err = VerifyFS(fs, "file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"file.par2",
+		"file.vol00+01.par2",
+		"file.vol01+01.par2",
+	}, result.PurgedPaths)
+	require.Equal(t, dataFileCount, fs.FileCount())
+}
+
+func TestVerifyPurgeMissingDuplicateFile(t *testing.T) {
+	// a.bin is a duplicate of b.bin, so when it's missing, all
+	// of its slices are still found in b.bin, and no slice is
+	// missing.
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"a.bin": {0x1, 0x2, 0x3, 0x4, 0x5},
+		"b.bin": {0x1, 0x2, 0x3, 0x4, 0x5},
+	})
+	buildPAR2Data(t, fs, workingDir, 4, 2)
+	_, err := fs.RemoveFile("a.bin")
+	require.NoError(t, err)
+
+	result, err := VerifyFS(fs, "file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.False(t, result.ShardCounts.RepairNeeded())
+	require.False(t, result.DataFilesOk)
+	require.Nil(t, result.PurgedPaths)
+	require.Equal(t, 4, fs.FileCount())
+
+	repairResult, err := RepairFS(fs, "file.par2", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.bin"}, repairResult.RepairedPaths)
+
+	result, err = VerifyFS(fs, "file.par2", VerifyOptions{
+		VerifyDelegate: testDecoderDelegate{t},
+	})
+	require.NoError(t, err)
+	require.True(t, result.DataFilesOk)
+}
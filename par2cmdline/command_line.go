@@ -0,0 +1,364 @@
+package par2cmdline
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Operation is what a par2cmdline command line does.
+type Operation int
+
+// The operations that par2cmdline supports.
+const (
+	Create Operation = iota + 1
+	Verify
+	Repair
+)
+
+// DefaultBlockCount is the number of blocks par2cmdline aims for when
+// creating if neither -s nor -b is given.
+const DefaultBlockCount = 2000
+
+// DefaultRedundancy is the redundancy percentage par2cmdline uses when
+// creating if neither -c nor -r is given.
+const DefaultRedundancy = 5
+
+// CommandLine holds a parsed par2cmdline command line. Numeric fields
+// that are zero weren't given.
+type CommandLine struct {
+	Operation Operation
+	// ParFile is the PAR2 file to create, verify, or repair. When
+	// creating, it always ends in .par2.
+	ParFile string
+	// Files are the data files when creating, or extra files to
+	// scan when verifying or repairing.
+	Files []string
+
+	// BlockSize is the block size in bytes (-s).
+	BlockSize int
+	// BlockCount is the number of blocks to aim for (-b).
+	BlockCount int
+	// RecoveryBlockCount is the number of recovery blocks (-c).
+	RecoveryBlockCount int
+	// Redundancy is the number of recovery blocks as a percentage
+	// of the number of blocks (-r).
+	Redundancy int
+	// IndexOnly is whether -c0 or -r0 was given, which means that
+	// only the index file should be created.
+	IndexOnly bool
+	// RecoveryFileCount is the number of recovery files (-n).
+	RecoveryFileCount int
+	// Uniform is whether recovery files should have the same
+	// number of recovery blocks (-u).
+	Uniform bool
+	// LimitSize is whether recovery files should be no bigger
+	// than the largest data file (-l).
+	LimitSize bool
+	// Recurse is whether directories in Files should be
+	// recursed into (-R).
+	Recurse bool
+
+	// Purge is whether the PAR2 files should be removed after a
+	// successful verify or repair (-p).
+	Purge bool
+	// DataSkipping is whether to skip over data when scanning
+	// for blocks (-N), and SkipLeeway is by how many bytes the
+	// position of a block may differ from its expected position
+	// (-S).
+	DataSkipping bool
+	SkipLeeway   int
+
+	// MemoryMB is the amount of memory to use in megabytes (-m).
+	MemoryMB int
+	// NumThreads is the number of threads to use (-t).
+	NumThreads int
+	// Verbosity is the number of -v options minus the number of
+	// -q options.
+	Verbosity int
+	// BasePath is the directory that data file names are relative
+	// to (-B).
+	BasePath string
+}
+
+// ParseOperation returns the Operation for the given word, e.g. "c"
+// or "create".
+func ParseOperation(word string) (Operation, error) {
+	switch strings.ToLower(word) {
+	case "c", "create":
+		return Create, nil
+	case "v", "verify":
+		return Verify, nil
+	case "r", "repair":
+		return Repair, nil
+	}
+	return 0, fmt.Errorf("unknown operation %q", word)
+}
+
+const (
+	createOnly         = "cannot be used when verifying or repairing"
+	verifyOrRepairOnly = "cannot be used when creating"
+)
+
+// ParseCommandLine parses the arguments of a par2cmdline command line
+// after the program name, i.e. the operation followed by options,
+// the PAR2 file, and data files. Options may come before, after, or
+// between files, except after a "--" argument, and their values may
+// either be attached, as in "-r10", or be the next argument.
+func ParseCommandLine(args []string) (CommandLine, error) {
+	if len(args) == 0 {
+		return CommandLine{}, errors.New("no operation specified")
+	}
+
+	operation, err := ParseOperation(args[0])
+	if err != nil {
+		return CommandLine{}, err
+	}
+
+	c := CommandLine{Operation: operation}
+	var archiveName string
+	var positional []string
+	// Whether -c and -r were given, which can't be told from
+	// their values if they're 0.
+	var recoveryBlockCountGiven, redundancyGiven bool
+	endOfOptions := false
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if endOfOptions || len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+		if arg == "--" {
+			endOfOptions = true
+			continue
+		}
+
+		option := arg[:2]
+		value := arg[2:]
+		nextValue := func() (string, error) {
+			if value != "" {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s requires a value", option)
+			}
+			i++
+			return args[i], nil
+		}
+		nextInt := func() (int, error) {
+			value, err := nextValue()
+			if err != nil {
+				return 0, err
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s requires a positive integer, got %q", option, value)
+			}
+			return n, nil
+		}
+		// Like par2cmdline, -c and -r also accept 0.
+		nextNonNegativeInt := func() (int, error) {
+			value, err := nextValue()
+			if err != nil {
+				return 0, err
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("%s requires a non-negative integer, got %q", option, value)
+			}
+			return n, nil
+		}
+
+		var restriction string
+		switch option {
+		case "-a":
+			restriction = createOnly
+			archiveName, err = nextValue()
+		case "-s":
+			restriction = createOnly
+			c.BlockSize, err = nextInt()
+			if err == nil && c.BlockSize%4 != 0 {
+				err = errors.New("-s must be a multiple of 4")
+			}
+		case "-b":
+			restriction = createOnly
+			c.BlockCount, err = nextInt()
+		case "-c":
+			restriction = createOnly
+			c.RecoveryBlockCount, err = nextNonNegativeInt()
+			recoveryBlockCountGiven = true
+		case "-r":
+			restriction = createOnly
+			c.Redundancy, err = nextNonNegativeInt()
+			redundancyGiven = true
+		case "-n":
+			restriction = createOnly
+			c.RecoveryFileCount, err = nextInt()
+		case "-u", "-l", "-R":
+			restriction = createOnly
+			if value != "" {
+				err = fmt.Errorf("unknown option %q", arg)
+			}
+			c.Uniform = c.Uniform || option == "-u"
+			c.LimitSize = c.LimitSize || option == "-l"
+			c.Recurse = c.Recurse || option == "-R"
+		case "-p", "-N":
+			restriction = verifyOrRepairOnly
+			if value != "" {
+				err = fmt.Errorf("unknown option %q", arg)
+			}
+			c.Purge = c.Purge || option == "-p"
+			c.DataSkipping = c.DataSkipping || option == "-N"
+		case "-S":
+			restriction = verifyOrRepairOnly
+			c.SkipLeeway, err = nextInt()
+		case "-m":
+			c.MemoryMB, err = nextInt()
+		case "-t":
+			c.NumThreads, err = nextInt()
+		case "-B":
+			c.BasePath, err = nextValue()
+		case "-v", "-q":
+			delta := 1
+			if option == "-q" {
+				delta = -1
+			}
+			if value != "" && value != option[1:] {
+				err = fmt.Errorf("unknown option %q", arg)
+			}
+			c.Verbosity += delta * (len(value) + 1)
+		default:
+			err = fmt.Errorf("unknown option %q", arg)
+		}
+		if err != nil {
+			return CommandLine{}, err
+		}
+
+		if restriction == createOnly && operation != Create || restriction == verifyOrRepairOnly && operation == Create {
+			return CommandLine{}, fmt.Errorf("%s %s", option, restriction)
+		}
+	}
+
+	if recoveryBlockCountGiven && redundancyGiven {
+		return CommandLine{}, errors.New("cannot specify both -c and -r")
+	}
+	c.IndexOnly = recoveryBlockCountGiven && c.RecoveryBlockCount == 0 || redundancyGiven && c.Redundancy == 0
+
+	err = c.checkConflicts()
+	if err != nil {
+		return CommandLine{}, err
+	}
+
+	if archiveName != "" {
+		c.ParFile = archiveName
+		c.Files = positional
+	} else if len(positional) > 0 {
+		c.ParFile = positional[0]
+		c.Files = positional[1:]
+	} else {
+		return CommandLine{}, errors.New("no PAR2 file specified")
+	}
+
+	if operation == Create {
+		if !strings.HasSuffix(strings.ToLower(c.ParFile), ".par2") {
+			c.ParFile += ".par2"
+		}
+		if len(c.Files) == 0 {
+			return CommandLine{}, errors.New("no data files specified")
+		}
+	}
+
+	return c, nil
+}
+
+func (c CommandLine) checkConflicts() error {
+	if c.BlockSize > 0 && c.BlockCount > 0 {
+		return errors.New("cannot specify both -s and -b")
+	}
+	if c.Uniform && c.LimitSize {
+		return errors.New("cannot specify both -u and -l")
+	}
+	if c.RecoveryFileCount > 0 && c.LimitSize {
+		return errors.New("cannot specify both -n and -l")
+	}
+	if c.SkipLeeway > 0 && !c.DataSkipping {
+		return errors.New("-S requires -N")
+	}
+	return nil
+}
+
+// SliceByteCount returns the block size to use when creating with
+// the given data file sizes: BlockSize if given, or otherwise the
+// smallest multiple of 4 that makes the total number of blocks at
+// most BlockCount, or DefaultBlockCount if that isn't given either.
+// If that's not possible, i.e. the block count is less than the
+// number of non-empty data files, the block size is the size of the
+// largest data file rounded up to a multiple of 4.
+func (c CommandLine) SliceByteCount(fileByteCounts []int64) int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+
+	blockCount := c.BlockCount
+	if blockCount <= 0 {
+		blockCount = DefaultBlockCount
+	}
+
+	var maxByteCount int64
+	for _, byteCount := range fileByteCounts {
+		if byteCount > maxByteCount {
+			maxByteCount = byteCount
+		}
+	}
+
+	// Binary search over the multiples of 4.
+	lo, hi := int64(1), (maxByteCount+3)/4
+	if hi < lo {
+		hi = lo
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if blockCountForSliceByteCount(fileByteCounts, 4*mid) <= blockCount {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return int(4 * lo)
+}
+
+func blockCountForSliceByteCount(fileByteCounts []int64, sliceByteCount int64) int {
+	blockCount := 0
+	for _, byteCount := range fileByteCounts {
+		blockCount += int((byteCount + sliceByteCount - 1) / sliceByteCount)
+	}
+	return blockCount
+}
+
+// NumParityShards returns the number of recovery blocks to create
+// for the given data file sizes and block size: 0 if IndexOnly is
+// true, RecoveryBlockCount if given, or otherwise Redundancy percent,
+// or DefaultRedundancy percent if that isn't given either, of the
+// number of blocks, rounded to the nearest integer like par2cmdline
+// does, but at least 1.
+func (c CommandLine) NumParityShards(fileByteCounts []int64, sliceByteCount int) int {
+	if c.IndexOnly {
+		return 0
+	}
+	if c.RecoveryBlockCount > 0 {
+		return c.RecoveryBlockCount
+	}
+
+	redundancy := c.Redundancy
+	if redundancy <= 0 {
+		redundancy = DefaultRedundancy
+	}
+
+	blockCount := blockCountForSliceByteCount(fileByteCounts, int64(sliceByteCount))
+	numParityShards := (blockCount*redundancy + 50) / 100
+	if numParityShards < 1 {
+		numParityShards = 1
+	}
+	return numParityShards
+}
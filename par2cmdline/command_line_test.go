@@ -0,0 +1,101 @@
+package par2cmdline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	for _, test := range []struct {
+		args        string
+		expected    CommandLine
+		expectedErr error
+	}{
+		{"c file.par2 a b", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a", "b"}}, nil},
+		{"create file a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}}, nil},
+		{"c -s8 -c3 file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, BlockSize: 8, RecoveryBlockCount: 3}, nil},
+		{"c -s 8 -r 10 file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, BlockSize: 8, Redundancy: 10}, nil},
+		{"c -b100 -n3 -u file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, BlockCount: 100, RecoveryFileCount: 3, Uniform: true}, nil},
+		{"c -l -R -m16 -t2 -B dir file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, LimitSize: true, Recurse: true, MemoryMB: 16, NumThreads: 2, BasePath: "dir"}, nil},
+		{"c -afile a b", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a", "b"}}, nil},
+		{"c -a file.par2 -- -a -b", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"-a", "-b"}}, nil},
+		{"c file.par2 a -q b", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a", "b"}, Verbosity: -1}, nil},
+		{"v -qq file.par2", CommandLine{Operation: Verify, ParFile: "file.par2", Files: []string{}, Verbosity: -2}, nil},
+		{"v -vv -p file.par2 extra", CommandLine{Operation: Verify, ParFile: "file.par2", Files: []string{"extra"}, Verbosity: 2, Purge: true}, nil},
+		{"r -N -S64 file.par2", CommandLine{Operation: Repair, ParFile: "file.par2", Files: []string{}, DataSkipping: true, SkipLeeway: 64}, nil},
+		{"R file.par", CommandLine{Operation: Repair, ParFile: "file.par", Files: []string{}}, nil},
+		{"c -r0 file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, IndexOnly: true}, nil},
+		{"c -c 0 file.par2 a", CommandLine{Operation: Create, ParFile: "file.par2", Files: []string{"a"}, IndexOnly: true}, nil},
+
+		{"", CommandLine{}, errors.New("no operation specified")},
+		{"x file.par2", CommandLine{}, errors.New(`unknown operation "x"`)},
+		{"c", CommandLine{}, errors.New("no PAR2 file specified")},
+		{"c file.par2", CommandLine{}, errors.New("no data files specified")},
+		{"c -x file.par2 a", CommandLine{}, errors.New(`unknown option "-x"`)},
+		{"c -uq file.par2 a", CommandLine{}, errors.New(`unknown option "-uq"`)},
+		{"c -vq file.par2 a", CommandLine{}, errors.New(`unknown option "-vq"`)},
+		{"c -s6 file.par2 a", CommandLine{}, errors.New("-s must be a multiple of 4")},
+		{"c -r-1 file.par2 a", CommandLine{}, errors.New(`-r requires a non-negative integer, got "-1"`)},
+		{"c -b0 file.par2 a", CommandLine{}, errors.New(`-b requires a positive integer, got "0"`)},
+		{"c -c0 -r10 file.par2 a", CommandLine{}, errors.New("cannot specify both -c and -r")},
+		{"c file.par2 a -c", CommandLine{}, errors.New("-c requires a value")},
+		{"c -s4 -b10 file.par2 a", CommandLine{}, errors.New("cannot specify both -s and -b")},
+		{"c -c4 -r10 file.par2 a", CommandLine{}, errors.New("cannot specify both -c and -r")},
+		{"c -u -l file.par2 a", CommandLine{}, errors.New("cannot specify both -u and -l")},
+		{"c -n2 -l file.par2 a", CommandLine{}, errors.New("cannot specify both -n and -l")},
+		{"c -p file.par2 a", CommandLine{}, errors.New("-p cannot be used when creating")},
+		{"v -S4 file.par2", CommandLine{}, errors.New("-S requires -N")},
+		{"v -r10 file.par2", CommandLine{}, errors.New("-r cannot be used when verifying or repairing")},
+		{"r -afile file.par2", CommandLine{}, errors.New("-a cannot be used when verifying or repairing")},
+	} {
+		c, err := ParseCommandLine(strings.Fields(test.args))
+		require.Equal(t, test.expectedErr, err, test.args)
+		require.Equal(t, test.expected, c, test.args)
+	}
+}
+
+func TestSliceByteCount(t *testing.T) {
+	fileByteCounts := []int64{1000, 10, 0}
+	for _, test := range []struct {
+		c        CommandLine
+		expected int
+	}{
+		{CommandLine{BlockSize: 100}, 100},
+		// 1000/4 + 10/4 rounded up = 253 blocks.
+		{CommandLine{}, 4},
+		{CommandLine{BlockCount: 253}, 4},
+		{CommandLine{BlockCount: 252}, 8},
+		{CommandLine{BlockCount: 11}, 100},
+		{CommandLine{BlockCount: 2}, 1000},
+		// Can't have fewer blocks than non-empty files.
+		{CommandLine{BlockCount: 1}, 1000},
+	} {
+		require.Equal(t, test.expected, test.c.SliceByteCount(fileByteCounts), "%+v", test.c)
+	}
+
+	require.Equal(t, 4, CommandLine{}.SliceByteCount(nil))
+	require.Equal(t, 4, CommandLine{}.SliceByteCount([]int64{0}))
+}
+
+func TestNumParityShards(t *testing.T) {
+	// 10 + 1 = 11 blocks of 100 bytes.
+	fileByteCounts := []int64{1000, 10}
+	for _, test := range []struct {
+		c        CommandLine
+		expected int
+	}{
+		{CommandLine{RecoveryBlockCount: 7}, 7},
+		// 5% of 11 is 0.55, which rounds to 1.
+		{CommandLine{}, 1},
+		{CommandLine{Redundancy: 50}, 6},
+		{CommandLine{Redundancy: 40}, 4},
+		{CommandLine{Redundancy: 200}, 22},
+		{CommandLine{Redundancy: 1}, 1},
+		{CommandLine{IndexOnly: true}, 0},
+	} {
+		require.Equal(t, test.expected, test.c.NumParityShards(fileByteCounts, 100), "%+v", test.c)
+	}
+}
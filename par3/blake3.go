@@ -0,0 +1,158 @@
+package par3
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// This is a straightforward port of the BLAKE3 reference
+// implementation, restricted to the default hash mode and 32-byte
+// outputs, which is all that PAR3 needs. It's not optimized.
+
+const (
+	blake3BlockLen = 64
+	blake3ChunkLen = 1024
+
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+)
+
+var blake3IV = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var blake3MsgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func blake3G(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] = s[a] + s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] = s[a] + s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func blake3Round(s *[16]uint32, m *[16]uint32) {
+	// Mix the columns.
+	blake3G(s, 0, 4, 8, 12, m[0], m[1])
+	blake3G(s, 1, 5, 9, 13, m[2], m[3])
+	blake3G(s, 2, 6, 10, 14, m[4], m[5])
+	blake3G(s, 3, 7, 11, 15, m[6], m[7])
+	// Mix the diagonals.
+	blake3G(s, 0, 5, 10, 15, m[8], m[9])
+	blake3G(s, 1, 6, 11, 12, m[10], m[11])
+	blake3G(s, 2, 7, 8, 13, m[12], m[13])
+	blake3G(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+func blake3Compress(cv [8]uint32, blockWords [16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := blockWords
+	for r := 0; r < 7; r++ {
+		blake3Round(&s, &m)
+		if r < 6 {
+			var permuted [16]uint32
+			for i, j := range blake3MsgPermutation {
+				permuted[i] = m[j]
+			}
+			m = permuted
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func blake3Words(block []byte) [16]uint32 {
+	var padded [blake3BlockLen]byte
+	copy(padded[:], block)
+	var words [16]uint32
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(padded[4*i:])
+	}
+	return words
+}
+
+// A blake3Output is the input to a compression that hasn't been done
+// yet, since it depends on whether it's for the root node.
+type blake3Output struct {
+	cv         [8]uint32
+	blockWords [16]uint32
+	counter    uint64
+	blockLen   uint32
+	flags      uint32
+}
+
+func (o blake3Output) chainingValue() [8]uint32 {
+	var cv [8]uint32
+	s := blake3Compress(o.cv, o.blockWords, o.counter, o.blockLen, o.flags)
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func (o blake3Output) rootBytes() [32]byte {
+	// Only the first output block is needed for 32 bytes.
+	s := blake3Compress(o.cv, o.blockWords, 0, o.blockLen, o.flags|blake3Root)
+	var out [32]byte
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], s[i])
+	}
+	return out
+}
+
+// blake3ChunkOutput compresses all but the last block of chunk,
+// which must be at most blake3ChunkLen bytes long, and returns the
+// output for the last block.
+func blake3ChunkOutput(chunk []byte, chunkCounter uint64) blake3Output {
+	cv := blake3IV
+	var startFlag uint32 = blake3ChunkStart
+	for len(chunk) > blake3BlockLen {
+		s := blake3Compress(cv, blake3Words(chunk[:blake3BlockLen]), chunkCounter, blake3BlockLen, startFlag)
+		copy(cv[:], s[:8])
+		startFlag = 0
+		chunk = chunk[blake3BlockLen:]
+	}
+	return blake3Output{cv, blake3Words(chunk), chunkCounter, uint32(len(chunk)), startFlag | blake3ChunkEnd}
+}
+
+func blake3ParentOutput(left, right [8]uint32) blake3Output {
+	var blockWords [16]uint32
+	copy(blockWords[:8], left[:])
+	copy(blockWords[8:], right[:])
+	return blake3Output{blake3IV, blockWords, 0, blake3BlockLen, blake3Parent}
+}
+
+// blake3Sum256 returns the 32-byte BLAKE3 hash of data.
+func blake3Sum256(data []byte) [32]byte {
+	var cvStack [][8]uint32
+	chunkCounter := uint64(0)
+	for len(data) > blake3ChunkLen {
+		cv := blake3ChunkOutput(data[:blake3ChunkLen], chunkCounter).chainingValue()
+		data = data[blake3ChunkLen:]
+		chunkCounter++
+		// Merge completed subtrees, whose number is given by
+		// the number of trailing zeroes of chunkCounter.
+		for totalChunks := chunkCounter; totalChunks&1 == 0; totalChunks >>= 1 {
+			cv = blake3ParentOutput(cvStack[len(cvStack)-1], cv).chainingValue()
+			cvStack = cvStack[:len(cvStack)-1]
+		}
+		cvStack = append(cvStack, cv)
+	}
+
+	output := blake3ChunkOutput(data, chunkCounter)
+	for i := len(cvStack) - 1; i >= 0; i-- {
+		output = blake3ParentOutput(cvStack[i], output.chainingValue())
+	}
+	return output.rootBytes()
+}
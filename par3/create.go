@@ -0,0 +1,156 @@
+package par3
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec16"
+)
+
+// BlockByteCountDefault is the default value used for
+// CreateOptions.BlockByteCount if the latter is <= 0.
+const BlockByteCountDefault = 2000
+
+// NumParityShardsDefault is the default value used for
+// CreateOptions.NumParityShards if the latter is <= 0.
+const NumParityShardsDefault = 3
+
+// NumGoroutinesDefault returns the default value used for
+// CreateOptions.NumGoRoutines the latter is <= 0.
+func NumGoroutinesDefault() int {
+	return rsec16.DefaultNumGoroutines()
+}
+
+// CreateDelegate is just EncoderDelegate for now.
+type CreateDelegate interface {
+	EncoderDelegate
+}
+
+// DoNothingCreateDelegate is an implementation of CreateDelegate that
+// does nothing for all methods.
+type DoNothingCreateDelegate struct{}
+
+// OnDataFileLoad implements the CreateDelegate interface.
+func (DoNothingCreateDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {
+}
+
+// OnIndexFileWrite implements the CreateDelegate interface.
+func (DoNothingCreateDelegate) OnIndexFileWrite(path string, byteCount int, err error) {
+}
+
+// OnRecoveryFileWrite implements the CreateDelegate interface.
+func (DoNothingCreateDelegate) OnRecoveryFileWrite(start, count, total int, path string, dataByteCount, byteCount int, err error) {
+}
+
+// CreateOptions holds all the options for Create.
+type CreateOptions struct {
+	// How big each input block should be in bytes. If <= 0,
+	// BlockByteCountDefault is used.
+	BlockByteCount int
+	// The number of recovery blocks to create. If <= 0,
+	// NumParityShardsDefault is used.
+	NumParityShards int
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
+	// The CreateDelegate to use. If nil, DoNothingCreateDelegate
+	// is used.
+	CreateDelegate CreateDelegate
+	// The directory that the paths of the data files in the par
+	// file are relative to, which must contain all the data
+	// files. If empty, the directory of parPath is used. Data
+	// files in subdirectories of it are recorded with their
+	// directories.
+	BasePath string
+}
+
+// Create a par file for the given file paths at parPath with the
+// given options.
+func Create(parPath string, filePaths []string, options CreateOptions) error {
+	return create(defaultFileIO{}, parPath, filePaths, options)
+}
+
+// CreateFS is like Create, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the elements of
+// filePaths are names in fsys.
+func CreateFS(fsys fsio.WriteFS, parPath string, filePaths []string, options CreateOptions) error {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	return create(p, p.Path(parPath), p.Paths(filePaths), options)
+}
+
+func checkExtension(parPath string) error {
+	ext := path.Ext(parPath)
+	if ext != ".par3" {
+		return &InvalidArgumentError{"parPath", "must have a .par3 extension"}
+	}
+	return nil
+}
+
+func create(fileIO fileIO, parPath string, filePaths []string, options CreateOptions) error {
+	err := checkExtension(parPath)
+	if err != nil {
+		return err
+	}
+
+	if len(filePaths) == 0 {
+		return &InvalidArgumentError{"filePaths", "must not be empty"}
+	}
+
+	blockByteCount := options.BlockByteCount
+	if blockByteCount <= 0 {
+		blockByteCount = BlockByteCountDefault
+	}
+
+	numParityShards := options.NumParityShards
+	if numParityShards <= 0 {
+		numParityShards = NumParityShardsDefault
+	}
+
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	delegate := options.CreateDelegate
+	if delegate == nil {
+		delegate = DoNothingCreateDelegate{}
+	}
+
+	basePath := options.BasePath
+	if basePath == "" {
+		basePath = filepath.Dir(parPath)
+	}
+	basePath, err = filepath.Abs(basePath)
+	if err != nil {
+		return err
+	}
+	absFilePaths := make([]string, len(filePaths))
+	for i, path := range filePaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		absFilePaths[i] = absPath
+	}
+
+	encoder, err := newEncoder(fileIO, delegate, basePath, absFilePaths, blockByteCount, numParityShards, numGoroutines)
+	if err != nil {
+		return err
+	}
+
+	err = encoder.LoadFileData()
+	if err != nil {
+		return err
+	}
+
+	err = encoder.ComputeParityData()
+	if err != nil {
+		return err
+	}
+
+	return encoder.Write(parPath)
+}
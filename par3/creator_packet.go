@@ -0,0 +1,22 @@
+package par3
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+var creatorPacketType = packetType{'P', 'A', 'R', ' ', 'C', 'R', 'E', '\x00'}
+
+func readCreatorPacket(body []byte) (string, error) {
+	if !utf8.Valid(body) {
+		return "", errors.New("invalid UTF-8 string")
+	}
+	return string(body), nil
+}
+
+func writeCreatorPacket(clientID string) ([]byte, error) {
+	if !utf8.ValidString(clientID) {
+		return nil, errors.New("invalid UTF-8 string")
+	}
+	return []byte(clientID), nil
+}
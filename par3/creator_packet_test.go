@@ -0,0 +1,16 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatorPacketRoundTrip(t *testing.T) {
+	clientID := "some par program"
+	packetBytes, err := writeCreatorPacket(clientID)
+	require.NoError(t, err)
+	roundTripClientID, err := readCreatorPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, clientID, roundTripClientID)
+}
@@ -0,0 +1,46 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var dataPacketType = packetType{'P', 'A', 'R', ' ', 'D', 'A', 'T', '\x00'}
+
+// A dataPacket holds an input block inside a PAR3 file, which may be
+// shorter than the block size, in which case the rest of the block
+// is zero.
+type dataPacket struct {
+	blockIndex int
+	data       []byte
+}
+
+func readDataPacket(body []byte) (dataPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var blockIndex uint64
+	err := binary.Read(buf, binary.LittleEndian, &blockIndex)
+	if err != nil {
+		return dataPacket{}, err
+	}
+
+	maxInt := uint64(^uint(0) >> 1)
+	if blockIndex > maxInt {
+		return dataPacket{}, errors.New("invalid block index")
+	}
+
+	return dataPacket{int(blockIndex), buf.Bytes()}, nil
+}
+
+func writeDataPacket(packet dataPacket) ([]byte, error) {
+	if packet.blockIndex < 0 {
+		return nil, errors.New("invalid block index")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, uint64(packet.blockIndex))
+	_, _ = buf.Write(packet.data)
+	return buf.Bytes(), nil
+}
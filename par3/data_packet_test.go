@@ -0,0 +1,38 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataPacketRoundTrip(t *testing.T) {
+	packet := dataPacket{
+		blockIndex: 7,
+		data:       []byte{0x1, 0x2, 0x3},
+	}
+	packetBytes, err := writeDataPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readDataPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestDataPacketGolden(t *testing.T) {
+	packet := dataPacket{
+		blockIndex: 0x10203,
+		data:       []byte{0xa, 0xb, 0xc, 0xd, 0xe},
+	}
+	expectedBytes := goldenBytes(t,
+		// Input block index.
+		"03 02 01 00 00 00 00 00",
+		// Data.
+		"0a 0b 0c 0d 0e",
+	)
+	packetBytes, err := writeDataPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readDataPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
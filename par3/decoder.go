@@ -0,0 +1,624 @@
+package par3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec16"
+)
+
+type decoderFileInfo struct {
+	// The path of the file relative to the base path, with
+	// slashes as separators.
+	relPath string
+	packet  filePacket
+}
+
+// A Decoder keeps track of all information needed to check the
+// integrity of a set of data files, and possibly repair any
+// missing/corrupt data files from the PAR3 files (that usually end in
+// .par3).
+type Decoder struct {
+	fileIO   fileIO
+	delegate DecoderDelegate
+
+	indexPath string
+	// The directory that the data files are looked up in, which
+	// is the directory of indexPath unless overridden.
+	basePath string
+	// If true, Repair moves damaged data files out of the way
+	// instead of overwriting them, and records their new paths
+	// in backupPaths.
+	keepBackups bool
+	backupPaths []string
+
+	setID          inputSetID
+	indexFile      file
+	blockByteCount int
+	rootChecksum   fingerprint
+	matrixChecksum fingerprint
+	files          []decoderFileInfo
+	blockChecksums []blockChecksum
+
+	numGoroutines int
+
+	// Indexed the same as blockChecksums, with nil for blocks
+	// that are missing or corrupt.
+	blocks [][]byte
+	// Indexed the same as files.
+	damaged []bool
+
+	// Indexed by recovery block index, with nil for missing
+	// recovery blocks.
+	parityShards [][]byte
+	// The paths of the volumes that parityShards was loaded from.
+	parityVolumePaths []string
+}
+
+// DecoderDelegate holds methods that are called during the decode
+// process.
+type DecoderDelegate interface {
+	OnCreatorPacketLoad(clientID string)
+	OnStartPacketLoad(blockByteCount int)
+	OnRecoveryPacketLoad(blockIndex, byteCount int)
+	OnUnknownPacketLoad(packetType [8]byte, byteCount int)
+	OnOtherPacketSkip(setID [8]byte, packetType [8]byte, byteCount int)
+	OnCorruptPacketSkip(offset int, packetType [8]byte, err error)
+	OnDataFileLoad(i, n int, path string, byteCount, hits, misses int, err error)
+	OnParityFileLoad(i int, path string, err error)
+	OnDetectCorruptDataChunk(path string, startByteOffset, endByteOffset int)
+	OnDataFileWrite(i, n int, path string, byteCount int, err error)
+}
+
+// DoNothingDecoderDelegate is an implementation of DecoderDelegate
+// that does nothing for all methods.
+type DoNothingDecoderDelegate struct{}
+
+// OnCreatorPacketLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnCreatorPacketLoad(clientID string) {}
+
+// OnStartPacketLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnStartPacketLoad(blockByteCount int) {}
+
+// OnRecoveryPacketLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnRecoveryPacketLoad(blockIndex, byteCount int) {}
+
+// OnUnknownPacketLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnUnknownPacketLoad(packetType [8]byte, byteCount int) {}
+
+// OnOtherPacketSkip implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnOtherPacketSkip(setID [8]byte, packetType [8]byte, byteCount int) {
+}
+
+// OnCorruptPacketSkip implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnCorruptPacketSkip(offset int, packetType [8]byte, err error) {}
+
+// OnDataFileLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnDataFileLoad(i, n int, path string, byteCount, hits, misses int, err error) {
+}
+
+// OnParityFileLoad implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnParityFileLoad(i int, path string, err error) {}
+
+// OnDetectCorruptDataChunk implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnDetectCorruptDataChunk(path string, startByteOffset, endByteOffset int) {
+}
+
+// OnDataFileWrite implements the DecoderDelegate interface.
+func (DoNothingDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount int, err error) {}
+
+func newDecoder(fileIO fileIO, delegate DecoderDelegate, indexPath string, numGoroutines int) (*Decoder, error) {
+	indexBytes, err := fileIO.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	setID, indexFile, err := readFile(delegate, nil, indexBytes)
+	if err != nil {
+		return nil, withPath(err, indexPath)
+	}
+
+	if indexFile.startPacket == nil {
+		return nil, &MissingPacketError{Path: indexPath, PacketType: startPacketType}
+	}
+
+	if len(indexFile.rootPackets) == 0 {
+		return nil, &MissingPacketError{Path: indexPath, PacketType: rootPacketType}
+	} else if len(indexFile.rootPackets) > 1 {
+		return nil, fmt.Errorf("%s: multiple root packets found", indexPath)
+	}
+	var rootChecksum fingerprint
+	var root rootPacket
+	for checksum, packet := range indexFile.rootPackets {
+		rootChecksum, root = checksum, packet
+	}
+
+	// Check the block count before using it to size anything,
+	// since it comes straight from the file.
+	externalBlockCount := 0
+	for _, packet := range indexFile.externalDataPackets {
+		if end := packet.firstBlockIndex + len(packet.checksums); end > externalBlockCount {
+			externalBlockCount = end
+		}
+	}
+	if root.lowestUnusedBlockIndex > maxBlockCount {
+		return nil, fmt.Errorf("%s: root packet has %d input blocks, more than the maximum of %d", indexPath, root.lowestUnusedBlockIndex, maxBlockCount)
+	} else if root.lowestUnusedBlockIndex > externalBlockCount {
+		return nil, &MissingPacketError{Path: indexPath, PacketType: externalDataPacketType}
+	}
+
+	// Only a single matrix covering all the input blocks is
+	// supported, which is what Encoder writes.
+	var matrixChecksum fingerprint
+	foundMatrix := false
+	for checksum, packet := range indexFile.matrixPackets {
+		if packet.firstBlockIndex == 0 && packet.endBlockIndex == root.lowestUnusedBlockIndex {
+			matrixChecksum = checksum
+			foundMatrix = true
+			break
+		}
+	}
+	if !foundMatrix {
+		return nil, &MissingPacketError{Path: indexPath, PacketType: cauchyMatrixPacketType}
+	}
+
+	blockChecksums := make([]blockChecksum, root.lowestUnusedBlockIndex)
+	hasBlockChecksum := make([]bool, len(blockChecksums))
+	for _, packet := range indexFile.externalDataPackets {
+		for i, checksum := range packet.checksums {
+			blockIndex := packet.firstBlockIndex + i
+			if blockIndex >= len(blockChecksums) {
+				break
+			}
+			blockChecksums[blockIndex] = checksum
+			hasBlockChecksum[blockIndex] = true
+		}
+	}
+	for _, ok := range hasBlockChecksum {
+		if !ok {
+			return nil, &MissingPacketError{Path: indexPath, PacketType: externalDataPacketType}
+		}
+	}
+
+	d := &Decoder{
+		fileIO:         fileIO,
+		delegate:       delegate,
+		indexPath:      indexPath,
+		basePath:       filepath.Dir(indexPath),
+		setID:          setID,
+		indexFile:      indexFile,
+		blockByteCount: indexFile.startPacket.blockByteCount,
+		rootChecksum:   rootChecksum,
+		matrixChecksum: matrixChecksum,
+		blockChecksums: blockChecksums,
+		numGoroutines:  numGoroutines,
+	}
+	err = d.addFiles("", root.children)
+	if err != nil {
+		return nil, withPath(err, indexPath)
+	}
+	return d, nil
+}
+
+// addFiles adds the files in the tree of file and directory packets
+// with the given checksums to d.files, with paths under dir.
+func (d *Decoder) addFiles(dir string, children []fingerprint) error {
+	for _, child := range children {
+		if packet, ok := d.indexFile.filePackets[child]; ok {
+			for _, c := range packet.chunks {
+				if c.firstBlockIndex+c.blockCount(d.blockByteCount) > len(d.blockChecksums) || c.hasTailBlock(d.blockByteCount) && c.tailBlockIndex >= len(d.blockChecksums) {
+					return fmt.Errorf("file packet for %s refers to unknown input blocks", packet.name)
+				}
+			}
+			d.files = append(d.files, decoderFileInfo{path.Join(dir, packet.name), packet})
+		} else if packet, ok := d.indexFile.directoryPackets[child]; ok {
+			// Since packets refer to their children by
+			// checksum, there can't be any cycles.
+			err := d.addFiles(path.Join(dir, packet.name), packet.children)
+			if err != nil {
+				return err
+			}
+		} else {
+			return &MissingPacketError{PacketType: filePacketType, Checksum: child}
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) getFilePath(info decoderFileInfo) string {
+	return filepath.Join(d.basePath, filepath.FromSlash(info.relPath))
+}
+
+// checkFileBlocks checks the blocks and tails of the file described
+// by info against data, which is known to be intact if intact is
+// true, stores the good blocks in d.blocks and the good tails in
+// tailBlocks, and returns the number of good and bad blocks and
+// tails stored in blocks.
+func (d *Decoder) checkFileBlocks(info decoderFileInfo, data []byte, intact bool, tailBlocks map[int][]byte) (int, int) {
+	path := d.getFilePath(info)
+	hits, misses := 0, 0
+	corruptStart, corruptEnd := -1, -1
+	// check records whether data[start:end] is good, and reports
+	// runs of bad bytes to the delegate.
+	check := func(start, end int, good bool) {
+		if !good {
+			if corruptStart < 0 {
+				corruptStart = start
+			}
+			corruptEnd = end
+		} else if corruptStart >= 0 {
+			d.delegate.OnDetectCorruptDataChunk(path, corruptStart, corruptEnd)
+			corruptStart = -1
+		}
+	}
+
+	offset := 0
+	for _, c := range info.packet.chunks {
+		for j := 0; j < c.blockCount(d.blockByteCount); j++ {
+			blockIndex := c.firstBlockIndex + j
+			start := offset + j*d.blockByteCount
+			end := start + d.blockByteCount
+
+			var block []byte
+			if end <= len(data) {
+				block = make([]byte, d.blockByteCount)
+				copy(block, data[start:end])
+				if !intact && computeFingerprint(block) != d.blockChecksums[blockIndex].Fingerprint {
+					block = nil
+				}
+			}
+
+			if block == nil {
+				misses++
+			} else {
+				hits++
+				if d.blocks[blockIndex] == nil {
+					d.blocks[blockIndex] = block
+				}
+			}
+			check(start, end, block != nil)
+		}
+
+		start := offset + c.blockCount(d.blockByteCount)*d.blockByteCount
+		end := offset + c.byteCount
+		if start < end {
+			var tail []byte
+			if end <= len(data) {
+				tail = data[start:end]
+			}
+			if !c.hasTailBlock(d.blockByteCount) {
+				check(start, end, tail != nil && (intact || bytes.Equal(tail, c.tailData)))
+			} else {
+				good := tail != nil && (intact || computeFingerprint(tail) == c.tailChecksum.Fingerprint)
+				if good {
+					hits++
+					tailBlock := tailBlocks[c.tailBlockIndex]
+					if tailBlock == nil {
+						tailBlock = make([]byte, d.blockByteCount)
+						tailBlocks[c.tailBlockIndex] = tailBlock
+					}
+					copy(tailBlock[c.tailByteOffset:], tail)
+				} else {
+					misses++
+				}
+				check(start, end, good)
+			}
+		}
+		offset += c.byteCount
+	}
+	if corruptStart >= 0 {
+		d.delegate.OnDetectCorruptDataChunk(path, corruptStart, corruptEnd)
+	}
+	if len(data) > offset {
+		d.delegate.OnDetectCorruptDataChunk(path, offset, len(data))
+	}
+	return hits, misses
+}
+
+// LoadFileData loads existing file data into memory. Unlike PAR2
+// data files, PAR3 data files are checked block by block at their
+// expected offsets only, so a block that has been moved, e.g. by an
+// insertion, is treated as corrupt. A block holding the tails of
+// several files is usable only if all of those tails are good.
+func (d *Decoder) LoadFileData() error {
+	d.blocks = make([][]byte, len(d.blockChecksums))
+	d.damaged = make([]bool, len(d.files))
+	tailBlocks := make(map[int][]byte)
+	for i, info := range d.files {
+		path := d.getFilePath(info)
+		data, err := d.fileIO.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			d.damaged[i] = true
+			_, misses := d.checkFileBlocks(info, nil, false, tailBlocks)
+			d.delegate.OnDataFileLoad(i+1, len(d.files), path, 0, 0, misses, nil)
+			continue
+		}
+		if err != nil {
+			d.delegate.OnDataFileLoad(i+1, len(d.files), path, len(data), 0, 0, err)
+			return err
+		}
+
+		intact := len(data) == info.packet.byteCount() && computeFingerprint(data) == info.packet.hash
+		d.damaged[i] = !intact
+		hits, misses := d.checkFileBlocks(info, data, intact, tailBlocks)
+		d.delegate.OnDataFileLoad(i+1, len(d.files), path, len(data), hits, misses, nil)
+	}
+
+	for blockIndex, block := range tailBlocks {
+		if d.blocks[blockIndex] == nil && computeFingerprint(block) == d.blockChecksums[blockIndex].Fingerprint {
+			d.blocks[blockIndex] = block
+		}
+	}
+	return nil
+}
+
+type recoveryDelegate struct {
+	DoNothingDecoderDelegate
+	d DecoderDelegate
+}
+
+func (r recoveryDelegate) OnRecoveryPacketLoad(blockIndex, byteCount int) {
+	r.d.OnRecoveryPacketLoad(blockIndex, byteCount)
+}
+
+func (r recoveryDelegate) OnUnknownPacketLoad(packetType [8]byte, byteCount int) {
+	r.d.OnUnknownPacketLoad(packetType, byteCount)
+}
+
+func (r recoveryDelegate) OnCorruptPacketSkip(offset int, packetType [8]byte, err error) {
+	r.d.OnCorruptPacketSkip(offset, packetType, err)
+}
+
+// addParityPackets adds the recovery blocks in f that belong to the
+// input set, and fills in missing input blocks from its data packets.
+func (d *Decoder) addParityPackets(f file) {
+	for _, packet := range f.recoveryPackets {
+		if packet.rootChecksum != d.rootChecksum || packet.matrixChecksum != d.matrixChecksum || len(packet.data) != d.blockByteCount {
+			continue
+		}
+		if packet.blockIndex >= len(d.parityShards) {
+			d.parityShards = append(d.parityShards, make([][]byte, packet.blockIndex+1-len(d.parityShards))...)
+		}
+		d.parityShards[packet.blockIndex] = packet.data
+	}
+
+	for _, packet := range f.dataPackets {
+		if packet.blockIndex >= len(d.blocks) || d.blocks[packet.blockIndex] != nil || len(packet.data) > d.blockByteCount {
+			continue
+		}
+		block := make([]byte, d.blockByteCount)
+		copy(block, packet.data)
+		if computeFingerprint(block) == d.blockChecksums[packet.blockIndex].Fingerprint {
+			d.blocks[packet.blockIndex] = block
+		}
+	}
+}
+
+// findParityVolumes returns the paths of the files next to indexPath
+// that may hold recovery packets for it.
+func findParityVolumes(fileIO fileIO, indexPath string) ([]string, error) {
+	ext := path.Ext(indexPath)
+	base := indexPath[:len(indexPath)-len(ext)]
+	return fileIO.FindWithPrefixAndSuffix(base+".", ext)
+}
+
+// LoadParityData searches for parity volumes and loads them into
+// memory. It must be called after LoadFileData.
+func (d *Decoder) LoadParityData() error {
+	if d.blocks == nil {
+		return errors.New("no file data loaded")
+	}
+
+	matches, err := findParityVolumes(d.fileIO, d.indexPath)
+	if err != nil {
+		return err
+	}
+
+	d.parityShards = nil
+	d.addParityPackets(d.indexFile)
+	var parityVolumePaths []string
+	for i, match := range matches {
+		parityFile, err := func() (*file, error) {
+			volumeBytes, err := d.fileIO.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+
+			// Only recovery and data packets are
+			// needed from parity volumes.
+			_, parityFile, err := readFile(recoveryDelegate{d: d.delegate}, &d.setID, volumeBytes)
+			if _, ok := err.(noPacketsFoundError); ok {
+				return nil, nil
+			} else if err != nil {
+				return nil, withPath(err, match)
+			}
+			return &parityFile, nil
+		}()
+		d.delegate.OnParityFileLoad(i+1, match, err)
+		if err != nil {
+			return err
+		}
+		if parityFile == nil {
+			continue
+		}
+
+		d.addParityPackets(*parityFile)
+		parityVolumePaths = append(parityVolumePaths, match)
+	}
+
+	d.parityVolumePaths = parityVolumePaths
+	return nil
+}
+
+// ShardCounts contains shard counts which can be used to deduce
+// whether repair is necessary and/or possible.
+type ShardCounts struct {
+	// UsableDataShardCount is the number of input blocks that
+	// are usable, i.e. found intact in some data file or in a
+	// data packet.
+	UsableDataShardCount int
+	// UnusableDataShardCount is the number of input blocks that
+	// are unusable, i.e. missing or corrupt everywhere.
+	UnusableDataShardCount int
+
+	// UsableParityShardCount is the number of recovery blocks
+	// that were found.
+	UsableParityShardCount int
+	// UnusableParityShardCount is the number of recovery blocks
+	// below the highest one found that are missing.
+	UnusableParityShardCount int
+
+	// DamagedFileCount is the number of data files that are
+	// missing or don't match their hash.
+	DamagedFileCount int
+}
+
+// RepairNeeded returns whether repair is needed, i.e. whether
+// UnusableDataShardCount or DamagedFileCount is non-zero.
+func (sc ShardCounts) RepairNeeded() bool {
+	return sc.UnusableDataShardCount > 0 || sc.DamagedFileCount > 0
+}
+
+// RepairPossible returns whether repair is possible i.e. whether
+// UsableParityShardCount >= UnusableDataShardCount.
+func (sc ShardCounts) RepairPossible() bool {
+	return sc.UsableParityShardCount >= sc.UnusableDataShardCount
+}
+
+// ShardCounts returns a ShardCounts object for the current shard set.
+func (d *Decoder) ShardCounts() ShardCounts {
+	var sc ShardCounts
+	for _, block := range d.blocks {
+		if block == nil {
+			sc.UnusableDataShardCount++
+		} else {
+			sc.UsableDataShardCount++
+		}
+	}
+	for _, shard := range d.parityShards {
+		if shard == nil {
+			sc.UnusableParityShardCount++
+		} else {
+			sc.UsableParityShardCount++
+		}
+	}
+	for _, damaged := range d.damaged {
+		if damaged {
+			sc.DamagedFileCount++
+		}
+	}
+	return sc
+}
+
+// Repair tries to repair any missing or corrupt data, using the
+// recovery blocks, and rewrites the damaged data files. Returns a
+// list of paths to files that were successfully repaired in no
+// particular order, which is present even if an error is returned.
+// Missing directories aren't recreated.
+func (d *Decoder) Repair() ([]string, error) {
+	if d.ShardCounts().UnusableDataShardCount > 0 {
+		if len(d.parityShards) == 0 {
+			return nil, rsec16.NotEnoughParityShardsError{}
+		}
+
+		coder, err := rsec16.NewCoderCauchy(len(d.blocks), len(d.parityShards), d.numGoroutines)
+		if err != nil {
+			return nil, err
+		}
+
+		err = coder.ReconstructData(d.blocks, d.parityShards)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var repairedPaths []string
+	for i, info := range d.files {
+		if !d.damaged[i] {
+			continue
+		}
+
+		buf := bytes.NewBuffer(nil)
+		for _, c := range info.packet.chunks {
+			for j := 0; j < c.blockCount(d.blockByteCount); j++ {
+				_, _ = buf.Write(d.blocks[c.firstBlockIndex+j])
+			}
+			tail := c.tailData
+			if c.hasTailBlock(d.blockByteCount) {
+				tail = d.blocks[c.tailBlockIndex][c.tailByteOffset : c.tailByteOffset+c.tailByteCount(d.blockByteCount)]
+			}
+			_, _ = buf.Write(tail)
+		}
+
+		path := d.getFilePath(info)
+		data := buf.Bytes()
+		if computeSixteenKHash(data) != info.packet.sixteenKHash {
+			return repairedPaths, &RepairFailedError{path, "hash mismatch (16k) in reconstructed data"}
+		} else if computeFingerprint(data) != info.packet.hash {
+			return repairedPaths, &RepairFailedError{path, "hash mismatch in reconstructed data"}
+		}
+
+		// Keep the metadata of a damaged file, if it exists.
+		fileInfo, err := d.fileIO.StatFile(path)
+		if err != nil {
+			fileInfo = fsio.NewFileInfo(info.packet.name, int64(len(data)), fsio.RestoredFilePerm, time.Now())
+		}
+
+		if d.keepBackups {
+			backupPath, err := fsio.BackUpFile(d.fileIO, path)
+			if err != nil {
+				return repairedPaths, err
+			}
+			if backupPath != "" {
+				d.backupPaths = append(d.backupPaths, backupPath)
+			}
+		}
+
+		err = d.fileIO.WriteFile(path, data)
+		if err == nil {
+			err = d.fileIO.SetFileInfo(path, fileInfo)
+		}
+		d.delegate.OnDataFileWrite(i+1, len(d.files), path, len(data), err)
+		if err != nil {
+			return repairedPaths, err
+		}
+
+		d.damaged[i] = false
+		repairedPaths = append(repairedPaths, path)
+	}
+
+	return repairedPaths, nil
+}
+
+// Purge removes the index file, the parity volumes loaded by
+// LoadParityData, and any backups of damaged data files made by
+// Repair, and returns the paths of the removed files, which is
+// present even if an error is returned. It should be called only
+// once the data files are known to be intact.
+func (d *Decoder) Purge() ([]string, error) {
+	paths := append([]string{d.indexPath}, d.parityVolumePaths...)
+	paths = append(paths, d.backupPaths...)
+
+	return fsio.DeleteFiles(d.fileIO, paths)
+}
+
+// NewDecoder reads the given index file, which usually has a .par3
+// extension.
+func NewDecoder(delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
+	return newDecoder(defaultFileIO{}, delegate, indexFile, numGoroutines)
+}
+
+// NewDecoderFS is like NewDecoder, except that it reads and writes
+// files in fsys instead of the OS file system, and indexFile is a
+// name in fsys. The paths passed to the delegate are under
+// fsio.Root().
+func NewDecoderFS(fsys fs.FS, delegate DecoderDelegate, indexFile string, numGoroutines int) (*Decoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newDecoder(p, delegate, p.Path(indexFile), numGoroutines)
+}
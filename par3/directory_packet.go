@@ -0,0 +1,59 @@
+package par3
+
+import (
+	"bytes"
+)
+
+var directoryPacketType = packetType{'P', 'A', 'R', ' ', 'D', 'I', 'R', '\x00'}
+
+// A directoryPacket describes a directory by its name, which is a
+// single path component, and the checksums of the file and directory
+// packets for its entries.
+type directoryPacket struct {
+	name     string
+	children []fingerprint
+}
+
+func readDirectoryPacket(body []byte) (directoryPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	name, err := readString(buf)
+	if err != nil {
+		return directoryPacket{}, err
+	}
+	err = checkName(name)
+	if err != nil {
+		return directoryPacket{}, err
+	}
+
+	err = skipOptions(buf)
+	if err != nil {
+		return directoryPacket{}, err
+	}
+
+	children, err := readFingerprints(buf)
+	if err != nil {
+		return directoryPacket{}, err
+	}
+
+	return directoryPacket{name, children}, nil
+}
+
+func writeDirectoryPacket(packet directoryPacket) ([]byte, error) {
+	err := checkName(packet.name)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = writeString(buf, packet.name)
+	if err != nil {
+		return nil, err
+	}
+	writeNoOptions(buf)
+	for _, child := range packet.children {
+		// Writes to a bytes.Buffer never fail.
+		_, _ = buf.Write(child[:])
+	}
+	return buf.Bytes(), nil
+}
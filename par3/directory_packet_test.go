@@ -0,0 +1,44 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryPacketRoundTrip(t *testing.T) {
+	packet := directoryPacket{
+		name:     "dir",
+		children: []fingerprint{{0x1}, {0x2}},
+	}
+	packetBytes, err := writeDirectoryPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readDirectoryPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestDirectoryPacketGolden(t *testing.T) {
+	packet := directoryPacket{
+		name: "dir",
+		children: []fingerprint{
+			{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf},
+			{0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf},
+		},
+	}
+	expectedBytes := goldenBytes(t,
+		// Name.
+		"03 00", "64 69 72",
+		// No options.
+		"00",
+		// Checksums of the children.
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+		"b0 b1 b2 b3 b4 b5 b6 b7 b8 b9 ba bb bc bd be bf",
+	)
+	packetBytes, err := writeDirectoryPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readDirectoryPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
@@ -0,0 +1,448 @@
+package par3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akalin/gopar/fsio"
+	"github.com/akalin/gopar/rsec16"
+)
+
+// An Encoder keeps track of all information needed to create recovery
+// blocks for a set of data files, and write them out to PAR3 files
+// (that usually end in .par3).
+type Encoder struct {
+	fileIO   fileIO
+	delegate EncoderDelegate
+
+	basePath string
+	// The paths of the data files relative to basePath, with
+	// slashes as separators.
+	relFilePaths []string
+
+	blockByteCount   int
+	parityShardCount int
+	numGoroutines    int
+
+	// The distinct input blocks of the data files, each padded to
+	// blockByteCount, indexed by block index.
+	blocks         [][]byte
+	blockChecksums []blockChecksum
+	// Indexed the same as relFilePaths.
+	filePackets []filePacket
+
+	parityShards [][]byte
+}
+
+// EncoderDelegate holds methods that are called during the encode
+// process.
+type EncoderDelegate interface {
+	OnDataFileLoad(i, n int, path string, byteCount int, err error)
+	OnIndexFileWrite(path string, byteCount int, err error)
+	OnRecoveryFileWrite(start, count, total int, path string, dataByteCount, byteCount int, err error)
+}
+
+func newEncoder(fileIO fileIO, delegate EncoderDelegate, basePath string, filePaths []string, blockByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
+	if !filepath.IsAbs(basePath) {
+		return nil, &InvalidArgumentError{"basePath", "must be absolute"}
+	}
+
+	relFilePaths := make([]string, len(filePaths))
+	seen := make(map[string]bool)
+	for i, path := range filePaths {
+		if !filepath.IsAbs(path) {
+			return nil, &InvalidArgumentError{"filePaths", "must all be absolute"}
+		}
+		relPath, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return nil, err
+		}
+		relPath = filepath.ToSlash(relPath)
+		for _, name := range strings.Split(relPath, "/") {
+			if checkName(name) != nil {
+				return nil, &InvalidArgumentError{"filePaths", "must all lie in basePath"}
+			}
+		}
+		if seen[relPath] {
+			return nil, &InvalidArgumentError{"filePaths", "must not contain duplicates"}
+		}
+		seen[relPath] = true
+		relFilePaths[i] = relPath
+	}
+
+	if checkBlockByteCount(uint64(blockByteCount)) != nil {
+		return nil, &InvalidArgumentError{"blockByteCount", "must be a positive multiple of 4"}
+	}
+	if parityShardCount <= 0 {
+		return nil, &InvalidArgumentError{"parityShardCount", "must be positive"}
+	}
+	return &Encoder{fileIO, delegate, basePath, relFilePaths, blockByteCount, parityShardCount, numGoroutines, nil, nil, nil, nil}, nil
+}
+
+// NewEncoder creates an encoder with the given list of file paths,
+// and with the given number of recovery blocks. basePath must be
+// absolute. Elements of filePaths must be absolute, and must also lie
+// in basePath.
+func NewEncoder(delegate EncoderDelegate, basePath string, filePaths []string, blockByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
+	return newEncoder(defaultFileIO{}, delegate, basePath, filePaths, blockByteCount, parityShardCount, numGoroutines)
+}
+
+// NewEncoderFS is like NewEncoder, except that it reads and writes
+// files in fsys instead of the OS file system. basePath and the
+// elements of filePaths are names in fsys. The paths passed to the
+// delegate are under fsio.Root(), and so must be the path passed to
+// Write, e.g. as returned by fsio.PathFS.Path.
+func NewEncoderFS(fsys fsio.WriteFS, delegate EncoderDelegate, basePath string, filePaths []string, blockByteCount, parityShardCount, numGoroutines int) (*Encoder, error) {
+	p := fsio.PathFS{FS: fsys}
+	return newEncoder(p, delegate, p.Path(basePath), p.Paths(filePaths), blockByteCount, parityShardCount, numGoroutines)
+}
+
+// A tailPacker packs the tails of chunks into shared input blocks.
+type tailPacker struct {
+	// The index of the input block being filled, or -1 if
+	// there's none yet, and the offset of its unused part.
+	blockIndex int
+	byteOffset int
+	// The locations of the tails packed so far, so that
+	// identical tails are stored only once.
+	locations map[blockChecksum][2]int
+	// The indices of all the input blocks holding tails, whose
+	// checksums can be computed only once they're full.
+	blockIndices []int
+}
+
+// packTail stores tail in an input block, starting a new one if it
+// doesn't fit in the current one, and returns the index of that
+// block and the offset of tail in it.
+func (e *Encoder) packTail(p *tailPacker, tail []byte, checksum blockChecksum) (int, int) {
+	if location, ok := p.locations[checksum]; ok {
+		return location[0], location[1]
+	}
+
+	if p.blockIndex < 0 || p.byteOffset+len(tail) > e.blockByteCount {
+		p.blockIndex = len(e.blocks)
+		p.byteOffset = 0
+		p.blockIndices = append(p.blockIndices, p.blockIndex)
+		e.blocks = append(e.blocks, make([]byte, e.blockByteCount))
+		e.blockChecksums = append(e.blockChecksums, blockChecksum{})
+	}
+
+	blockIndex, byteOffset := p.blockIndex, p.byteOffset
+	copy(e.blocks[blockIndex][byteOffset:], tail)
+	p.byteOffset += len(tail)
+	p.locations[checksum] = [2]int{blockIndex, byteOffset}
+	return blockIndex, byteOffset
+}
+
+// addFileData splits data into whole blocks, adds the ones that
+// haven't been seen before, stores the rest as the tail of the last
+// chunk, and returns the chunks that describe data in terms of block
+// indices.
+func (e *Encoder) addFileData(data []byte, blockIndices map[blockChecksum]int, p *tailPacker) []chunkDescription {
+	var chunks []chunkDescription
+	tailStart := len(data) - len(data)%e.blockByteCount
+	for start := 0; start < tailStart; start += e.blockByteCount {
+		block := make([]byte, e.blockByteCount)
+		copy(block, data[start:])
+
+		checksum := computeBlockChecksum(block)
+		blockIndex, ok := blockIndices[checksum]
+		if !ok {
+			blockIndex = len(e.blocks)
+			blockIndices[checksum] = blockIndex
+			e.blocks = append(e.blocks, block)
+			e.blockChecksums = append(e.blockChecksums, checksum)
+		}
+
+		if len(chunks) > 0 {
+			last := &chunks[len(chunks)-1]
+			if last.firstBlockIndex+last.blockCount(e.blockByteCount) == blockIndex {
+				last.byteCount += e.blockByteCount
+				continue
+			}
+		}
+		chunks = append(chunks, chunkDescription{byteCount: e.blockByteCount, firstBlockIndex: blockIndex})
+	}
+
+	tail := data[tailStart:]
+	if len(tail) == 0 {
+		return chunks
+	}
+
+	if len(chunks) == 0 {
+		chunks = append(chunks, chunkDescription{})
+	}
+	last := &chunks[len(chunks)-1]
+	last.byteCount += len(tail)
+	if len(tail) < inlineTailByteCount {
+		last.tailData = append([]byte(nil), tail...)
+	} else {
+		last.tailChecksum = computeTailChecksum(tail)
+		last.tailBlockIndex, last.tailByteOffset = e.packTail(p, tail, last.tailChecksum)
+	}
+	return chunks
+}
+
+// LoadFileData loads the file data into memory, splitting it into
+// input blocks, storing identical blocks only once, and packing the
+// tails of files into shared blocks.
+func (e *Encoder) LoadFileData() error {
+	blockIndices := make(map[blockChecksum]int)
+	p := tailPacker{blockIndex: -1, locations: make(map[blockChecksum][2]int)}
+	e.blocks = nil
+	e.blockChecksums = nil
+	e.filePackets = make([]filePacket, len(e.relFilePaths))
+	for i, relPath := range e.relFilePaths {
+		filePath := filepath.Join(e.basePath, filepath.FromSlash(relPath))
+		data, err := e.fileIO.ReadFile(filePath)
+		e.delegate.OnDataFileLoad(i+1, len(e.relFilePaths), filePath, len(data), err)
+		if err != nil {
+			return err
+		}
+
+		e.filePackets[i] = filePacket{
+			name:         path.Base(relPath),
+			sixteenKHash: computeSixteenKHash(data),
+			hash:         computeFingerprint(data),
+			chunks:       e.addFileData(data, blockIndices, &p),
+		}
+	}
+
+	for _, blockIndex := range p.blockIndices {
+		e.blockChecksums[blockIndex] = computeBlockChecksum(e.blocks[blockIndex])
+	}
+
+	if len(e.blocks) == 0 {
+		return &InvalidArgumentError{"filePaths", "must contain at least one file of at least 40 bytes"}
+	}
+	return nil
+}
+
+// ComputeParityData computes the recovery blocks for the input
+// blocks.
+func (e *Encoder) ComputeParityData() error {
+	if len(e.blocks) == 0 {
+		return errors.New("no file data loaded")
+	}
+
+	coder, err := rsec16.NewCoderCauchy(len(e.blocks), e.parityShardCount, e.numGoroutines)
+	if err != nil {
+		return err
+	}
+
+	e.parityShards = coder.GenerateParity(e.blocks)
+	return nil
+}
+
+const clientID = "gopar"
+
+// A dirNode is a directory in the tree of data files that Write
+// builds to write the file, directory, and root packets.
+type dirNode struct {
+	dirs  map[string]*dirNode
+	files map[string]filePacket
+}
+
+func newDirNode() *dirNode {
+	return &dirNode{make(map[string]*dirNode), make(map[string]filePacket)}
+}
+
+// packetWriter accumulates packets for a single input set.
+type packetWriter struct {
+	setID          inputSetID
+	blockByteCount int
+	buf            bytes.Buffer
+}
+
+func (w *packetWriter) write(packetType packetType, body []byte, err error) (fingerprint, error) {
+	if err != nil {
+		return fingerprint{}, err
+	}
+	return writeNextPacket(&w.buf, w.setID, packetType, body)
+}
+
+// writeChildren writes the packets for the entries of n, with
+// children before their parents, and returns the checksums of the
+// packets for its entries in order of name.
+func (w *packetWriter) writeChildren(n *dirNode) ([]fingerprint, error) {
+	names := make([]string, 0, len(n.dirs)+len(n.files))
+	for name := range n.dirs {
+		names = append(names, name)
+	}
+	for name := range n.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var children []fingerprint
+	for _, name := range names {
+		var checksum fingerprint
+		var err error
+		if dir, ok := n.dirs[name]; ok {
+			var grandchildren []fingerprint
+			grandchildren, err = w.writeChildren(dir)
+			if err != nil {
+				return nil, err
+			}
+			body, bodyErr := writeDirectoryPacket(directoryPacket{name, grandchildren})
+			checksum, err = w.write(directoryPacketType, body, bodyErr)
+		} else {
+			body, bodyErr := writeFilePacket(n.files[name], w.blockByteCount)
+			checksum, err = w.write(filePacketType, body, bodyErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, checksum)
+	}
+	return children, nil
+}
+
+// writeCriticalPackets returns the bytes of the packets needed to
+// verify the data files, which every PAR3 file written by Write
+// starts with, along with the input set ID and the checksums of the
+// root and matrix packets, which recovery packets refer to.
+func (e *Encoder) writeCriticalPackets() ([]byte, inputSetID, fingerprint, fingerprint, error) {
+	startBody, err := writeStartPacket(startPacket{blockByteCount: e.blockByteCount})
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	w := packetWriter{setID: computeInputSetID(startBody), blockByteCount: e.blockByteCount}
+
+	root := newDirNode()
+	for i, relPath := range e.relFilePaths {
+		n := root
+		components := strings.Split(relPath, "/")
+		for _, name := range components[:len(components)-1] {
+			child, ok := n.dirs[name]
+			if !ok {
+				if _, ok := n.files[name]; ok {
+					return nil, inputSetID{}, fingerprint{}, fingerprint{}, fmt.Errorf("%s is both a file and a directory", name)
+				}
+				child = newDirNode()
+				n.dirs[name] = child
+			}
+			n = child
+		}
+		if _, ok := n.dirs[e.filePackets[i].name]; ok {
+			return nil, inputSetID{}, fingerprint{}, fingerprint{}, fmt.Errorf("%s is both a file and a directory", relPath)
+		}
+		n.files[e.filePackets[i].name] = e.filePackets[i]
+	}
+
+	creatorBody, err := writeCreatorPacket(clientID)
+	_, err = w.write(creatorPacketType, creatorBody, err)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	_, err = w.write(startPacketType, startBody, nil)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	matrixBody, err := writeCauchyMatrixPacket(cauchyMatrixPacket{0, len(e.blocks), e.parityShardCount})
+	matrixChecksum, err := w.write(cauchyMatrixPacketType, matrixBody, err)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	externalDataBody, err := writeExternalDataPacket(externalDataPacket{0, e.blockChecksums})
+	_, err = w.write(externalDataPacketType, externalDataBody, err)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	children, err := w.writeChildren(root)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	rootBody, err := writeRootPacket(rootPacket{len(e.blocks), children})
+	rootChecksum, err := w.write(rootPacketType, rootBody, err)
+	if err != nil {
+		return nil, inputSetID{}, fingerprint{}, fingerprint{}, err
+	}
+	return w.buf.Bytes(), w.setID, rootChecksum, matrixChecksum, nil
+}
+
+// recoveryFileShardCounts returns the number of recovery blocks in
+// each recovery file, which doubles from one file to the next, like
+// par2cmdline's default.
+func recoveryFileShardCounts(parityShardCount int) []int {
+	var counts []int
+	for count := 1; parityShardCount > 0; count *= 2 {
+		if count > parityShardCount {
+			count = parityShardCount
+		}
+		counts = append(counts, count)
+		parityShardCount -= count
+	}
+	return counts
+}
+
+// Write writes the index file and the recovery files next to
+// indexPath. The recovery files are written first and the index file
+// last, so that a failure never replaces the index file of an
+// existing set, and if writing any of them fails, the ones already
+// written that didn't exist before are removed.
+func (e *Encoder) Write(indexPath string) (err error) {
+	criticalBytes, setID, rootChecksum, matrixChecksum, err := e.writeCriticalPackets()
+	if err != nil {
+		return err
+	}
+
+	ext := path.Ext(indexPath)
+	base := indexPath[:len(indexPath)-len(ext)]
+
+	// Don't leave a partial set of files behind if writing one
+	// of them fails, but don't remove files that belong to an
+	// existing set, either.
+	var createdPaths []string
+	defer func() {
+		if err != nil {
+			for _, path := range createdPaths {
+				_ = e.fileIO.DeleteFile(path)
+			}
+		}
+	}()
+	writeFile := func(path string, data []byte) error {
+		_, statErr := e.fileIO.StatFile(path)
+		existed := statErr == nil
+		err := e.fileIO.WriteFile(path, data)
+		if err == nil && !existed {
+			createdPaths = append(createdPaths, path)
+		}
+		return err
+	}
+
+	i := 0
+	for _, volumeCount := range recoveryFileShardCounts(e.parityShardCount) {
+		buf := bytes.NewBuffer(nil)
+		_, _ = buf.Write(criticalBytes)
+		for j, parityShard := range e.parityShards[i : i+volumeCount] {
+			body, err := writeRecoveryPacket(recoveryPacket{rootChecksum, matrixChecksum, i + j, parityShard})
+			if err != nil {
+				return err
+			}
+			// Writes to a bytes.Buffer never fail.
+			_, _ = writeNextPacket(buf, setID, recoveryPacketType, body)
+		}
+
+		// TODO: Figure out how to handle when either i or
+		// volumeCount is >= 100.
+		filename := fmt.Sprintf("%s.vol%02d+%02d.par3", base, i, volumeCount)
+		err = writeFile(filename, buf.Bytes())
+		e.delegate.OnRecoveryFileWrite(i, volumeCount, e.parityShardCount, filename, buf.Len()-len(criticalBytes), buf.Len(), err)
+		if err != nil {
+			return err
+		}
+
+		i += volumeCount
+	}
+
+	filename := base + ".par3"
+	err = writeFile(filename, criticalBytes)
+	e.delegate.OnIndexFileWrite(filename, len(criticalBytes), err)
+	return err
+}
@@ -0,0 +1,169 @@
+package par3
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/akalin/gopar/rsec16"
+	"github.com/stretchr/testify/require"
+)
+
+type testEncoderDelegate struct {
+	t *testing.T
+}
+
+func (d testEncoderDelegate) OnDataFileLoad(i, n int, path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnDataFileLoad(%d, %d, byteCount=%d, %s, %v)", i, n, byteCount, path, err)
+}
+
+func (d testEncoderDelegate) OnIndexFileWrite(path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnIndexFileWrite(%s, %d, %v)", path, byteCount, err)
+}
+
+func (d testEncoderDelegate) OnRecoveryFileWrite(start, count, total int, path string, dataByteCount, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnRecoveryFileWrite(start=%d, count=%d, total=%d, %s, dataByteCount=%d, byteCount=%d, %v)", start, count, total, path, dataByteCount, byteCount, err)
+}
+
+func newEncoderForTest(t *testing.T, fs memfs.MemFS, basePath string, paths []string, blockByteCount, parityShardCount int) (*Encoder, error) {
+	return newEncoder(fs, testEncoderDelegate{t}, basePath, paths, blockByteCount, parityShardCount, rsec16.DefaultNumGoroutines())
+}
+
+func TestEncoderLoadFileDataDeduplicates(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"a.bin":                       {0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9},
+		filepath.Join("dir", "b.bin"): {0x5, 0x6, 0x7, 0x8, 0x1, 0x2, 0x3, 0x4, 0x1, 0x2, 0x3, 0x4},
+		"empty.bin":                   {},
+	})
+	paths := []string{
+		filepath.Join(workingDir, "a.bin"),
+		filepath.Join(workingDir, "dir", "b.bin"),
+		filepath.Join(workingDir, "empty.bin"),
+	}
+	encoder, err := newEncoderForTest(t, fs, workingDir, paths, 4, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.bin", "dir/b.bin", "empty.bin"}, encoder.relFilePaths)
+
+	err = encoder.LoadFileData()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{
+		{0x1, 0x2, 0x3, 0x4},
+		{0x5, 0x6, 0x7, 0x8},
+	}, encoder.blocks)
+	// The 1-byte tail of a.bin is short enough to be stored in
+	// its chunk description.
+	require.Equal(t, []chunkDescription{{byteCount: 9, firstBlockIndex: 0, tailData: []byte{0x9}}}, encoder.filePackets[0].chunks)
+	require.Equal(t, []chunkDescription{
+		{byteCount: 4, firstBlockIndex: 1},
+		{byteCount: 4, firstBlockIndex: 0},
+		{byteCount: 4, firstBlockIndex: 0},
+	}, encoder.filePackets[1].chunks)
+	require.Equal(t, "b.bin", encoder.filePackets[1].name)
+	require.Empty(t, encoder.filePackets[2].chunks)
+}
+
+func TestEncoderLoadFileDataPacksTails(t *testing.T) {
+	data := func(n int, seed byte) []byte {
+		bs := make([]byte, n)
+		for i := range bs {
+			bs[i] = byte(i) ^ seed
+		}
+		return bs
+	}
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"a.bin": data(60, 0x1),
+		"b.bin": data(150, 0x2),
+		"c.bin": data(40, 0x3),
+		"d.bin": data(60, 0x1),
+	})
+	var paths []string
+	for _, name := range []string{"a.bin", "b.bin", "c.bin", "d.bin"} {
+		paths = append(paths, filepath.Join(workingDir, name))
+	}
+	encoder, err := newEncoderForTest(t, fs, workingDir, paths, 100, 2)
+	require.NoError(t, err)
+
+	err = encoder.LoadFileData()
+	require.NoError(t, err)
+	// The tail of b.bin doesn't fit in the block holding the
+	// tail of a.bin, but the tail of c.bin fits after it, and
+	// d.bin is the same as a.bin, so it shares its tail.
+	require.Equal(t, 3, len(encoder.blocks))
+	tail := func(i, blockIndex, byteOffset int) {
+		c := encoder.filePackets[i].chunks[len(encoder.filePackets[i].chunks)-1]
+		require.Equal(t, blockIndex, c.tailBlockIndex, i)
+		require.Equal(t, byteOffset, c.tailByteOffset, i)
+		n := c.tailByteCount(100)
+		require.Equal(t, computeTailChecksum(encoder.blocks[blockIndex][byteOffset:byteOffset+n]), c.tailChecksum, i)
+	}
+	tail(0, 0, 0)
+	tail(1, 2, 0)
+	tail(2, 2, 50)
+	tail(3, 0, 0)
+	require.Equal(t, []chunkDescription{{
+		byteCount:       150,
+		firstBlockIndex: 1,
+		tailChecksum:    encoder.filePackets[1].chunks[0].tailChecksum,
+		tailBlockIndex:  2,
+	}}, encoder.filePackets[1].chunks)
+	for i, block := range encoder.blocks {
+		require.Equal(t, computeBlockChecksum(block), encoder.blockChecksums[i], i)
+	}
+}
+
+func TestEncoderInvalidPaths(t *testing.T) {
+	workingDir := filepath.Join(memfs.RootDir(), "dir")
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{"a.bin": {0x1}})
+	for _, paths := range [][]string{
+		{filepath.Join(memfs.RootDir(), "a.bin")},
+		{filepath.Join(workingDir, "a.bin"), filepath.Join(workingDir, "a.bin")},
+	} {
+		_, err := newEncoderForTest(t, fs, workingDir, paths, 4, 2)
+		_, ok := err.(*InvalidArgumentError)
+		require.True(t, ok, "%v", err)
+	}
+}
+
+// failingWriteFileIO is a fileIO whose WriteFile fails for
+// failingPath.
+type failingWriteFileIO struct {
+	fileIO
+	failingPath string
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (io failingWriteFileIO) WriteFile(path string, data []byte) error {
+	if path == io.failingPath {
+		return errWriteFailed
+	}
+	return io.fileIO.WriteFile(path, data)
+}
+
+func TestEncoderWriteKeepExistingIndexFileOnError(t *testing.T) {
+	workingDir := memfs.RootDir()
+	fs := memfs.MakeMemFS(workingDir, map[string][]byte{
+		"a.bin": {0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9},
+	})
+	indexPath := filepath.Join(workingDir, "parity.par3")
+	oldIndexData := []byte("old index file")
+	require.NoError(t, fs.WriteFile(indexPath, oldIndexData))
+	paths := fs.Paths()
+	fileIO := failingWriteFileIO{fs, filepath.Join(workingDir, "parity.vol01+02.par3")}
+	encoder, err := newEncoder(fileIO, testEncoderDelegate{t}, workingDir, []string{filepath.Join(workingDir, "a.bin")}, 4, 3, rsec16.DefaultNumGoroutines())
+	require.NoError(t, err)
+
+	require.NoError(t, encoder.LoadFileData())
+	require.NoError(t, encoder.ComputeParityData())
+	require.Equal(t, errWriteFailed, encoder.Write(indexPath))
+	require.ElementsMatch(t, paths, fs.Paths())
+	data, err := fs.ReadFile(indexPath)
+	require.NoError(t, err)
+	require.Equal(t, oldIndexData, data)
+}
@@ -0,0 +1,174 @@
+package par3
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/akalin/gopar/rsec16"
+)
+
+func packetTypeName(packetType [8]byte) string {
+	switch packetType {
+	case creatorPacketType:
+		return "creator"
+	case startPacketType:
+		return "start"
+	case cauchyMatrixPacketType:
+		return "Cauchy matrix"
+	case dataPacketType:
+		return "data"
+	case recoveryPacketType:
+		return "recovery"
+	case externalDataPacketType:
+		return "external data"
+	case filePacketType:
+		return "file"
+	case directoryPacketType:
+		return "directory"
+	case rootPacketType:
+		return "root"
+	}
+	return fmt.Sprintf("%q", packetType[:])
+}
+
+// A PacketError is returned when a packet in a par file is invalid.
+type PacketError struct {
+	// Path is the path of the par file, or empty if the bytes of
+	// the file were read from somewhere else.
+	Path string
+	// Offset is the byte offset of the packet in the file.
+	Offset int
+	// PacketType is the type of the packet.
+	PacketType [8]byte
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *PacketError) Error() string {
+	var location string
+	if e.Path != "" {
+		location = e.Path + ": "
+	}
+	return fmt.Sprintf("%s%s packet at offset %d: %s", location, packetTypeName(e.PacketType), e.Offset, e.Err)
+}
+
+// Unwrap returns e.Err.
+func (e *PacketError) Unwrap() error {
+	return e.Err
+}
+
+// A MissingPacketError is returned when a par file doesn't contain a
+// packet that's needed.
+type MissingPacketError struct {
+	// Path is the path of the par file.
+	Path string
+	// PacketType is the type of the missing packet.
+	PacketType [8]byte
+	// Checksum is the checksum of the missing packet, or all
+	// zeroes if it isn't referred to by another packet.
+	Checksum [16]byte
+}
+
+func (e *MissingPacketError) Error() string {
+	var location, withChecksum string
+	if e.Path != "" {
+		location = e.Path + ": "
+	}
+	if e.Checksum != ([16]byte{}) {
+		withChecksum = fmt.Sprintf(" with checksum %x", e.Checksum)
+	}
+	return fmt.Sprintf("%sno %s packet found%s", location, packetTypeName(e.PacketType), withChecksum)
+}
+
+// withPath fills in the path of err if it's a PacketError or a
+// MissingPacketError without one.
+func withPath(err error, path string) error {
+	var packetErr *PacketError
+	if errors.As(err, &packetErr) && packetErr.Path == "" {
+		packetErr.Path = path
+	}
+	var missingPacketErr *MissingPacketError
+	if errors.As(err, &missingPacketErr) && missingPacketErr.Path == "" {
+		missingPacketErr.Path = path
+	}
+	return err
+}
+
+// An InvalidArgumentError is returned when an argument passed into a
+// function is invalid.
+type InvalidArgumentError struct {
+	// Arg is the name of the argument, e.g. "parPath".
+	Arg string
+	// Problem describes what's wrong with the argument, e.g.
+	// "must have a .par3 extension".
+	Problem string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return e.Arg + " " + e.Problem
+}
+
+// A RepairFailedError is returned when repaired data fails a
+// consistency check, which means that the par files or the repair
+// itself are faulty.
+type RepairFailedError struct {
+	// Path is the path of the file whose repaired data failed
+	// the check.
+	Path string
+	// Problem describes the failed check.
+	Problem string
+}
+
+func (e *RepairFailedError) Error() string {
+	return fmt.Sprintf("repair of %s failed: %s", e.Path, e.Problem)
+}
+
+// exitCodeForErrorPar2CmdLine handles the errors common to all
+// commands for the ExitCodeFor*ErrorPar2CmdLine functions.
+func exitCodeForErrorPar2CmdLine(err error) int {
+	var invalidArgumentErr *InvalidArgumentError
+	var pathErr *fs.PathError
+	var packetErr *PacketError
+	var missingPacketErr *MissingPacketError
+	switch {
+	case err == nil:
+		return par2cmdline.ExitSuccess
+	case errors.As(err, &invalidArgumentErr):
+		return par2cmdline.ExitInvalidCommandLineArguments
+	case errors.As(err, &packetErr), errors.As(err, &missingPacketErr):
+		return par2cmdline.ExitInsufficientCriticalData
+	case errors.As(err, &pathErr), errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return par2cmdline.ExitFileIOError
+	}
+	return par2cmdline.ExitLogicError
+}
+
+// ExitCodeForCreateErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Create.
+func ExitCodeForCreateErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForVerifyErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Verify. Note that a nil error doesn't mean that no repair is
+// needed; that has to be deduced from VerifyResult.ShardCounts.
+func ExitCodeForVerifyErrorPar2CmdLine(err error) int {
+	return exitCodeForErrorPar2CmdLine(err)
+}
+
+// ExitCodeForRepairErrorPar2CmdLine returns the error code
+// par2cmdline would have returned for the given error returned by
+// Repair.
+func ExitCodeForRepairErrorPar2CmdLine(err error) int {
+	var repairFailedErr *RepairFailedError
+	if errors.As(err, &rsec16.NotEnoughParityShardsError{}) {
+		return par2cmdline.ExitRepairNotPossible
+	} else if errors.As(err, &repairFailedErr) {
+		return par2cmdline.ExitRepairFailed
+	}
+	return exitCodeForErrorPar2CmdLine(err)
+}
@@ -0,0 +1,72 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+)
+
+var externalDataPacketType = packetType{'P', 'A', 'R', ' ', 'E', 'X', 'T', '\x00'}
+
+var crc64Table = crc64.MakeTable(crc64.ISO)
+
+// A blockChecksum holds the checksums of an input block, padded with
+// zeroes to the block size: a CRC-64, which can be rolled, and a
+// fingerprint.
+type blockChecksum struct {
+	RollingHash uint64
+	Fingerprint fingerprint
+}
+
+func computeBlockChecksum(block []byte) blockChecksum {
+	return blockChecksum{crc64.Checksum(block, crc64Table), computeFingerprint(block)}
+}
+
+// An externalDataPacket holds the checksums of consecutive input
+// blocks, starting at firstBlockIndex, which are stored outside of
+// PAR3 files, i.e. in the files being protected.
+type externalDataPacket struct {
+	firstBlockIndex int
+	checksums       []blockChecksum
+}
+
+func readExternalDataPacket(body []byte) (externalDataPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var firstBlockIndex uint64
+	err := binary.Read(buf, binary.LittleEndian, &firstBlockIndex)
+	if err != nil {
+		return externalDataPacket{}, err
+	}
+
+	checksumSize := binary.Size(blockChecksum{})
+	if buf.Len()%checksumSize != 0 {
+		return externalDataPacket{}, errors.New("invalid size")
+	}
+
+	maxInt := uint64(^uint(0) >> 1)
+	if firstBlockIndex > maxInt-uint64(buf.Len()/checksumSize) {
+		return externalDataPacket{}, errors.New("invalid block index")
+	}
+
+	checksums := make([]blockChecksum, buf.Len()/checksumSize)
+	err = binary.Read(buf, binary.LittleEndian, checksums)
+	if err != nil {
+		return externalDataPacket{}, err
+	}
+
+	return externalDataPacket{int(firstBlockIndex), checksums}, nil
+}
+
+func writeExternalDataPacket(packet externalDataPacket) ([]byte, error) {
+	if packet.firstBlockIndex < 0 {
+		return nil, errors.New("invalid block index")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, uint64(packet.firstBlockIndex))
+	_ = binary.Write(buf, binary.LittleEndian, packet.checksums)
+	return buf.Bytes(), nil
+}
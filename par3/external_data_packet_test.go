@@ -0,0 +1,47 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalDataPacketRoundTrip(t *testing.T) {
+	packet := externalDataPacket{
+		firstBlockIndex: 2,
+		checksums: []blockChecksum{
+			computeBlockChecksum([]byte{0x1, 0x2, 0x3, 0x4}),
+			computeBlockChecksum([]byte{0x5, 0x6, 0x7, 0x8}),
+		},
+	}
+	packetBytes, err := writeExternalDataPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readExternalDataPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestExternalDataPacketGolden(t *testing.T) {
+	packet := externalDataPacket{
+		firstBlockIndex: 0x102,
+		checksums: []blockChecksum{
+			{0x0102030405060708, fingerprint{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf}},
+			{0x1112131415161718, fingerprint{0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf}},
+		},
+	}
+	expectedBytes := goldenBytes(t,
+		// Index of the first input block.
+		"02 01 00 00 00 00 00 00",
+		// CRC-64 and hash of each input block.
+		"08 07 06 05 04 03 02 01",
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+		"18 17 16 15 14 13 12 11",
+		"b0 b1 b2 b3 b4 b5 b6 b7 b8 b9 ba bb bc bd be bf",
+	)
+	packetBytes, err := writeExternalDataPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readExternalDataPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
@@ -0,0 +1,177 @@
+package par3
+
+import (
+	"bytes"
+	"io"
+)
+
+// A file holds the packets read from a PAR3 file that belong to a
+// particular input set.
+type file struct {
+	clientID            string
+	startPacket         *startPacket
+	matrixPackets       map[fingerprint]cauchyMatrixPacket
+	externalDataPackets []externalDataPacket
+	filePackets         map[fingerprint]filePacket
+	directoryPackets    map[fingerprint]directoryPacket
+	rootPackets         map[fingerprint]rootPacket
+	dataPackets         []dataPacket
+	recoveryPackets     []recoveryPacket
+}
+
+// A pendingPacket is a packet that can be parsed only once all the
+// packets of a file have been read.
+type pendingPacket struct {
+	offset   int
+	body     []byte
+	checksum fingerprint
+}
+
+type noPacketsFoundError struct{}
+
+func (noPacketsFoundError) Error() string {
+	return "no packets found"
+}
+
+// readFile reads the packets in fileBytes with the given input set
+// ID, or the ID of the first packet if expectedSetID is nil. Unlike
+// PAR2, PAR3 files may be damaged, so packets that fail their
+// checksum are skipped, and reading resumes at the next packet. A
+// packet that passes its checksum but can't be parsed is still an
+// error, though. File packets are parsed only if there's a start
+// packet, since their layout depends on the block size.
+func readFile(delegate DecoderDelegate, expectedSetID *inputSetID, fileBytes []byte) (inputSetID, file, error) {
+	buf := bytes.NewBuffer(fileBytes)
+
+	var setID inputSetID
+	var hasSetID bool
+	if expectedSetID != nil {
+		setID = *expectedSetID
+		hasSetID = true
+	}
+
+	var foundPacket bool
+	var filePackets []pendingPacket
+	f := file{
+		matrixPackets:    make(map[fingerprint]cauchyMatrixPacket),
+		filePackets:      make(map[fingerprint]filePacket),
+		directoryPackets: make(map[fingerprint]directoryPacket),
+		rootPackets:      make(map[fingerprint]rootPacket),
+	}
+	for buf.Len() > 0 {
+		offset := len(fileBytes) - buf.Len()
+		packetSetID, packetType, body, checksum, err := readNextPacket(bytes.NewBuffer(buf.Bytes()))
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				delegate.OnCorruptPacketSkip(offset, packetType, err)
+			}
+			skipToNextPacket(buf)
+			continue
+		}
+		buf.Next(int(sizeOfPacketHeader()) + len(body))
+
+		if hasSetID {
+			if packetSetID != setID {
+				delegate.OnOtherPacketSkip(packetSetID, packetType, len(body))
+				continue
+			}
+		} else {
+			setID = packetSetID
+			hasSetID = true
+		}
+		foundPacket = true
+
+		if packetType == filePacketType {
+			filePackets = append(filePackets, pendingPacket{offset, body, checksum})
+			continue
+		}
+
+		err = f.addPacket(delegate, packetType, body, checksum)
+		if err != nil {
+			return inputSetID{}, file{}, &PacketError{Offset: offset, PacketType: packetType, Err: err}
+		}
+	}
+
+	if !foundPacket {
+		return inputSetID{}, file{}, noPacketsFoundError{}
+	}
+
+	if f.startPacket != nil {
+		for _, p := range filePackets {
+			packet, err := readFilePacket(p.body, f.startPacket.blockByteCount)
+			if err != nil {
+				return inputSetID{}, file{}, &PacketError{Offset: p.offset, PacketType: filePacketType, Err: err}
+			}
+			f.filePackets[p.checksum] = packet
+		}
+	}
+
+	return setID, f, nil
+}
+
+func (f *file) addPacket(delegate DecoderDelegate, packetType packetType, body []byte, checksum fingerprint) error {
+	switch packetType {
+	case creatorPacketType:
+		clientID, err := readCreatorPacket(body)
+		if err != nil {
+			return err
+		}
+		f.clientID = clientID
+		delegate.OnCreatorPacketLoad(clientID)
+
+	case startPacketType:
+		packet, err := readStartPacket(body)
+		if err != nil {
+			return err
+		}
+		f.startPacket = &packet
+		delegate.OnStartPacketLoad(packet.blockByteCount)
+
+	case cauchyMatrixPacketType:
+		packet, err := readCauchyMatrixPacket(body)
+		if err != nil {
+			return err
+		}
+		f.matrixPackets[checksum] = packet
+
+	case externalDataPacketType:
+		packet, err := readExternalDataPacket(body)
+		if err != nil {
+			return err
+		}
+		f.externalDataPackets = append(f.externalDataPackets, packet)
+
+	case directoryPacketType:
+		packet, err := readDirectoryPacket(body)
+		if err != nil {
+			return err
+		}
+		f.directoryPackets[checksum] = packet
+
+	case rootPacketType:
+		packet, err := readRootPacket(body)
+		if err != nil {
+			return err
+		}
+		f.rootPackets[checksum] = packet
+
+	case dataPacketType:
+		packet, err := readDataPacket(body)
+		if err != nil {
+			return err
+		}
+		f.dataPackets = append(f.dataPackets, packet)
+
+	case recoveryPacketType:
+		packet, err := readRecoveryPacket(body)
+		if err != nil {
+			return err
+		}
+		f.recoveryPackets = append(f.recoveryPackets, packet)
+		delegate.OnRecoveryPacketLoad(packet.blockIndex, len(packet.data))
+
+	default:
+		delegate.OnUnknownPacketLoad(packetType, len(body))
+	}
+	return nil
+}
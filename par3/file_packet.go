@@ -0,0 +1,254 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"strings"
+)
+
+var filePacketType = packetType{'P', 'A', 'R', ' ', 'F', 'I', 'L', '\x00'}
+
+type filePacketHeader struct {
+	SixteenKHash uint64
+	Hash         fingerprint
+}
+
+// inlineTailByteCount is the size of the part of a chunk description
+// that describes its tail. A tail shorter than that is stored there
+// directly, padded with zeroes, instead of in an input block.
+const inlineTailByteCount = 40
+
+// chunkTailBody describes a tail that's stored in an input block.
+type chunkTailBody struct {
+	// The CRC-64 of the first inlineTailByteCount bytes of the
+	// tail, and the fingerprint of the whole tail.
+	Checksum   blockChecksum
+	BlockIndex uint64
+	ByteOffset uint64
+}
+
+// A chunkDescription describes a run of bytes of a file. All but its
+// tail, i.e. the last byteCount % the block size bytes, are stored in
+// consecutive input blocks starting at firstBlockIndex. A tail
+// shorter than inlineTailByteCount is stored in tailData; a longer
+// one is stored at tailByteOffset in the input block at
+// tailBlockIndex, which may also hold the tails of other chunks.
+type chunkDescription struct {
+	byteCount int
+	// Meaningful only if byteCount is at least the block size.
+	firstBlockIndex int
+
+	tailData       []byte
+	tailChecksum   blockChecksum
+	tailBlockIndex int
+	tailByteOffset int
+}
+
+// blockCount returns the number of whole input blocks that c uses,
+// not counting the one holding its tail.
+func (c chunkDescription) blockCount(blockByteCount int) int {
+	return c.byteCount / blockByteCount
+}
+
+func (c chunkDescription) tailByteCount(blockByteCount int) int {
+	return c.byteCount % blockByteCount
+}
+
+// hasTailBlock returns whether c has a tail stored in an input
+// block.
+func (c chunkDescription) hasTailBlock(blockByteCount int) bool {
+	return c.tailByteCount(blockByteCount) >= inlineTailByteCount
+}
+
+func computeTailChecksum(tail []byte) blockChecksum {
+	return blockChecksum{crc64.Checksum(tail[:inlineTailByteCount], crc64Table), computeFingerprint(tail)}
+}
+
+// A filePacket describes a file by its name, which is a single path
+// component, hashes of its contents, and the chunks that make it up.
+type filePacket struct {
+	name string
+	// The CRC-64 of the first 16 KiB of the file.
+	sixteenKHash uint64
+	// The fingerprint of the whole file.
+	hash   fingerprint
+	chunks []chunkDescription
+}
+
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return errors.New("invalid name")
+	}
+	return nil
+}
+
+func computeSixteenKHash(data []byte) uint64 {
+	if len(data) > 16*1024 {
+		data = data[:16*1024]
+	}
+	return crc64.Checksum(data, crc64Table)
+}
+
+// readChunkDescription reads a chunk description, whose layout
+// depends on the block size: the first input block index is present
+// only if the chunk has at least one whole block, and the tail
+// description only if it has a tail.
+func readChunkDescription(buf *bytes.Buffer, blockByteCount int) (chunkDescription, error) {
+	var byteCount uint64
+	err := binary.Read(buf, binary.LittleEndian, &byteCount)
+	if err != nil {
+		return chunkDescription{}, err
+	}
+
+	// A zero length marks an unprotected chunk, which isn't
+	// supported.
+	maxInt := uint64(^uint(0) >> 1)
+	if byteCount == 0 || byteCount > maxInt {
+		return chunkDescription{}, errors.New("invalid chunk description")
+	}
+
+	c := chunkDescription{byteCount: int(byteCount)}
+	if blockCount := c.blockCount(blockByteCount); blockCount > 0 {
+		var firstBlockIndex uint64
+		err := binary.Read(buf, binary.LittleEndian, &firstBlockIndex)
+		if err != nil {
+			return chunkDescription{}, err
+		}
+		if firstBlockIndex > maxInt-uint64(blockCount) {
+			return chunkDescription{}, errors.New("invalid block index")
+		}
+		c.firstBlockIndex = int(firstBlockIndex)
+	}
+
+	tailByteCount := c.tailByteCount(blockByteCount)
+	if tailByteCount == 0 {
+		return c, nil
+	}
+
+	if !c.hasTailBlock(blockByteCount) {
+		tailData := buf.Next(inlineTailByteCount)
+		if len(tailData) != inlineTailByteCount {
+			return chunkDescription{}, errors.New("could not read tail")
+		}
+		c.tailData = append([]byte(nil), tailData[:tailByteCount]...)
+		return c, nil
+	}
+
+	var tail chunkTailBody
+	err = binary.Read(buf, binary.LittleEndian, &tail)
+	if err != nil {
+		return chunkDescription{}, err
+	}
+	if tail.BlockIndex > maxInt || tail.ByteOffset > uint64(blockByteCount-tailByteCount) {
+		return chunkDescription{}, errors.New("invalid tail location")
+	}
+	c.tailChecksum = tail.Checksum
+	c.tailBlockIndex = int(tail.BlockIndex)
+	c.tailByteOffset = int(tail.ByteOffset)
+	return c, nil
+}
+
+// readFilePacket reads a file packet, which can be parsed only once
+// the block size is known.
+func readFilePacket(body []byte, blockByteCount int) (filePacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	name, err := readString(buf)
+	if err != nil {
+		return filePacket{}, err
+	}
+	err = checkName(name)
+	if err != nil {
+		return filePacket{}, err
+	}
+
+	var h filePacketHeader
+	err = binary.Read(buf, binary.LittleEndian, &h)
+	if err != nil {
+		return filePacket{}, err
+	}
+
+	err = skipOptions(buf)
+	if err != nil {
+		return filePacket{}, err
+	}
+
+	var chunks []chunkDescription
+	for buf.Len() > 0 {
+		c, err := readChunkDescription(buf, blockByteCount)
+		if err != nil {
+			return filePacket{}, err
+		}
+		chunks = append(chunks, c)
+	}
+
+	return filePacket{name, h.SixteenKHash, h.Hash, chunks}, nil
+}
+
+func writeChunkDescription(buf *bytes.Buffer, c chunkDescription, blockByteCount int) error {
+	if c.byteCount <= 0 || c.firstBlockIndex < 0 {
+		return errors.New("invalid chunk description")
+	}
+
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, uint64(c.byteCount))
+	if c.blockCount(blockByteCount) > 0 {
+		_ = binary.Write(buf, binary.LittleEndian, uint64(c.firstBlockIndex))
+	}
+
+	tailByteCount := c.tailByteCount(blockByteCount)
+	if tailByteCount == 0 {
+		return nil
+	}
+
+	if !c.hasTailBlock(blockByteCount) {
+		if len(c.tailData) != tailByteCount {
+			return errors.New("invalid tail data")
+		}
+		var tailData [inlineTailByteCount]byte
+		copy(tailData[:], c.tailData)
+		_, _ = buf.Write(tailData[:])
+		return nil
+	}
+
+	if c.tailBlockIndex < 0 || c.tailByteOffset < 0 || c.tailByteOffset > blockByteCount-tailByteCount {
+		return errors.New("invalid tail location")
+	}
+	_ = binary.Write(buf, binary.LittleEndian, chunkTailBody{c.tailChecksum, uint64(c.tailBlockIndex), uint64(c.tailByteOffset)})
+	return nil
+}
+
+func writeFilePacket(packet filePacket, blockByteCount int) ([]byte, error) {
+	err := checkName(packet.name)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = writeString(buf, packet.name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, filePacketHeader{packet.sixteenKHash, packet.hash})
+	writeNoOptions(buf)
+	for _, c := range packet.chunks {
+		err := writeChunkDescription(buf, c, blockByteCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// byteCount returns the size of the file described by packet.
+func (packet filePacket) byteCount() int {
+	byteCount := 0
+	for _, c := range packet.chunks {
+		byteCount += c.byteCount
+	}
+	return byteCount
+}
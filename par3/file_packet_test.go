@@ -0,0 +1,103 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePacketRoundTrip(t *testing.T) {
+	data := make([]byte, 128+70+50)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	packet := filePacket{
+		name:         "file.rar",
+		sixteenKHash: computeSixteenKHash(data),
+		hash:         computeFingerprint(data),
+		chunks: []chunkDescription{
+			{byteCount: 128, firstBlockIndex: 1},
+			{byteCount: 70, firstBlockIndex: 3, tailData: data[128+64 : 128+70]},
+			{byteCount: 50, tailChecksum: computeTailChecksum(data[128+70:]), tailBlockIndex: 5, tailByteOffset: 10},
+		},
+	}
+	packetBytes, err := writeFilePacket(packet, 64)
+	require.NoError(t, err)
+	roundTripPacket, err := readFilePacket(packetBytes, 64)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+	require.Equal(t, len(data), roundTripPacket.byteCount())
+}
+
+func TestFilePacketInvalidName(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "dir/file", "dir\\file"} {
+		_, err := writeFilePacket(filePacket{name: name}, 4)
+		require.Error(t, err, name)
+	}
+}
+
+func TestFilePacketInvalidTail(t *testing.T) {
+	for _, c := range []chunkDescription{
+		// A tail too short to be stored in a block, without its data.
+		{byteCount: 5, tailBlockIndex: 1},
+		// The tail doesn't fit in its block.
+		{byteCount: 50, tailByteOffset: 15},
+	} {
+		_, err := writeFilePacket(filePacket{name: "file.rar", chunks: []chunkDescription{c}}, 64)
+		require.Error(t, err, "%+v", c)
+	}
+}
+
+func TestFilePacketGolden(t *testing.T) {
+	packet := filePacket{
+		name:         "a.rar",
+		sixteenKHash: 0x0102030405060708,
+		hash:         fingerprint{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf},
+		chunks: []chunkDescription{
+			{byteCount: 128, firstBlockIndex: 1},
+			{byteCount: 70, firstBlockIndex: 3, tailData: []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6}},
+			{
+				byteCount: 50,
+				tailChecksum: blockChecksum{
+					0x1122334455667788,
+					fingerprint{0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf},
+				},
+				tailBlockIndex: 5,
+				tailByteOffset: 10,
+			},
+		},
+	}
+	expectedBytes := goldenBytes(t,
+		// Name.
+		"05 00", "61 2e 72 61 72",
+		// Hash of the first 16 KiB.
+		"08 07 06 05 04 03 02 01",
+		// Hash of the file.
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+		// No options.
+		"00",
+		// A chunk of two whole blocks starting at block 1,
+		// with no tail.
+		"80 00 00 00 00 00 00 00",
+		"01 00 00 00 00 00 00 00",
+		// A chunk of one whole block at block 3, with a
+		// 6-byte tail stored in the chunk description.
+		"46 00 00 00 00 00 00 00",
+		"03 00 00 00 00 00 00 00",
+		"01 02 03 04 05 06 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		"00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		// A chunk of just a 50-byte tail, with its CRC-64,
+		// hash, block index, and offset.
+		"32 00 00 00 00 00 00 00",
+		"88 77 66 55 44 33 22 11",
+		"b0 b1 b2 b3 b4 b5 b6 b7 b8 b9 ba bb bc bd be bf",
+		"05 00 00 00 00 00 00 00",
+		"0a 00 00 00 00 00 00 00",
+	)
+	packetBytes, err := writeFilePacket(packet, 64)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readFilePacket(expectedBytes, 64)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
@@ -0,0 +1,112 @@
+package par3
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testDecoderDelegate struct {
+	t *testing.T
+}
+
+func (d testDecoderDelegate) OnCreatorPacketLoad(clientID string) {
+	d.t.Helper()
+	d.t.Logf("OnCreatorPacketLoad(%s)", clientID)
+}
+
+func (d testDecoderDelegate) OnStartPacketLoad(blockByteCount int) {
+	d.t.Helper()
+	d.t.Logf("OnStartPacketLoad(blockByteCount=%d)", blockByteCount)
+}
+
+func (d testDecoderDelegate) OnRecoveryPacketLoad(blockIndex, byteCount int) {
+	d.t.Helper()
+	d.t.Logf("OnRecoveryPacketLoad(%d, %d)", blockIndex, byteCount)
+}
+
+func (d testDecoderDelegate) OnUnknownPacketLoad(packetType [8]byte, byteCount int) {
+	d.t.Helper()
+	d.t.Logf("OnUnknownPacketLoad(%q, %d)", packetType, byteCount)
+}
+
+func (d testDecoderDelegate) OnOtherPacketSkip(setID [8]byte, packetType [8]byte, byteCount int) {
+	d.t.Helper()
+	d.t.Logf("OnOtherPacketSkip(%x, %q, %d)", setID, packetType, byteCount)
+}
+
+func (d testDecoderDelegate) OnCorruptPacketSkip(offset int, packetType [8]byte, err error) {
+	d.t.Helper()
+	d.t.Logf("OnCorruptPacketSkip(%d, %q, %v)", offset, packetType, err)
+}
+
+func (d testDecoderDelegate) OnDataFileLoad(i, n int, path string, byteCount, hits, misses int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnDataFileLoad(%d, %d, byteCount=%d, hits=%d, misses=%d, %s, %v)", i, n, byteCount, hits, misses, path, err)
+}
+
+func (d testDecoderDelegate) OnParityFileLoad(i int, path string, err error) {
+	d.t.Helper()
+	d.t.Logf("OnParityFileLoad(%d, %s, %v)", i, path, err)
+}
+
+func (d testDecoderDelegate) OnDetectCorruptDataChunk(path string, startByteOffset, endByteOffset int) {
+	d.t.Helper()
+	d.t.Logf("OnDetectCorruptDataChunk(%s, %d, %d)", path, startByteOffset, endByteOffset)
+}
+
+func (d testDecoderDelegate) OnDataFileWrite(i, n int, path string, byteCount int, err error) {
+	d.t.Helper()
+	d.t.Logf("OnDataFileWrite(%d, %d, %s, %d, %v)", i, n, path, byteCount, err)
+}
+
+func TestReadFile(t *testing.T) {
+	setID := inputSetID{0x1}
+	otherSetID := inputSetID{0x2}
+	buf := bytes.NewBuffer(nil)
+
+	creatorBody, err := writeCreatorPacket("some client")
+	require.NoError(t, err)
+	_, err = writeNextPacket(buf, setID, creatorPacketType, creatorBody)
+	require.NoError(t, err)
+
+	// A corrupt packet, which should be skipped.
+	corruptBytes, _ := makePacket(setID, creatorPacketType, creatorBody)
+	corruptBytes[len(corruptBytes)-1]++
+	_, _ = buf.Write(corruptBytes)
+
+	// A packet from another set, which should be skipped.
+	_, err = writeNextPacket(buf, otherSetID, creatorPacketType, creatorBody)
+	require.NoError(t, err)
+
+	startBody, err := writeStartPacket(startPacket{blockByteCount: 4})
+	require.NoError(t, err)
+	_, err = writeNextPacket(buf, setID, startPacketType, startBody)
+	require.NoError(t, err)
+
+	dirBody, err := writeDirectoryPacket(directoryPacket{"dir", nil})
+	require.NoError(t, err)
+	dirChecksum, err := writeNextPacket(buf, setID, directoryPacketType, dirBody)
+	require.NoError(t, err)
+
+	readSetID, f, err := readFile(testDecoderDelegate{t}, nil, buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, setID, readSetID)
+	require.Equal(t, "some client", f.clientID)
+	require.Equal(t, &startPacket{blockByteCount: 4}, f.startPacket)
+	require.Equal(t, map[fingerprint]directoryPacket{dirChecksum: {"dir", []fingerprint{}}}, f.directoryPackets)
+}
+
+func TestReadFileNoPackets(t *testing.T) {
+	_, _, err := readFile(testDecoderDelegate{t}, nil, []byte{0x1, 0x2, 0x3})
+	require.Equal(t, noPacketsFoundError{}, err)
+}
+
+func TestReadFileInvalidPacket(t *testing.T) {
+	packetBytes, _ := makePacket(inputSetID{0x1}, startPacketType, []byte{0x1})
+	_, _, err := readFile(testDecoderDelegate{t}, nil, packetBytes)
+	packetErr, ok := err.(*PacketError)
+	require.True(t, ok)
+	require.Equal(t, [8]byte(startPacketType), packetErr.PacketType)
+}
@@ -0,0 +1,68 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var cauchyMatrixPacketType = packetType{'P', 'A', 'R', ' ', 'C', 'A', 'U', '\x00'}
+
+type cauchyMatrixPacketBody struct {
+	FirstBlockIndex        uint64
+	EndBlockIndex          uint64
+	RecoveryBlockCountHint uint64
+}
+
+// maxBlockCount is the most input blocks a single matrix can cover,
+// since rsec16 supports at most 65535 shards in total.
+const maxBlockCount = 1<<16 - 1
+
+// A cauchyMatrixPacket says that recovery blocks are computed from
+// the input blocks in [firstBlockIndex, endBlockIndex) using a
+// Cauchy matrix. The matrix used is rsec16's, whose element for
+// recovery block i and input block j is 1/(x_i - y_j) with x_i = n +
+// i and y_j = j, where n is the number of input blocks. It hasn't
+// been checked against sets made by par3cmdline or any other PAR3
+// client, so PAR3 support is experimental.
+type cauchyMatrixPacket struct {
+	firstBlockIndex        int
+	endBlockIndex          int
+	recoveryBlockCountHint int
+}
+
+func readCauchyMatrixPacket(body []byte) (cauchyMatrixPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var b cauchyMatrixPacketBody
+	err := binary.Read(buf, binary.LittleEndian, &b)
+	if err != nil {
+		return cauchyMatrixPacket{}, err
+	}
+
+	if buf.Len() != 0 {
+		return cauchyMatrixPacket{}, errors.New("unexpected trailing bytes")
+	}
+
+	if b.FirstBlockIndex >= b.EndBlockIndex || b.EndBlockIndex-b.FirstBlockIndex > maxBlockCount || b.RecoveryBlockCountHint > maxBlockCount {
+		return cauchyMatrixPacket{}, errors.New("invalid block range")
+	}
+
+	return cauchyMatrixPacket{int(b.FirstBlockIndex), int(b.EndBlockIndex), int(b.RecoveryBlockCountHint)}, nil
+}
+
+func writeCauchyMatrixPacket(packet cauchyMatrixPacket) ([]byte, error) {
+	if packet.firstBlockIndex < 0 || packet.firstBlockIndex >= packet.endBlockIndex || packet.recoveryBlockCountHint < 0 {
+		return nil, errors.New("invalid block range")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	b := cauchyMatrixPacketBody{
+		FirstBlockIndex:        uint64(packet.firstBlockIndex),
+		EndBlockIndex:          uint64(packet.endBlockIndex),
+		RecoveryBlockCountHint: uint64(packet.recoveryBlockCountHint),
+	}
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, b)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,42 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCauchyMatrixPacketRoundTrip(t *testing.T) {
+	packet := cauchyMatrixPacket{
+		firstBlockIndex:        3,
+		endBlockIndex:          10,
+		recoveryBlockCountHint: 5,
+	}
+	packetBytes, err := writeCauchyMatrixPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readCauchyMatrixPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestCauchyMatrixPacketGolden(t *testing.T) {
+	packet := cauchyMatrixPacket{
+		firstBlockIndex:        0x102,
+		endBlockIndex:          0x304,
+		recoveryBlockCountHint: 0x56,
+	}
+	expectedBytes := goldenBytes(t,
+		// Index of the first input block.
+		"02 01 00 00 00 00 00 00",
+		// Index of the last input block plus one.
+		"04 03 00 00 00 00 00 00",
+		// Hint for the number of recovery blocks.
+		"56 00 00 00 00 00 00 00",
+	)
+	packetBytes, err := writeCauchyMatrixPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readCauchyMatrixPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
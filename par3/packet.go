@@ -0,0 +1,132 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+)
+
+// A fingerprint is the first 16 bytes of the BLAKE3 hash of some
+// data, which PAR3 uses to check packets and blocks, and to refer to
+// packets from other packets.
+type fingerprint [16]byte
+
+func computeFingerprint(data []byte) fingerprint {
+	var f fingerprint
+	hash := blake3Sum256(data)
+	copy(f[:], hash[:])
+	return f
+}
+
+type packetHeader struct {
+	Magic      [8]byte
+	Checksum   fingerprint
+	Length     uint64
+	InputSetID inputSetID
+	Type       packetType
+}
+
+type inputSetID [8]byte
+type packetType [8]byte
+
+var expectedMagic = [8]byte{'P', 'A', 'R', '3', '\x00', 'P', 'K', 'T'}
+
+func sizeOfPacketHeader() uint64 {
+	return uint64(reflect.TypeOf(packetHeader{}).Size())
+}
+
+// checksumOffset is the offset in a packet of the first byte covered
+// by its checksum, which is the one right after the checksum.
+const checksumOffset = 8 + 16
+
+func checkPacketHeader(h packetHeader) error {
+	if h.Magic != expectedMagic {
+		return errors.New("unexpected magic string")
+	}
+
+	if h.Length < sizeOfPacketHeader() {
+		return errors.New("invalid length")
+	}
+
+	return nil
+}
+
+// readNextPacket reads the packet at the start of buf, and returns
+// its input set ID, type, body, and checksum, which is also how
+// other packets refer to it.
+func readNextPacket(buf *bytes.Buffer) (inputSetID, packetType, []byte, fingerprint, error) {
+	packetBytes := buf.Bytes()
+
+	var h packetHeader
+	err := binary.Read(buf, binary.LittleEndian, &h)
+	if err != nil {
+		return inputSetID{}, packetType{}, nil, fingerprint{}, err
+	}
+
+	err = checkPacketHeader(h)
+	if err != nil {
+		return inputSetID{}, packetType{}, nil, fingerprint{}, err
+	}
+
+	// Check the length against what's left before converting it
+	// to an int, since a corrupt length may not fit in one.
+	if h.Length-sizeOfPacketHeader() > uint64(buf.Len()) {
+		return inputSetID{}, h.Type, nil, fingerprint{}, errors.New("could not read body")
+	}
+	bodyLength := int(h.Length - sizeOfPacketHeader())
+	body := buf.Next(bodyLength)
+
+	if computeFingerprint(packetBytes[checksumOffset:h.Length]) != h.Checksum {
+		return inputSetID{}, h.Type, nil, fingerprint{}, errors.New("checksum mismatch")
+	}
+
+	bodyCopy := make([]byte, len(body))
+	copy(bodyCopy, body)
+	return h.InputSetID, h.Type, bodyCopy, h.Checksum, nil
+}
+
+// skipToNextPacket discards bytes from buf up to the next occurrence
+// of the magic string after the first byte, or all of them if there
+// isn't one. It's used to resynchronize after a corrupt packet.
+func skipToNextPacket(buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	i := bytes.Index(buf.Bytes()[1:], expectedMagic[:])
+	if i < 0 {
+		buf.Reset()
+		return
+	}
+	buf.Next(i + 1)
+}
+
+// makePacket returns the bytes of a packet with the given input set
+// ID, type, and body, along with its checksum.
+func makePacket(setID inputSetID, packetType packetType, body []byte) ([]byte, fingerprint) {
+	// len(body) is at most math.MaxInt64, so this can't
+	// overflow.
+	length := sizeOfPacketHeader() + uint64(len(body))
+	buf := bytes.NewBuffer(make([]byte, 0, length))
+	h := packetHeader{
+		Magic:      expectedMagic,
+		Length:     length,
+		InputSetID: setID,
+		Type:       packetType,
+	}
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, h)
+	_, _ = buf.Write(body)
+
+	packetBytes := buf.Bytes()
+	checksum := computeFingerprint(packetBytes[checksumOffset:])
+	copy(packetBytes[8:checksumOffset], checksum[:])
+	return packetBytes, checksum
+}
+
+func writeNextPacket(w io.Writer, setID inputSetID, packetType packetType, body []byte) (fingerprint, error) {
+	packetBytes, checksum := makePacket(setID, packetType, body)
+	_, err := w.Write(packetBytes)
+	return checksum, err
+}
@@ -0,0 +1,114 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// goldenBytes returns the concatenation of the bytes encoded by the
+// given hex strings, which may contain spaces.
+func goldenBytes(t *testing.T, hexStrings ...string) []byte {
+	bs, err := hex.DecodeString(strings.ReplaceAll(strings.Join(hexStrings, ""), " ", ""))
+	require.NoError(t, err)
+	return bs
+}
+
+type typedPacket struct {
+	packetType packetType
+	body       []byte
+}
+
+func TestPacketsRoundTrip(t *testing.T) {
+	packets := []typedPacket{
+		{packetType{0x1}, []byte{0x2, 0x3, 0x0, 0x1}},
+		{packetType{0x4}, []byte{0x5, 0x6, 0x1, 0x0}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	setID := inputSetID{0x5}
+	var checksums []fingerprint
+	for _, p := range packets {
+		checksum, err := writeNextPacket(buf, setID, p.packetType, p.body)
+		require.NoError(t, err)
+		checksums = append(checksums, checksum)
+	}
+
+	var roundTripPackets []typedPacket
+	var roundTripChecksums []fingerprint
+	for {
+		roundTripSetID, packetType, body, checksum, err := readNextPacket(buf)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, setID, roundTripSetID)
+		roundTripPackets = append(roundTripPackets, typedPacket{packetType, body})
+		roundTripChecksums = append(roundTripChecksums, checksum)
+	}
+
+	require.Equal(t, packets, roundTripPackets)
+	require.Equal(t, checksums, roundTripChecksums)
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestReadNextPacketChecksumMismatch(t *testing.T) {
+	packetBytes, _ := makePacket(inputSetID{0x1}, packetType{0x2}, []byte{0x3, 0x4})
+	packetBytes[len(packetBytes)-1]++
+	_, roundTripPacketType, _, _, err := readNextPacket(bytes.NewBuffer(packetBytes))
+	require.Error(t, err)
+	require.Equal(t, packetType{0x2}, roundTripPacketType)
+}
+
+func TestReadNextPacketHugeLength(t *testing.T) {
+	for _, length := range []uint64{1 << 63, 1<<64 - 1, 1 << 32} {
+		packetBytes, _ := makePacket(inputSetID{0x1}, packetType{0x2}, []byte{0x3, 0x4})
+		// The length comes right after the magic string and
+		// the checksum.
+		binary.LittleEndian.PutUint64(packetBytes[checksumOffset:], length)
+		_, roundTripPacketType, _, _, err := readNextPacket(bytes.NewBuffer(packetBytes))
+		require.Error(t, err, "length=%d", length)
+		require.Equal(t, packetType{0x2}, roundTripPacketType)
+	}
+}
+
+func TestSkipToNextPacket(t *testing.T) {
+	packetBytes, _ := makePacket(inputSetID{0x1}, packetType{0x2}, []byte{0x3, 0x4})
+	junk := []byte{0x5, 0x6, 0x7}
+	buf := bytes.NewBuffer(append(append(append([]byte(nil), packetBytes...), junk...), packetBytes...))
+
+	// Skips the first packet and the junk after it.
+	skipToNextPacket(buf)
+	require.Equal(t, packetBytes, buf.Bytes())
+
+	skipToNextPacket(buf)
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestPacketGolden(t *testing.T) {
+	packetBytes, checksum := makePacket(inputSetID{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8}, dataPacketType, []byte{0xa, 0xb, 0xc, 0xd})
+	expectedBytes := goldenBytes(t,
+		// Magic.
+		"50 41 52 33 00 50 4b 54",
+		// Checksum, filled in below.
+		"00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00",
+		// Length of the header and the body.
+		"34 00 00 00 00 00 00 00",
+		// Input set ID.
+		"01 02 03 04 05 06 07 08",
+		// Type.
+		"50 41 52 20 44 41 54 00",
+		// Body.
+		"0a 0b 0c 0d",
+	)
+	// The checksum covers everything after it.
+	expectedChecksum := computeFingerprint(expectedBytes[24:])
+	copy(expectedBytes[8:24], expectedChecksum[:])
+	require.Equal(t, expectedBytes, packetBytes)
+	require.Equal(t, expectedChecksum, checksum)
+}
@@ -0,0 +1,66 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var recoveryPacketType = packetType{'P', 'A', 'R', ' ', 'R', 'E', 'C', '\x00'}
+
+type recoveryPacketHeader struct {
+	RootChecksum   fingerprint
+	MatrixChecksum fingerprint
+	BlockIndex     uint64
+}
+
+// A recoveryPacket holds a recovery block, computed from the input
+// blocks described by the root packet using the matrix packet with
+// the given checksums.
+type recoveryPacket struct {
+	rootChecksum   fingerprint
+	matrixChecksum fingerprint
+	blockIndex     int
+	data           []byte
+}
+
+func readRecoveryPacket(body []byte) (recoveryPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var h recoveryPacketHeader
+	err := binary.Read(buf, binary.LittleEndian, &h)
+	if err != nil {
+		return recoveryPacket{}, err
+	}
+
+	if h.BlockIndex >= 1<<16 {
+		return recoveryPacket{}, errors.New("invalid block index")
+	}
+
+	if buf.Len() == 0 || buf.Len()%4 != 0 {
+		return recoveryPacket{}, errors.New("invalid data length")
+	}
+
+	return recoveryPacket{h.RootChecksum, h.MatrixChecksum, int(h.BlockIndex), buf.Bytes()}, nil
+}
+
+func writeRecoveryPacket(packet recoveryPacket) ([]byte, error) {
+	if packet.blockIndex < 0 || packet.blockIndex >= 1<<16 {
+		return nil, errors.New("invalid block index")
+	}
+
+	if len(packet.data) == 0 || len(packet.data)%4 != 0 {
+		return nil, errors.New("invalid data length")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	h := recoveryPacketHeader{
+		RootChecksum:   packet.rootChecksum,
+		MatrixChecksum: packet.matrixChecksum,
+		BlockIndex:     uint64(packet.blockIndex),
+	}
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, h)
+	_, _ = buf.Write(packet.data)
+	return buf.Bytes(), nil
+}
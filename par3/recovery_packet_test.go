@@ -0,0 +1,46 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryPacketRoundTrip(t *testing.T) {
+	packet := recoveryPacket{
+		rootChecksum:   fingerprint{0x1},
+		matrixChecksum: fingerprint{0x2},
+		blockIndex:     0xff00,
+		data:           []byte{0xff, 0xff, 0x00, 0x00, 0xcd, 0xab, 0x01, 0x00},
+	}
+	packetBytes, err := writeRecoveryPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readRecoveryPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestRecoveryPacketGolden(t *testing.T) {
+	packet := recoveryPacket{
+		rootChecksum:   fingerprint{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf},
+		matrixChecksum: fingerprint{0xb0, 0xb1, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf},
+		blockIndex:     0x102,
+		data:           []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8},
+	}
+	expectedBytes := goldenBytes(t,
+		// Root packet checksum.
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+		// Matrix packet checksum.
+		"b0 b1 b2 b3 b4 b5 b6 b7 b8 b9 ba bb bc bd be bf",
+		// Recovery block index.
+		"02 01 00 00 00 00 00 00",
+		// Data.
+		"01 02 03 04 05 06 07 08",
+	)
+	packetBytes, err := writeRecoveryPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readRecoveryPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
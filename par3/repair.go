@@ -0,0 +1,129 @@
+package par3
+
+import (
+	"github.com/akalin/gopar/fsio"
+)
+
+// RepairDelegate is just DecoderDelegate for now.
+type RepairDelegate interface {
+	DecoderDelegate
+}
+
+// DoNothingRepairDelegate is an implementation of RepairDelegate that
+// does nothing for all methods.
+type DoNothingRepairDelegate struct {
+	DoNothingDecoderDelegate
+}
+
+// RepairOptions holds all the options for Repair.
+type RepairOptions struct {
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
+	// The RepairDelegate to use. If nil, DoNothingRepairDelegate
+	// is used.
+	RepairDelegate RepairDelegate
+	// The directory that the data files are looked up in. If
+	// empty, the directory of parPath is used.
+	BasePath string
+	// If KeepBackups is true, then a damaged data file is moved
+	// to the first of <path>.1, <path>.2, etc. that doesn't exist
+	// before the repaired file is written.
+	KeepBackups bool
+	// If Purge is true, then once the data files are intact,
+	// either because no repair was needed or because the repair
+	// succeeded, the par file, its parity volumes, and any
+	// backups made by the repair are removed.
+	Purge bool
+}
+
+// RepairResult holds the result of a Repair call.
+type RepairResult struct {
+	// RepairedPaths contains the paths of the files that were
+	// repaired.
+	RepairedPaths []string
+	// BackupPaths contains the paths that damaged data files
+	// were moved to, if KeepBackups is set to true in
+	// RepairOptions.
+	BackupPaths []string
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in RepairOptions.
+	PurgedPaths []string
+}
+
+// Repair a par file at parPath with the given options. The returned
+// RepairResult may be partially or not filled in if an error is
+// returned.
+func Repair(parPath string, options RepairOptions) (RepairResult, error) {
+	return repair(defaultFileIO{}, parPath, options)
+}
+
+// RepairFS is like Repair, except that it reads and writes files in
+// fsys instead of the OS file system. parPath and the returned
+// RepairedPaths are names in fsys, but the paths passed to the
+// delegate are under fsio.Root().
+func RepairFS(fsys fsio.WriteFS, parPath string, options RepairOptions) (RepairResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	result, err := repair(p, p.Path(parPath), options)
+	for _, paths := range [][]string{result.RepairedPaths, result.BackupPaths, result.PurgedPaths} {
+		for i, path := range paths {
+			name, nameErr := p.Name(path)
+			if nameErr != nil {
+				return result, nameErr
+			}
+			paths[i] = name
+		}
+	}
+	return result, err
+}
+
+func repair(fileIO fileIO, parPath string, options RepairOptions) (RepairResult, error) {
+	err := checkExtension(parPath)
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	delegate := options.RepairDelegate
+	if delegate == nil {
+		delegate = DoNothingRepairDelegate{}
+	}
+
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	decoder, err := newDecoder(fileIO, delegate, parPath, numGoroutines)
+	if err != nil {
+		return RepairResult{}, err
+	}
+	if options.BasePath != "" {
+		decoder.basePath = options.BasePath
+	}
+	decoder.keepBackups = options.KeepBackups
+
+	err = decoder.LoadFileData()
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	err = decoder.LoadParityData()
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	repairedPaths, err := decoder.Repair()
+	result := RepairResult{
+		RepairedPaths: repairedPaths,
+		BackupPaths:   decoder.backupPaths,
+	}
+	if err != nil || !options.Purge {
+		return result, err
+	}
+
+	result.PurgedPaths, err = decoder.Purge()
+	return result, err
+}
@@ -0,0 +1,245 @@
+package par3
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/akalin/gopar/memfs"
+	"github.com/akalin/gopar/par2cmdline"
+	"github.com/stretchr/testify/require"
+)
+
+func makeDecoderMemFS(workingDir string) memfs.MemFS {
+	data := func(n int, seed byte) []byte {
+		bs := make([]byte, n)
+		for i := range bs {
+			bs[i] = byte(i) ^ seed
+		}
+		return bs
+	}
+	return memfs.MakeMemFS(workingDir, map[string][]byte{
+		"file.rar":                                data(50, 0x1),
+		filepath.Join("dir1", "file.r01"):         data(30, 0x2),
+		filepath.Join("dir1", "file.r02"):         data(50, 0x1),
+		filepath.Join("dir2", "dir3", "file.r03"): data(17, 0x3),
+	})
+}
+
+var decoderMemFSNames = []string{"file.rar", "dir1/file.r01", "dir1/file.r02", "dir2/dir3/file.r03"}
+
+func createForTest(t *testing.T, fs memfs.MemFS, numParityShards int) {
+	err := CreateFS(fs, "file.par3", decoderMemFSNames, CreateOptions{
+		BlockByteCount:  8,
+		NumParityShards: numParityShards,
+		CreateDelegate:  testEncoderDelegate{t},
+	})
+	require.NoError(t, err)
+}
+
+func perturbFile(t *testing.T, fs memfs.MemFS, name string) {
+	path := filepath.Join(memfs.RootDir(), name)
+	data, err := fs.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)/2]++
+}
+
+func TestCreateFSWritesVolumes(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	createForTest(t, fs, 4)
+	for _, name := range []string{"file.par3", "file.vol00+01.par3", "file.vol01+02.par3", "file.vol03+01.par3"} {
+		_, err := fs.ReadFile(filepath.Join(memfs.RootDir(), name))
+		require.NoError(t, err, name)
+	}
+}
+
+func TestVerifyFS(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	createForTest(t, fs, 3)
+
+	result, err := VerifyFS(fs, "file.par3", VerifyOptions{VerifyDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	// file.rar and dir1/file.r02 are identical, so the 6 blocks
+	// of one of them are stored once.
+	require.Equal(t, ShardCounts{
+		UsableDataShardCount:   6 + 3 + 2,
+		UsableParityShardCount: 3,
+	}, result.ShardCounts)
+	require.False(t, result.ShardCounts.RepairNeeded())
+
+	perturbFile(t, fs, filepath.Join("dir1", "file.r01"))
+	result, err = VerifyFS(fs, "file.par3", VerifyOptions{VerifyDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	require.Equal(t, ShardCounts{
+		UsableDataShardCount:   6 + 2 + 2,
+		UnusableDataShardCount: 1,
+		UsableParityShardCount: 3,
+		DamagedFileCount:       1,
+	}, result.ShardCounts)
+	require.True(t, result.ShardCounts.RepairNeeded())
+	require.True(t, result.ShardCounts.RepairPossible())
+}
+
+func TestVerifyFSDuplicateDataIsUsable(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	createForTest(t, fs, 1)
+
+	// A damaged copy of a block doesn't matter if another copy
+	// is intact, but the damaged file still needs repair.
+	perturbFile(t, fs, "file.rar")
+	result, err := VerifyFS(fs, "file.par3", VerifyOptions{VerifyDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	require.Equal(t, 0, result.ShardCounts.UnusableDataShardCount)
+	require.Equal(t, 1, result.ShardCounts.DamagedFileCount)
+	require.True(t, result.ShardCounts.RepairNeeded())
+}
+
+func TestRepairFS(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	original := make(map[string][]byte)
+	for _, name := range decoderMemFSNames {
+		data, err := fs.ReadFile(filepath.Join(memfs.RootDir(), name))
+		require.NoError(t, err)
+		original[name] = append([]byte(nil), data...)
+	}
+	createForTest(t, fs, 4)
+
+	perturbFile(t, fs, "file.rar")
+	perturbFile(t, fs, filepath.Join("dir1", "file.r01"))
+	_, err := fs.RemoveFile(filepath.Join(memfs.RootDir(), "dir2", "dir3", "file.r03"))
+	require.NoError(t, err)
+
+	result, err := RepairFS(fs, "file.par3", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		KeepBackups:    true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, RepairResult{
+		RepairedPaths: []string{"dir1/file.r01", "dir2/dir3/file.r03", "file.rar"},
+		BackupPaths:   []string{"dir1/file.r01.1", "file.rar.1"},
+	}, result)
+
+	for _, name := range decoderMemFSNames {
+		data, err := fs.ReadFile(filepath.Join(memfs.RootDir(), filepath.FromSlash(name)))
+		require.NoError(t, err)
+		require.Equal(t, original[name], data, name)
+	}
+
+	result, err = RepairFS(fs, "file.par3", RepairOptions{
+		RepairDelegate: testDecoderDelegate{t},
+		Purge:          true,
+	})
+	require.NoError(t, err)
+	require.Empty(t, result.RepairedPaths)
+	require.Equal(t, []string{"file.par3", "file.vol00+01.par3", "file.vol01+02.par3", "file.vol03+01.par3"}, result.PurgedPaths)
+}
+
+func TestRepairFSNotPossible(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	createForTest(t, fs, 1)
+
+	perturbFile(t, fs, filepath.Join("dir1", "file.r01"))
+	perturbFile(t, fs, filepath.Join("dir2", "dir3", "file.r03"))
+	_, err := RepairFS(fs, "file.par3", RepairOptions{RepairDelegate: testDecoderDelegate{t}})
+	require.Error(t, err)
+	require.Equal(t, par2cmdline.ExitRepairNotPossible, ExitCodeForRepairErrorPar2CmdLine(err))
+}
+
+func TestRepairFSWithCorruptVolume(t *testing.T) {
+	fs := makeDecoderMemFS(memfs.RootDir())
+	createForTest(t, fs, 3)
+
+	// Corrupt the critical packets at the start of a volume,
+	// which should be skipped over to get to its recovery
+	// packets.
+	perturbFile(t, fs, "file.vol01+02.par3")
+	_, err := fs.RemoveFile(filepath.Join(memfs.RootDir(), "file.vol00+01.par3"))
+	require.NoError(t, err)
+	perturbFile(t, fs, "file.rar")
+	perturbFile(t, fs, filepath.Join("dir1", "file.r01"))
+
+	result, err := RepairFS(fs, "file.par3", RepairOptions{RepairDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"dir1/file.r01", "file.rar"}, result.RepairedPaths)
+}
+
+func TestRepairFSPackedTails(t *testing.T) {
+	data := func(n int, seed byte) []byte {
+		bs := make([]byte, n)
+		for i := range bs {
+			bs[i] = byte(i) ^ seed
+		}
+		return bs
+	}
+	original := map[string][]byte{
+		"a.bin": data(45, 0x1),
+		"b.bin": data(50, 0x2),
+		"c.bin": data(150, 0x3),
+		"d.bin": data(17, 0x4),
+	}
+	fileData := make(map[string][]byte)
+	for name, data := range original {
+		fileData[name] = append([]byte(nil), data...)
+	}
+	fs := memfs.MakeMemFS(memfs.RootDir(), fileData)
+	err := CreateFS(fs, "file.par3", []string{"a.bin", "b.bin", "c.bin", "d.bin"}, CreateOptions{
+		BlockByteCount:  100,
+		NumParityShards: 2,
+		CreateDelegate:  testEncoderDelegate{t},
+	})
+	require.NoError(t, err)
+
+	// The tails of a.bin and b.bin share a block, which is
+	// unusable if either of them is damaged, even though the
+	// tail of the other one is fine.
+	perturbFile(t, fs, "a.bin")
+	result, err := VerifyFS(fs, "file.par3", VerifyOptions{VerifyDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	require.Equal(t, ShardCounts{
+		UsableDataShardCount:   2,
+		UnusableDataShardCount: 1,
+		UsableParityShardCount: 2,
+		DamagedFileCount:       1,
+	}, result.ShardCounts)
+
+	_, err = fs.RemoveFile(filepath.Join(memfs.RootDir(), "b.bin"))
+	require.NoError(t, err)
+	perturbFile(t, fs, "c.bin")
+	repairResult, err := RepairFS(fs, "file.par3", RepairOptions{RepairDelegate: testDecoderDelegate{t}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.bin", "b.bin", "c.bin"}, repairResult.RepairedPaths)
+	for name, data := range original {
+		repairedData, err := fs.ReadFile(filepath.Join(memfs.RootDir(), name))
+		require.NoError(t, err)
+		require.Equal(t, data, repairedData, name)
+	}
+}
+
+func TestNewDecoderFSRejectsInvalidBlockCount(t *testing.T) {
+	var setID inputSetID
+	startBody, err := writeStartPacket(startPacket{blockByteCount: 8})
+	require.NoError(t, err)
+	startPacketBytes, _ := makePacket(setID, startPacketType, startBody)
+	externalBody, err := writeExternalDataPacket(externalDataPacket{0, make([]blockChecksum, 2)})
+	require.NoError(t, err)
+	externalPacketBytes, _ := makePacket(setID, externalDataPacketType, externalBody)
+
+	for _, lowestUnusedBlockIndex := range []int{3, maxBlockCount + 1, 1<<31 - 1} {
+		rootBody, err := writeRootPacket(rootPacket{lowestUnusedBlockIndex: lowestUnusedBlockIndex})
+		require.NoError(t, err)
+		rootPacketBytes, _ := makePacket(setID, rootPacketType, rootBody)
+
+		var indexBytes []byte
+		indexBytes = append(indexBytes, startPacketBytes...)
+		indexBytes = append(indexBytes, externalPacketBytes...)
+		indexBytes = append(indexBytes, rootPacketBytes...)
+		fs := memfs.MakeMemFS(memfs.RootDir(), map[string][]byte{
+			"file.par3": indexBytes,
+		})
+
+		_, err = NewDecoderFS(fs, testDecoderDelegate{t}, "file.par3", 1)
+		require.Error(t, err, lowestUnusedBlockIndex)
+		if lowestUnusedBlockIndex <= maxBlockCount {
+			require.Equal(t, &MissingPacketError{Path: filepath.Join(memfs.RootDir(), "file.par3"), PacketType: externalDataPacketType}, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var rootPacketType = packetType{'P', 'A', 'R', ' ', 'R', 'O', 'O', '\x00'}
+
+type rootPacketHeader struct {
+	LowestUnusedBlockIndex uint64
+	Attributes             uint8
+}
+
+// rootAbsolutePath is the attribute bit that says that the root is
+// an absolute path, which isn't supported.
+const rootAbsolutePath = 1 << 0
+
+// A rootPacket holds the checksums of the file and directory packets
+// for the entries of the top-level directory, and the number of input
+// blocks they use.
+type rootPacket struct {
+	lowestUnusedBlockIndex int
+	children               []fingerprint
+}
+
+func readRootPacket(body []byte) (rootPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var h rootPacketHeader
+	err := binary.Read(buf, binary.LittleEndian, &h)
+	if err != nil {
+		return rootPacket{}, err
+	}
+
+	maxInt := uint64(^uint(0) >> 1)
+	if h.LowestUnusedBlockIndex > maxInt {
+		return rootPacket{}, errors.New("invalid block index")
+	}
+
+	if h.Attributes&rootAbsolutePath != 0 {
+		return rootPacket{}, errors.New("absolute paths not supported")
+	}
+
+	err = skipOptions(buf)
+	if err != nil {
+		return rootPacket{}, err
+	}
+
+	children, err := readFingerprints(buf)
+	if err != nil {
+		return rootPacket{}, err
+	}
+
+	return rootPacket{int(h.LowestUnusedBlockIndex), children}, nil
+}
+
+func writeRootPacket(packet rootPacket) ([]byte, error) {
+	if packet.lowestUnusedBlockIndex < 0 {
+		return nil, errors.New("invalid block index")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, rootPacketHeader{LowestUnusedBlockIndex: uint64(packet.lowestUnusedBlockIndex)})
+	writeNoOptions(buf)
+	for _, child := range packet.children {
+		_, _ = buf.Write(child[:])
+	}
+	return buf.Bytes(), nil
+}
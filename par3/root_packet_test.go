@@ -0,0 +1,52 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootPacketRoundTrip(t *testing.T) {
+	packet := rootPacket{
+		lowestUnusedBlockIndex: 5,
+		children:               []fingerprint{{0x1}, {0x2}},
+	}
+	packetBytes, err := writeRootPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readRootPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestRootPacketAbsolutePath(t *testing.T) {
+	packetBytes, err := writeRootPacket(rootPacket{})
+	require.NoError(t, err)
+	packetBytes[8] |= rootAbsolutePath
+	_, err = readRootPacket(packetBytes)
+	require.Error(t, err)
+}
+
+func TestRootPacketGolden(t *testing.T) {
+	packet := rootPacket{
+		lowestUnusedBlockIndex: 0x102,
+		children: []fingerprint{
+			{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf},
+		},
+	}
+	expectedBytes := goldenBytes(t,
+		// Lowest unused input block index.
+		"02 01 00 00 00 00 00 00",
+		// Attributes.
+		"00",
+		// No options.
+		"00",
+		// Checksums of the children.
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+	)
+	packetBytes, err := writeRootPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readRootPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
@@ -0,0 +1,89 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var startPacketType = packetType{'P', 'A', 'R', ' ', 'S', 'T', 'A', '\x00'}
+
+type startPacketHeader struct {
+	ParentInputSetID   inputSetID
+	ParentRootChecksum fingerprint
+	BlockSize          uint64
+	GaloisFieldSize    uint8
+}
+
+// gf2p16Generator is the generator polynomial of gf2p16, x^16 + x^12
+// + x^3 + x + 1, without its leading term, which is how the start
+// packet stores it.
+var gf2p16Generator = [2]byte{0x0b, 0x10}
+
+type startPacket struct {
+	// The parent fields are for incremental backups, which
+	// aren't supported yet, so they're always zero when writing.
+	parentSetID        inputSetID
+	parentRootChecksum fingerprint
+	blockByteCount     int
+}
+
+func checkBlockByteCount(blockByteCount uint64) error {
+	maxInt := uint64(^uint(0) >> 1)
+	if blockByteCount == 0 || blockByteCount%4 != 0 || blockByteCount > maxInt {
+		return errors.New("invalid block size")
+	}
+	return nil
+}
+
+func readStartPacket(body []byte) (startPacket, error) {
+	buf := bytes.NewBuffer(body)
+
+	var h startPacketHeader
+	err := binary.Read(buf, binary.LittleEndian, &h)
+	if err != nil {
+		return startPacket{}, err
+	}
+
+	err = checkBlockByteCount(h.BlockSize)
+	if err != nil {
+		return startPacket{}, err
+	}
+
+	generator := buf.Next(int(h.GaloisFieldSize))
+	if h.GaloisFieldSize != 2 || !bytes.Equal(generator, gf2p16Generator[:]) {
+		return startPacket{}, errors.New("unsupported Galois field")
+	}
+
+	return startPacket{h.ParentInputSetID, h.ParentRootChecksum, int(h.BlockSize)}, nil
+}
+
+func writeStartPacket(packet startPacket) ([]byte, error) {
+	err := checkBlockByteCount(uint64(packet.blockByteCount))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	h := startPacketHeader{
+		ParentInputSetID:   packet.parentSetID,
+		ParentRootChecksum: packet.parentRootChecksum,
+		BlockSize:          uint64(packet.blockByteCount),
+		GaloisFieldSize:    uint8(len(gf2p16Generator)),
+	}
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, h)
+	_, _ = buf.Write(gf2p16Generator[:])
+	return buf.Bytes(), nil
+}
+
+// computeInputSetID returns the input set ID for the given start
+// packet body. The spec only requires that it be unique, so it's
+// derived from the body, like PAR2's recovery set ID, so that
+// creating a PAR3 file is deterministic.
+func computeInputSetID(startPacketBody []byte) inputSetID {
+	var id inputSetID
+	hash := blake3Sum256(startPacketBody)
+	copy(id[:], hash[:])
+	return id
+}
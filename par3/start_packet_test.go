@@ -0,0 +1,63 @@
+package par3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartPacketRoundTrip(t *testing.T) {
+	packet := startPacket{
+		parentSetID:        inputSetID{0x1},
+		parentRootChecksum: fingerprint{0x2},
+		blockByteCount:     8,
+	}
+	packetBytes, err := writeStartPacket(packet)
+	require.NoError(t, err)
+	roundTripPacket, err := readStartPacket(packetBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, roundTripPacket)
+}
+
+func TestStartPacketInvalidBlockByteCount(t *testing.T) {
+	for _, blockByteCount := range []int{0, 6} {
+		_, err := writeStartPacket(startPacket{blockByteCount: blockByteCount})
+		require.Error(t, err)
+	}
+}
+
+func TestStartPacketUnsupportedGaloisField(t *testing.T) {
+	packetBytes, err := writeStartPacket(startPacket{blockByteCount: 8})
+	require.NoError(t, err)
+	// Change the generator to that of GF(2^16) with x^16 + x^5
+	// + x^3 + x^2 + 1.
+	packetBytes[len(packetBytes)-2] = 0x2d
+	packetBytes[len(packetBytes)-1] = 0x00
+	_, err = readStartPacket(packetBytes)
+	require.Error(t, err)
+}
+
+func TestStartPacketGolden(t *testing.T) {
+	packet := startPacket{
+		parentSetID:        inputSetID{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8},
+		parentRootChecksum: fingerprint{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf},
+		blockByteCount:     2000,
+	}
+	expectedBytes := goldenBytes(t,
+		// Parent input set ID.
+		"01 02 03 04 05 06 07 08",
+		// Parent root checksum.
+		"a0 a1 a2 a3 a4 a5 a6 a7 a8 a9 aa ab ac ad ae af",
+		// Block size.
+		"d0 07 00 00 00 00 00 00",
+		// Galois field size, and its generator x^16 + x^12 +
+		// x^3 + x + 1 without its leading term.
+		"02 0b 10",
+	)
+	packetBytes, err := writeStartPacket(packet)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, packetBytes)
+	readPacket, err := readStartPacket(expectedBytes)
+	require.NoError(t, err)
+	require.Equal(t, packet, readPacket)
+}
@@ -0,0 +1,74 @@
+package par3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"unicode/utf8"
+)
+
+// readString reads a string stored as a 2-byte length followed by
+// that many bytes of UTF-8.
+func readString(buf *bytes.Buffer) (string, error) {
+	var length uint16
+	err := binary.Read(buf, binary.LittleEndian, &length)
+	if err != nil {
+		return "", err
+	}
+	s := buf.Next(int(length))
+	if len(s) != int(length) {
+		return "", errors.New("could not read string")
+	}
+	if !utf8.Valid(s) {
+		return "", errors.New("invalid UTF-8 string")
+	}
+	return string(s), nil
+}
+
+func writeString(buf *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return errors.New("string too long")
+	}
+	if !utf8.ValidString(s) {
+		return errors.New("invalid UTF-8 string")
+	}
+	// Writes to a bytes.Buffer never fail.
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(s)))
+	_, _ = buf.WriteString(s)
+	return nil
+}
+
+// readFingerprints reads fingerprints from buf until it's empty.
+func readFingerprints(buf *bytes.Buffer) ([]fingerprint, error) {
+	fingerprintSize := len(fingerprint{})
+	if buf.Len()%fingerprintSize != 0 {
+		return nil, errors.New("invalid size")
+	}
+	fingerprints := make([]fingerprint, buf.Len()/fingerprintSize)
+	err := binary.Read(buf, binary.LittleEndian, fingerprints)
+	if err != nil {
+		return nil, err
+	}
+	return fingerprints, nil
+}
+
+// skipOptions skips the checksums of option packets, e.g. for
+// permissions, which are preceded by a 1-byte count. Options aren't
+// supported yet.
+func skipOptions(buf *bytes.Buffer) error {
+	optionCount, err := buf.ReadByte()
+	if err != nil {
+		return err
+	}
+	optionsLength := int(optionCount) * len(fingerprint{})
+	if len(buf.Next(optionsLength)) != optionsLength {
+		return errors.New("could not read options")
+	}
+	return nil
+}
+
+// writeNoOptions writes an empty list of option packet checksums.
+func writeNoOptions(buf *bytes.Buffer) {
+	_ = buf.WriteByte(0)
+}
@@ -0,0 +1,118 @@
+package par3
+
+import (
+	"io/fs"
+
+	"github.com/akalin/gopar/fsio"
+)
+
+// VerifyDelegate is just DecoderDelegate for now.
+type VerifyDelegate interface {
+	DecoderDelegate
+}
+
+// DoNothingVerifyDelegate is an implementation of VerifyDelegate that
+// does nothing for all methods.
+type DoNothingVerifyDelegate struct {
+	DoNothingDecoderDelegate
+}
+
+// VerifyOptions holds all the options for Verify.
+type VerifyOptions struct {
+	// The number of goroutines to use while encoding. If <= 0,
+	// NumGoroutinesDefault() is used.
+	NumGoroutines int
+	// The VerifyDelegate to use. If nil, DoNothingVerifyDelegate
+	// is used.
+	VerifyDelegate VerifyDelegate
+	// The directory that the data files are looked up in. If
+	// empty, the directory of parPath is used.
+	BasePath string
+	// If Purge is true, then if no repair is needed, the par
+	// file and its parity volumes are removed. This requires the
+	// file system passed to VerifyFS to be a fsio.RemoveFS.
+	Purge bool
+}
+
+// VerifyResult holds the result of a Verify call.
+type VerifyResult struct {
+	// ShardCounts contains shard counts which can be used to deduce
+	// whether repair is necessary and/or possible.
+	ShardCounts ShardCounts
+	// PurgedPaths contains the paths of the files that were
+	// removed, if Purge is set to true in VerifyOptions.
+	PurgedPaths []string
+}
+
+// Verify a par file at parPath with the given options. The returned
+// VerifyResult is not filled in if an error is returned.
+func Verify(parPath string, options VerifyOptions) (VerifyResult, error) {
+	return verify(defaultFileIO{}, parPath, options)
+}
+
+// VerifyFS is like Verify, except that it reads files from fsys
+// instead of the OS file system, and parPath is a name in fsys. The
+// paths passed to the delegate are under fsio.Root().
+func VerifyFS(fsys fs.FS, parPath string, options VerifyOptions) (VerifyResult, error) {
+	p := fsio.PathFS{FS: fsys}
+	if options.BasePath != "" {
+		options.BasePath = p.Path(options.BasePath)
+	}
+	result, err := verify(p, p.Path(parPath), options)
+	for i, path := range result.PurgedPaths {
+		name, nameErr := p.Name(path)
+		if nameErr != nil {
+			return result, nameErr
+		}
+		result.PurgedPaths[i] = name
+	}
+	return result, err
+}
+
+func verify(fileIO fileIO, parPath string, options VerifyOptions) (VerifyResult, error) {
+	err := checkExtension(parPath)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	delegate := options.VerifyDelegate
+	if delegate == nil {
+		delegate = DoNothingVerifyDelegate{}
+	}
+
+	numGoroutines := options.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = NumGoroutinesDefault()
+	}
+
+	decoder, err := newDecoder(fileIO, delegate, parPath, numGoroutines)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	if options.BasePath != "" {
+		decoder.basePath = options.BasePath
+	}
+
+	err = decoder.LoadFileData()
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	err = decoder.LoadParityData()
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	shardCounts := decoder.ShardCounts()
+	var purgedPaths []string
+	if options.Purge && !shardCounts.RepairNeeded() {
+		purgedPaths, err = decoder.Purge()
+		if err != nil {
+			return VerifyResult{}, err
+		}
+	}
+	return VerifyResult{
+		ShardCounts: shardCounts,
+		PurgedPaths: purgedPaths,
+	}, nil
+}
@@ -0,0 +1,155 @@
+package rsec16
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+
+	"github.com/akalin/gopar/gf2p16"
+)
+
+// ReconstructionCacheStats holds statistics about the cache of
+// reconstruction matrices of a Coder.
+type ReconstructionCacheStats struct {
+	// Hits is the number of times a reconstruction matrix was
+	// found in the cache, and Misses is the number of times it
+	// had to be computed.
+	Hits, Misses int64
+	// Evictions is the number of reconstruction matrices that
+	// were evicted to make room for new ones.
+	Evictions int64
+	// Len is the number of reconstruction matrices in the cache,
+	// which is at most Capacity.
+	Len, Capacity int
+}
+
+type reconstructionCacheEntry struct {
+	key    string
+	matrix gf2p16.Matrix
+}
+
+// A reconstructionCache is an LRU cache of reconstruction matrices,
+// keyed by the available rows and the used parity rows, which
+// determine the missing rows. It's safe for concurrent use.
+type reconstructionCache struct {
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries from most to least recently used.
+	order *list.List
+	stats ReconstructionCacheStats
+}
+
+func newReconstructionCache(capacity int) *reconstructionCache {
+	return &reconstructionCache{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		stats:   ReconstructionCacheStats{Capacity: capacity},
+	}
+}
+
+func reconstructionCacheKey(availableRows, usedParityRows []int) string {
+	// The parity rows are offset by one and separated by a zero,
+	// so that different pairs of lists always give different keys.
+	buf := make([]byte, binary.MaxVarintLen64*(len(availableRows)+len(usedParityRows))+1)
+	n := 0
+	for _, i := range availableRows {
+		n += binary.PutUvarint(buf[n:], uint64(i)+1)
+	}
+	n++
+	for _, i := range usedParityRows {
+		n += binary.PutUvarint(buf[n:], uint64(i)+1)
+	}
+	return string(buf[:n])
+}
+
+func (c *reconstructionCache) get(key string) (gf2p16.Matrix, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// Don't count lookups while caching is disabled, so that
+	// the stats only reflect how well the cache is doing.
+	if c.stats.Capacity <= 0 {
+		return gf2p16.Matrix{}, false
+	}
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return gf2p16.Matrix{}, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(e)
+	return e.Value.(reconstructionCacheEntry).matrix, true
+}
+
+func (c *reconstructionCache) evictToCapacity() {
+	for c.order.Len() > c.stats.Capacity {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(reconstructionCacheEntry).key)
+		c.stats.Evictions++
+	}
+	c.stats.Len = c.order.Len()
+}
+
+func (c *reconstructionCache) put(key string, matrix gf2p16.Matrix) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stats.Capacity <= 0 {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		// Another goroutine computed the same matrix in the
+		// meantime.
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(reconstructionCacheEntry{key, matrix})
+	c.evictToCapacity()
+}
+
+func (c *reconstructionCache) setCapacity(capacity int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.Capacity = capacity
+	c.evictToCapacity()
+}
+
+func (c *reconstructionCache) getStats() ReconstructionCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
+
+// SetReconstructionCacheCapacity sets the maximum number of
+// reconstruction matrices that c caches, evicting the least recently
+// used ones if there are more than that. Reconstructing data with the
+// same available and used parity shards as a cached matrix skips
+// computing it, which otherwise takes time at least quadratic in the
+// number of data shards. If capacity is <= 0, nothing is cached and
+// no lookups are counted in the stats, which is the default.
+//
+// Coder has a value receiver, but the cache is shared: copies of a
+// Coder returned by a constructor all use the same cache, so setting
+// the capacity on one affects all of them. The zero Coder has no
+// cache, so this does nothing for it.
+//
+// Each cached matrix takes 2 bytes per element, and has as many
+// elements as the number of missing data shards times the number of
+// data shards, so the cache can hold on to a lot of memory; for
+// example, a single matrix for 1000 missing data shards out of 32768
+// takes about 64 MiB.
+func (c Coder) SetReconstructionCacheCapacity(capacity int) {
+	if c.cache != nil {
+		c.cache.setCapacity(capacity)
+	}
+}
+
+// ReconstructionCacheStats returns statistics about the cache of
+// reconstruction matrices of c, which are shared with its copies as
+// described in SetReconstructionCacheCapacity. It returns the zero
+// ReconstructionCacheStats for the zero Coder.
+func (c Coder) ReconstructionCacheStats() ReconstructionCacheStats {
+	if c.cache == nil {
+		return ReconstructionCacheStats{}
+	}
+	return c.cache.getStats()
+}
@@ -0,0 +1,184 @@
+package rsec16
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCacheCapacity is the reconstruction cache capacity used by the
+// tests below, since caching is off by default.
+const testCacheCapacity = 16
+
+func TestReconstructionCacheKey(t *testing.T) {
+	// Moving a row from one list to the other must change the
+	// key.
+	require.NotEqual(t,
+		reconstructionCacheKey([]int{0, 1}, []int{2}),
+		reconstructionCacheKey([]int{0}, []int{1, 2}))
+	require.NotEqual(t,
+		reconstructionCacheKey([]int{200}, nil),
+		reconstructionCacheKey([]int{1, 72}, nil))
+	require.Equal(t,
+		reconstructionCacheKey([]int{0, 300}, []int{5}),
+		reconstructionCacheKey([]int{0, 300}, []int{5}))
+}
+
+// reconstructWithMissing reconstructs the data shards of data whose
+// indices are in missingRows, using the given parity shards, and
+// checks that they match.
+func reconstructWithMissing(t *testing.T, c Coder, data, parity [][]byte, missingRows []int) {
+	corruptData := append([][]byte(nil), data...)
+	for _, i := range missingRows {
+		corruptData[i] = nil
+	}
+	err := c.ReconstructData(corruptData, parity)
+	require.NoError(t, err)
+	require.Equal(t, data, corruptData)
+}
+
+func testCoderReconstructionCache(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+	require.Equal(t, ReconstructionCacheStats{}, c.ReconstructionCacheStats())
+
+	// Nothing is cached or counted by default.
+	reconstructWithMissing(t, c, data, parity, []int{0, 2})
+	reconstructWithMissing(t, c, data, parity, []int{0, 2})
+	require.Equal(t, ReconstructionCacheStats{}, c.ReconstructionCacheStats())
+
+	c.SetReconstructionCacheCapacity(testCacheCapacity)
+	require.Equal(t, ReconstructionCacheStats{0, 0, 0, 0, testCacheCapacity}, c.ReconstructionCacheStats())
+
+	// Nothing is missing, so the cache isn't consulted.
+	reconstructWithMissing(t, c, data, parity, nil)
+	require.Equal(t, ReconstructionCacheStats{0, 0, 0, 0, testCacheCapacity}, c.ReconstructionCacheStats())
+
+	reconstructWithMissing(t, c, data, parity, []int{0, 2})
+	reconstructWithMissing(t, c, data, parity, []int{0, 2})
+	require.Equal(t, ReconstructionCacheStats{1, 1, 0, 1, testCacheCapacity}, c.ReconstructionCacheStats())
+
+	// A different parity shard is used, so the matrix is
+	// different.
+	parityMissingFirst := [][]byte{nil, parity[1], parity[2]}
+	reconstructWithMissing(t, c, data, parityMissingFirst, []int{0, 2})
+	require.Equal(t, ReconstructionCacheStats{1, 2, 0, 2, testCacheCapacity}, c.ReconstructionCacheStats())
+
+	// Copies share the cache.
+	c2 := c
+	reconstructWithMissing(t, c2, data, parity, []int{0, 2})
+	require.Equal(t, ReconstructionCacheStats{2, 2, 0, 2, testCacheCapacity}, c.ReconstructionCacheStats())
+	c2.SetReconstructionCacheCapacity(1)
+	require.Equal(t, ReconstructionCacheStats{2, 2, 1, 1, 1}, c.ReconstructionCacheStats())
+
+	// The zero Coder has no cache.
+	var zero Coder
+	zero.SetReconstructionCacheCapacity(testCacheCapacity)
+	require.Equal(t, ReconstructionCacheStats{}, zero.ReconstructionCacheStats())
+}
+
+func TestCoderReconstructionCache(t *testing.T) {
+	testCoder(t, testCoderReconstructionCache)
+}
+
+func testCoderReconstructionCacheEviction(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+	c.SetReconstructionCacheCapacity(2)
+
+	reconstructWithMissing(t, c, data, parity, []int{0})
+	reconstructWithMissing(t, c, data, parity, []int{1})
+	// Use {0} so that {1} is the least recently used.
+	reconstructWithMissing(t, c, data, parity, []int{0})
+	reconstructWithMissing(t, c, data, parity, []int{2})
+	require.Equal(t, ReconstructionCacheStats{1, 3, 1, 2, 2}, c.ReconstructionCacheStats())
+
+	reconstructWithMissing(t, c, data, parity, []int{0})
+	reconstructWithMissing(t, c, data, parity, []int{1})
+	require.Equal(t, ReconstructionCacheStats{2, 4, 2, 2, 2}, c.ReconstructionCacheStats())
+
+	c.SetReconstructionCacheCapacity(1)
+	require.Equal(t, ReconstructionCacheStats{2, 4, 3, 1, 1}, c.ReconstructionCacheStats())
+
+	c.SetReconstructionCacheCapacity(0)
+	reconstructWithMissing(t, c, data, parity, []int{3})
+	reconstructWithMissing(t, c, data, parity, []int{3})
+	require.Equal(t, ReconstructionCacheStats{2, 4, 4, 0, 0}, c.ReconstructionCacheStats())
+}
+
+func TestCoderReconstructionCacheEviction(t *testing.T) {
+	testCoder(t, testCoderReconstructionCacheEviction)
+}
+
+func testCoderReconstructionCacheConcurrent(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	rand := rand.New(rand.NewSource(1))
+	dataShards := 10
+	c, err := newCoder(dataShards, 4)
+	require.NoError(t, err)
+	c.SetReconstructionCacheCapacity(3)
+	data := makeStreamTestData(rand, dataShards, 20)
+	parity := c.GenerateParity(data)
+
+	var missingRows [][]int
+	for i := 0; i < 6; i++ {
+		missingRows = append(missingRows, rand.Perm(dataShards)[:1+i%4])
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				reconstructWithMissing(t, c, data, parity, missingRows[(i+j)%len(missingRows)])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.ReconstructionCacheStats()
+	require.Equal(t, int64(4*20), stats.Hits+stats.Misses)
+	require.True(t, stats.Len <= 3)
+}
+
+func TestCoderReconstructionCacheConcurrent(t *testing.T) {
+	testCoder(t, testCoderReconstructionCacheConcurrent)
+}
+
+func BenchmarkCoderReconstructDataCache(b *testing.B) {
+	rand := rand.New(rand.NewSource(1))
+	for _, config := range []struct {
+		dataShards   int
+		parityShards int
+	}{{100, 10}, {1000, 100}} {
+		for _, capacity := range []int{0, testCacheCapacity} {
+			b.Run(fmt.Sprintf("%dx%d,capacity=%d", config.dataShards, config.parityShards, capacity), func(b *testing.B) {
+				c, err := newCoderPAR2Vandermonde(config.dataShards, config.parityShards)
+				require.NoError(b, err)
+				c.SetReconstructionCacheCapacity(capacity)
+				data := makeStreamTestData(rand, config.dataShards, 1024)
+				parity := c.GenerateParity(data)
+				missingRows := rand.Perm(config.dataShards)[:config.parityShards]
+				corruptData := make([][]byte, config.dataShards)
+
+				b.SetBytes(int64(config.dataShards * 1024))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					copy(corruptData, data)
+					for _, j := range missingRows {
+						corruptData[j] = nil
+					}
+					err := c.ReconstructData(corruptData, parity)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
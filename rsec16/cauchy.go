@@ -7,3 +7,120 @@ func newCauchyMatrix(rows, columns int, xFunc, yFunc func(int) gf2p16.T) gf2p16.
 		return xFunc(i).Plus(yFunc(j)).Inverse()
 	})
 }
+
+// logProductOfDifferences returns the log of the product of w - p
+// over the elements p of points, skipping the element with index
+// skip, if any. w must not equal any of the other elements.
+func logProductOfDifferences(w gf2p16.T, points []gf2p16.T, skip int) uint32 {
+	// Since each log is < 2^16, this can't overflow as long as
+	// there are at most 2^16 points.
+	var sum uint32
+	for k, p := range points {
+		if k != skip {
+			sum += logOf(w.Minus(p))
+		}
+	}
+	return sum % (fieldOrder - 1)
+}
+
+// cauchyInverseFactors returns the logs of the lists e and f such
+// that the inverse of the Cauchy matrix with elements 1/(xs[i] -
+// ys[j]) has elements e[i] * f[j] / (xs[j] - ys[i]). It takes O(n^2)
+// operations, where n is len(xs), which must equal len(ys).
+//
+// With A(z) = prod_k (z - xs[k]) and B(z) = prod_k (z - ys[k]), the
+// inverse has elements A(ys[i]) B(xs[j]) / ((xs[j] - ys[i]) A'(xs[j])
+// B'(ys[i])), up to sign, which doesn't matter in characteristic 2,
+// and A'(xs[j]) and B'(ys[i]) are products of differences.
+func cauchyInverseFactors(xs, ys []gf2p16.T, numGoroutines int) (logE, logF []uint32) {
+	n := len(xs)
+	if len(ys) != n {
+		panic("mismatched lengths")
+	}
+
+	logE = make([]uint32, n)
+	logF = make([]uint32, n)
+	runParallelRanges(n, numGoroutines, 1, func(start, end int) {
+		for i := start; i < end; i++ {
+			logE[i] = logProductOfDifferences(ys[i], xs, -1) + (fieldOrder - 1) - logProductOfDifferences(ys[i], ys, i)
+			logF[i] = logProductOfDifferences(xs[i], ys, -1) + (fieldOrder - 1) - logProductOfDifferences(xs[i], xs, i)
+		}
+	})
+	return logE, logF
+}
+
+// invertCauchyMatrix returns the inverse of the Cauchy matrix with
+// elements 1/(xs[i] - ys[j]), which must have distinct elements
+// between them, in O(n^2) operations instead of the O(n^3) operations
+// that row reduction takes.
+func invertCauchyMatrix(xs, ys []gf2p16.T, numGoroutines int) gf2p16.Matrix {
+	n := len(xs)
+	logE, logF := cauchyInverseFactors(xs, ys, numGoroutines)
+	elements := make([]gf2p16.T, n*n)
+	runParallelRanges(n, numGoroutines, 1, func(start, end int) {
+		for i := start; i < end; i++ {
+			for j := 0; j < n; j++ {
+				elements[i*n+j] = expOf(logE[i] + logF[j] + (fieldOrder - 1) - logOf(xs[j].Minus(ys[i])))
+			}
+		}
+	})
+	return gf2p16.NewMatrixFromSlice(n, n, elements)
+}
+
+// makeCauchyReconstructionMatrix returns the same matrix as
+// makeReconstructionMatrix does for the parity matrix returned by
+// newCauchyParityMatrix, but in O(n^2) operations, where n is
+// dataShards.
+func makeCauchyReconstructionMatrix(dataShards int, availableRows, missingRows, usedParityRows []int, numGoroutines int) gf2p16.Matrix {
+	// Let xs be the Cauchy points of the used parity rows, ys be
+	// those of the missing rows, and zs be those of the available
+	// rows, and let C(us, vs) be the Cauchy matrix with elements
+	// 1/(us[i] - vs[j]). Then the missing data is C(xs, ys)^{-1}
+	// times the used parity minus C(xs, zs) times the available
+	// data.
+	//
+	// By the above, C(xs, ys)^{-1} has elements e[i] f[j] /
+	// (xs[j] - ys[i]), and expanding 1/((xs[j] - ys[i]) (xs[j] -
+	// zs[l])) into partial fractions, C(xs, ys)^{-1} C(xs, zs) has
+	// elements e[i] / (ys[i] - zs[l]) times (g(ys[i]) - g(zs[l])),
+	// where g(w) = sum_j f[j] / (xs[j] - w). Since f[j] = B(xs[j]) /
+	// A'(xs[j]), g(w) A(w) is the Lagrange interpolation of B at
+	// xs, which is B(w) - A(w), since A and B are both monic with
+	// degree len(xs). So g(ys[i]) = -1 and g(zs[l]) = B(zs[l]) /
+	// A(zs[l]) - 1, which means that the elements are -e[i] h[l] /
+	// (ys[i] - zs[l]), where h[l] = B(zs[l]) / A(zs[l]).
+	xs := make([]gf2p16.T, len(usedParityRows))
+	for i, k := range usedParityRows {
+		xs[i] = gf2p16.T(dataShards + k)
+	}
+	ys := make([]gf2p16.T, len(missingRows))
+	for i, k := range missingRows {
+		ys[i] = gf2p16.T(k)
+	}
+	zs := make([]gf2p16.T, len(availableRows))
+	for i, k := range availableRows {
+		zs[i] = gf2p16.T(k)
+	}
+
+	logE, logF := cauchyInverseFactors(xs, ys, numGoroutines)
+	logH := make([]uint32, len(zs))
+	runParallelRanges(len(zs), numGoroutines, 1, func(start, end int) {
+		for l := start; l < end; l++ {
+			logH[l] = logProductOfDifferences(zs[l], ys, -1) + (fieldOrder - 1) - logProductOfDifferences(zs[l], xs, -1)
+		}
+	})
+
+	elements := make([]gf2p16.T, len(ys)*dataShards)
+	runParallelRanges(len(ys), numGoroutines, 1, func(start, end int) {
+		for i := start; i < end; i++ {
+			row := elements[i*dataShards : (i+1)*dataShards]
+			for l, z := range zs {
+				row[l] = expOf(logE[i] + logH[l] + (fieldOrder - 1) - logOf(ys[i].Minus(z)))
+			}
+			for j, x := range xs {
+				row[len(zs)+j] = expOf(logE[i] + logF[j] + (fieldOrder - 1) - logOf(x.Minus(ys[i])))
+			}
+		}
+	})
+	return gf2p16.NewMatrixFromSlice(len(ys), dataShards, elements)
+}
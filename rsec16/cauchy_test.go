@@ -1,6 +1,8 @@
 package rsec16
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/akalin/gopar/gf2p16"
@@ -20,3 +22,69 @@ func TestCauchyMatrix(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestInvertCauchyMatrix(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 10, 100} {
+		// Pick 2n distinct points, and split them into xs and
+		// ys.
+		points := rand.Perm(1 << 16)[:2*n]
+		xs := make([]gf2p16.T, n)
+		ys := make([]gf2p16.T, n)
+		for i := 0; i < n; i++ {
+			xs[i] = gf2p16.T(points[i])
+			ys[i] = gf2p16.T(points[n+i])
+		}
+		m := newCauchyMatrix(n, n, func(i int) gf2p16.T {
+			return xs[i]
+		}, func(i int) gf2p16.T {
+			return ys[i]
+		})
+		expectedMInv, err := m.Inverse()
+		require.NoError(t, err)
+
+		for _, numGoroutines := range []int{1, 3} {
+			mInv := invertCauchyMatrix(xs, ys, numGoroutines)
+			require.Equal(t, expectedMInv, mInv, "n=%d", n)
+		}
+	}
+}
+
+func TestMakeCauchyReconstructionMatrix(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	dataShards := 20
+	parityShards := 15
+	parityMatrix := newCauchyParityMatrix(dataShards, parityShards)
+	for _, missingCount := range []int{1, 5, 15} {
+		perm := rand.Perm(dataShards)
+		missingRows := append([]int(nil), perm[:missingCount]...)
+		availableRows := append([]int(nil), perm[missingCount:]...)
+		usedParityRows := rand.Perm(parityShards)[:missingCount]
+
+		expectedReconstructionMatrix, err := makeReconstructionMatrixNaive(dataShards, availableRows, missingRows, usedParityRows, parityMatrix)
+		require.NoError(t, err)
+
+		for _, numGoroutines := range []int{1, 3} {
+			reconstructionMatrix := makeCauchyReconstructionMatrix(dataShards, availableRows, missingRows, usedParityRows, numGoroutines)
+			require.Equal(t, expectedReconstructionMatrix, reconstructionMatrix, "missingCount=%d", missingCount)
+		}
+	}
+}
+
+func BenchmarkInvertCauchyMatrix(b *testing.B) {
+	for _, n := range []int{1000, 5000, 20000} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			xs := make([]gf2p16.T, n)
+			ys := make([]gf2p16.T, n)
+			for i := 0; i < n; i++ {
+				xs[i] = gf2p16.T(n + i)
+				ys[i] = gf2p16.T(i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				invertCauchyMatrix(xs, ys, DefaultNumGoroutines())
+			}
+		})
+	}
+}
@@ -1,17 +1,19 @@
 package rsec16
 
 import (
+	"bytes"
 	"errors"
 	"math"
 	"runtime"
+	"sync"
 
 	"github.com/akalin/gopar/gf2p16"
 	"github.com/klauspost/cpuid/v2"
 )
 
 // DefaultNumGoroutines returns a default value for the numGoroutines
-// parameter to pass into NewCoderCauchy and
-// NewCoderPAR2Vandermonde. This is not necessarily GOMAXPROCS.
+// parameter to pass into NewCoderCauchy, NewCoderPAR2Vandermonde, and
+// NewFFTCoder. This is not necessarily GOMAXPROCS.
 func DefaultNumGoroutines() int {
 	numGoroutines := runtime.GOMAXPROCS(0)
 	physicalCores := cpuid.CPU.PhysicalCores
@@ -26,11 +28,27 @@ func DefaultNumGoroutines() int {
 }
 
 // A Coder is an object that can generate parity shards, verify parity
-// shards, and reconstruct data shards from parity shards.
+// shards, and reconstruct data and parity shards from the shards that
+// are present. It can also cache the matrices used to reconstruct
+// data shards for recently seen sets of present shards; see
+// SetReconstructionCacheCapacity.
+//
+// Verify, ReconstructSome, ReconstructParity and ReconstructData work
+// on whole shards, and allocate whatever they compute. To bound
+// memory use by processing shards in passes over byte ranges, use
+// GenerateParityInto and ReconstructDataInto instead.
 type Coder struct {
 	dataShards, parityShards int
 	numGoroutines            int
 	parityMatrix             gf2p16.Matrix
+	// isCauchy is true if parityMatrix was returned by
+	// newCauchyParityMatrix, in which case reconstruction
+	// matrices can be computed in closed form.
+	isCauchy bool
+	// cache holds reconstruction matrices for recently seen sets
+	// of present shards. It's a pointer so that copies of a Coder
+	// share it, and it's nil for the zero Coder.
+	cache *reconstructionCache
 }
 
 func newCauchyParityMatrix(dataShards, parityShards int) gf2p16.Matrix {
@@ -59,23 +77,36 @@ func NewCoderCauchy(dataShards, parityShards, numGoroutines int) (Coder, error)
 	}
 
 	parityMatrix := newCauchyParityMatrix(dataShards, parityShards)
-	return Coder{dataShards, parityShards, numGoroutines, parityMatrix}, nil
+	return Coder{dataShards, parityShards, numGoroutines, parityMatrix, true, newReconstructionCache(0)}, nil
 }
 
+// maxPAR2DataShards is the number of generators of GF(2^16), which
+// is the maximum number of data shards for the PAR2 Vandermonde
+// matrix.
+const maxPAR2DataShards = 32768
+
+var generatorsOnce sync.Once
 var generators []gf2p16.T
 
-func init() {
-	// TODO: Generate this table at compile time.
-	for i := 0; i < (1 << 16); i++ {
-		if i%3 == 0 || i%5 == 0 || i%17 == 0 || i%257 == 0 {
-			continue
+// getGenerators returns the generators of GF(2^16) in the order used
+// by the PAR2 spec, computing them the first time it's called, so
+// that nothing is paid for them unless they're needed.
+func getGenerators() []gf2p16.T {
+	generatorsOnce.Do(func() {
+		generators = make([]gf2p16.T, 0, maxPAR2DataShards)
+		for i := 0; i < (1 << 16); i++ {
+			if i%3 == 0 || i%5 == 0 || i%17 == 0 || i%257 == 0 {
+				continue
+			}
+			g := gf2p16.T(2).Pow(uint32(i))
+			generators = append(generators, g)
 		}
-		g := gf2p16.T(2).Pow(uint32(i))
-		generators = append(generators, g)
-	}
+	})
+	return generators
 }
 
 func newVandermondeParityMatrix(dataShards, parityShards int) gf2p16.Matrix {
+	generators := getGenerators()
 	return newVandermondeMatrix(parityShards, dataShards, func(i int) gf2p16.T {
 		return generators[i]
 	})
@@ -126,7 +157,7 @@ func NewCoderPAR2Vandermonde(dataShards, parityShards, numGoroutines int) (Coder
 		panic("invalid goroutine count")
 	}
 
-	if dataShards > len(generators) {
+	if dataShards > maxPAR2DataShards {
 		return Coder{}, errors.New("too many data shards")
 	}
 
@@ -135,7 +166,7 @@ func NewCoderPAR2Vandermonde(dataShards, parityShards, numGoroutines int) (Coder
 	}
 
 	parityMatrix := newVandermondeParityMatrix(dataShards, parityShards)
-	return Coder{dataShards, parityShards, numGoroutines, parityMatrix}, nil
+	return Coder{dataShards, parityShards, numGoroutines, parityMatrix, false, newReconstructionCache(0)}, nil
 }
 
 func (c Coder) applyMatrix(m gf2p16.Matrix, in, out [][]byte) {
@@ -155,7 +186,39 @@ func (c Coder) GenerateParity(data [][]byte) [][]byte {
 	return parity
 }
 
-func makeReconstructionMatrix(dataShards int, availableRows, missingRows, usedParityRows []int, parityMatrix gf2p16.Matrix) (gf2p16.Matrix, error) {
+// GenerateParityInto is like GenerateParity, except that it only
+// computes the parity shards with indices in [start,
+// start+len(parity)), and writes them into parity instead of
+// allocating them. The byte slices of parity must have the same
+// length as those of data. Since each pair of bytes of a parity shard
+// depends only on the pairs of bytes at the same offset in the data
+// shards, shards can be processed in passes over byte ranges by
+// passing in subslices, which gives the same result as processing
+// them all at once.
+func (c Coder) GenerateParityInto(data, parity [][]byte, start int) {
+	if start < 0 || start+len(parity) > c.parityShards {
+		panic("invalid parity shard range")
+	}
+	m := c.parityMatrix
+	if start > 0 {
+		m = gf2p16.NewMatrixFromFunction(len(parity), c.dataShards, func(i, j int) gf2p16.T {
+			return c.parityMatrix.At(start+i, j)
+		})
+	}
+	c.applyMatrix(m, data, parity)
+}
+
+// ParityCoefficient returns the coefficient that the data shard with
+// index j is multiplied by when computing the parity shard with index
+// i. Since the parity shards are linear in the data shards, this can
+// be used to update parity shards when a data shard changes, by
+// adding ParityCoefficient(i, j) times the difference to the ith
+// parity shard.
+func (c Coder) ParityCoefficient(i, j int) gf2p16.T {
+	return c.parityMatrix.At(i, j)
+}
+
+func makeReconstructionMatrix(dataShards int, availableRows, missingRows, usedParityRows []int, parityMatrix gf2p16.Matrix, numGoroutines int) (gf2p16.Matrix, error) {
 	m := gf2p16.NewMatrixFromFunction(len(usedParityRows), len(usedParityRows), func(i, j int) gf2p16.T {
 		k := usedParityRows[i]
 		l := missingRows[j]
@@ -172,64 +235,291 @@ func makeReconstructionMatrix(dataShards int, availableRows, missingRows, usedPa
 		}
 		return 0
 	})
-	return m.RowReduceForInverse(n)
+	return m.RowReduceForInverseParallel(n, numGoroutines)
 }
 
-// NotEnoughParityShardsError is returned by ReconstructData or if
-// there isn't enough parity shards to reconstruct some missing data.
+// NotEnoughParityShardsError is returned by ReconstructData,
+// ReconstructSome, and ReconstructParity if there aren't enough parity
+// shards to reconstruct some missing data.
 type NotEnoughParityShardsError struct{}
 
 func (NotEnoughParityShardsError) Error() string {
 	return "not enough parity shards"
 }
 
-// ReconstructData takes a list of data shards and parity shards, some
-// of which may be nil, and tries to reconstruct the missing data
-// shards. If successful, the nil rows of data are filled in and a nil
-// error is returned. Otherwise, an error is returned. In particular,
-// if there are missing data shards but there aren't enough parity
-// shards to reconstruct them, NotEnoughParityShardsError is returned.
-func (c Coder) ReconstructData(data, parity [][]byte) error {
-	var availableRows, missingRows []int
-	var input [][]byte
-	for i, dataShard := range data {
-		if dataShard != nil {
-			availableRows = append(availableRows, i)
-			input = append(input, dataShard)
+// A reconstructionPlan holds which shards are used to reconstruct
+// the missing data shards, and the matrix to apply to them, which
+// depend only on which shards are present.
+type reconstructionPlan struct {
+	availableRows, missingRows, usedParityRows []int
+	matrix                                     gf2p16.Matrix
+}
+
+// planReconstruction returns a reconstructionPlan for the data and
+// parity shards whose entries in dataPresent and parityPresent are
+// true. If there are no missing data shards, the returned plan has
+// empty missingRows and no matrix.
+func (c Coder) planReconstruction(dataPresent, parityPresent []bool) (reconstructionPlan, error) {
+	var p reconstructionPlan
+	for i, present := range dataPresent {
+		if present {
+			p.availableRows = append(p.availableRows, i)
 		} else {
-			missingRows = append(missingRows, i)
+			p.missingRows = append(p.missingRows, i)
 		}
 	}
 
-	if len(missingRows) == 0 {
+	if len(p.missingRows) == 0 {
 		// Nothing to reconstruct.
-		return nil
+		return p, nil
+	}
+
+	for i := 0; i < len(parityPresent) && len(p.usedParityRows) < len(p.missingRows); i++ {
+		if parityPresent[i] {
+			p.usedParityRows = append(p.usedParityRows, i)
+		}
+	}
+
+	if len(p.usedParityRows) < len(p.missingRows) {
+		return reconstructionPlan{}, NotEnoughParityShardsError{}
+	}
+
+	var key string
+	if c.cache != nil {
+		key = reconstructionCacheKey(p.availableRows, p.usedParityRows)
+		if m, ok := c.cache.get(key); ok {
+			p.matrix = m
+			return p, nil
+		}
 	}
 
-	var usedParityRows []int
-	for i := 0; i < len(parity) && len(input) < c.dataShards; i++ {
-		if parity[i] != nil {
-			usedParityRows = append(usedParityRows, i)
-			input = append(input, parity[i])
+	if c.isCauchy {
+		p.matrix = makeCauchyReconstructionMatrix(c.dataShards, p.availableRows, p.missingRows, p.usedParityRows, c.numGoroutines)
+	} else {
+		var err error
+		p.matrix, err = makeReconstructionMatrix(c.dataShards, p.availableRows, p.missingRows, p.usedParityRows, c.parityMatrix, c.numGoroutines)
+		if err != nil {
+			return reconstructionPlan{}, err
 		}
 	}
+	if c.cache != nil {
+		c.cache.put(key, p.matrix)
+	}
+	return p, nil
+}
+
+// reconstruct applies p to the shards of data and parity, which must
+// have the shards that p uses, and writes the reconstructed missing
+// data shards into out, which must have an entry for each row of
+// p.matrix in order.
+func (c Coder) reconstruct(p reconstructionPlan, data, parity, out [][]byte) {
+	input := make([][]byte, 0, c.dataShards)
+	for _, i := range p.availableRows {
+		input = append(input, data[i])
+	}
+	for _, i := range p.usedParityRows {
+		input = append(input, parity[i])
+	}
+	c.applyMatrix(p.matrix, input, out)
+}
 
-	if len(input) < c.dataShards {
-		return NotEnoughParityShardsError{}
+func presentShards(shards [][]byte) []bool {
+	present := make([]bool, len(shards))
+	for i, shard := range shards {
+		present[i] = shard != nil
 	}
+	return present
+}
 
-	reconstructionMatrix, err := makeReconstructionMatrix(c.dataShards, availableRows, missingRows, usedParityRows, c.parityMatrix)
+// selectRows returns the matrix made up of the given rows of m.
+func selectRows(m gf2p16.Matrix, rows []int, columns int) gf2p16.Matrix {
+	return gf2p16.NewMatrixFromFunction(len(rows), columns, func(i, j int) gf2p16.T {
+		return m.At(rows[i], j)
+	})
+}
+
+// verifyBatchRowCount is the maximum number of parity shards that
+// Verify computes at once.
+const verifyBatchRowCount = 16
+
+// Verify takes a list of data shards and parity shards, which must
+// have lengths matching the dataShards and parityShards values passed
+// into NewCoder, and returns whether the parity shards match the ones
+// computed from the data shards. The parity shards are computed a few
+// at a time, so at most a few parity shards' worth of memory is
+// allocated. An error is returned if any shard is missing, or if the
+// shards don't all have the same even length.
+func (c Coder) Verify(data, parity [][]byte) (bool, error) {
+	if len(data) != c.dataShards {
+		return false, errors.New("wrong number of data shards")
+	}
+	if len(parity) != c.parityShards {
+		return false, errors.New("wrong number of parity shards")
+	}
+	byteCount := len(data[0])
+	if byteCount%2 != 0 {
+		return false, errors.New("odd shard size")
+	}
+	for _, shards := range [][][]byte{data, parity} {
+		for _, shard := range shards {
+			if shard == nil {
+				return false, errors.New("missing shard")
+			}
+			if len(shard) != byteCount {
+				return false, errors.New("mismatched shard sizes")
+			}
+		}
+	}
+
+	batchRowCount := verifyBatchRowCount
+	if batchRowCount > c.parityShards {
+		batchRowCount = c.parityShards
+	}
+	computed := make([][]byte, batchRowCount)
+	for i := range computed {
+		computed[i] = make([]byte, byteCount)
+	}
+	for start := 0; start < c.parityShards; start += batchRowCount {
+		end := start + batchRowCount
+		if end > c.parityShards {
+			end = c.parityShards
+		}
+		batch := computed[:end-start]
+		c.GenerateParityInto(data, batch, start)
+		for i, shard := range batch {
+			if !bytes.Equal(shard, parity[start+i]) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// ReconstructSome is like ReconstructData, except that it only fills
+// in the nil rows of data and parity whose entries in wanted are
+// true. wanted must have length matching either the dataShards value
+// passed into NewCoder, in which case no parity shards are wanted, or
+// that plus the parityShards value, in which case its last
+// parityShards entries are for the parity shards. Only the wanted
+// data shards are computed, unless a parity shard is also wanted, in
+// which case all missing data shards have to be computed, but only
+// the wanted ones are filled in.
+func (c Coder) ReconstructSome(data, parity [][]byte, wanted []bool) error {
+	if len(wanted) != c.dataShards && len(wanted) != c.dataShards+c.parityShards {
+		panic("invalid wanted length")
+	}
+	isWanted := func(i int) bool {
+		return i < len(wanted) && wanted[i]
+	}
+
+	var wantedParityRows []int
+	for i, shard := range parity {
+		if shard == nil && isWanted(c.dataShards+i) {
+			wantedParityRows = append(wantedParityRows, i)
+		}
+	}
+	needAllData := len(wantedParityRows) > 0
+
+	p, err := c.planReconstruction(presentShards(data), presentShards(parity))
 	if err != nil {
 		return err
 	}
 
-	reconstructedData := make([][]byte, len(missingRows))
-	for i := range reconstructedData {
-		reconstructedData[i] = make([]byte, len(input[0]))
+	var byteCount int
+	if len(p.availableRows) > 0 {
+		byteCount = len(data[p.availableRows[0]])
+	} else if len(p.usedParityRows) > 0 {
+		byteCount = len(parity[p.usedParityRows[0]])
 	}
-	c.applyMatrix(reconstructionMatrix, input, reconstructedData)
-	for i, r := range missingRows {
-		data[r] = reconstructedData[i]
+
+	// Pick the rows of the reconstruction matrix for the missing
+	// data shards that are needed.
+	var neededRows []int
+	for k, r := range p.missingRows {
+		if needAllData || isWanted(r) {
+			neededRows = append(neededRows, k)
+		}
+	}
+
+	allData := data
+	if len(neededRows) > 0 {
+		if len(neededRows) < len(p.missingRows) {
+			p.matrix = selectRows(p.matrix, neededRows, c.dataShards)
+		}
+		reconstructedData := make([][]byte, len(neededRows))
+		for i := range reconstructedData {
+			reconstructedData[i] = make([]byte, byteCount)
+		}
+		c.reconstruct(p, data, parity, reconstructedData)
+
+		allData = append([][]byte(nil), data...)
+		for i, k := range neededRows {
+			r := p.missingRows[k]
+			allData[r] = reconstructedData[i]
+			if isWanted(r) {
+				data[r] = reconstructedData[i]
+			}
+		}
+	}
+
+	if needAllData {
+		reconstructedParity := make([][]byte, len(wantedParityRows))
+		for i := range reconstructedParity {
+			reconstructedParity[i] = make([]byte, byteCount)
+		}
+		c.applyMatrix(selectRows(c.parityMatrix, wantedParityRows, c.dataShards), allData, reconstructedParity)
+		for i, r := range wantedParityRows {
+			parity[r] = reconstructedParity[i]
+		}
+	}
+	return nil
+}
+
+// ReconstructParity is like ReconstructData, except that it fills in
+// the nil rows of parity instead of those of data. Missing data
+// shards are still computed if needed, but they aren't filled in.
+func (c Coder) ReconstructParity(data, parity [][]byte) error {
+	wanted := make([]bool, c.dataShards+c.parityShards)
+	for i := c.dataShards; i < len(wanted); i++ {
+		wanted[i] = true
+	}
+	return c.ReconstructSome(data, parity, wanted)
+}
+
+// ReconstructData takes a list of data shards and parity shards, some
+// of which may be nil, and tries to reconstruct the missing data
+// shards. If successful, the nil rows of data are filled in and a nil
+// error is returned. Otherwise, an error is returned. In particular,
+// if there are missing data shards but there aren't enough parity
+// shards to reconstruct them, NotEnoughParityShardsError is returned.
+func (c Coder) ReconstructData(data, parity [][]byte) error {
+	wanted := make([]bool, c.dataShards)
+	for i := range wanted {
+		wanted[i] = true
+	}
+	return c.ReconstructSome(data, parity, wanted)
+}
+
+// ReconstructDataInto is like ReconstructData, except that it writes
+// the missing data shards into out, in order of their indices in
+// data, instead of allocating them and filling in the nil rows of
+// data. out must have an entry for each nil row of data, with the
+// same length as the other shards. As with GenerateParityInto,
+// shards can be processed in passes over byte ranges by passing in
+// subslices; since the reconstruction matrix depends only on which
+// shards are present, enabling the cache with
+// SetReconstructionCacheCapacity avoids recomputing it for each pass.
+func (c Coder) ReconstructDataInto(data, parity, out [][]byte) error {
+	p, err := c.planReconstruction(presentShards(data), presentShards(parity))
+	if err != nil {
+		return err
+	}
+	if len(out) != len(p.missingRows) {
+		panic("invalid out length")
+	}
+	if len(p.missingRows) == 0 {
+		return nil
 	}
+	c.reconstruct(p, data, parity, out)
 	return nil
 }
@@ -25,7 +25,8 @@ func TestCoderCauchyNewCoderError(t *testing.T) {
 }
 
 func TestGenerators(t *testing.T) {
-	require.Equal(t, 32768, len(generators))
+	generators := getGenerators()
+	require.Equal(t, maxPAR2DataShards, len(generators))
 	for i := 0; i < len(generators); i += 1000 {
 		g := generators[i]
 		for i := uint32(1); i < 65535; i++ {
@@ -84,7 +85,7 @@ func testMakeReconstructionMatrix(t *testing.T, newParityMatrixFn func(int, int)
 	expectedReconstructionMatrix, err := makeReconstructionMatrixNaive(dataShards, availableRows, missingRows, usedParityRows, parityMatrix)
 	require.NoError(t, err)
 
-	reconstructionMatrix, err := makeReconstructionMatrix(dataShards, availableRows, missingRows, usedParityRows, parityMatrix)
+	reconstructionMatrix, err := makeReconstructionMatrix(dataShards, availableRows, missingRows, usedParityRows, parityMatrix, 1)
 	require.NoError(t, err)
 
 	require.Equal(t, expectedReconstructionMatrix, reconstructionMatrix)
@@ -114,7 +115,7 @@ func benchmarkMakeReconstructionMatrix(b *testing.B, newParityMatrixFn func(int,
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := makeReconstructionMatrix(dataShards, availableRows, missingRows, usedParityRows, parityMatrix)
+		_, err := makeReconstructionMatrix(dataShards, availableRows, missingRows, usedParityRows, parityMatrix, 1)
 		require.NoError(b, err)
 	}
 }
@@ -176,6 +177,33 @@ func TestCoderGenerateParity(t *testing.T) {
 	testCoder(t, testCoderGenerateParity)
 }
 
+func testCoderGenerateParityInto(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	expectedParity := c.GenerateParity(data)
+
+	// Compute the last two parity shards in two passes of two
+	// bytes each.
+	parity := [][]byte{make([]byte, 4), make([]byte, 4)}
+	for start := 0; start < 4; start += 2 {
+		dataPass := make([][]byte, len(data))
+		for i, shard := range data {
+			dataPass[i] = shard[start : start+2]
+		}
+		c.GenerateParityInto(dataPass, [][]byte{parity[0][start : start+2], parity[1][start : start+2]}, 1)
+	}
+	require.Equal(t, expectedParity[1:], parity)
+
+	require.Panics(t, func() {
+		c.GenerateParityInto(data, parity, 2)
+	})
+}
+
+func TestCoderGenerateParityInto(t *testing.T) {
+	testCoder(t, testCoderGenerateParityInto)
+}
+
 func testCoderReconstructData(t *testing.T, newCoder func(int, int) (Coder, error)) {
 	data := makeTestData()
 	c, err := newCoder(5, 3)
@@ -265,4 +293,191 @@ func TestCoderReconstructDataNotEnough(t *testing.T) {
 	testCoder(t, testCoderReconstructDataNotEnough)
 }
 
+func testCoderVerify(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	ok, err := c.Verify(data, parity)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	corruptParity := [][]byte{
+		parity[0],
+		parity[1],
+		{0x1, 0x2, 0x3, 0x4},
+	}
+	ok, err = c.Verify(data, corruptParity)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = c.Verify(data, parity[:2])
+	require.Equal(t, errors.New("wrong number of parity shards"), err)
+
+	_, err = c.Verify([][]byte{data[0], data[1], nil, data[3], data[4]}, parity)
+	require.Equal(t, errors.New("missing shard"), err)
+
+	_, err = c.Verify(data, [][]byte{parity[0], parity[1], {0x1, 0x2}})
+	require.Equal(t, errors.New("mismatched shard sizes"), err)
+}
+
+func TestCoderVerify(t *testing.T) {
+	testCoder(t, testCoderVerify)
+}
+
+func testCoderReconstructSome(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	corruptData := [][]byte{
+		nil,
+		data[1],
+		nil,
+		data[3],
+		data[4],
+	}
+	corruptParity := [][]byte{
+		parity[0],
+		nil,
+		parity[2],
+	}
+
+	// Only ask for one of the missing data shards.
+	err = c.ReconstructSome(corruptData, corruptParity, []bool{false, false, true, false, false})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{nil, data[1], data[2], data[3], data[4]}, corruptData)
+	require.Equal(t, [][]byte{parity[0], nil, parity[2]}, corruptParity)
+
+	// Ask for the missing parity shard, which needs the other
+	// missing data shard, which shouldn't be filled in.
+	err = c.ReconstructSome(corruptData, corruptParity, []bool{false, false, false, false, false, false, true, false})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{nil, data[1], data[2], data[3], data[4]}, corruptData)
+	require.Equal(t, parity, corruptParity)
+}
+
+func TestCoderReconstructSome(t *testing.T) {
+	testCoder(t, testCoderReconstructSome)
+}
+
+func testCoderReconstructDataInto(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	c.SetReconstructionCacheCapacity(1)
+	parity := c.GenerateParity(data)
+
+	// Reconstruct the missing data shards in two passes of two
+	// bytes each.
+	out := [][]byte{make([]byte, 4), make([]byte, 4)}
+	for start := 0; start < 4; start += 2 {
+		shardPass := func(shards [][]byte) [][]byte {
+			pass := make([][]byte, len(shards))
+			for i, shard := range shards {
+				if shard != nil {
+					pass[i] = shard[start : start+2]
+				}
+			}
+			return pass
+		}
+		dataPass := shardPass([][]byte{nil, data[1], data[2], nil, data[4]})
+		parityPass := shardPass([][]byte{parity[0], nil, parity[2]})
+		err = c.ReconstructDataInto(dataPass, parityPass, [][]byte{out[0][start : start+2], out[1][start : start+2]})
+		require.NoError(t, err)
+	}
+	require.Equal(t, [][]byte{data[0], data[3]}, out)
+
+	out = [][]byte{make([]byte, 4), make([]byte, 4), make([]byte, 4)}
+	err = c.ReconstructDataInto([][]byte{nil, nil, nil, data[3], data[4]}, parity, out)
+	require.NoError(t, err)
+	require.Equal(t, data[:3], out)
+	err = c.ReconstructDataInto([][]byte{nil, nil, nil, nil, data[4]}, parity, make([][]byte, 4))
+	require.Equal(t, NotEnoughParityShardsError{}, err)
+	require.Panics(t, func() {
+		_ = c.ReconstructDataInto([][]byte{nil, data[1], data[2], data[3], data[4]}, parity, nil)
+	})
+}
+
+func TestCoderReconstructDataInto(t *testing.T) {
+	testCoder(t, testCoderReconstructDataInto)
+}
+
+func testCoderReconstructParity(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	corruptParity := [][]byte{
+		nil,
+		parity[1],
+		nil,
+	}
+	err = c.ReconstructParity(data, corruptParity)
+	require.NoError(t, err)
+	require.Equal(t, parity, corruptParity)
+
+	corruptData := [][]byte{
+		data[0],
+		nil,
+		data[2],
+		data[3],
+		data[4],
+	}
+	corruptParity = [][]byte{
+		nil,
+		parity[1],
+		parity[2],
+	}
+	err = c.ReconstructParity(corruptData, corruptParity)
+	require.NoError(t, err)
+	require.Equal(t, parity, corruptParity)
+	require.Nil(t, corruptData[1])
+
+	corruptData = [][]byte{
+		data[0],
+		nil,
+		nil,
+		data[3],
+		data[4],
+	}
+	corruptParity = [][]byte{
+		nil,
+		nil,
+		parity[2],
+	}
+	err = c.ReconstructParity(corruptData, corruptParity)
+	require.Equal(t, NotEnoughParityShardsError{}, err)
+}
+
+func TestCoderReconstructParity(t *testing.T) {
+	testCoder(t, testCoderReconstructParity)
+}
+
+func testCoderParityCoefficient(t *testing.T, newCoder func(int, int) (Coder, error)) {
+	data := makeTestData()
+	c, err := newCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	newData := makeTestData()
+	newData[2] = []byte{0x1, 0x2, 0x3, 0x4}
+	delta := make([]byte, len(data[2]))
+	for i := range delta {
+		delta[i] = data[2][i] ^ newData[2][i]
+	}
+	for i := range parity {
+		gf2p16.MulAndAddByteSliceLE(c.ParityCoefficient(i, 2), delta, parity[i])
+	}
+
+	require.Equal(t, c.GenerateParity(newData), parity)
+}
+
+func TestCoderParityCoefficient(t *testing.T) {
+	testCoder(t, testCoderParityCoefficient)
+}
+
 // TODO: Add tests demonstrating the flaws in the PAR2 Vandermonde matrix.
@@ -0,0 +1,411 @@
+package rsec16
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/akalin/gopar/gf2p16"
+)
+
+// This file implements a Reed-Solomon code over GF(2^16) using the
+// additive FFT from Lin, Chung, and Han, "Novel Polynomial Basis and
+// Its Application to Reed-Solomon Erasure Codes", which is also what
+// Leopard-RS uses. Encoding and decoding take O(n log n) operations
+// on shards, where n is the total number of shards, instead of the
+// O(n^2) operations (and O(n^3) matrix inversion) that Coder needs.
+//
+// Let v_0, ..., v_15 be a basis of GF(2^16) over GF(2). We use the
+// standard basis v_j = 2^j, so that the ith evaluation point
+// omega_i = sum_{j : bit j of i is set} v_j is just T(i), and
+// omega_i + omega_k = omega_{i ^ k}. Let W_j be the span of v_0, ...,
+// v_{j-1}, and let s_j be the subspace vanishing polynomial
+// prod_{a in W_j} (x - a), which is linear over GF(2). Then the
+// novel polynomial basis is X_i = prod_{j : bit j of i is set}
+// s_j / s_j(v_j), where X_i has degree i.
+//
+// The FFT of size 2^r with shift beta evaluates a polynomial of
+// degree < 2^r, given by its coefficients in the novel basis, at the
+// points omega_i + beta for i < 2^r, and the IFFT does the reverse.
+//
+// The code has the data shards as the values at omega_{m'}, ...,
+// omega_{m'+k-1}, and the parity shards as the values at omega_0,
+// ..., omega_{m-1}, where k and m are the data and parity shard
+// counts, and m' is m rounded up to a power of two. Any set of
+// values at the points omega_0, ..., omega_{N-1}, for N a power of
+// two >= m'+k, is a codeword if it's the evaluation of a polynomial
+// of degree < N-m', with zeros for the points past the data shards
+// and anything for the unused parity points. Since a non-zero
+// polynomial of degree < N-m' has fewer than N-m' roots, this is an
+// MDS code.
+
+// fftTables holds the tables used by FFTCoder, which are computed
+// lazily, so that nothing is paid for them unless an FFTCoder is
+// used.
+type fftTables struct {
+	// skews[a+2^j-1] is s_j(omega_a) / s_j(v_j), for a a multiple
+	// of 2^(j+1). Every index in [0, 65535) is used exactly once.
+	skews [fieldOrder - 1]gf2p16.T
+
+	// derivativeFactors[j] is the derivative of s_j / s_j(v_j),
+	// which is a constant since s_j is linear.
+	derivativeFactors [16]gf2p16.T
+}
+
+var fftTablesOnce sync.Once
+var fftTablesInstance *fftTables
+
+func getFFTTables() *fftTables {
+	fftTablesOnce.Do(func() {
+		fftTablesInstance = newFFTTables()
+	})
+	return fftTablesInstance
+}
+
+func newFFTTables() *fftTables {
+	var t fftTables
+
+	// sv[j][b] is s_j(v_b), using the recurrence s_{j+1}(x) =
+	// s_j(x) * s_j(x + v_j) = s_j(x) * (s_j(x) + s_j(v_j)).
+	var sv [17][16]gf2p16.T
+	for b := 0; b < 16; b++ {
+		sv[0][b] = gf2p16.T(1 << b)
+	}
+	for j := 0; j < 16; j++ {
+		for b := 0; b < 16; b++ {
+			sv[j+1][b] = sv[j][b].Times(sv[j][b].Plus(sv[j][j]))
+		}
+	}
+
+	// Differentiating the recurrence gives s_{j+1}' = s_j(v_j) *
+	// s_j', and s_0' = 1.
+	derivative := gf2p16.T(1)
+	for j := 0; j < 16; j++ {
+		t.derivativeFactors[j] = derivative.Div(sv[j][j])
+		derivative = derivative.Times(sv[j][j])
+	}
+
+	for j := 0; j < 16; j++ {
+		h := 1 << j
+		for a := 0; a < fieldOrder; a += 2 * h {
+			// Since s_j is linear, s_j(omega_a) is the
+			// sum of s_j(v_b) over the bits b of a.
+			var s gf2p16.T
+			for b := j + 1; b < 16; b++ {
+				if a&(1<<b) != 0 {
+					s = s.Plus(sv[j][b])
+				}
+			}
+			t.skews[a+h-1] = s.Div(sv[j][j])
+		}
+	}
+
+	return &t
+}
+
+func xorByteSlice(in, out []byte) {
+	for i, b := range in {
+		out[i] ^= b
+	}
+}
+
+// fft replaces work, which has a power-of-two length n and holds the
+// coefficients of a polynomial of degree < n in the novel basis,
+// with its values at omega_i + omega_shift for 0 <= i < n. shift
+// must be a multiple of n.
+func (t *fftTables) fft(work [][]byte, shift int) {
+	n := len(work)
+	for h := n / 2; h >= 1; h /= 2 {
+		for start := 0; start < n; start += 2 * h {
+			skew := t.skews[shift+start+h-1]
+			for i := start; i < start+h; i++ {
+				if skew != 0 {
+					gf2p16.MulAndAddByteSliceLE(skew, work[i+h], work[i])
+				}
+				xorByteSlice(work[i], work[i+h])
+			}
+		}
+	}
+}
+
+// ifft is the inverse of fft.
+func (t *fftTables) ifft(work [][]byte, shift int) {
+	n := len(work)
+	for h := 1; h < n; h *= 2 {
+		for start := 0; start < n; start += 2 * h {
+			skew := t.skews[shift+start+h-1]
+			for i := start; i < start+h; i++ {
+				xorByteSlice(work[i], work[i+h])
+				if skew != 0 {
+					gf2p16.MulAndAddByteSliceLE(skew, work[i+h], work[i])
+				}
+			}
+		}
+	}
+}
+
+// formalDerivative replaces work, which holds the coefficients of a
+// polynomial in the novel basis, with the coefficients of its formal
+// derivative. Since the derivative of X_i is the sum of
+// derivativeFactors[j] * X_{i-2^j} over the bits j of i, the
+// coefficient of X_i in the derivative is the sum of
+// derivativeFactors[j] times the coefficient of X_{i+2^j} over the
+// unset bits j of i.
+func (t *fftTables) formalDerivative(work [][]byte) {
+	n := len(work)
+	for i := 1; i < n; i++ {
+		// Handle the indices in [i-w, i), whose bit j is unset,
+		// where w = 2^j is the lowest set bit of i. Since only
+		// lower indices are updated, the indices in [i, i+w)
+		// still hold the original coefficients.
+		w := i & -i
+		j := 0
+		for (1 << j) != w {
+			j++
+		}
+		factor := t.derivativeFactors[j]
+		for k := i - w; k < i && k+w < n; k++ {
+			gf2p16.MulAndAddByteSliceLE(factor, work[k+w], work[k])
+		}
+	}
+}
+
+// fwhtMod replaces v, which has a power-of-two length, with its
+// Walsh-Hadamard transform mod 65535.
+func fwhtMod(v []uint32) {
+	const p = fieldOrder - 1
+	n := len(v)
+	for h := 1; h < n; h *= 2 {
+		for start := 0; start < n; start += 2 * h {
+			for i := start; i < start+h; i++ {
+				a, b := v[i], v[i+h]
+				v[i] = (a + b) % p
+				v[i+h] = (a + p - b) % p
+			}
+		}
+	}
+}
+
+// erasureLocatorLogs returns a slice whose ith entry, for i not in
+// erased, is the log of l(omega_i), where l is the erasure locator
+// polynomial prod_{e in erased} (x - omega_e), and for i in erased is
+// the log of l'(omega_i) = prod_{e in erased, e != i} (omega_i -
+// omega_e). n must be a power of two greater than every entry of
+// erased.
+//
+// Since omega_i - omega_e = omega_{i ^ e}, the ith entry is the sum
+// of L(i ^ e) over e in erased, where L(0) = 0 and L(k) = log(omega_k)
+// otherwise. This is a xor convolution, which can be computed with
+// Walsh-Hadamard transforms in O(n log n) time.
+func (t *fftTables) erasureLocatorLogs(erased []int, n int) []uint32 {
+	const p = fieldOrder - 1
+
+	indicator := make([]uint32, n)
+	for _, e := range erased {
+		indicator[e] = 1
+	}
+	fwhtMod(indicator)
+
+	logs := make([]uint32, n)
+	for i := 1; i < n; i++ {
+		logs[i] = logOf(gf2p16.T(i))
+	}
+	fwhtMod(logs)
+
+	for i := range logs {
+		logs[i] = uint32((uint64(logs[i]) * uint64(indicator[i])) % p)
+	}
+	fwhtMod(logs)
+
+	// The inverse transform is the transform divided by n. Since
+	// 2^16 = 1 mod 65535, the inverse of n mod 65535 is 2^16 / n.
+	nInv := uint64(fieldOrder/n) % p
+	for i := range logs {
+		logs[i] = uint32((uint64(logs[i]) * nInv) % p)
+	}
+	return logs
+}
+
+// An FFTCoder is like a Coder, but it uses an FFT-based code, which
+// makes generating parity shards and reconstructing data shards much
+// faster when there are many shards. Its parity shards are different
+// from those of any Coder, so it's only suitable for formats that
+// aren't constrained to a particular encoding matrix.
+type FFTCoder struct {
+	dataShards, parityShards int
+	numGoroutines            int
+	// parityChunkShards is parityShards rounded up to a power of
+	// two.
+	parityChunkShards int
+	tables            *fftTables
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+// NewFFTCoder returns an FFTCoder that works with the given number of
+// data and parity shards. The number of data shards plus the number
+// of parity shards rounded up to a power of two must be at most
+// 65536.
+func NewFFTCoder(dataShards, parityShards, numGoroutines int) (FFTCoder, error) {
+	if dataShards <= 0 {
+		panic("invalid data shard count")
+	}
+	if parityShards <= 0 {
+		panic("invalid parity shard count")
+	}
+	if numGoroutines <= 0 {
+		panic("invalid goroutine count")
+	}
+
+	if dataShards > fieldOrder || parityShards > fieldOrder {
+		return FFTCoder{}, errors.New("too many shards")
+	}
+
+	parityChunkShards := nextPowerOfTwo(parityShards)
+	if dataShards+parityChunkShards > fieldOrder {
+		return FFTCoder{}, errors.New("too many shards")
+	}
+
+	return FFTCoder{dataShards, parityShards, numGoroutines, parityChunkShards, getFFTTables()}, nil
+}
+
+func makeShards(n, byteCount int) [][]byte {
+	shards := make([][]byte, n)
+	for i := range shards {
+		shards[i] = make([]byte, byteCount)
+	}
+	return shards
+}
+
+// GenerateParity takes a list of data shards, which must have length
+// matching the dataShards value passed into NewFFTCoder, and which
+// must have equal-sized byte slices with even length, and returns a
+// list of parityShards parity shards.
+func (c FFTCoder) GenerateParity(data [][]byte) [][]byte {
+	parity := makeShards(c.parityShards, len(data[0]))
+	runParallelRanges(len(data[0]), c.numGoroutines, 16, func(start, end int) {
+		c.generateParitySlice(data, parity, start, end)
+	})
+	return parity
+}
+
+func (c FFTCoder) generateParitySlice(data, parity [][]byte, start, end int) {
+	// The parity shards are the values at the first m' points of
+	// the polynomial of degree < N-m' whose values at the next
+	// points are the data shards. Split the data shards into
+	// chunks of m' shards, and interpolate each chunk separately
+	// with an IFFT. Then, the sum of the resulting polynomials of
+	// degree < m', evaluated at the first m' points with an FFT,
+	// gives the parity shards.
+	m := c.parityChunkShards
+	work := makeShards(m, end-start)
+	temp := makeShards(m, end-start)
+	for chunkStart := 0; chunkStart < c.dataShards; chunkStart += m {
+		for i := range temp {
+			if chunkStart+i < c.dataShards {
+				copy(temp[i], data[chunkStart+i][start:end])
+			} else {
+				for j := range temp[i] {
+					temp[i][j] = 0
+				}
+			}
+		}
+		c.tables.ifft(temp, m+chunkStart)
+		for i := range work {
+			xorByteSlice(temp[i], work[i])
+		}
+	}
+	c.tables.fft(work, 0)
+	for i := range parity {
+		copy(parity[i][start:end], work[i])
+	}
+}
+
+// ReconstructData takes a list of data shards and parity shards, some
+// of which may be nil, and tries to reconstruct the missing data
+// shards. If successful, the nil rows of data are filled in and a nil
+// error is returned. Otherwise, an error is returned. In particular,
+// if there are missing data shards but there aren't enough parity
+// shards to reconstruct them, NotEnoughParityShardsError is returned.
+func (c FFTCoder) ReconstructData(data, parity [][]byte) error {
+	// Since the shards are the values of a polynomial C of degree
+	// < N-m', and there are at most m' erasures, l*C has degree <
+	// N, where l is the erasure locator polynomial. Therefore,
+	// the values of l*C at all N points, which are zero at the
+	// erasures, determine it, and its formal derivative can be
+	// computed with an IFFT and an FFT. Then, since (l*C)' = l'*C
+	// + l*C' and l is zero at the erasures, C = (l*C)' / l' there.
+	m := c.parityChunkShards
+	var erased []int
+	var missingData []int
+	var byteCount int
+	availableParityCount := 0
+	for i := 0; i < m; i++ {
+		if i < c.parityShards && i < len(parity) && parity[i] != nil {
+			availableParityCount++
+			byteCount = len(parity[i])
+		} else {
+			erased = append(erased, i)
+		}
+	}
+	for i, dataShard := range data {
+		if dataShard == nil {
+			erased = append(erased, m+i)
+			missingData = append(missingData, i)
+		} else {
+			byteCount = len(dataShard)
+		}
+	}
+
+	if len(missingData) == 0 {
+		// Nothing to reconstruct.
+		return nil
+	}
+
+	if len(missingData) > availableParityCount {
+		return NotEnoughParityShardsError{}
+	}
+
+	n := nextPowerOfTwo(m + c.dataShards)
+	logs := c.tables.erasureLocatorLogs(erased, n)
+
+	for _, i := range missingData {
+		data[i] = make([]byte, byteCount)
+	}
+
+	isErased := make([]bool, n)
+	for _, e := range erased {
+		isErased[e] = true
+	}
+
+	runParallelRanges(byteCount, c.numGoroutines, 16, func(start, end int) {
+		work := makeShards(n, end-start)
+		for i := 0; i < m+c.dataShards; i++ {
+			if isErased[i] {
+				continue
+			}
+			var shard []byte
+			if i < m {
+				shard = parity[i]
+			} else {
+				shard = data[i-m]
+			}
+			gf2p16.MulByteSliceLE(expOf(logs[i]), shard[start:end], work[i])
+		}
+
+		c.tables.ifft(work, 0)
+		c.tables.formalDerivative(work)
+		c.tables.fft(work, 0)
+
+		for _, i := range missingData {
+			factor := expOf(fieldOrder - 1 - logs[m+i])
+			gf2p16.MulByteSliceLE(factor, work[m+i], data[i][start:end])
+		}
+	})
+	return nil
+}
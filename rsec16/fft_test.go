@@ -0,0 +1,332 @@
+package rsec16
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/akalin/gopar/gf2p16"
+	"github.com/stretchr/testify/require"
+)
+
+func newFFTCoder(dataShards, parityShards int) (FFTCoder, error) {
+	return NewFFTCoder(dataShards, parityShards, DefaultNumGoroutines())
+}
+
+func TestFFTCoderNewCoderError(t *testing.T) {
+	_, err := newFFTCoder(32768, 32768)
+	require.NoError(t, err)
+
+	_, err = newFFTCoder(32769, 32768)
+	require.Equal(t, errors.New("too many shards"), err)
+
+	// 32767 parity shards are rounded up to 32768.
+	_, err = newFFTCoder(32769, 32767)
+	require.Equal(t, errors.New("too many shards"), err)
+
+	_, err = newFFTCoder(1, 65536)
+	require.Equal(t, errors.New("too many shards"), err)
+}
+
+func TestFFTRoundTrip(t *testing.T) {
+	tables := getFFTTables()
+	rand := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 8, 64} {
+		for _, shift := range []int{0, n, 4 * n} {
+			work := make([][]byte, n)
+			for i := range work {
+				work[i] = make([]byte, 4)
+				rand.Read(work[i])
+			}
+			expectedWork := make([][]byte, n)
+			for i := range work {
+				expectedWork[i] = append([]byte(nil), work[i]...)
+			}
+			tables.fft(work, shift)
+			tables.ifft(work, shift)
+			require.Equal(t, expectedWork, work)
+		}
+	}
+}
+
+func shardToT(shard []byte) gf2p16.T {
+	return gf2p16.T(shard[0]) | gf2p16.T(shard[1])<<8
+}
+
+func tToShard(x gf2p16.T) []byte {
+	return []byte{byte(x), byte(x >> 8)}
+}
+
+// interpolate returns the value at z of the polynomial of degree <
+// len(xs) whose value at xs[i] is ys[i], using Lagrange
+// interpolation.
+func interpolate(xs, ys []gf2p16.T, z gf2p16.T) gf2p16.T {
+	var sum gf2p16.T
+	for i := range xs {
+		term := ys[i]
+		for j := range xs {
+			if i != j {
+				term = term.Times(z.Minus(xs[j])).Div(xs[i].Minus(xs[j]))
+			}
+		}
+		sum = sum.Plus(term)
+	}
+	return sum
+}
+
+func TestFFTCoderGenerateParityMatchesInterpolation(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for _, config := range []struct {
+		dataShards   int
+		parityShards int
+	}{{1, 1}, {5, 3}, {3, 5}, {10, 4}, {17, 9}} {
+		t.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(t *testing.T) {
+			c, err := newFFTCoder(config.dataShards, config.parityShards)
+			require.NoError(t, err)
+
+			data := make([][]byte, config.dataShards)
+			for i := range data {
+				data[i] = tToShard(gf2p16.T(rand.Intn(1 << 16)))
+			}
+			parity := c.GenerateParity(data)
+
+			// The parity shards are the values at the first
+			// points of the polynomial of degree < n-m'
+			// whose values at the remaining n-m' points are
+			// the data shards, padded with zeros.
+			m := nextPowerOfTwo(config.parityShards)
+			n := nextPowerOfTwo(m + config.dataShards)
+			var xs, ys []gf2p16.T
+			for i := m; i < n; i++ {
+				xs = append(xs, gf2p16.T(i))
+				if i-m < len(data) {
+					ys = append(ys, shardToT(data[i-m]))
+				} else {
+					ys = append(ys, 0)
+				}
+			}
+			for i := range parity {
+				require.Equal(t, interpolate(xs, ys, gf2p16.T(i)), shardToT(parity[i]), "i=%d", i)
+			}
+		})
+	}
+}
+
+// combinations calls fn with every subset of [0, n) with k elements,
+// in increasing order.
+func combinations(n, k int, fn func([]int)) {
+	var rec func(start int, chosen []int)
+	rec = func(start int, chosen []int) {
+		if len(chosen) == k {
+			fn(chosen)
+			return
+		}
+		for i := start; i < n; i++ {
+			rec(i+1, append(chosen, i))
+		}
+	}
+	rec(0, nil)
+}
+
+func TestFFTCoderIsMDS(t *testing.T) {
+	// A systematic code is MDS if and only if every square
+	// submatrix of its parity matrix is non-singular.
+	for _, config := range []struct {
+		dataShards   int
+		parityShards int
+	}{{6, 5}, {4, 6}, {9, 3}, {3, 8}} {
+		t.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(t *testing.T) {
+			c, err := newFFTCoder(config.dataShards, config.parityShards)
+			require.NoError(t, err)
+
+			parityMatrix := make([][]gf2p16.T, config.parityShards)
+			for i := range parityMatrix {
+				parityMatrix[i] = make([]gf2p16.T, config.dataShards)
+			}
+			for j := 0; j < config.dataShards; j++ {
+				data := make([][]byte, config.dataShards)
+				for k := range data {
+					data[k] = tToShard(0)
+				}
+				data[j] = tToShard(1)
+				for i, shard := range c.GenerateParity(data) {
+					parityMatrix[i][j] = shardToT(shard)
+				}
+			}
+
+			maxSize := config.dataShards
+			if config.parityShards < maxSize {
+				maxSize = config.parityShards
+			}
+			for size := 1; size <= maxSize; size++ {
+				combinations(config.parityShards, size, func(rows []int) {
+					combinations(config.dataShards, size, func(columns []int) {
+						m := gf2p16.NewMatrixFromFunction(size, size, func(i, j int) gf2p16.T {
+							return parityMatrix[rows[i]][columns[j]]
+						})
+						_, err := m.Inverse()
+						require.NoError(t, err, "rows=%v, columns=%v", rows, columns)
+					})
+				})
+			}
+		})
+	}
+}
+
+func TestFFTCoderReconstructDataAllErasures(t *testing.T) {
+	dataShards := 5
+	parityShards := 3
+	c, err := newFFTCoder(dataShards, parityShards)
+	require.NoError(t, err)
+	data := makeTestData()
+	parity := c.GenerateParity(data)
+
+	// Try every way of erasing parityShards of the shards.
+	combinations(dataShards+parityShards, parityShards, func(erased []int) {
+		corruptData := append([][]byte(nil), data...)
+		corruptParity := append([][]byte(nil), parity...)
+		for _, i := range erased {
+			if i < dataShards {
+				corruptData[i] = nil
+			} else {
+				corruptParity[i-dataShards] = nil
+			}
+		}
+		err := c.ReconstructData(corruptData, corruptParity)
+		require.NoError(t, err)
+		require.Equal(t, data, corruptData, "erased=%v", erased)
+	})
+}
+
+func TestFFTCoderReconstructDataRandom(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	for _, config := range []struct {
+		dataShards    int
+		parityShards  int
+		numGoroutines int
+	}{{1, 1, 1}, {100, 10, 1}, {10, 100, 2}, {1000, 100, 3}, {2000, 2000, 4}} {
+		t.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(t *testing.T) {
+			c, err := NewFFTCoder(config.dataShards, config.parityShards, config.numGoroutines)
+			require.NoError(t, err)
+
+			data := make([][]byte, config.dataShards)
+			for i := range data {
+				data[i] = make([]byte, 66)
+				rand.Read(data[i])
+			}
+			parity := c.GenerateParity(data)
+			require.Equal(t, config.parityShards, len(parity))
+
+			corruptData := append([][]byte(nil), data...)
+			corruptParity := append([][]byte(nil), parity...)
+			erasedCount := config.parityShards
+			if erasedCount > config.dataShards {
+				erasedCount = config.dataShards
+			}
+			for _, i := range rand.Perm(config.dataShards + config.parityShards)[:erasedCount] {
+				if i < config.dataShards {
+					corruptData[i] = nil
+				} else {
+					corruptParity[i-config.dataShards] = nil
+				}
+			}
+			err = c.ReconstructData(corruptData, corruptParity)
+			require.NoError(t, err)
+			require.Equal(t, data, corruptData)
+		})
+	}
+}
+
+func TestFFTCoderReconstructDataNotEnough(t *testing.T) {
+	data := makeTestData()
+	c, err := newFFTCoder(5, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	corruptData := [][]byte{
+		data[0],
+		nil,
+		nil,
+		nil,
+		nil,
+	}
+	expectedErr := NotEnoughParityShardsError{}
+	err = c.ReconstructData(corruptData, parity)
+	require.Equal(t, expectedErr, err)
+
+	corruptData = [][]byte{
+		data[0],
+		data[1],
+		nil,
+		nil,
+		nil,
+	}
+	err = c.ReconstructData(corruptData, parity[1:2])
+	require.Equal(t, expectedErr, err)
+}
+
+func benchmarkGenerateParity(b *testing.B, dataShards, parityShards, shardByteCount int, generateParity func([][]byte) [][]byte) {
+	data := make([][]byte, dataShards)
+	for i := range data {
+		data[i] = make([]byte, shardByteCount)
+		rand.Read(data[i])
+	}
+
+	b.SetBytes(int64(dataShards * shardByteCount))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		generateParity(data)
+	}
+}
+
+func BenchmarkGenerateParityLarge(b *testing.B) {
+	const shardByteCount = 1024
+	for _, config := range []struct {
+		dataShards   int
+		parityShards int
+	}{{1000, 100}, {10000, 1000}} {
+		b.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(b *testing.B) {
+			b.Run("Cauchy", func(b *testing.B) {
+				c, err := newCoderCauchy(config.dataShards, config.parityShards)
+				require.NoError(b, err)
+				benchmarkGenerateParity(b, config.dataShards, config.parityShards, shardByteCount, c.GenerateParity)
+			})
+			b.Run("FFT", func(b *testing.B) {
+				c, err := newFFTCoder(config.dataShards, config.parityShards)
+				require.NoError(b, err)
+				benchmarkGenerateParity(b, config.dataShards, config.parityShards, shardByteCount, c.GenerateParity)
+			})
+		})
+	}
+}
+
+func BenchmarkFFTCoderReconstructData(b *testing.B) {
+	const shardByteCount = 1024
+	for _, config := range []struct {
+		dataShards   int
+		parityShards int
+	}{{1000, 100}, {10000, 1000}, {30000, 30000}} {
+		b.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(b *testing.B) {
+			c, err := newFFTCoder(config.dataShards, config.parityShards)
+			require.NoError(b, err)
+			data := make([][]byte, config.dataShards)
+			for i := range data {
+				data[i] = make([]byte, shardByteCount)
+				rand.Read(data[i])
+			}
+			parity := c.GenerateParity(data)
+
+			b.SetBytes(int64(config.dataShards * shardByteCount))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				corruptData := append([][]byte(nil), data...)
+				for j := 0; j < config.parityShards; j++ {
+					corruptData[j] = nil
+				}
+				err := c.ReconstructData(corruptData, parity)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
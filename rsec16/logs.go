@@ -0,0 +1,19 @@
+package rsec16
+
+import "github.com/akalin/gopar/gf2p16"
+
+const fieldOrder = 1 << 16
+
+// Computations that are mostly products and quotients of elements of
+// GF(2^16) can be done as sums and differences of logs instead, using
+// the log and exp tables from gf2p16.
+
+// logOf returns the discrete log of x, which must be non-zero.
+func logOf(x gf2p16.T) uint32 {
+	return uint32(x.Log())
+}
+
+// expOf returns the element with discrete log p mod 65535.
+func expOf(p uint32) gf2p16.T {
+	return gf2p16.Exp(p)
+}
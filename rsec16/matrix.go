@@ -43,6 +43,37 @@ func calculateParallelParams(totalLength, numGoroutines, minPerGoroutineLength,
 	return perGoroutineLength, newNumGoroutines
 }
 
+// runParallelRanges splits [0, length) into ranges with lengths
+// divisible by divisor, except possibly for the last one, and calls
+// fn on each of them with up to numGoroutines goroutines.
+func runParallelRanges(length, numGoroutines, divisor int, fn func(start, end int)) {
+	if numGoroutines < 1 {
+		panic("invalid numGoroutines value")
+	}
+
+	perGoroutineLength, numGoroutines := calculateParallelParams(length, numGoroutines, divisor, divisor)
+	if numGoroutines < 2 {
+		fn(0, length)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			start := i * perGoroutineLength
+			end := start + perGoroutineLength
+			if end > length {
+				end = length
+			}
+			fn(start, end)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
 func applyMatrixParallelOut(m gf2p16.Matrix, in, out [][]byte, numGoroutines int) {
 	if len(in[0]) != len(out[0]) {
 		panic("mismatched lengths")
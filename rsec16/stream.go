@@ -0,0 +1,294 @@
+package rsec16
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/akalin/gopar/gf2p16"
+)
+
+// StreamReadError is returned by the methods of StreamCoder when
+// reading from one of the given streams fails.
+type StreamReadError struct {
+	// Stream is the index of the stream in the list of streams
+	// passed in.
+	Stream int
+	Err    error
+}
+
+func (e StreamReadError) Error() string {
+	return fmt.Sprintf("error reading stream %d: %s", e.Stream, e.Err)
+}
+
+// StreamWriteError is returned by the methods of StreamCoder when
+// writing to one of the given streams fails.
+type StreamWriteError struct {
+	// Stream is the index of the stream in the list of streams
+	// passed in.
+	Stream int
+	Err    error
+}
+
+func (e StreamWriteError) Error() string {
+	return fmt.Sprintf("error writing stream %d: %s", e.Stream, e.Err)
+}
+
+// ShardSizeError is returned by the methods of StreamCoder when the
+// streams that are read don't all have the same length, or when that
+// length is odd.
+type ShardSizeError struct {
+	// Stream is the index of the stream in the list of streams
+	// passed in whose length is wrong.
+	Stream int
+	// ByteCount is the number of bytes read from the stream, and
+	// ExpectedByteCount is the number of bytes read from the
+	// first stream that was read, or ByteCount+1 if ByteCount is
+	// odd.
+	ByteCount, ExpectedByteCount int64
+}
+
+func (e ShardSizeError) Error() string {
+	if e.ByteCount%2 != 0 {
+		return fmt.Sprintf("stream %d has an odd byte count %d", e.Stream, e.ByteCount)
+	}
+	return fmt.Sprintf("stream %d has byte count %d, expected %d", e.Stream, e.ByteCount, e.ExpectedByteCount)
+}
+
+// A StreamCoder wraps a Coder to generate parity shards and
+// reconstruct data shards from streams instead of byte slices. It
+// processes the streams in chunks, so it uses memory proportional to
+// the chunk byte count times the number of shards, independent of the
+// length of the streams.
+type StreamCoder struct {
+	coder          Coder
+	chunkByteCount int
+}
+
+// NewStreamCoder returns a StreamCoder that uses c, and reads and
+// writes chunkByteCount bytes of each stream at a time, which must
+// be positive and even.
+func NewStreamCoder(c Coder, chunkByteCount int) StreamCoder {
+	if chunkByteCount <= 0 || chunkByteCount%2 != 0 {
+		panic("invalid chunk byte count")
+	}
+	return StreamCoder{c, chunkByteCount}
+}
+
+// readChunk reads up to len(bufs[i]) bytes from readers[streams[i]]
+// into bufs[i] for each i, and returns the number of bytes read,
+// which must be the same for all of them. offset is the number of
+// bytes read from each stream so far.
+func readChunk(readers []io.Reader, streams []int, bufs [][]byte, offset int64) (int, error) {
+	byteCount := -1
+	for i, stream := range streams {
+		n, err := io.ReadFull(readers[stream], bufs[i])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, StreamReadError{stream, err}
+		}
+		if byteCount < 0 {
+			byteCount = n
+		} else if n != byteCount {
+			return 0, ShardSizeError{stream, offset + int64(n), offset + int64(byteCount)}
+		}
+	}
+	if byteCount%2 != 0 {
+		total := offset + int64(byteCount)
+		return 0, ShardSizeError{streams[0], total, total + 1}
+	}
+	return byteCount, nil
+}
+
+// writeChunk writes bufs[i] to writers[streams[i]] for each i.
+func writeChunk(writers []io.Writer, streams []int, bufs [][]byte) error {
+	for i, stream := range streams {
+		_, err := writers[stream].Write(bufs[i])
+		if err != nil {
+			return StreamWriteError{stream, err}
+		}
+	}
+	return nil
+}
+
+func sliceShards(shards [][]byte, byteCount int) [][]byte {
+	sliced := make([][]byte, len(shards))
+	for i, shard := range shards {
+		if shard != nil {
+			sliced[i] = shard[:byteCount]
+		}
+	}
+	return sliced
+}
+
+func indices(n int) []int {
+	is := make([]int, n)
+	for i := range is {
+		is[i] = i
+	}
+	return is
+}
+
+// Encode reads the data shards from data, which must have length
+// matching the dataShards value of the wrapped Coder, and writes the
+// parity shards to parity, which must have length matching its
+// parityShards value. The data streams must all have the same even
+// length; otherwise, ShardSizeError is returned.
+func (s StreamCoder) Encode(data []io.Reader, parity []io.Writer) error {
+	c := s.coder
+	if len(data) != c.dataShards {
+		panic("invalid data stream count")
+	}
+	if len(parity) != c.parityShards {
+		panic("invalid parity stream count")
+	}
+
+	dataStreams := indices(c.dataShards)
+	parityStreams := indices(c.parityShards)
+	dataBufs := makeShards(c.dataShards, s.chunkByteCount)
+	parityBufs := makeShards(c.parityShards, s.chunkByteCount)
+	var offset int64
+	for {
+		n, err := readChunk(data, dataStreams, dataBufs, offset)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+
+		parityChunk := sliceShards(parityBufs, n)
+		c.GenerateParityInto(sliceShards(dataBufs, n), parityChunk, 0)
+		err = writeChunk(parity, parityStreams, parityChunk)
+		if err != nil {
+			return err
+		}
+
+		offset += int64(n)
+		if n < s.chunkByteCount {
+			return nil
+		}
+	}
+}
+
+// Reconstruct takes a list of streams for the data shards followed
+// by the parity shards, with length matching the dataShards value of
+// the wrapped Coder plus its parityShards value, some of which may be
+// nil, and a list of the same length of streams to write shards to.
+// For each non-nil entry of fill, whose corresponding entry in valid
+// must be nil, the shard is reconstructed and written to it. The
+// valid streams that are needed must all have the same even length;
+// otherwise, ShardSizeError is returned. If there aren't enough
+// valid streams to reconstruct the missing data shards,
+// NotEnoughParityShardsError is returned.
+func (s StreamCoder) Reconstruct(valid []io.Reader, fill []io.Writer) error {
+	c := s.coder
+	shardCount := c.dataShards + c.parityShards
+	if len(valid) != shardCount {
+		panic("invalid valid stream count")
+	}
+	if len(fill) != shardCount {
+		panic("invalid fill stream count")
+	}
+	for i, w := range fill {
+		if w != nil && valid[i] != nil {
+			panic("fill stream given for valid stream")
+		}
+	}
+
+	dataPresent := make([]bool, c.dataShards)
+	for i := range dataPresent {
+		dataPresent[i] = valid[i] != nil
+	}
+	parityPresent := make([]bool, c.parityShards)
+	for i := range parityPresent {
+		parityPresent[i] = valid[c.dataShards+i] != nil
+	}
+	p, err := c.planReconstruction(dataPresent, parityPresent)
+	if err != nil {
+		return err
+	}
+
+	// Read only the streams that are needed.
+	var readStreams []int
+	readStreams = append(readStreams, p.availableRows...)
+	for _, i := range p.usedParityRows {
+		readStreams = append(readStreams, c.dataShards+i)
+	}
+
+	var fillDataStreams, fillParityRows, fillParityStreams []int
+	for _, i := range p.missingRows {
+		if fill[i] != nil {
+			fillDataStreams = append(fillDataStreams, i)
+		}
+	}
+	for i := 0; i < c.parityShards; i++ {
+		if fill[c.dataShards+i] != nil {
+			fillParityRows = append(fillParityRows, i)
+			fillParityStreams = append(fillParityStreams, c.dataShards+i)
+		}
+	}
+	if len(fillDataStreams) == 0 && len(fillParityRows) == 0 {
+		return nil
+	}
+
+	var fillParityMatrix gf2p16.Matrix
+	if len(fillParityRows) > 0 {
+		fillParityMatrix = gf2p16.NewMatrixFromFunction(len(fillParityRows), c.dataShards, func(i, j int) gf2p16.T {
+			return c.parityMatrix.At(fillParityRows[i], j)
+		})
+	}
+
+	readBufs := makeShards(len(readStreams), s.chunkByteCount)
+	data := make([][]byte, c.dataShards)
+	parity := make([][]byte, c.parityShards)
+	for i, stream := range readStreams {
+		if stream < c.dataShards {
+			data[stream] = readBufs[i]
+		} else {
+			parity[stream-c.dataShards] = readBufs[i]
+		}
+	}
+	missingBufs := makeShards(len(p.missingRows), s.chunkByteCount)
+	for i, r := range p.missingRows {
+		data[r] = missingBufs[i]
+	}
+	fillParityBufs := makeShards(len(fillParityRows), s.chunkByteCount)
+
+	var offset int64
+	for {
+		n, err := readChunk(valid, readStreams, readBufs, offset)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+
+		dataChunk := sliceShards(data, n)
+		if len(p.missingRows) > 0 {
+			c.reconstruct(p, dataChunk, sliceShards(parity, n), sliceShards(missingBufs, n))
+		}
+
+		var fillDataBufs [][]byte
+		for _, i := range fillDataStreams {
+			fillDataBufs = append(fillDataBufs, dataChunk[i])
+		}
+		err = writeChunk(fill, fillDataStreams, fillDataBufs)
+		if err != nil {
+			return err
+		}
+
+		if len(fillParityRows) > 0 {
+			fillParityChunk := sliceShards(fillParityBufs, n)
+			c.applyMatrix(fillParityMatrix, dataChunk, fillParityChunk)
+			err = writeChunk(fill, fillParityStreams, fillParityChunk)
+			if err != nil {
+				return err
+			}
+		}
+
+		offset += int64(n)
+		if n < s.chunkByteCount {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package rsec16
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeStreamTestData(rand *rand.Rand, dataShards, byteCount int) [][]byte {
+	data := make([][]byte, dataShards)
+	for i := range data {
+		data[i] = make([]byte, byteCount)
+		rand.Read(data[i])
+	}
+	return data
+}
+
+func makeReaders(shards [][]byte) []io.Reader {
+	readers := make([]io.Reader, len(shards))
+	for i, shard := range shards {
+		if shard != nil {
+			readers[i] = bytes.NewReader(shard)
+		}
+	}
+	return readers
+}
+
+func makeBuffers(n int) ([]*bytes.Buffer, []io.Writer) {
+	buffers := make([]*bytes.Buffer, n)
+	writers := make([]io.Writer, n)
+	for i := range buffers {
+		buffers[i] = &bytes.Buffer{}
+		writers[i] = buffers[i]
+	}
+	return buffers, writers
+}
+
+func TestStreamCoderEncode(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	c, err := newCoderCauchy(5, 3)
+	require.NoError(t, err)
+	for _, byteCount := range []int{0, 2, 10, 64, 70} {
+		data := makeStreamTestData(rand, 5, byteCount)
+		expectedParity := c.GenerateParity(data)
+
+		// Use chunk sizes that do and don't divide byteCount.
+		for _, chunkByteCount := range []int{2, 6, 64} {
+			s := NewStreamCoder(c, chunkByteCount)
+			buffers, writers := makeBuffers(3)
+			err := s.Encode(makeReaders(data), writers)
+			require.NoError(t, err)
+			for i, buffer := range buffers {
+				if byteCount == 0 {
+					require.Equal(t, 0, buffer.Len())
+				} else {
+					require.Equal(t, expectedParity[i], buffer.Bytes(), "byteCount=%d, chunkByteCount=%d", byteCount, chunkByteCount)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamCoderEncodeShardSizeError(t *testing.T) {
+	c, err := newCoderCauchy(3, 2)
+	require.NoError(t, err)
+	s := NewStreamCoder(c, 4)
+	_, writers := makeBuffers(2)
+
+	data := [][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 8)}
+	err = s.Encode(makeReaders(data), writers)
+	require.Equal(t, ShardSizeError{2, 8, 10}, err)
+
+	data = [][]byte{make([]byte, 9), make([]byte, 9), make([]byte, 9)}
+	err = s.Encode(makeReaders(data), writers)
+	require.Equal(t, ShardSizeError{0, 9, 10}, err)
+}
+
+type errReader struct{}
+
+var errTestRead = errors.New("test read error")
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errTestRead
+}
+
+type errWriter struct{}
+
+var errTestWrite = errors.New("test write error")
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errTestWrite
+}
+
+func TestStreamCoderEncodeStreamErrors(t *testing.T) {
+	c, err := newCoderCauchy(3, 2)
+	require.NoError(t, err)
+	s := NewStreamCoder(c, 4)
+	data := [][]byte{make([]byte, 10), make([]byte, 10), make([]byte, 10)}
+
+	_, writers := makeBuffers(2)
+	readers := makeReaders(data)
+	readers[1] = errReader{}
+	err = s.Encode(readers, writers)
+	require.Equal(t, StreamReadError{1, errTestRead}, err)
+
+	writers[1] = errWriter{}
+	err = s.Encode(makeReaders(data), writers)
+	require.Equal(t, StreamWriteError{1, errTestWrite}, err)
+}
+
+func TestStreamCoderReconstruct(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	c, err := newCoderCauchy(5, 3)
+	require.NoError(t, err)
+	data := makeStreamTestData(rand, 5, 70)
+	parity := c.GenerateParity(data)
+	shards := append(append([][]byte(nil), data...), parity...)
+
+	for _, chunkByteCount := range []int{2, 6, 64} {
+		s := NewStreamCoder(c, chunkByteCount)
+
+		// Lose two data shards and a parity shard, and
+		// reconstruct all of them.
+		validShards := append([][]byte(nil), shards...)
+		validShards[1] = nil
+		validShards[4] = nil
+		validShards[6] = nil
+		buffers, _ := makeBuffers(len(shards))
+		fill := make([]io.Writer, len(shards))
+		for _, i := range []int{1, 4, 6} {
+			fill[i] = buffers[i]
+		}
+
+		err := s.Reconstruct(makeReaders(validShards), fill)
+		require.NoError(t, err)
+		for _, i := range []int{1, 4, 6} {
+			require.Equal(t, shards[i], buffers[i].Bytes(), "i=%d, chunkByteCount=%d", i, chunkByteCount)
+		}
+	}
+}
+
+func TestStreamCoderReconstructOnlySome(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	c, err := newCoderPAR2Vandermonde(5, 3)
+	require.NoError(t, err)
+	data := makeStreamTestData(rand, 5, 20)
+	parity := c.GenerateParity(data)
+	shards := append(append([][]byte(nil), data...), parity...)
+	s := NewStreamCoder(c, 8)
+
+	// Lose three data shards, but only ask for one of them.
+	validShards := append([][]byte(nil), shards...)
+	validShards[0] = nil
+	validShards[2] = nil
+	validShards[3] = nil
+	buffers, _ := makeBuffers(len(shards))
+	fill := make([]io.Writer, len(shards))
+	fill[2] = buffers[2]
+
+	err = s.Reconstruct(makeReaders(validShards), fill)
+	require.NoError(t, err)
+	require.Equal(t, shards[2], buffers[2].Bytes())
+	require.Equal(t, 0, buffers[0].Len())
+}
+
+func TestStreamCoderReconstructNotEnough(t *testing.T) {
+	c, err := newCoderCauchy(3, 2)
+	require.NoError(t, err)
+	s := NewStreamCoder(c, 4)
+	shards := [][]byte{nil, nil, nil, make([]byte, 10), make([]byte, 10)}
+	buffers, _ := makeBuffers(len(shards))
+	fill := []io.Writer{buffers[0], nil, nil, nil, nil}
+
+	err = s.Reconstruct(makeReaders(shards), fill)
+	require.Equal(t, NotEnoughParityShardsError{}, err)
+}
+
+func TestStreamCoderReconstructShardSizeError(t *testing.T) {
+	c, err := newCoderCauchy(3, 2)
+	require.NoError(t, err)
+	s := NewStreamCoder(c, 4)
+	shards := [][]byte{make([]byte, 10), nil, make([]byte, 10), make([]byte, 12), make([]byte, 10)}
+	buffers, _ := makeBuffers(len(shards))
+	fill := []io.Writer{nil, buffers[1], nil, nil, nil}
+
+	err = s.Reconstruct(makeReaders(shards), fill)
+	require.Equal(t, ShardSizeError{3, 12, 10}, err)
+}
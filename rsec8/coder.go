@@ -0,0 +1,212 @@
+// Package rsec8 implements Reed-Solomon erasure codes over GF(2^8),
+// as used by PAR1.
+package rsec8
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+
+	"github.com/akalin/gopar/gf2p8"
+	"github.com/klauspost/cpuid/v2"
+)
+
+// DefaultNumGoroutines returns a default value for the numGoroutines
+// parameter to pass into NewCoderPAR1Vandermonde. This is not
+// necessarily GOMAXPROCS.
+func DefaultNumGoroutines() int {
+	numGoroutines := runtime.GOMAXPROCS(0)
+	physicalCores := cpuid.CPU.PhysicalCores
+	// Use the number of physical cores as the default instead of
+	// the number of virtual cores, which GOMAXPROCS is, for the
+	// same reasons as rsec16.DefaultNumGoroutines.
+	if physicalCores > 0 && physicalCores < numGoroutines {
+		numGoroutines = physicalCores
+	}
+	return numGoroutines
+}
+
+// A Coder is an object that can generate parity shards, verify parity
+// shards, and reconstruct data shards from the shards that are
+// present.
+type Coder struct {
+	dataShards, parityShards int
+	numGoroutines            int
+	parityMatrix             gf2p8.Matrix
+}
+
+// maxShards is the maximum number of data and parity shards, which is
+// the number of elements of GF(2^8).
+const maxShards = 256
+
+// newPAR1VandermondeParityMatrix returns the parity matrix described
+// in the PAR1 spec, whose (i, j) entry is (j+1)^i.
+//
+// Note that, unlike what the PAR1 spec claims, not all of its square
+// submatrices are invertible, so some sets of missing data shards
+// can't be reconstructed even if there are as many parity shards.
+func newPAR1VandermondeParityMatrix(dataShards, parityShards int) gf2p8.Matrix {
+	return gf2p8.NewMatrixFromFunction(parityShards, dataShards, func(i, j int) gf2p8.T {
+		return gf2p8.T(j + 1).Pow(uint32(i))
+	})
+}
+
+// NewCoderPAR1Vandermonde returns a Coder that works with the given
+// number of data and parity shards, using the parity matrix from the
+// PAR1 spec, and using up to numGoroutines goroutines. If the total
+// number of shards is more than 256, an error is returned.
+func NewCoderPAR1Vandermonde(dataShards, parityShards, numGoroutines int) (Coder, error) {
+	if dataShards <= 0 {
+		panic("invalid data shard count")
+	}
+	if parityShards <= 0 {
+		panic("invalid parity shard count")
+	}
+	if numGoroutines <= 0 {
+		panic("invalid goroutine count")
+	}
+	if dataShards+parityShards > maxShards {
+		return Coder{}, errors.New("too many shards")
+	}
+
+	parityMatrix := newPAR1VandermondeParityMatrix(dataShards, parityShards)
+	return Coder{dataShards, parityShards, numGoroutines, parityMatrix}, nil
+}
+
+func (c Coder) applyMatrix(m gf2p8.Matrix, in, out [][]byte) {
+	applyMatrixParallelData(m, in, out, c.numGoroutines)
+}
+
+// GenerateParity takes a list of data shards, which must have length
+// matching the dataShards value passed into NewCoderPAR1Vandermonde,
+// and which must have equal-sized byte slices, and returns a list of
+// parityShards parity shards.
+func (c Coder) GenerateParity(data [][]byte) [][]byte {
+	if len(data) != c.dataShards {
+		panic("wrong number of data shards")
+	}
+	parity := make([][]byte, c.parityShards)
+	for i := range parity {
+		parity[i] = make([]byte, len(data[0]))
+	}
+	c.applyMatrix(c.parityMatrix, data, parity)
+	return parity
+}
+
+// Verify takes a list of data shards and parity shards, which must
+// have lengths matching the dataShards and parityShards values passed
+// into NewCoderPAR1Vandermonde, and returns whether the parity shards
+// match the ones computed from the data shards. An error is returned
+// if any shard is missing, or if the shards don't all have the same
+// length.
+func (c Coder) Verify(data, parity [][]byte) (bool, error) {
+	if len(data) != c.dataShards {
+		return false, errors.New("wrong number of data shards")
+	}
+	if len(parity) != c.parityShards {
+		return false, errors.New("wrong number of parity shards")
+	}
+	byteCount := len(data[0])
+	for _, shards := range [][][]byte{data, parity} {
+		for _, shard := range shards {
+			if shard == nil {
+				return false, errors.New("missing shard")
+			}
+			if len(shard) != byteCount {
+				return false, errors.New("mismatched shard sizes")
+			}
+		}
+	}
+
+	computedParity := c.GenerateParity(data)
+	for i, shard := range computedParity {
+		if !bytes.Equal(shard, parity[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func makeReconstructionMatrix(dataShards int, availableRows, missingRows, usedParityRows []int, parityMatrix gf2p8.Matrix, numGoroutines int) (gf2p8.Matrix, error) {
+	m := gf2p8.NewMatrixFromFunction(len(usedParityRows), len(usedParityRows), func(i, j int) gf2p8.T {
+		k := usedParityRows[i]
+		l := missingRows[j]
+		return parityMatrix.At(k, l)
+	})
+	n := gf2p8.NewMatrixFromFunction(len(usedParityRows), dataShards, func(i, j int) gf2p8.T {
+		if j < len(availableRows) {
+			k := usedParityRows[i]
+			l := availableRows[j]
+			return parityMatrix.At(k, l)
+		}
+		if i == j-len(availableRows) {
+			return 1
+		}
+		return 0
+	})
+	return m.RowReduceForInverseParallel(n, numGoroutines)
+}
+
+// NotEnoughParityShardsError is returned by ReconstructData if there
+// aren't enough parity shards to reconstruct some missing data.
+type NotEnoughParityShardsError struct{}
+
+func (NotEnoughParityShardsError) Error() string {
+	return "not enough parity shards"
+}
+
+// ReconstructData takes a list of data shards and parity shards, some
+// of which may be nil, and tries to reconstruct the missing data
+// shards, using the first parity shards that are present. If
+// successful, the nil rows of data are filled in and a nil error is
+// returned. Otherwise, an error is returned. In particular, if there
+// are missing data shards but there aren't enough parity shards to
+// reconstruct them, NotEnoughParityShardsError is returned, and if
+// the PAR1 parity matrix can't be used to reconstruct them (see
+// newPAR1VandermondeParityMatrix), a singular matrix error is
+// returned.
+func (c Coder) ReconstructData(data, parity [][]byte) error {
+	var availableRows, missingRows []int
+	var input [][]byte
+	for i, shard := range data {
+		if shard != nil {
+			availableRows = append(availableRows, i)
+			input = append(input, shard)
+		} else {
+			missingRows = append(missingRows, i)
+		}
+	}
+
+	if len(missingRows) == 0 {
+		// Nothing to reconstruct.
+		return nil
+	}
+
+	var usedParityRows []int
+	for i := 0; i < len(parity) && len(usedParityRows) < len(missingRows); i++ {
+		if parity[i] != nil {
+			usedParityRows = append(usedParityRows, i)
+			input = append(input, parity[i])
+		}
+	}
+
+	if len(usedParityRows) < len(missingRows) {
+		return NotEnoughParityShardsError{}
+	}
+
+	reconstructionMatrix, err := makeReconstructionMatrix(c.dataShards, availableRows, missingRows, usedParityRows, c.parityMatrix, c.numGoroutines)
+	if err != nil {
+		return err
+	}
+
+	reconstructedData := make([][]byte, len(missingRows))
+	for i := range reconstructedData {
+		reconstructedData[i] = make([]byte, len(input[0]))
+	}
+	c.applyMatrix(reconstructionMatrix, input, reconstructedData)
+
+	for i, r := range missingRows {
+		data[r] = reconstructedData[i]
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package rsec8
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/akalin/gopar/gf2p8"
+	"github.com/stretchr/testify/require"
+)
+
+func newCoder(dataShards, parityShards int) (Coder, error) {
+	return NewCoderPAR1Vandermonde(dataShards, parityShards, DefaultNumGoroutines())
+}
+
+func TestNewCoderPAR1VandermondeError(t *testing.T) {
+	_, err := newCoder(200, 56)
+	require.NoError(t, err)
+
+	_, err = newCoder(200, 57)
+	require.Equal(t, "too many shards", err.Error())
+}
+
+func TestPAR1VandermondeParityMatrix(t *testing.T) {
+	m := newPAR1VandermondeParityMatrix(5, 3)
+	for j := 0; j < 5; j++ {
+		x := gf2p8.T(j + 1)
+		require.Equal(t, gf2p8.T(1), m.At(0, j))
+		require.Equal(t, x, m.At(1, j))
+		require.Equal(t, x.Times(x), m.At(2, j))
+	}
+}
+
+func makeTestData() [][]byte {
+	return [][]byte{
+		{0x00, 0x01, 0x02, 0x03},
+		{0x10, 0x20, 0x30, 0x40},
+		{0xff, 0xfe, 0xfd, 0xfc},
+		{0x12, 0x34, 0x56, 0x78},
+	}
+}
+
+func TestCoderGenerateParity(t *testing.T) {
+	c, err := newCoder(4, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(makeTestData())
+	// This was computed by the klauspost/reedsolomon package
+	// with the PAR1 matrix, which was used before this package.
+	expectedParity := [][]byte{
+		{0xfd, 0xeb, 0x99, 0xc7},
+		{0x74, 0x8e, 0x3d, 0x67},
+		{0x59, 0xc7, 0xe5, 0xe6},
+	}
+	require.Equal(t, expectedParity, parity)
+}
+
+func TestCoderGenerateParityParallel(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	data := make([][]byte, 10)
+	for i := range data {
+		data[i] = make([]byte, 1000)
+		rand.Read(data[i])
+	}
+	c, err := NewCoderPAR1Vandermonde(10, 5, 1)
+	require.NoError(t, err)
+	expectedParity := c.GenerateParity(data)
+	for _, numGoroutines := range []int{2, 3, 7} {
+		c, err := NewCoderPAR1Vandermonde(10, 5, numGoroutines)
+		require.NoError(t, err)
+		require.Equal(t, expectedParity, c.GenerateParity(data), "numGoroutines=%d", numGoroutines)
+	}
+}
+
+func TestCoderVerify(t *testing.T) {
+	data := makeTestData()
+	c, err := newCoder(4, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	ok, err := c.Verify(data, parity)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	parity[2][1]++
+	ok, err = c.Verify(data, parity)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = c.Verify(data, [][]byte{parity[0], nil, parity[2]})
+	require.Equal(t, "missing shard", err.Error())
+
+	_, err = c.Verify(data, [][]byte{parity[0], parity[1][:2], parity[2]})
+	require.Equal(t, "mismatched shard sizes", err.Error())
+}
+
+func TestCoderReconstructData(t *testing.T) {
+	data := makeTestData()
+	c, err := newCoder(4, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	corruptData := [][]byte{nil, data[1], nil, nil}
+	err = c.ReconstructData(corruptData, parity)
+	require.NoError(t, err)
+	require.Equal(t, data, corruptData)
+
+	// Use the later parity shards.
+	corruptData = [][]byte{data[0], nil, data[2], data[3]}
+	err = c.ReconstructData(corruptData, [][]byte{nil, nil, parity[2]})
+	require.NoError(t, err)
+	require.Equal(t, data, corruptData)
+}
+
+func TestCoderReconstructDataNotEnough(t *testing.T) {
+	data := makeTestData()
+	c, err := newCoder(4, 3)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	corruptData := [][]byte{nil, data[1], nil, nil}
+	err = c.ReconstructData(corruptData, [][]byte{parity[0], nil, parity[2]})
+	require.Equal(t, NotEnoughParityShardsError{}, err)
+	require.Equal(t, [][]byte{nil, data[1], nil, nil}, corruptData)
+}
+
+func TestCoderReconstructDataRandom(t *testing.T) {
+	rand := rand.New(rand.NewSource(1))
+	dataShards := 20
+	parityShards := 5
+	data := make([][]byte, dataShards)
+	for i := range data {
+		data[i] = make([]byte, 100)
+		rand.Read(data[i])
+	}
+	c, err := newCoder(dataShards, parityShards)
+	require.NoError(t, err)
+	parity := c.GenerateParity(data)
+
+	for i := 0; i < 20; i++ {
+		corruptData := append([][]byte(nil), data...)
+		missingCount := 1 + rand.Intn(parityShards)
+		for _, j := range rand.Perm(dataShards)[:missingCount] {
+			corruptData[j] = nil
+		}
+		err := c.ReconstructData(corruptData, parity)
+		if err != nil {
+			// Some patterns can't be reconstructed with
+			// the PAR1 matrix.
+			require.Equal(t, "singular matrix", err.Error())
+			continue
+		}
+		require.Equal(t, data, corruptData)
+	}
+}
+
+func BenchmarkCoderGenerateParity(b *testing.B) {
+	rand := rand.New(rand.NewSource(1))
+	for _, config := range []struct {
+		dataShards, parityShards int
+	}{{10, 3}, {100, 10}, {200, 50}} {
+		b.Run(fmt.Sprintf("%dx%d", config.dataShards, config.parityShards), func(b *testing.B) {
+			data := make([][]byte, config.dataShards)
+			for i := range data {
+				data[i] = make([]byte, 64*1024)
+				rand.Read(data[i])
+			}
+			c, err := newCoder(config.dataShards, config.parityShards)
+			require.NoError(b, err)
+
+			b.SetBytes(int64(config.dataShards * len(data[0])))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.GenerateParity(data)
+			}
+		})
+	}
+}
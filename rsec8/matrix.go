@@ -0,0 +1,73 @@
+package rsec8
+
+import (
+	"sync"
+
+	"github.com/akalin/gopar/gf2p8"
+)
+
+func applyMatrixSlice(m gf2p8.Matrix, in, out [][]byte, dataStart, dataEnd int) {
+	for i := range out {
+		outSlice := out[i][dataStart:dataEnd]
+		c := m.At(i, 0)
+		inSlice := in[0][dataStart:dataEnd]
+		gf2p8.MulByteSlice(c, inSlice, outSlice)
+		for j := 1; j < len(in); j++ {
+			c := m.At(i, j)
+			inSlice := in[j][dataStart:dataEnd]
+			gf2p8.MulAndAddByteSlice(c, inSlice, outSlice)
+		}
+	}
+}
+
+func calculateParallelParams(totalLength, numGoroutines, minPerGoroutineLength, perGoroutineLengthDivisor int) (perGoroutineLength, newNumGoroutines int) {
+	perGoroutineLength = (totalLength + numGoroutines - 1) / numGoroutines
+	if perGoroutineLength < minPerGoroutineLength {
+		perGoroutineLength = minPerGoroutineLength
+	}
+
+	rem := perGoroutineLength % perGoroutineLengthDivisor
+	if rem != 0 {
+		perGoroutineLength += (perGoroutineLengthDivisor - rem)
+	}
+
+	newNumGoroutines = (totalLength + perGoroutineLength - 1) / perGoroutineLength
+	return perGoroutineLength, newNumGoroutines
+}
+
+// applyMatrixParallelData sets out to m times in, where in and out
+// are treated as matrices whose rows are their byte slices, splitting
+// the byte slices into ranges processed by up to numGoroutines
+// goroutines.
+func applyMatrixParallelData(m gf2p8.Matrix, in, out [][]byte, numGoroutines int) {
+	if len(in[0]) != len(out[0]) {
+		panic("mismatched lengths")
+	}
+
+	if numGoroutines < 1 {
+		panic("invalid numGoroutines value")
+	}
+
+	dataLength := len(out[0])
+	perGoroutineDataLength, numGoroutines := calculateParallelParams(dataLength, numGoroutines, 16, 16)
+	if numGoroutines < 2 {
+		applyMatrixSlice(m, in, out, 0, dataLength)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			start := i * perGoroutineDataLength
+			end := start + perGoroutineDataLength
+			if end > dataLength {
+				end = dataLength
+			}
+			applyMatrixSlice(m, in, out, start, end)
+		}(i)
+	}
+
+	wg.Wait()
+}